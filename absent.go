@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// groupStateAbsent は、バックエンド（グループ）ごと HAProxy から削除することを表す state の値です
+const groupStateAbsent = "absent"
+
+// errBackendRemovalDeclined は、バックエンドの削除の確認で中止が選ばれた場合のエラーです
+var errBackendRemovalDeclined = errors.New("バックエンドの削除が確認されなかったため中止しました")
+
+// absent は、グループが削除対象（state: absent）かどうかを返します
+func (g GroupConfig) absent() bool {
+	return g.State == groupStateAbsent
+}
+
+// absentGroups は、削除対象のグループ名を設定ファイルでの定義順に返します
+func absentGroups(config *Config) []string {
+	var names []string
+	for _, g := range config.Groups {
+		if g.absent() {
+			names = append(names, g.Name)
+		}
+	}
+	return names
+}
+
+// validateAbsentGroups は、削除対象のグループがサーバーや他のグループから参照されていないかを検証します
+func validateAbsentGroups(config *Config) error {
+	absent := map[string]bool{}
+	for _, g := range config.Groups {
+		switch g.State {
+		case "", "present":
+		case groupStateAbsent:
+			absent[g.Name] = true
+		default:
+			return fmt.Errorf("グループ[%s]の state[%s]は未対応です（present または absent）", g.Name, g.State)
+		}
+	}
+	for _, b := range config.Backends {
+		if absent[b.Group] {
+			return fmt.Errorf("削除対象（state: absent）のグループ[%s]にサーバー[%s]が定義されています", b.Group, b.Name)
+		}
+	}
+	for _, g := range config.Groups {
+		for _, dep := range g.DependsOn {
+			if absent[dep] && !g.absent() {
+				return fmt.Errorf("グループ[%s]が削除対象（state: absent）のグループ[%s]に依存しています", g.Name, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// referencingFrontends は、指定したバックエンドを default_backend または use_backend で参照しているフロントエンド名を返します
+func referencingFrontends(client haproxyClient, backend string) ([]string, error) {
+	frontends, err := client.GetFrontends()
+	if err != nil {
+		return nil, fmt.Errorf("フロントエンド一覧の取得に失敗: %w", err)
+	}
+	var names []string
+	for _, f := range frontends {
+		refs := append([]string{f.DefaultBackend}, f.UseBackends...)
+		for _, r := range refs {
+			if r == backend {
+				names = append(names, f.Name)
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// deleteAbsentBackends は、state: absent のバックエンドをサーバーごと削除します。
+// 既に存在しないバックエンドは何もせず、フロントエンドから参照されているバックエンドがあれば
+// 何も削除せずにエラーを返します
+func deleteAbsentBackends(client haproxyClient, config *Config, opts applyOptions) ([]BackendResult, error) {
+	names := absentGroups(config)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	current, err := client.GetBackends()
+	if err != nil {
+		return nil, fmt.Errorf("バックエンド一覧の取得に失敗: %w", err)
+	}
+	exists := map[string]bool{}
+	for _, name := range current {
+		exists[name] = true
+	}
+
+	// フロントエンドから参照されていないことを全て確認してから削除を始めます
+	var targets []string
+	for _, name := range names {
+		if !exists[name] {
+			logf("バックエンド[%s]は既に存在しないためスキップしました\n", name)
+			continue
+		}
+		refs, err := referencingFrontends(client, name)
+		if err != nil {
+			return nil, err
+		}
+		if len(refs) > 0 {
+			return nil, fmt.Errorf("バックエンド[%s]はフロントエンド[%s]から参照されているため削除できません", name, strings.Join(refs, ", "))
+		}
+		targets = append(targets, name)
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	if opts.confirmBackendRemoval != nil {
+		ok, err := opts.confirmBackendRemoval(targets)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errBackendRemovalDeclined
+		}
+	}
+
+	results := make([]BackendResult, 0, len(targets))
+	for _, name := range targets {
+		if err := client.DeleteBackend(name); err != nil {
+			reportError(errorCategoryBackend, name, fmt.Sprintf("バックエンド[%s]の削除に失敗", name), err)
+			results = append(results, newBackendResult(name, StatusFailedAPI, err))
+			continue
+		}
+		logf("バックエンド[%s]をサーバーごと削除しました\n", name)
+		results = append(results, newBackendResult(name, StatusBackendRemoved, nil))
+	}
+	return results, nil
+}
+
+// confirmBackendRemovals は、削除対象のバックエンドを一覧表示し、"yes" と入力された場合のみ true を返します
+func confirmBackendRemovals(in io.Reader, out io.Writer, backends []string) (bool, error) {
+	fmt.Fprintf(out, "以下の %d 個のバックエンドを所属するサーバーごと削除します:\n", len(backends))
+	for _, name := range backends {
+		fmt.Fprintf(out, "  - %s\n", name)
+	}
+	fmt.Fprint(out, "続行するには yes と入力してください: ")
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("確認入力の読み込みに失敗: %w", err)
+	}
+	return strings.TrimSpace(answer) == "yes", nil
+}
+
+// stdinConfirmBackends は、標準入力からバックエンドの削除の確認を受け付けます
+func stdinConfirmBackends(backends []string) (bool, error) {
+	return confirmBackendRemovals(os.Stdin, os.Stdout, backends)
+}
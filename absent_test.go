@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// absentTestConfig は、legacy グループを削除対象（state: absent）とする設定です
+const absentTestConfig = `{
+	"haproxy_endpoint": ["memory://absent"],
+	"load_balancing_algorithm": "roundrobin",
+	"groups": [{"name": "web"}, {"name": "legacy", "state": "absent"}],
+	"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"}]
+}`
+
+// newAbsentTestHAProxy は、legacy バックエンドにサーバーを持つメモリ上の HAProxy を返します
+func newAbsentTestHAProxy(t *testing.T, frontends ...haproxy.Frontend) *haproxyfake.HAProxy {
+	t.Helper()
+	_, fake := testMemoryEndpoint(t)
+	for _, name := range []string{"legacy-1", "legacy-2"} {
+		if err := fake.AddServer(&haproxy.Server{Backend: "legacy", Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake.SetFrontends(frontends)
+	return fake
+}
+
+func TestApplyDeletesAbsentBackend(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, absentTestConfig)
+	fake := newAbsentTestHAProxy(t, haproxy.Frontend{Name: "www", DefaultBackend: "web"})
+	var confirmed []string
+	result, err := applyConfig(fake, config, applyOptions{confirmBackendRemoval: func(backends []string) (bool, error) {
+		confirmed = backends
+		return true, nil
+	}})
+	if err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	if strings.Join(confirmed, ",") != "legacy" {
+		t.Errorf("確認したバックエンド = %v, want [legacy]", confirmed)
+	}
+	if backends, _ := fake.GetBackends(); strings.Join(backends, ",") != "web" {
+		t.Errorf("適用後のバックエンド = %v, want [web]（legacy をサーバーごと削除）", backends)
+	}
+	if len(result.Removed) != 1 || result.Removed[0].Name != "legacy" || result.Removed[0].Status != StatusBackendRemoved {
+		t.Errorf("削除の結果 = %+v, want legacy が %s", result.Removed, StatusBackendRemoved)
+	}
+}
+
+func TestAbsentBackendReferencedByFrontendIsKept(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, absentTestConfig)
+	fake := newAbsentTestHAProxy(t, haproxy.Frontend{Name: "www", DefaultBackend: "web", UseBackends: []string{"legacy"}})
+	_, err := deleteAbsentBackends(fake, config, applyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "フロントエンド[www]から参照されている") {
+		t.Errorf("deleteAbsentBackends() = %v, want フロントエンドから参照されているエラー", err)
+	}
+	if servers, _ := fake.GetServers(); len(servers) != 2 {
+		t.Errorf("削除後の legacy のサーバー数 = %d, want 2（何も削除しないこと）", len(servers))
+	}
+}
+
+func TestAbsentBackendRemovalDeclined(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, absentTestConfig)
+	fake := newAbsentTestHAProxy(t)
+	_, err := deleteAbsentBackends(fake, config, applyOptions{confirmBackendRemoval: func([]string) (bool, error) { return false, nil }})
+	if !errors.Is(err, errBackendRemovalDeclined) {
+		t.Errorf("deleteAbsentBackends() = %v, want errBackendRemovalDeclined", err)
+	}
+	if backends, _ := fake.GetBackends(); len(backends) != 1 {
+		t.Errorf("中止後のバックエンド = %v, want [legacy]", backends)
+	}
+
+	var out bytes.Buffer
+	if ok, _ := confirmBackendRemovals(strings.NewReader("yes\n"), &out, []string{"legacy"}); !ok || !strings.Contains(out.String(), "  - legacy\n") {
+		t.Errorf("confirmBackendRemovals(yes) = %v, 出力 %q, want true と削除対象の一覧", ok, out.String())
+	}
+}
+
+func TestValidateAbsentGroups(t *testing.T) {
+	err := validateTestConfig(t, strings.Replace(absentTestConfig, `"group": "web"`, `"group": "legacy"`, 1))
+	if err == nil || !strings.Contains(err.Error(), "サーバー[web-1]が定義されています") {
+		t.Errorf("Validate() = %v, want 削除対象のグループにサーバーがあるエラー", err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// algorithmParamRule は、引数（パラメータ）を取るアルゴリズムの引数の指定方法です
+type algorithmParamRule struct {
+	required bool   // 引数が必須かどうか（false の場合は省略できます）
+	paren    bool   // "hdr(Host)" のように括弧で囲むかどうか（false の場合は "url_param sessionid" のように空白で区切ります）
+	example  string // エラーメッセージに表示する引数の例
+}
+
+// algorithmParamRules は、引数を取るアルゴリズムとその指定方法です。ここにないアルゴリズムは引数を取りません
+var algorithmParamRules = map[string]algorithmParamRule{
+	"url_param":  {required: true, example: "sessionid"},
+	"hdr":        {required: true, paren: true, example: "Host"},
+	"hash":       {required: true, example: "req.hdr(host)"},
+	"rdp-cookie": {paren: true, example: "mstshash"},
+	"uri":        {example: "depth 3"},
+}
+
+// splitAlgorithm は、balance の指定をアルゴリズム名と引数に分けます（"hdr(Host)" は hdr と Host、"url_param sessionid" は url_param と sessionid）
+func splitAlgorithm(algo string) (name, param string) {
+	name = strings.TrimSpace(algo)
+	i := strings.IndexAny(name, "( ")
+	if i < 0 {
+		return name, ""
+	}
+	if name[i] == '(' {
+		return name[:i], strings.TrimSuffix(name[i+1:], ")")
+	}
+	return name[:i], strings.TrimSpace(name[i+1:])
+}
+
+// composeAlgorithm は、アルゴリズム名と引数から balance の指定を組み立てます（param が空の場合は algo をそのまま返します）
+func composeAlgorithm(algo, param string) string {
+	algo, param = strings.TrimSpace(algo), strings.TrimSpace(param)
+	if param == "" {
+		return algo
+	}
+	if algorithmParamRules[algo].paren {
+		return algo + "(" + param + ")"
+	}
+	return algo + " " + param
+}
+
+// validateAlgorithmParam は、アルゴリズム名と引数（algorithm と param、または引数を含めた1つの文字列）を
+// アルゴリズムごとの引数の要否に照らして検証します。field はエラーメッセージに表示する項目名です
+func validateAlgorithmParam(field, algo, param string) error {
+	if strings.TrimSpace(param) != "" && strings.ContainsAny(strings.TrimSpace(algo), "( ") {
+		return fmt.Errorf("%s[%s]に引数を含めた場合は、引数を別に指定できません（指定値: %s）", field, algo, param)
+	}
+	name, arg := splitAlgorithm(composeAlgorithm(algo, param))
+	rule, ok := algorithmParamRules[name]
+	switch {
+	case !ok && arg != "":
+		return fmt.Errorf("%s: %s は引数を取りません（指定値: %s）", field, name, arg)
+	case ok && rule.required && arg == "":
+		return fmt.Errorf("%s: %s には引数が必要です（例: %s）", field, name, composeAlgorithm(name, rule.example))
+	case rule.paren && strings.ContainsAny(arg, "() "):
+		return fmt.Errorf("%s: %s の引数[%s]に空白や括弧は使用できません（例: %s）", field, name, arg, composeAlgorithm(name, rule.example))
+	}
+	return nil
+}
+
+// balanceAlgorithm は、全体の balance の指定（load_balancing_algorithm と load_balancing_param を組み立てたもの）を返します
+func (c *Config) balanceAlgorithm() string {
+	return composeAlgorithm(c.LoadBalancingAlgorithm, c.LoadBalancingParam)
+}
+
+// isAlgorithmDisabled は、balance の指定が disabled_algorithms で禁止されているかを返します。
+// 禁止の指定は引数を含めた指定全体、またはアルゴリズム名（"url_param" など）と比較します
+func (c *Config) isAlgorithmDisabled(algo string) bool {
+	name, _ := splitAlgorithm(algo)
+	for _, forbidden := range c.DisabledAlgorithms {
+		forbidden = strings.TrimSpace(forbidden)
+		if strings.EqualFold(forbidden, algo) || strings.EqualFold(forbidden, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownAlgorithm は、balance に指定できる値かを返します。
+// "hdr(host)" や "hash req.hdr(host)" のような引数付きの指定はアルゴリズム名の部分で判定します
+func isKnownAlgorithm(algo string) bool {
+	name, _ := splitAlgorithm(algo)
+	for _, known := range knownAlgorithms {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// groupAlgorithms は、バックエンドの algorithm（と algorithm_param）で全体の設定を上書きしたグループ名とアルゴリズムの対応を返します。
+// 同じグループのサーバーに異なる algorithm が指定されている場合はエラーを返します
+func groupAlgorithms(config *Config) (map[string]string, error) {
+	algorithms := map[string]string{}
+	for _, b := range config.Backends {
+		if b.Algorithm == "" {
+			continue
+		}
+		algo := composeAlgorithm(b.Algorithm, b.AlgorithmParam)
+		if cur, ok := algorithms[b.Group]; ok && cur != algo {
+			return nil, fmt.Errorf("グループ[%s]に異なる algorithm（%s, %s）が指定されています", b.Group, cur, algo)
+		}
+		algorithms[b.Group] = algo
+	}
+	return algorithms, nil
+}
+
+// effectiveAlgorithm は、グループに適用するロードバランシングアルゴリズムを返します
+func effectiveAlgorithm(config *Config, group string) string {
+	if algorithms, err := groupAlgorithms(config); err == nil {
+		if algo, ok := algorithms[group]; ok {
+			return algo
+		}
+	}
+	return config.balanceAlgorithm()
+}
+
+// validateAlgorithms は、全体とバックエンドごとの algorithm の引数と、
+// バックエンドごとの algorithm を既知のアルゴリズムと使用禁止の設定に照らして検証します
+func (c *Config) validateAlgorithms() error {
+	if c.LoadBalancingParam != "" && c.LoadBalancingAlgorithm == "" {
+		return fmt.Errorf("load_balancing_param[%s]を指定する場合は load_balancing_algorithm を指定してください", c.LoadBalancingParam)
+	}
+	if isKnownAlgorithm(c.LoadBalancingAlgorithm) {
+		if err := validateAlgorithmParam("load_balancing_algorithm", c.LoadBalancingAlgorithm, c.LoadBalancingParam); err != nil {
+			return err
+		}
+	}
+	for _, b := range c.Backends {
+		if b.AlgorithmParam != "" && b.Algorithm == "" {
+			return fmt.Errorf("サーバー[%s]: algorithm_param[%s]を指定する場合は algorithm を指定してください", b.Name, b.AlgorithmParam)
+		}
+		if b.Algorithm != "" && isKnownAlgorithm(b.Algorithm) {
+			if err := validateAlgorithmParam(fmt.Sprintf("サーバー[%s]の algorithm", b.Name), b.Algorithm, b.AlgorithmParam); err != nil {
+				return err
+			}
+		}
+	}
+
+	algorithms, err := groupAlgorithms(c)
+	if err != nil {
+		return err
+	}
+	for group, algo := range algorithms {
+		if !isKnownAlgorithm(algo) {
+			return fmt.Errorf("グループ[%s]の algorithm[%s]は未知のアルゴリズムです（有効な値: %s）", group, algo, strings.Join(knownAlgorithms, ", "))
+		}
+		if c.isAlgorithmDisabled(algo) {
+			return fmt.Errorf("%w: グループ[%s]のロードバランシングアルゴリズム[%s]の使用は禁止されています", errPolicyViolation, group, algo)
+		}
+	}
+	return nil
+}
+
+// applyGroupAlgorithms は、algorithm を指定したグループ（バックエンド）に balance を設定します
+func applyGroupAlgorithms(client haproxyClient, config *Config) error {
+	algorithms, err := groupAlgorithms(config)
+	if err != nil {
+		return err
+	}
+	groups, err := orderGroups(config)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		algo, ok := algorithms[g.name]
+		if !ok {
+			continue
+		}
+		if err := client.SetBackendConfig(g.name, "balance", algo); err != nil {
+			return fmt.Errorf("バックエンド[%s]のロードバランシングアルゴリズムの設定に失敗: %w", g.name, err)
+		}
+		logf("バックエンド[%s]のロードバランシングアルゴリズムを [%s] に設定しました\n", g.name, algo)
+	}
+	return nil
+}
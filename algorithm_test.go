@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyPerBackendAlgorithm(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://algorithm"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "cache-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "cache", "algorithm": "uri"},
+			{"name": "cache-2", "ip": "10.0.1.2", "port": 80, "weight": 10, "group": "cache", "algorithm": "uri"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, config, applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.Algorithm(); got != "roundrobin" {
+		t.Errorf("全体のアルゴリズム = %q, want roundrobin", got)
+	}
+	if got := fake.BackendConfig("cache", "balance"); got != "uri" {
+		t.Errorf("cache の balance = %q, want uri（バックエンドの algorithm で上書き）", got)
+	}
+	if got := fake.BackendConfig("web", "balance"); got != "" {
+		t.Errorf("web の balance = %q, want 未設定（全体の設定を使用）", got)
+	}
+	if got := effectiveAlgorithm(config, "web"); got != "roundrobin" {
+		t.Errorf("effectiveAlgorithm(web) = %q, want roundrobin", got)
+	}
+}
+
+func TestPerBackendAlgorithmValidation(t *testing.T) {
+	for _, tt := range []struct {
+		name, backends, want string
+	}{
+		{"未知のアルゴリズム",
+			`{"name": "cache-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "cache", "algorithm": "uri-hash"}`,
+			"algorithm[uri-hash]は未知のアルゴリズムです"},
+		{"グループ内で異なるアルゴリズム",
+			`{"name": "cache-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "cache", "algorithm": "uri"},
+			{"name": "cache-2", "ip": "10.0.1.2", "port": 80, "weight": 10, "group": "cache", "algorithm": "leastconn"}`,
+			"異なる algorithm（uri, leastconn）"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTestConfig(t, `{
+				"haproxy_endpoint": ["memory://algorithm"],
+				"load_balancing_algorithm": "roundrobin",
+				"backends": [`+tt.backends+`]
+			}`)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want %q を含むエラー", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestComposeAndSplitAlgorithm(t *testing.T) {
+	for _, tt := range []struct {
+		algo, param, want string
+	}{
+		{"url_param", "sessionid", "url_param sessionid"},
+		{"hdr", "Host", "hdr(Host)"},
+		{"hash", "req.hdr(host)", "hash req.hdr(host)"},
+		{"rdp-cookie", "mstshash", "rdp-cookie(mstshash)"},
+		{"roundrobin", "", "roundrobin"},
+	} {
+		got := composeAlgorithm(tt.algo, tt.param)
+		if got != tt.want {
+			t.Errorf("composeAlgorithm(%q, %q) = %q, want %q", tt.algo, tt.param, got, tt.want)
+		}
+		if name, param := splitAlgorithm(got); name != tt.algo || param != tt.param {
+			t.Errorf("splitAlgorithm(%q) = %q, %q, want %q, %q", got, name, param, tt.algo, tt.param)
+		}
+	}
+}
+
+func TestApplyStructuredBalanceParams(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://algorithm"],
+		"load_balancing_algorithm": "url_param",
+		"load_balancing_param": "sessionid",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "api-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "api", "algorithm": "hdr", "algorithm_param": "Host"}
+		]
+	}`)
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() がエラーを返しました: %v", err)
+	}
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, config, applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.Algorithm(); got != "url_param sessionid" {
+		t.Errorf("全体のアルゴリズム = %q, want url_param sessionid", got)
+	}
+	if got := fake.BackendConfig("api", "balance"); got != "hdr(Host)" {
+		t.Errorf("api の balance = %q, want hdr(Host)（algorithm と algorithm_param から組み立てる）", got)
+	}
+	if got := effectiveAlgorithm(config, "web"); got != "url_param sessionid" {
+		t.Errorf("effectiveAlgorithm(web) = %q, want url_param sessionid", got)
+	}
+}
+
+func TestBalanceParamValidation(t *testing.T) {
+	for _, tt := range []struct {
+		name, global, backends, want string
+	}{
+		{"必須の引数がない", `"load_balancing_algorithm": "url_param"`, ``,
+			"url_param には引数が必要です（例: url_param sessionid）"},
+		{"引数を取らないアルゴリズム", `"load_balancing_algorithm": "roundrobin", "load_balancing_param": "x"`, ``,
+			"roundrobin は引数を取りません"},
+		{"文字列の指定と引数の併用", `"load_balancing_algorithm": "hdr(Host)", "load_balancing_param": "Host"`, ``,
+			"引数を別に指定できません"},
+		{"アルゴリズムなしの引数", `"load_balancing_algorithm": "", "load_balancing_param": "sessionid"`, ``,
+			"load_balancing_algorithm を指定してください"},
+		{"括弧で囲む引数に空白", `"load_balancing_algorithm": "hdr", "load_balancing_param": "X Forwarded"`, ``,
+			"空白や括弧は使用できません"},
+		{"バックエンドの必須の引数がない", `"load_balancing_algorithm": "roundrobin"`,
+			`{"name": "api-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "api", "algorithm": "hash"}`,
+			"サーバー[api-1]の algorithm: hash には引数が必要です"},
+		{"バックエンドの algorithm なしの引数", `"load_balancing_algorithm": "roundrobin"`,
+			`{"name": "api-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "api", "algorithm_param": "Host"}`,
+			"algorithm_param[Host]を指定する場合は algorithm を指定してください"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTestConfig(t, `{
+				"haproxy_endpoint": ["memory://algorithm"],
+				`+tt.global+`,
+				"backends": [`+tt.backends+`]
+			}`)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want %q を含むエラー", err, tt.want)
+			}
+		})
+	}
+
+	for _, global := range []string{
+		`"load_balancing_algorithm": "uri"`,
+		`"load_balancing_algorithm": "uri", "load_balancing_param": "depth 3"`,
+		`"load_balancing_algorithm": "url_param sessionid"`,
+	} {
+		if err := validateTestConfig(t, `{"haproxy_endpoint": ["memory://algorithm"], `+global+`, "backends": []}`); err != nil {
+			t.Errorf("%s の検証がエラーになりました: %v", global, err)
+		}
+	}
+}
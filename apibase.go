@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// supportedAPIBasePaths は、api_base_path に指定できる Data Plane API のベースパスです
+var supportedAPIBasePaths = []string{"/v2", "/v3"}
+
+// validateAPIBasePath は、api_base_path が対応するベースパスか、
+// また Data Plane API のエンドポイントの URL にパスが含まれていないかを検証します（パスの指定が二重にならないようにします）
+func validateAPIBasePath(basePath string, endpoints []string) error {
+	if basePath == "" {
+		return nil
+	}
+	supported := false
+	for _, p := range supportedAPIBasePaths {
+		if basePath == p {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("api_base_path[%s]は未対応です（%s のいずれか）", basePath, strings.Join(supportedAPIBasePaths, ", "))
+	}
+	for _, e := range endpoints {
+		if strings.HasPrefix(e, socketScheme) || strings.HasPrefix(e, memoryScheme) {
+			continue
+		}
+		u, err := url.Parse(e)
+		if err != nil {
+			return fmt.Errorf("haproxy_endpoint[%s]を解釈できません: %w", e, err)
+		}
+		if strings.Trim(u.Path, "/") != "" {
+			return fmt.Errorf("api_base_path を指定した場合、haproxy_endpoint[%s]にはパスを含めないでください", e)
+		}
+	}
+	return nil
+}
+
+// apiEndpointURL は、Data Plane API のエンドポイントにベースパスを付けた URL を返します（basePath が空の場合はそのまま返します）
+func apiEndpointURL(endpoint, basePath string) string {
+	if basePath == "" {
+		return endpoint
+	}
+	return strings.TrimRight(endpoint, "/") + basePath
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestBuildHAProxyClientUsesBasePath(t *testing.T) {
+	for _, tt := range []struct{ endpoint, basePath, want string }{
+		{"http://haproxy1:5555", "/v3", "http://haproxy1:5555/v3"},
+		{"https://haproxy1:5555/", "/v2", "https://haproxy1:5555/v2"},
+		{"http://haproxy1:5555/v2", "", "http://haproxy1:5555/v2"},
+	} {
+		client, ok := buildHAProxyClient(tt.endpoint, "key", tt.basePath).(*dataPlaneClient)
+		if !ok {
+			t.Fatalf("buildHAProxyClient(%q) が Data Plane API のクライアントを返しませんでした", tt.endpoint)
+		}
+		if client.Endpoint != tt.want {
+			t.Errorf("buildHAProxyClient(%q, %q) の接続先 = %q, want %q", tt.endpoint, tt.basePath, client.Endpoint, tt.want)
+		}
+	}
+	if _, ok := buildHAProxyClient(memoryScheme+t.Name(), "", "/v3").(*dataPlaneClient); ok {
+		t.Error("memory:// のエンドポイントで Data Plane API のクライアントが返されました（api_base_path の影響を受けないこと）")
+	}
+}
+
+func TestValidateAPIBasePath(t *testing.T) {
+	for _, tt := range []struct {
+		basePath  string
+		endpoints []string
+		valid     bool
+	}{
+		{"", []string{"http://haproxy1:5555/v2"}, true},
+		{"/v2", []string{"http://haproxy1:5555", "unix:///run/haproxy.sock", "memory://test"}, true},
+		{"/v3", []string{"https://haproxy1:5555/"}, true},
+		{"/v4", []string{"http://haproxy1:5555"}, false},
+		{"v3", []string{"http://haproxy1:5555"}, false},
+		{"/v3", []string{"http://haproxy1:5555/v2"}, false},
+	} {
+		if err := validateAPIBasePath(tt.basePath, tt.endpoints); (err == nil) != tt.valid {
+			t.Errorf("validateAPIBasePath(%q, %v) = %v, want 正しい設定=%v", tt.basePath, tt.endpoints, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// applyOptions は、コマンドラインフラグなどで指定される適用時の動作オプションです
+type applyOptions struct {
+	parallelBackends bool // グループ内のサーバーを並列に適用するかどうか
+	prune            bool // 設定ファイルに記載のないサーバーを削除するかどうか
+	pruneOnly        bool // サーバーの削除のみを行い、追加・更新や他のフェーズを実行しないかどうか（prune も有効になります）
+	force            bool // min_servers を下回る削除も行うかどうか
+	seed             bool // 初回の適用（管理対象のサーバーが1台もない接続先）では削除を行わないかどうか
+
+	maxChangePercent float64 // 1回の適用で変更してよいサーバーの割合（%、0で制限なし）
+	attempts         int     // サーバーの追加や再接続ポリシーの設定などの最大試行回数（0 の場合は defaultOperationAttempts）
+
+	// drain は、削除するサーバーを先に drain して接続がなくなるのを待つ方法です（-graceful-remove、nil の場合は待たずに削除します）
+	drain *drainPolicy
+
+	// skipPhases は実行しないフェーズ名と、その理由となったオプションです（-no-algorithm / -no-retry-policy）
+	skipPhases map[string]string
+
+	// tags は適用するバックエンドの絞り込み条件です（-tag / -exclude-tag / -server-filter）。対象外のバックエンドは変更せず、削除対象にもしません
+	tags tagFilter
+
+	// resolver は、ホスト名を名前解決できないサーバーをスキップするための名前解決の処理です（-skip-unresolvable、nil の場合は確認しません）
+	resolver hostResolver
+
+	// deadline は適用全体の所要時間の上限です（max_apply_duration、nil の場合は上限なし）
+	deadline *applyDeadline
+
+	// ctx は、HAProxy への操作の再試行の待機を中断するためのコンテキストです
+	// （SIGINT / SIGTERM、max_apply_duration、-repeat の終了でキャンセルされます。nil の場合は中断しません）
+	ctx context.Context
+
+	// confirmRemoval は、サーバーを削除する前に呼ばれる確認処理です。nil の場合は確認しません
+	confirmRemoval func(removals []haproxy.Server) (bool, error)
+	// confirmBackendRemoval は、state: absent のバックエンドを削除する前に呼ばれる確認処理です。nil の場合は確認しません
+	confirmBackendRemoval func(backends []string) (bool, error)
+}
+
+// operationAttempts は、HAProxy への1つの操作の最大試行回数を返します（-max-retries の指定がなければ defaultOperationAttempts）
+func (o applyOptions) operationAttempts() int {
+	if o.attempts <= 0 {
+		return defaultOperationAttempts
+	}
+	return o.attempts
+}
+
+// context は、再試行の待機を中断するためのコンテキストを返します（未指定の場合は context.Background()）
+func (o applyOptions) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+// applyPhase は適用処理の1段階です。
+// 実際の適用（run）と dry-run での表示（describe）は同じ applyPhases の順序で行われます
+type applyPhase struct {
+	name     string
+	run      func(client haproxyClient, config *Config, opts applyOptions, result *Result) error
+	describe func(config *Config, opts applyOptions) []string
+}
+
+// applyPhases は適用の順序です。アルゴリズムによってはサーバーが存在しない状態で変更すると
+// 一時的に不正な状態になるため、次の順序で適用します。
+//
+//  1. resolvers セクション（server-template の名前解決に使うため最初に作成）
+//  2. peers セクション（stick-table から参照されるため group-settings より前に作成）
+//  3. バックエンドサーバーの追加・更新（-prune 指定時は削除も）
+//  4. グループ（バックエンド）単位の設定（stick-table など）
+//  5. mailers セクションとバックエンドのメール通知（email-alert）
+//  6. cache セクションとバックエンド・frontend のキャッシュの利用（cache-use / cache-store）
+//  7. ヘッダー操作ルール（http-request / http-response）
+//  8. frontend のログの形式（option httplog / tcplog, log-format）
+//  9. ロードバランシングアルゴリズム
+//  10. 再接続ポリシー（retries, option redispatch）
+//  11. state: absent のバックエンドの削除
+var applyPhases = []applyPhase{
+	{name: "resolvers", run: applyResolversPhase, describe: describeResolversPhase},
+	{name: "peers", run: applyPeersPhase, describe: describePeersPhase},
+	{name: "servers", run: applyServersPhase, describe: describeServersPhase},
+	{name: "group-settings", run: applyGroupSettingsPhase, describe: describeGroupSettingsPhase},
+	{name: "mailers", run: applyMailersPhase, describe: describeMailersPhase},
+	{name: "cache", run: applyCachePhase, describe: describeCachePhase},
+	{name: "http-rules", run: applyHTTPRulesPhase, describe: describeHTTPRulesPhase},
+	{name: "frontend-logging", run: applyFrontendLoggingPhase, describe: describeFrontendLoggingPhase},
+	{name: "algorithm", run: applyAlgorithmPhase, describe: describeAlgorithmPhase},
+	{name: "retry-policy", run: applyRetryPolicyPhase, describe: describeRetryPolicyPhase},
+	{name: "backend-removal", run: applyBackendRemovalPhase, describe: describeBackendRemovalPhase},
+}
+
+// skipReason は、フェーズを実行しない場合にその理由となったオプションを返します（実行する場合は空文字列）。
+// -prune-only 指定時はサーバーの削除を行う servers のみを実行します
+func (p applyPhase) skipReason(opts applyOptions) string {
+	if opts.pruneOnly && p.name != "servers" {
+		return "-prune-only"
+	}
+	return opts.skipPhases[p.name]
+}
+
+// applyConfig は、設定ファイルの内容（バックエンドサーバー、ロードバランシングアルゴリズム、
+// 再接続ポリシー）を applyPhases の順序でHAProxy APIを通じて反映し、バックエンドごとの結果を返します
+func applyConfig(client haproxyClient, config *Config, opts applyOptions) (*Result, error) {
+	result := &Result{}
+	for _, phase := range applyPhases {
+		if reason := phase.skipReason(opts); reason != "" {
+			logf("%s の指定により %s を実行しません\n", reason, phase.name)
+			result.SkippedPhases = append(result.SkippedPhases, phase.name)
+			continue
+		}
+		// max_apply_duration を過ぎた後は残りのフェーズを開始しません
+		if opts.deadline.expired() {
+			result.DeadlineExceeded = true
+			result.DeferredPhases = append(result.DeferredPhases, phase.name)
+			continue
+		}
+		done := profilePhase(phase.name)
+		err := phase.run(client, config, opts, result)
+		done()
+		if err != nil {
+			return result, err
+		}
+	}
+	if result.DeadlineExceeded {
+		return result, errApplyDeadline
+	}
+	return result, nil
+}
+
+// planConfig は、applyConfig が行う操作を適用順に説明した一覧を返します（dry-run 用）
+func planConfig(config *Config, opts applyOptions) []string {
+	var plan []string
+	for _, phase := range applyPhases {
+		if reason := phase.skipReason(opts); reason != "" {
+			plan = append(plan, fmt.Sprintf("%s %s の指定により実行しません", colorize(colorCyan, "["+phase.name+"]"), reason))
+			continue
+		}
+		for _, line := range phase.describe(config, opts) {
+			plan = append(plan, fmt.Sprintf("%s %s", colorize(colorCyan, "["+phase.name+"]"), line))
+		}
+	}
+	return plan
+}
+
+// applyResolversPhase は、nameservers を指定した resolvers セクションを作成・更新します
+// （runtime socket では変更できないため、その場合は警告のみ）
+func applyResolversPhase(client haproxyClient, config *Config, opts applyOptions, result *Result) error {
+	err := applyResolvers(client, config)
+	switch {
+	case errors.Is(err, errRuntimeUnsupported):
+		warnf("resolvers の設定をスキップしました: %v", err)
+	case err != nil:
+		return err
+	}
+	return nil
+}
+
+func describeResolversPhase(config *Config, opts applyOptions) []string {
+	var lines []string
+	for _, r := range managedResolvers(config) {
+		lines = append(lines, fmt.Sprintf("resolvers[%s]を作成または更新: %s", r.Name, strings.Join(resolverLines(buildResolver(r)), ", ")))
+	}
+	return lines
+}
+
+// applyServersPhase は、設定ファイルに記載された各バックエンドサーバーを追加・更新します（リトライ付き）
+func applyServersPhase(client haproxyClient, config *Config, opts applyOptions, result *Result) error {
+	r, err := reconcileServers(client, config, opts)
+	if err != nil {
+		return err
+	}
+	result.Backends = r.Backends
+	result.Removed = r.Removed
+	result.Seeded = r.Seeded
+	return nil
+}
+
+func describeServersPhase(config *Config, opts applyOptions) []string {
+	var lines []string
+	groups, err := orderGroups(config)
+	if err != nil {
+		return []string{fmt.Sprintf("グループの順序を決定できません: %v", err)}
+	}
+	if opts.pruneOnly {
+		groups = nil // -prune-only ではサーバーの追加・更新を行いません
+	}
+	for _, group := range groups {
+		for _, backend := range opts.tags.filter(group.backends) {
+			if backend.SRV != "" {
+				lines = append(lines, fmt.Sprintf("server-template を追加または更新: %s", serverTemplateLine(buildServerTemplate(config, backend))))
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("サーバーを追加または更新: %s", serverLine(buildServer(config, backend))))
+		}
+	}
+	if opts.prune {
+		line := "設定ファイルに記載のないサーバーを削除"
+		if opts.seed {
+			line += "（-seed: 初回の適用の場合は削除しません）"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// applyPeersPhase は、peers セクションを作成・更新します
+func applyPeersPhase(client haproxyClient, config *Config, opts applyOptions, result *Result) error {
+	err := applyPeers(client, config)
+	switch {
+	case errors.Is(err, errRuntimeUnsupported):
+		warnf("peers の設定をスキップしました: %v", err)
+	case err != nil:
+		return err
+	}
+	return nil
+}
+
+func describePeersPhase(config *Config, opts applyOptions) []string {
+	var lines []string
+	for _, p := range config.Peers {
+		lines = append(lines, fmt.Sprintf("peers[%s]を作成または更新: %s", p.Name, strings.Join(peersLines(buildPeers(p)), ", ")))
+	}
+	return lines
+}
+
+// applyGroupSettingsPhase は、グループ（バックエンド）単位の設定を反映します
+func applyGroupSettingsPhase(client haproxyClient, config *Config, opts applyOptions, result *Result) error {
+	err := applyGroupSettings(client, config)
+	switch {
+	case errors.Is(err, errRuntimeUnsupported):
+		warnf("グループ単位の設定をスキップしました: %v", err)
+	case err != nil:
+		return err
+	}
+	return nil
+}
+
+func describeGroupSettingsPhase(config *Config, opts applyOptions) []string {
+	var lines []string
+	groups, _ := orderGroups(config)
+	for _, group := range groups {
+		if line := describeBackendMode(config, group); line != "" {
+			lines = append(lines, line)
+		}
+		if line := describeBackendTuning(config, group); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	for _, g := range config.Groups {
+		if g.Stick != nil && !g.absent() {
+			lines = append(lines, fmt.Sprintf("バックエンド[%s]: stick-table %s, stick on %s", g.Name, stickTableValue(g.Stick), g.Stick.On))
+		}
+	}
+	return lines
+}
+
+// applyMailersPhase は、mailers セクションを作成・更新し、バックエンドにメール通知を設定します
+func applyMailersPhase(client haproxyClient, config *Config, opts applyOptions, result *Result) error {
+	err := applyMailers(client, config)
+	switch {
+	case errors.Is(err, errRuntimeUnsupported):
+		warnf("mailers の設定をスキップしました: %v", err)
+	case err != nil:
+		return err
+	}
+	return nil
+}
+
+func describeMailersPhase(config *Config, opts applyOptions) []string {
+	var lines []string
+	for _, m := range config.Mailers {
+		lines = append(lines, fmt.Sprintf("mailers[%s]を作成または更新: %s", m.Name, strings.Join(mailerLines(buildMailers(m)), ", ")))
+	}
+	for _, g := range emailAlertGroups(config) {
+		if m := findMailer(config, g.EmailAlert); m != nil {
+			lines = append(lines, fmt.Sprintf("バックエンド[%s]: メール通知 mailers[%s] %s -> %s（level %s）", g.Name, m.Name, m.From, m.To, valueOrDash(m.Level)))
+		}
+	}
+	return lines
+}
+
+// applyCachePhase は、cache セクションを作成・更新し、バックエンドと frontend でキャッシュを有効にします
+func applyCachePhase(client haproxyClient, config *Config, opts applyOptions, result *Result) error {
+	err := applyCache(client, config)
+	switch {
+	case errors.Is(err, errRuntimeUnsupported):
+		warnf("cache の設定をスキップしました: %v", err)
+	case err != nil:
+		return err
+	}
+	return nil
+}
+
+func describeCachePhase(config *Config, opts applyOptions) []string {
+	var lines []string
+	for _, c := range config.Caches {
+		lines = append(lines, fmt.Sprintf("cache[%s]を作成または更新: %s", c.Name, strings.Join(cacheLines(buildCache(c)), ", ")))
+	}
+	for _, g := range cacheGroups(config) {
+		lines = append(lines, fmt.Sprintf("バックエンド[%s]: キャッシュ cache[%s]を使用", g.Name, g.Cache))
+	}
+	for _, f := range config.Frontends {
+		if f.Cache != "" {
+			lines = append(lines, fmt.Sprintf("frontend[%s]: キャッシュ cache[%s]を使用", f.Name, f.Cache))
+		}
+	}
+	return lines
+}
+
+// applyHTTPRulesPhase は、ヘッダー操作ルールを反映します
+func applyHTTPRulesPhase(client haproxyClient, config *Config, opts applyOptions, result *Result) error {
+	err := applyHTTPRules(client, config)
+	switch {
+	case errors.Is(err, errRuntimeUnsupported):
+		warnf("ヘッダー操作ルールの設定をスキップしました: %v", err)
+	case err != nil:
+		return err
+	}
+	return nil
+}
+
+func describeHTTPRulesPhase(config *Config, opts applyOptions) []string {
+	var lines []string
+	for _, r := range config.HTTPRules {
+		lines = append(lines, fmt.Sprintf("%s[%s]: %s", r.Scope, r.Name, httpRuleLine(r)))
+	}
+	return lines
+}
+
+// applyFrontendLoggingPhase は、frontend のログの形式を反映します
+// （runtime socket では変更できないため、その場合は警告のみ）
+func applyFrontendLoggingPhase(client haproxyClient, config *Config, opts applyOptions, result *Result) error {
+	err := applyFrontendLogging(client, config)
+	switch {
+	case errors.Is(err, errRuntimeUnsupported):
+		warnf("frontend のログの設定をスキップしました: %v", err)
+	case err != nil:
+		return err
+	}
+	return nil
+}
+
+func describeFrontendLoggingPhase(config *Config, opts applyOptions) []string {
+	var lines []string
+	for _, f := range config.Frontends {
+		lines = append(lines, fmt.Sprintf("frontend[%s]: %s", f.Name, frontendLogLine(f)))
+	}
+	return lines
+}
+
+// applyAlgorithmPhase は、ロードバランシングアルゴリズムを設定し、algorithm を指定したグループは個別に上書きします
+// （runtime socket では変更できないため、その場合は警告のみ）
+func applyAlgorithmPhase(client haproxyClient, config *Config, opts applyOptions, result *Result) error {
+	err := client.SetLoadBalancingAlgorithm(config.balanceAlgorithm())
+	switch {
+	case errors.Is(err, errRuntimeUnsupported):
+		warnf("ロードバランシングアルゴリズムの設定をスキップしました: %v", err)
+		return nil
+	case err != nil:
+		return fmt.Errorf("ロードバランシングアルゴリズムの設定に失敗: %w", err)
+	default:
+		logf("ロードバランシングアルゴリズムを [%s] に設定しました\n", config.balanceAlgorithm())
+	}
+
+	// バックエンドごとに algorithm が指定されたグループは全体の設定を上書きします
+	return applyGroupAlgorithms(client, config)
+}
+
+func describeAlgorithmPhase(config *Config, opts applyOptions) []string {
+	lines := []string{fmt.Sprintf("ロードバランシングアルゴリズムを設定: %s", config.balanceAlgorithm())}
+	groups, _ := orderGroups(config)
+	algorithms, _ := groupAlgorithms(config)
+	for _, g := range groups {
+		if algo, ok := algorithms[g.name]; ok {
+			lines = append(lines, fmt.Sprintf("バックエンド[%s]のロードバランシングアルゴリズムを設定: %s", g.name, algo))
+		}
+	}
+	return lines
+}
+
+// applyRetryPolicyPhase は、再接続ポリシー（リトライ設定と redispatch）の設定を反映します
+func applyRetryPolicyPhase(client haproxyClient, config *Config, opts applyOptions, result *Result) error {
+	err := setRetryPolicy(opts.context(), client, config.RetryPolicy, opts.operationAttempts())
+	switch {
+	case errors.Is(err, errRuntimeUnsupported):
+		warnf("再接続ポリシーの設定をスキップしました: %v", err)
+	case err != nil:
+		return fmt.Errorf("再接続ポリシーの設定に失敗: %w", err)
+	}
+	return nil
+}
+
+func describeRetryPolicyPhase(config *Config, opts applyOptions) []string {
+	return []string{fmt.Sprintf("再接続ポリシーを設定: retries=%d, redispatch=%v", config.RetryPolicy.Retries, config.RetryPolicy.Redispatch)}
+}
+
+// applyBackendRemovalPhase は、state: absent のバックエンドをサーバーごと削除します
+func applyBackendRemovalPhase(client haproxyClient, config *Config, opts applyOptions, result *Result) error {
+	if result.Seeded {
+		if groups := absentGroups(config); len(groups) > 0 {
+			logf("初回の適用（seed）のため、バックエンド %s の削除を行いません\n", strings.Join(groups, ", "))
+		}
+		return nil
+	}
+	removed, err := deleteAbsentBackends(client, config, opts)
+	switch {
+	case errors.Is(err, errRuntimeUnsupported):
+		warnf("バックエンドの削除をスキップしました: %v", err)
+	case err != nil:
+		return fmt.Errorf("バックエンドの削除に失敗: %w", err)
+	}
+	result.Removed = append(result.Removed, removed...)
+	return nil
+}
+
+func describeBackendRemovalPhase(config *Config, opts applyOptions) []string {
+	var lines []string
+	for _, name := range absentGroups(config) {
+		lines = append(lines, fmt.Sprintf("バックエンド[%s]をサーバーごと削除（フロントエンドから参照されていない場合のみ）", name))
+	}
+	return lines
+}
+
+// formatPlan は、dry-run で表示する計画を番号付きの文字列にします
+func formatPlan(plan []string) string {
+	var b strings.Builder
+	for i, line := range plan {
+		fmt.Fprintf(&b, "%2d. %s\n", i+1, line)
+	}
+	return b.String()
+}
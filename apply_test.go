@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// phaseRecordingClient は、サーバーの追加・アルゴリズム・設定値の変更の呼び出し順を記録するクライアントです
+type phaseRecordingClient struct {
+	*haproxyfake.HAProxy
+	calls []string
+}
+
+func (c *phaseRecordingClient) AddServer(server *haproxy.Server) error {
+	c.calls = append(c.calls, "add:"+server.Name)
+	return c.HAProxy.AddServer(server)
+}
+
+func (c *phaseRecordingClient) AddServers(servers []haproxy.Server) error {
+	for _, s := range servers {
+		c.calls = append(c.calls, "add:"+s.Name)
+	}
+	return c.HAProxy.AddServers(servers)
+}
+
+func (c *phaseRecordingClient) SetLoadBalancingAlgorithm(algorithm string) error {
+	c.calls = append(c.calls, "algorithm:"+algorithm)
+	return c.HAProxy.SetLoadBalancingAlgorithm(algorithm)
+}
+
+func (c *phaseRecordingClient) SetConfig(key, value string) error {
+	c.calls = append(c.calls, "config:"+key)
+	return c.HAProxy.SetConfig(key, value)
+}
+
+// applyOrderTestConfig は、サーバー2台とアルゴリズム、再接続ポリシーを持つ設定です
+const applyOrderTestConfig = `{
+	"haproxy_endpoint": ["memory://order"],
+	"load_balancing_algorithm": "leastconn",
+	"retry_policy": {"retries": 3, "redispatch": true},
+	"backends": [
+		{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+		{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+	]
+}`
+
+func TestApplyConfigAddsServersBeforeAlgorithmAndRetryPolicy(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, applyOrderTestConfig)
+	_, fake := testMemoryEndpoint(t)
+	client := &phaseRecordingClient{HAProxy: fake}
+	if _, err := applyConfig(client, config, applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	want := []string{"add:web-1", "add:web-2", "algorithm:leastconn", "config:retries", "config:option redispatch"}
+	if !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("呼び出し順 = %v, want %v（サーバー、アルゴリズム、再接続ポリシーの順）", client.calls, want)
+	}
+}
+
+func TestPlanConfigFollowsApplyOrder(t *testing.T) {
+	config := loadTestConfig(t, applyOrderTestConfig)
+	var phases []string
+	for _, line := range planConfig(config, applyOptions{skipPhases: map[string]string{"retry-policy": "-no-retry-policy"}}) {
+		name := strings.TrimPrefix(line[:strings.Index(line, "]")], "[")
+		if len(phases) == 0 || phases[len(phases)-1] != name {
+			phases = append(phases, name)
+		}
+	}
+	want := []string{"servers", "algorithm", "retry-policy"}
+	if !reflect.DeepEqual(phases, want) {
+		t.Errorf("dry-run のフェーズの順序 = %v, want %v（applyPhases と同じ順序）", phases, want)
+	}
+}
+
+func TestSkipPhasesSkipsAlgorithmAndRetryPolicy(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, applyOrderTestConfig)
+	for _, tt := range []struct {
+		skip map[string]string
+		want []string
+	}{
+		{map[string]string{"algorithm": "-no-algorithm"}, []string{"add:web-1", "add:web-2", "config:retries", "config:option redispatch"}},
+		{map[string]string{"retry-policy": "-no-retry-policy"}, []string{"add:web-1", "add:web-2", "algorithm:leastconn"}},
+		{map[string]string{"algorithm": "-no-algorithm", "retry-policy": "-no-retry-policy"}, []string{"add:web-1", "add:web-2"}},
+	} {
+		client := &phaseRecordingClient{HAProxy: haproxyfake.New()}
+		opts := applyOptions{skipPhases: tt.skip}
+		result, err := applyConfig(client, config, opts)
+		if err != nil {
+			t.Fatalf("applyConfig がエラーを返しました: %v", err)
+		}
+		if !reflect.DeepEqual(client.calls, tt.want) {
+			t.Errorf("%v のクライアントの呼び出し = %v, want %v", tt.skip, client.calls, tt.want)
+		}
+		if len(result.SkippedPhases) != len(tt.skip) {
+			t.Errorf("%v の skipped_phases = %v, want 実行しなかったフェーズ", tt.skip, result.SkippedPhases)
+		}
+		for _, name := range result.SkippedPhases {
+			if tt.skip[name] == "" {
+				t.Errorf("%v の skipped_phases に %s が含まれています", tt.skip, name)
+			}
+		}
+
+		plan := strings.Join(planConfig(config, opts), "\n")
+		for name, flag := range tt.skip {
+			if !strings.Contains(plan, "["+name+"] "+flag+" の指定により実行しません") {
+				t.Errorf("dry-run の計画に %s の省略が表示されていません:\n%s", name, plan)
+			}
+		}
+	}
+}
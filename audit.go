@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// auditRecord は監査ログの1レコード（HAProxyへの変更操作1回分）です
+type auditRecord struct {
+	Time     string `json:"time"`
+	RunID    string `json:"run_id"`
+	Operator string `json:"operator"`
+	Endpoint string `json:"endpoint"`
+	Action   string `json:"action"`
+	Target   string `json:"target"`
+	Outcome  string `json:"outcome"` // success または failure
+	Error    string `json:"error,omitempty"`
+}
+
+// auditLog は、変更操作ごとに1行のJSONを追記する監査ログです。
+// 途中で異常終了しても記録が失われないよう、レコードごとに書き込んでディスクへ同期します
+type auditLog struct {
+	mu       sync.Mutex
+	file     *os.File
+	runID    string
+	operator string
+	now      func() time.Time
+}
+
+// openAuditLog は、監査ログのファイルを追記専用で開きます
+func openAuditLog(path, runID, operator string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{file: f, runID: runID, operator: operator, now: time.Now}, nil
+}
+
+// record は、1回の変更操作の結果を追記します。書き込みに失敗しても適用は止めず、警告のみとします
+func (a *auditLog) record(endpoint, action, target string, opErr error) {
+	rec := auditRecord{
+		Time:     a.now().Format(time.RFC3339Nano),
+		RunID:    a.runID,
+		Operator: a.operator,
+		Endpoint: endpoint,
+		Action:   action,
+		Target:   target,
+		Outcome:  "success",
+	}
+	if opErr != nil {
+		rec.Outcome, rec.Error = "failure", opErr.Error()
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		warnf("監査ログのレコードの作成に失敗: %v", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		warnf("監査ログへの書き込みに失敗: %v", err)
+		return
+	}
+	if err := a.file.Sync(); err != nil {
+		warnf("監査ログの同期に失敗: %v", err)
+	}
+}
+
+// Close は監査ログのファイルを閉じます
+func (a *auditLog) Close() error {
+	return a.file.Close()
+}
+
+// auditingClient は、変更を伴う操作を監査ログに記録する haproxyClient です。
+// 参照のみの操作は元のクライアントをそのまま呼び出します
+type auditingClient struct {
+	haproxyClient
+	audit    *auditLog
+	endpoint string
+}
+
+// auditingFieldClient は、包んだクライアントが serverFieldUpdater を実装する場合の auditingClient です。
+// 項目ごとの変更も1項目につき1レコードとして記録します（実装しないクライアントでは定義全体の更新のままにします）
+type auditingFieldClient struct {
+	*auditingClient
+	updater serverFieldUpdater
+}
+
+// withAudit は、audit が nil でなければ変更操作を記録するクライアントで client を包みます
+func withAudit(client haproxyClient, audit *auditLog, endpoint string) haproxyClient {
+	if audit == nil {
+		return client
+	}
+	c := &auditingClient{haproxyClient: client, audit: audit, endpoint: endpoint}
+	if updater, ok := client.(serverFieldUpdater); ok {
+		return &auditingFieldClient{auditingClient: c, updater: updater}
+	}
+	return c
+}
+
+// fillUnreadServerFields は、包んだクライアントが partialServerReader であれば、その補い方で項目を補います
+func (c *auditingClient) fillUnreadServerFields(cur, desired haproxy.Server) haproxy.Server {
+	if p, ok := c.haproxyClient.(partialServerReader); ok {
+		return p.fillUnreadServerFields(cur, desired)
+	}
+	return cur
+}
+
+func (c *auditingClient) log(action, target string, err error) error {
+	c.audit.record(c.endpoint, action, target, err)
+	return err
+}
+
+func (c *auditingClient) AddServer(server *haproxy.Server) error {
+	return c.log("add-server", serverKey(server.Backend, server.Name), c.haproxyClient.AddServer(server))
+}
+
+func (c *auditingClient) UpdateServer(server *haproxy.Server) error {
+	return c.log("update-server", serverKey(server.Backend, server.Name), c.haproxyClient.UpdateServer(server))
+}
+
+func (c *auditingClient) RenameServer(name string, server *haproxy.Server) error {
+	return c.log("rename-server", fmt.Sprintf("%s -> %s", serverKey(server.Backend, name), server.Name), c.haproxyClient.RenameServer(name, server))
+}
+
+func (c *auditingClient) RemoveServer(server *haproxy.Server) error {
+	return c.log("remove-server", serverKey(server.Backend, server.Name), c.haproxyClient.RemoveServer(server))
+}
+
+func (c *auditingClient) DrainServer(backend, name string) error {
+	return c.log("drain-server", serverKey(backend, name), c.haproxyClient.DrainServer(backend, name))
+}
+
+func (c *auditingFieldClient) SetWeight(backend, name string, weight int64) error {
+	return c.log("set-weight", fmt.Sprintf("%s: weight=%d", serverKey(backend, name), weight), c.updater.SetWeight(backend, name, weight))
+}
+
+func (c *auditingFieldClient) SetMaxconn(backend, name string, maxconn int64) error {
+	return c.log("set-maxconn", fmt.Sprintf("%s: maxconn=%d", serverKey(backend, name), maxconn), c.updater.SetMaxconn(backend, name, maxconn))
+}
+
+func (c *auditingFieldClient) SetHealthCheck(backend, name string, enabled bool) error {
+	return c.log("set-health-check", fmt.Sprintf("%s: check=%v", serverKey(backend, name), enabled), c.updater.SetHealthCheck(backend, name, enabled))
+}
+
+func (c *auditingClient) AddServerTemplate(template *haproxy.ServerTemplate) error {
+	return c.log("add-server-template", serverKey(template.Backend, template.Prefix), c.haproxyClient.AddServerTemplate(template))
+}
+
+func (c *auditingClient) UpdateServerTemplate(template *haproxy.ServerTemplate) error {
+	return c.log("update-server-template", serverKey(template.Backend, template.Prefix), c.haproxyClient.UpdateServerTemplate(template))
+}
+
+func (c *auditingClient) SetLoadBalancingAlgorithm(algorithm string) error {
+	return c.log("set-algorithm", algorithm, c.haproxyClient.SetLoadBalancingAlgorithm(algorithm))
+}
+
+func (c *auditingClient) SetConfig(key, value string) error {
+	return c.log("set-config", fmt.Sprintf("%s=%s", key, value), c.haproxyClient.SetConfig(key, value))
+}
+
+func (c *auditingClient) SetBackendConfig(backend, key, value string) error {
+	return c.log("set-backend-config", fmt.Sprintf("%s: %s=%s", backend, key, value), c.haproxyClient.SetBackendConfig(backend, key, value))
+}
+
+func (c *auditingClient) SetFrontendConfig(frontend, key, value string) error {
+	return c.log("set-frontend-config", fmt.Sprintf("%s: %s=%s", frontend, key, value), c.haproxyClient.SetFrontendConfig(frontend, key, value))
+}
+
+func (c *auditingClient) DeleteBackend(name string) error {
+	return c.log("delete-backend", name, c.haproxyClient.DeleteBackend(name))
+}
+
+func (c *auditingClient) AddResolver(resolver *haproxy.Resolver) error {
+	return c.log("add-resolver", resolver.Name, c.haproxyClient.AddResolver(resolver))
+}
+
+func (c *auditingClient) UpdateResolver(resolver *haproxy.Resolver) error {
+	return c.log("update-resolver", resolver.Name, c.haproxyClient.UpdateResolver(resolver))
+}
+
+func (c *auditingClient) AddMailers(mailers *haproxy.MailersSection) error {
+	return c.log("add-mailers", mailers.Name, c.haproxyClient.AddMailers(mailers))
+}
+
+func (c *auditingClient) UpdateMailers(mailers *haproxy.MailersSection) error {
+	return c.log("update-mailers", mailers.Name, c.haproxyClient.UpdateMailers(mailers))
+}
+
+func (c *auditingClient) AddCache(cache *haproxy.Cache) error {
+	return c.log("add-cache", cache.Name, c.haproxyClient.AddCache(cache))
+}
+
+func (c *auditingClient) UpdateCache(cache *haproxy.Cache) error {
+	return c.log("update-cache", cache.Name, c.haproxyClient.UpdateCache(cache))
+}
+
+func (c *auditingClient) AddPeers(peers *haproxy.PeerSection) error {
+	return c.log("add-peers", peers.Name, c.haproxyClient.AddPeers(peers))
+}
+
+func (c *auditingClient) UpdatePeers(peers *haproxy.PeerSection) error {
+	return c.log("update-peers", peers.Name, c.haproxyClient.UpdatePeers(peers))
+}
+
+func (c *auditingClient) ReplaceHTTPRules(parentType, parentName, direction string, rules []haproxy.HTTPRule) error {
+	return c.log("replace-http-rules", fmt.Sprintf("%s %s %s（%d 件）", parentType, parentName, direction, len(rules)),
+		c.haproxyClient.ReplaceHTTPRules(parentType, parentName, direction, rules))
+}
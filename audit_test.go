@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// readAuditRecords は、監査ログの全てのレコードを読み込みます
+func readAuditRecords(t *testing.T, path string) []auditRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []auditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("監査ログの行を解析できません: %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestAuditLogRecordsEachMutation(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://audit"],
+		"load_balancing_algorithm": "leastconn",
+		"retry_policy": {"retries": 3, "redispatch": true},
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	endpoint, fake := testMemoryEndpoint(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	apply := func() {
+		audit, err := openAuditLog(path, "run-1", "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer audit.Close()
+		if _, err := applyConfig(withAudit(fake, audit, endpoint), config, applyOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	apply()
+	records := readAuditRecords(t, path)
+	var actions []string
+	for _, r := range records {
+		actions = append(actions, r.Action+" "+r.Target)
+	}
+	want := []string{"add-server web/web-1", "add-server web/web-2", "set-algorithm leastconn", "set-config retries=3", "set-config option redispatch=on"}
+	if len(actions) != len(want) {
+		t.Fatalf("監査ログのレコード = %v, want %v", actions, want)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Errorf("records[%d] = %s, want %s", i, actions[i], want[i])
+		}
+	}
+	if r := records[0]; r.RunID != "run-1" || r.Operator != "alice" || r.Endpoint != endpoint || r.Outcome != "success" || r.Time == "" {
+		t.Errorf("records[0] = %+v, want 実行ID・操作者・エンドポイントと success", r)
+	}
+
+	// 変更のない再適用では、常に設定するアルゴリズムの1件のみ追記されること
+	apply()
+	if got := len(readAuditRecords(t, path)); got != len(want)+1 {
+		t.Errorf("再適用後のレコード数 = %d, want %d（追記のみ）", got, len(want)+1)
+	}
+}
+
+func TestAuditLogRecordsFailure(t *testing.T) {
+	captureOutput(t)
+	endpoint, fake := testMemoryEndpoint(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := openAuditLog(path, "run-2", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+
+	if err := withAudit(fake, audit, endpoint).RemoveServer(&haproxy.Server{Backend: "web", Name: "web-9"}); err == nil {
+		t.Fatal("存在しないサーバーの削除がエラーになりませんでした")
+	}
+	records := readAuditRecords(t, path)
+	if len(records) != 1 || records[0].Action != "remove-server" || records[0].Outcome != "failure" || records[0].Error == "" {
+		t.Errorf("監査ログのレコード = %+v, want remove-server の failure とエラー内容", records)
+	}
+}
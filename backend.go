@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// 有効な stick-table のキーの型
+var stickTableTypes = map[string]bool{
+	"ip":      true,
+	"ipv6":    true,
+	"integer": true,
+	"string":  true,
+	"binary":  true,
+}
+
+var (
+	// haproxySizePattern は HAProxy のサイズ表記（数値と任意の k/m/g 接尾辞）です
+	haproxySizePattern = regexp.MustCompile(`^[1-9][0-9]*[kmg]?$`)
+	// haproxyTimePattern は HAProxy の時間表記（数値と任意の単位）です
+	haproxyTimePattern = regexp.MustCompile(`^[0-9]+(us|ms|s|m|h|d)?$`)
+	// sampleExprPattern はサンプル取得式（src, hdr(host), req.cook(sid),lower など）です
+	sampleExprPattern = regexp.MustCompile(`^[a-z][a-z0-9_.]*(\([^()\s]*\))?(,[a-z][a-z0-9_.]*(\([^()\s]*\))?)*$`)
+)
+
+// applyGroupSettings は、グループ（HAProxyのバックエンド）単位の設定を反映します
+func applyGroupSettings(client haproxyClient, config *Config) error {
+	groups, err := orderGroups(config)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if err := applyBackendMode(client, config, group); err != nil {
+			return err
+		}
+		if err := applyBackendTuning(client, config, group); err != nil {
+			return err
+		}
+	}
+	for _, g := range config.Groups {
+		if g.Stick != nil && !g.absent() {
+			if err := applyStickTable(client, g.Name, g.Stick); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findGroup は、名前に一致するグループ設定を返します。groups に定義されていなければ nil を返します
+func findGroup(config *Config, name string) *GroupConfig {
+	for i := range config.Groups {
+		if config.Groups[i].Name == name {
+			return &config.Groups[i]
+		}
+	}
+	return nil
+}
+
+// stickTableValue は、stick-table 行の値（"type ip size 200k expire 30m" など）を返します
+func stickTableValue(st *StickConfig) string {
+	table := fmt.Sprintf("type %s size %s", st.Type, st.Size)
+	if st.Expire != "" {
+		table += " expire " + st.Expire
+	}
+	if st.Peers != "" {
+		table += " peers " + st.Peers
+	}
+	return table
+}
+
+// applyStickTable は、バックエンドに stick-table と stick on を設定します
+func applyStickTable(client haproxyClient, backend string, st *StickConfig) error {
+	table := stickTableValue(st)
+	if err := client.SetBackendConfig(backend, "stick-table", table); err != nil {
+		return fmt.Errorf("バックエンド[%s]の stick-table の設定失敗: %w", backend, err)
+	}
+	if err := client.SetBackendConfig(backend, "stick on", st.On); err != nil {
+		return fmt.Errorf("バックエンド[%s]の stick on の設定失敗: %w", backend, err)
+	}
+	logf("バックエンド[%s]に stick-table を設定しました: %s, stick on %s\n", backend, table, st.On)
+	return nil
+}
+
+// validate は、stick-table 設定の値を検証します
+func (st *StickConfig) validate() error {
+	if !stickTableTypes[st.Type] {
+		return fmt.Errorf("type[%s]は未対応です（ip, ipv6, integer, string, binary のいずれか）", st.Type)
+	}
+	if !haproxySizePattern.MatchString(st.Size) {
+		return fmt.Errorf("size[%s]が不正です（例: 200k）", st.Size)
+	}
+	if st.Expire != "" && !haproxyTimePattern.MatchString(st.Expire) {
+		return fmt.Errorf("expire[%s]が不正です（例: 30m）", st.Expire)
+	}
+	if st.On == "" {
+		return errors.New("on が指定されていません")
+	}
+	if !sampleExprPattern.MatchString(st.On) {
+		return fmt.Errorf("on[%s]は不正なサンプル取得式です（例: src, hdr(host)）", st.On)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestApplyGroupSettingsSetsStickTable(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://stick"],
+		"load_balancing_algorithm": "roundrobin",
+		"groups": [{"name": "web", "stick": {"type": "ip", "size": "200k", "expire": "30m", "on": "src"}}],
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"}]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if err := applyGroupSettings(fake, config); err != nil {
+		t.Fatalf("applyGroupSettings がエラーを返しました: %v", err)
+	}
+	if got := fake.BackendConfig("web", "stick-table"); got != "type ip size 200k expire 30m" {
+		t.Errorf("stick-table = %q, want type ip size 200k expire 30m", got)
+	}
+	if got := fake.BackendConfig("web", "stick on"); got != "src" {
+		t.Errorf("stick on = %q, want src", got)
+	}
+}
+
+func TestStickConfigValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		stick StickConfig
+		valid bool
+	}{
+		{"有効な設定", StickConfig{Type: "string", Size: "1m", On: "req.cook(sid),lower"}, true},
+		{"未対応の type", StickConfig{Type: "uuid", Size: "200k", On: "src"}, false},
+		{"不正な size", StickConfig{Type: "ip", Size: "0", On: "src"}, false},
+		{"不正な expire", StickConfig{Type: "ip", Size: "200k", Expire: "30 min", On: "src"}, false},
+		{"on の指定なし", StickConfig{Type: "ip", Size: "200k"}, false},
+		{"不正なサンプル取得式", StickConfig{Type: "ip", Size: "200k", On: "src; hdr(host)"}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.stick.validate()
+			if (err == nil) != tt.valid {
+				t.Errorf("validate() = %v, want 有効 %v", err, tt.valid)
+			}
+		})
+	}
+}
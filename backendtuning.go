@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// retryOnKeywords は、retry-on に指定できるキーワードです。
+// HAProxy のドキュメントの retry-on の一覧に基づきます（HTTPステータスはリトライ可能なもののみ）
+var retryOnKeywords = map[string]bool{
+	"none":                 true,
+	"conn-failure":         true,
+	"empty-response":       true,
+	"junk-response":        true,
+	"response-timeout":     true,
+	"0rtt-rejected":        true,
+	"all-retryable-errors": true,
+	"401":                  true,
+	"403":                  true,
+	"404":                  true,
+	"408":                  true,
+	"425":                  true,
+	"500":                  true,
+	"501":                  true,
+	"502":                  true,
+	"503":                  true,
+	"504":                  true,
+}
+
+// httpReuseModes は、http-reuse に指定できる値です
+var httpReuseModes = map[string]bool{
+	"never":      true,
+	"safe":       true,
+	"aggressive": true,
+	"always":     true,
+}
+
+// websocket: true を指定した場合の推奨設定です。
+// 接続を長時間維持するため、バックエンドの接続を他のリクエストで再利用せず（http-reuse never）、
+// アップグレード後の無通信のタイムアウト（timeout tunnel）を長くします。
+// また TLS で接続するサーバーでは、HTTP/1.1 の Upgrade を使うため ALPN を http/1.1 とします（h2 をネゴシエーションさせません）
+const (
+	websocketHTTPReuse     = "never"
+	websocketTunnelTimeout = "1h"
+	websocketALPN          = "http/1.1"
+)
+
+// backendTuning は、グループ（HAProxyのバックエンド）に設定する retry-on, fullconn, http-reuse, timeout tunnel です。
+// 空・0 の項目は未指定で、バックエンドには設定しません
+type backendTuning struct {
+	retryOn       string
+	fullconn      int
+	httpReuse     string
+	tunnelTimeout string
+}
+
+// websocketTuning は、サーバーの websocket の指定と個別の指定から、バックエンドに設定する http-reuse と timeout tunnel を返します。
+// http_reuse / tunnel_timeout を指定した場合は websocket の推奨設定より優先します
+func websocketTuning(b BackendConfig) (httpReuse, tunnelTimeout string) {
+	httpReuse, tunnelTimeout = b.HTTPReuse, b.TunnelTimeout
+	if b.Websocket {
+		if httpReuse == "" {
+			httpReuse = websocketHTTPReuse
+		}
+		if tunnelTimeout == "" {
+			tunnelTimeout = websocketTunnelTimeout
+		}
+	}
+	return httpReuse, tunnelTimeout
+}
+
+// applyWebsocketServerDefaults は、websocket: true のサーバーのうち TLS で接続し alpn / npn を指定していないサーバーの
+// ALPN を http/1.1 にした設定を返します（alpn を指定した場合はその値が優先されます）
+func applyWebsocketServerDefaults(backend BackendConfig) BackendConfig {
+	if backend.Websocket && backend.SSL && len(backend.ALPN) == 0 && len(backend.NPN) == 0 {
+		backend.ALPN = []string{websocketALPN}
+	}
+	return backend
+}
+
+// validateRetryOn は、retry-on のキーワードが既知のものか、none が単独で指定されているかを検証します
+func validateRetryOn(tokens []string) error {
+	seen := map[string]bool{}
+	for _, token := range tokens {
+		if !retryOnKeywords[token] {
+			return fmt.Errorf("retry_on のキーワード[%s]は未知のキーワードです（例: conn-failure, 503, all-retryable-errors）", token)
+		}
+		if seen[token] {
+			return fmt.Errorf("retry_on のキーワード[%s]が重複しています", token)
+		}
+		seen[token] = true
+	}
+	if seen["none"] && len(tokens) > 1 {
+		return errors.New("retry_on の none は他のキーワードと同時に指定できません")
+	}
+	return nil
+}
+
+// withGroupHTTPReuse は、http_reuse を指定していないサーバーにグループの http_reuse を補った設定を返します
+// （グループの指定は websocket の推奨設定より優先します）
+func withGroupHTTPReuse(config *Config, b BackendConfig) BackendConfig {
+	if b.HTTPReuse == "" {
+		if g := findGroup(config, b.Group); g != nil {
+			b.HTTPReuse = g.HTTPReuse
+		}
+	}
+	return b
+}
+
+// groupBackendTunings は、retry_on / fullconn / http_reuse / tunnel_timeout（websocket を含む）を指定したグループ名と
+// その設定の対応を返します。いずれもバックエンド単位の設定のため、同じグループのサーバーに異なる値が指定されている場合はエラーを返します
+func groupBackendTunings(config *Config) (map[string]backendTuning, error) {
+	tunings := map[string]backendTuning{}
+	for _, b := range config.Backends {
+		httpReuse, tunnelTimeout := websocketTuning(withGroupHTTPReuse(config, b))
+		if len(b.RetryOn) == 0 && b.Fullconn == 0 && httpReuse == "" && tunnelTimeout == "" {
+			continue
+		}
+		t := tunings[b.Group]
+		if len(b.RetryOn) > 0 {
+			retryOn := strings.Join(b.RetryOn, " ")
+			if t.retryOn != "" && t.retryOn != retryOn {
+				return nil, fmt.Errorf("グループ[%s]に異なる retry_on（%s, %s）が指定されています", b.Group, t.retryOn, retryOn)
+			}
+			t.retryOn = retryOn
+		}
+		if b.Fullconn != 0 {
+			if t.fullconn != 0 && t.fullconn != b.Fullconn {
+				return nil, fmt.Errorf("グループ[%s]に異なる fullconn（%d, %d）が指定されています", b.Group, t.fullconn, b.Fullconn)
+			}
+			t.fullconn = b.Fullconn
+		}
+		for _, v := range []struct {
+			name  string
+			cur   *string
+			value string
+		}{
+			{"http_reuse", &t.httpReuse, httpReuse},
+			{"tunnel_timeout", &t.tunnelTimeout, tunnelTimeout},
+		} {
+			if v.value == "" {
+				continue
+			}
+			if *v.cur != "" && *v.cur != v.value {
+				return nil, fmt.Errorf("グループ[%s]に異なる %s（%s, %s）が指定されています（websocket の推奨設定を含む）", b.Group, v.name, *v.cur, v.value)
+			}
+			*v.cur = v.value
+		}
+		tunings[b.Group] = t
+	}
+	return tunings, nil
+}
+
+// validateBackendTunings は、グループの http_reuse と、バックエンドごとの retry_on のキーワード、fullconn, http_reuse, tunnel_timeout の値と、
+// websocket を指定したサーバーのグループのモードを検証します
+func (c *Config) validateBackendTunings() error {
+	for _, g := range c.Groups {
+		if g.HTTPReuse != "" && !httpReuseModes[g.HTTPReuse] {
+			return fmt.Errorf("グループ[%s]: http_reuse[%s]は未対応です（never, safe, aggressive, always のいずれか）", g.Name, g.HTTPReuse)
+		}
+		if g.HTTPReuse != "" && g.Mode == "tcp" {
+			return fmt.Errorf("グループ[%s]: http_reuse は mode http のバックエンドでのみ指定できます", g.Name)
+		}
+	}
+	for _, b := range c.Backends {
+		if err := validateRetryOn(b.RetryOn); err != nil {
+			return fmt.Errorf("サーバー[%s]: %w", b.Name, err)
+		}
+		if b.Fullconn < 0 {
+			return fmt.Errorf("サーバー[%s]: fullconn は 1 以上の整数で指定してください（指定値: %d）", b.Name, b.Fullconn)
+		}
+		if b.HTTPReuse != "" && !httpReuseModes[b.HTTPReuse] {
+			return fmt.Errorf("サーバー[%s]: http_reuse[%s]は未対応です（never, safe, aggressive, always のいずれか）", b.Name, b.HTTPReuse)
+		}
+		if g := findGroup(c, b.Group); g != nil && g.HTTPReuse != "" && b.HTTPReuse != "" && b.HTTPReuse != g.HTTPReuse {
+			return fmt.Errorf("サーバー[%s]: http_reuse[%s]がグループ[%s]の http_reuse[%s]と異なります", b.Name, b.HTTPReuse, g.Name, g.HTTPReuse)
+		}
+		if b.TunnelTimeout != "" && !haproxyTimePattern.MatchString(b.TunnelTimeout) {
+			return fmt.Errorf("サーバー[%s]: tunnel_timeout[%s]が不正です（例: 1h）", b.Name, b.TunnelTimeout)
+		}
+		if b.Websocket {
+			if g := findGroup(c, b.Group); g != nil && g.Mode == "tcp" {
+				return fmt.Errorf("サーバー[%s]: websocket は mode http のバックエンドでのみ指定できます（グループ[%s]は mode tcp です）", b.Name, b.Group)
+			}
+		}
+	}
+	_, err := groupBackendTunings(c)
+	return err
+}
+
+// backendTuningDirectives は、設定する項目のキーと値の組を返します（指定のない項目は含みません）
+func backendTuningDirectives(t backendTuning) [][2]string {
+	var directives [][2]string
+	if t.retryOn != "" {
+		directives = append(directives, [2]string{"retry-on", t.retryOn})
+	}
+	if t.fullconn > 0 {
+		directives = append(directives, [2]string{"fullconn", fmt.Sprint(t.fullconn)})
+	}
+	if t.httpReuse != "" {
+		directives = append(directives, [2]string{"http-reuse", t.httpReuse})
+	}
+	if t.tunnelTimeout != "" {
+		directives = append(directives, [2]string{"timeout tunnel", t.tunnelTimeout})
+	}
+	return directives
+}
+
+// applyBackendTuning は、retry_on などを指定したグループのバックエンドに retry-on, fullconn, http-reuse, timeout tunnel を設定します
+func applyBackendTuning(client haproxyClient, config *Config, group backendGroup) error {
+	tunings, err := groupBackendTunings(config)
+	if err != nil {
+		return err
+	}
+	for _, d := range backendTuningDirectives(tunings[group.name]) {
+		if err := client.SetBackendConfig(group.name, d[0], d[1]); err != nil {
+			return fmt.Errorf("バックエンド[%s]の %s の設定失敗: %w", group.name, d[0], err)
+		}
+		logf("バックエンド[%s]に %s %s を設定しました\n", group.name, d[0], d[1])
+	}
+	return nil
+}
+
+// describeBackendTuning は、applyBackendTuning が行う設定を dry-run 用に説明します
+func describeBackendTuning(config *Config, group backendGroup) string {
+	tunings, _ := groupBackendTunings(config)
+	directives := backendTuningDirectives(tunings[group.name])
+	if len(directives) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(directives))
+	for _, d := range directives {
+		parts = append(parts, d[0]+" "+d[1])
+	}
+	return fmt.Sprintf("バックエンド[%s]: %s", group.name, strings.Join(parts, ", "))
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyBackendRetryOnAndFullconn(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://tuning"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "api-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "api", "retry_on": ["conn-failure", "503"], "fullconn": 1000},
+			{"name": "api-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "api"},
+			{"name": "web-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "web", "fullconn": 200},
+			{"name": "db-1", "ip": "10.0.2.1", "port": 5432, "weight": 10, "group": "db"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, config, applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	for _, tt := range []struct{ backend, retryOn, fullconn string }{
+		{"api", "conn-failure 503", "1000"},
+		{"web", "", "200"},
+		{"db", "", ""},
+	} {
+		if got := fake.BackendConfig(tt.backend, "retry-on"); got != tt.retryOn {
+			t.Errorf("%s の retry-on = %q, want %q", tt.backend, got, tt.retryOn)
+		}
+		if got := fake.BackendConfig(tt.backend, "fullconn"); got != tt.fullconn {
+			t.Errorf("%s の fullconn = %q, want %q（指定した項目のみ設定すること）", tt.backend, got, tt.fullconn)
+		}
+	}
+}
+
+func TestValidateRetryOn(t *testing.T) {
+	for _, tt := range []struct {
+		tokens []string
+		valid  bool
+	}{
+		{[]string{"conn-failure", "empty-response", "503"}, true},
+		{[]string{"all-retryable-errors"}, true},
+		{[]string{"none"}, true},
+		{[]string{"conn-fail"}, false},
+		{[]string{"200"}, false},
+		{[]string{"503", "503"}, false},
+		{[]string{"none", "503"}, false},
+	} {
+		if err := validateRetryOn(tt.tokens); (err == nil) != tt.valid {
+			t.Errorf("validateRetryOn(%v) = %v, want 有効 %v", tt.tokens, err, tt.valid)
+		}
+	}
+}
+
+func TestBackendTuningConflictsAreRejected(t *testing.T) {
+	for name, backends := range map[string]string{
+		"負の fullconn": `{"name": "api-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "api", "fullconn": -1}`,
+		"異なる retry_on": `{"name": "api-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "api", "retry_on": ["503"]},
+			{"name": "api-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "api", "retry_on": ["504"]}`,
+		"異なる fullconn": `{"name": "api-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "api", "fullconn": 100},
+			{"name": "api-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "api", "fullconn": 200}`,
+	} {
+		err := validateTestConfig(t, `{
+			"haproxy_endpoint": ["memory://tuning"],
+			"load_balancing_algorithm": "roundrobin",
+			"backends": [`+backends+`]
+		}`)
+		if err == nil {
+			t.Errorf("%s の検証がエラーになりませんでした", name)
+		}
+	}
+}
+
+func TestApplyWebsocketBundle(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://websocket"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "ws-1", "ip": "10.0.0.1", "port": 443, "weight": 10, "group": "ws", "websocket": true, "ssl": true},
+			{"name": "ws-2", "ip": "10.0.0.2", "port": 443, "weight": 10, "group": "ws", "websocket": true, "ssl": true, "alpn": ["h2", "http/1.1"]},
+			{"name": "chat-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "chat", "websocket": true, "http_reuse": "safe", "tunnel_timeout": "10m"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, config, applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	for _, tt := range []struct{ backend, httpReuse, tunnelTimeout string }{
+		{"ws", websocketHTTPReuse, websocketTunnelTimeout},
+		{"chat", "safe", "10m"},
+	} {
+		if got := fake.BackendConfig(tt.backend, "http-reuse"); got != tt.httpReuse {
+			t.Errorf("%s の http-reuse = %q, want %q", tt.backend, got, tt.httpReuse)
+		}
+		if got := fake.BackendConfig(tt.backend, "timeout tunnel"); got != tt.tunnelTimeout {
+			t.Errorf("%s の timeout tunnel = %q, want %q（個別の指定が推奨設定より優先されること）", tt.backend, got, tt.tunnelTimeout)
+		}
+	}
+
+	alpn := map[string]string{}
+	servers, _ := fake.GetServers()
+	for _, s := range servers {
+		alpn[s.Name] = s.Alpn
+	}
+	for name, want := range map[string]string{"ws-1": websocketALPN, "ws-2": "h2,http/1.1", "chat-1": ""} {
+		if alpn[name] != want {
+			t.Errorf("%s の alpn = %q, want %q（TLS で alpn の指定がないサーバーのみ http/1.1 とすること）", name, alpn[name], want)
+		}
+	}
+}
+
+func TestWebsocketRequiresHTTPMode(t *testing.T) {
+	err := validateTestConfig(t, `{
+		"haproxy_endpoint": ["memory://websocket"],
+		"load_balancing_algorithm": "roundrobin",
+		"groups": [{"name": "ws", "mode": "tcp"}],
+		"backends": [{"name": "ws-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "ws", "websocket": true}]
+	}`)
+	if err == nil || !strings.Contains(err.Error(), "websocket") {
+		t.Errorf("mode tcp のグループでの websocket の検証のエラー = %v, want websocket に関するエラー", err)
+	}
+}
+
+func TestApplyGroupHTTPReuse(t *testing.T) {
+	for _, mode := range []string{"never", "safe", "aggressive", "always"} {
+		t.Run(mode, func(t *testing.T) {
+			captureOutput(t)
+			config := loadTestConfig(t, `{
+				"haproxy_endpoint": ["memory://http-reuse"],
+				"load_balancing_algorithm": "roundrobin",
+				"groups": [{"name": "web", "http_reuse": "`+mode+`"}],
+				"backends": [
+					{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web", "websocket": true},
+					{"name": "api-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "api"}
+				]
+			}`)
+			_, fake := testMemoryEndpoint(t)
+			if _, err := applyConfig(fake, config, applyOptions{}); err != nil {
+				t.Fatalf("applyConfig がエラーを返しました: %v", err)
+			}
+			if got := fake.BackendConfig("web", "http-reuse"); got != mode {
+				t.Errorf("web の http-reuse = %q, want %q（グループの指定が websocket の推奨設定より優先されること）", got, mode)
+			}
+			if got := fake.BackendConfig("api", "http-reuse"); got != "" {
+				t.Errorf("api の http-reuse = %q, want 未設定（HAProxy の既定のまま）", got)
+			}
+		})
+	}
+}
+
+func TestValidateGroupHTTPReuse(t *testing.T) {
+	for _, tt := range []struct{ name, groups, backend string }{
+		{"未対応の値", `[{"name": "web", "http_reuse": "sometimes"}]`, `"group": "web"`},
+		{"mode tcp", `[{"name": "web", "mode": "tcp", "http_reuse": "safe"}]`, `"group": "web"`},
+		{"サーバーの指定と異なる", `[{"name": "web", "http_reuse": "safe"}]`, `"group": "web", "http_reuse": "always"`},
+	} {
+		err := validateTestConfig(t, `{
+			"haproxy_endpoint": ["memory://http-reuse"],
+			"load_balancing_algorithm": "roundrobin",
+			"groups": `+tt.groups+`,
+			"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, `+tt.backend+`}]
+		}`)
+		if err == nil || !strings.Contains(err.Error(), "http_reuse") {
+			t.Errorf("%s の検証のエラー = %v, want http_reuse に関するエラー", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// maxServerBatch は、1回の一括追加で送るサーバー数の上限です
+const maxServerBatch = 1000
+
+// batchServerAdder は、複数のサーバーを1回のAPI呼び出しで追加できるクライアントです。
+// 空のHAProxyに数千台を追加する場合など、サーバーごとの呼び出しを避けて高速に追加するために使います。
+// Data Plane API のクライアントは raw 設定の1回の取得と送信（1回の再読み込み）で追加します。
+// runtime socket は再読み込みを伴わず、追加したサーバーごとに有効化も必要なため実装していません。
+// 監査ログのクライアント（-audit-log）はサーバーごとに記録するため実装していません
+type batchServerAdder interface {
+	AddServers(servers []haproxy.Server) error
+}
+
+// batchRun は、適用順に並べたサーバーの区切りです。servers がある場合は一括追加するサーバーの並びで、
+// servers は backends と同じ順のサーバー定義です（1回だけ組み立て、一括追加ではそのまま送ります）
+type batchRun struct {
+	backends []BackendConfig
+	servers  []haproxy.Server
+}
+
+// splitBatchRuns は、バックエンドを適用順のまま、新規に追加するサーバー（server-template を除く）が連続する区切りと
+// それ以外のサーバーの区切りに分けます。batch が false の場合（一括追加に未対応のクライアント）は全体を1つの区切りとします
+func splitBatchRuns(config *Config, state *liveState, backends []BackendConfig, batch bool) []batchRun {
+	if !batch {
+		return []batchRun{{backends: backends}}
+	}
+	var runs []batchRun
+	for _, backend := range backends {
+		var server *haproxy.Server
+		if backend.SRV == "" && validateBackend(backend) == nil {
+			s := buildServer(config, backend)
+			if decideServer(state, s).action == actionAdd {
+				server = &s
+			}
+		}
+		adding := server != nil
+		if n := len(runs); n == 0 || (len(runs[n-1].servers) > 0) != adding {
+			runs = append(runs, batchRun{})
+		}
+		run := &runs[len(runs)-1]
+		run.backends = append(run.backends, backend)
+		if adding {
+			run.servers = append(run.servers, *server)
+		}
+	}
+	return runs
+}
+
+// addServersInBatches は、サーバーを maxServerBatch 台ずつ一括で追加し、サーバーごとの結果を返します。
+// 一括追加が失敗した場合は、その回に送ったサーバーをすべて失敗として扱い、サーバーごとにエラーを出力します
+func addServersInBatches(ctx context.Context, client batchServerAdder, backends []BackendConfig, servers []haproxy.Server, retries int) []BackendResult {
+	results := make([]BackendResult, 0, len(servers))
+	for start := 0; start < len(servers); start += maxServerBatch {
+		end := start + maxServerBatch
+		if end > len(servers) {
+			end = len(servers)
+		}
+		batch := servers[start:end]
+
+		err := addServerBatchWithRetry(ctx, client, batch, retries)
+		for i, server := range batch {
+			backend := backends[start+i]
+			if err != nil {
+				reportError(errorCategoryServer, backend.Name, fmt.Sprintf("サーバー%sの一括追加に最終的に失敗", backendLabel(backend)), err)
+				results = append(results, newBackendResultFor(backend, StatusFailedAPI, err))
+				continue
+			}
+			emitServerChanges(changeStageApplied, actionAdd, nil, server)
+			results = append(results, newBackendResultFor(backend, StatusAdded, nil))
+		}
+	}
+	return results
+}
+
+// addServerBatchWithRetry は、サーバーの一括追加を指定回数リトライします。
+// タイムアウト後は、送ったサーバーがすべて存在するかを確認してから再送します
+func addServerBatchWithRetry(ctx context.Context, client batchServerAdder, servers []haproxy.Server, retries int) error {
+	defer profileOp(fmt.Sprintf("add-batch %d 台", len(servers)))()
+	op := clientOperation{
+		subject: fmt.Sprintf("サーバー %d 台", len(servers)),
+		verb:    "一括追加",
+		run:     func() error { return client.AddServers(servers) },
+	}
+	if c, ok := client.(haproxyClient); ok {
+		op.applied = serverAddedCheck(c, servers...)
+	}
+	return runWithRetry(ctx, op, retries)
+}
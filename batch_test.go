@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// perServerClient は、一括追加（AddServers）を隠し、サーバーを1台ずつ追加させるクライアントです
+type perServerClient struct {
+	haproxyClient
+}
+
+// orderRecordingClient は、サーバーの追加・更新の呼び出し順を記録するクライアントです
+type orderRecordingClient struct {
+	*haproxyfake.HAProxy
+	calls    []string
+	batchErr error // AddServers が返すエラー（nil の場合は追加します）
+}
+
+func (c *orderRecordingClient) AddServer(server *haproxy.Server) error {
+	c.calls = append(c.calls, "add:"+server.Name)
+	return c.HAProxy.AddServer(server)
+}
+
+func (c *orderRecordingClient) AddServers(servers []haproxy.Server) error {
+	names := make([]string, len(servers))
+	for i, s := range servers {
+		names[i] = s.Name
+	}
+	c.calls = append(c.calls, "add-batch:"+strings.Join(names, "+"))
+	if c.batchErr != nil {
+		return c.batchErr
+	}
+	return c.HAProxy.AddServers(servers)
+}
+
+func (c *orderRecordingClient) UpdateServer(server *haproxy.Server) error {
+	c.calls = append(c.calls, "update:"+server.Name)
+	return c.HAProxy.UpdateServer(server)
+}
+
+func (c *orderRecordingClient) SetWeight(backend, name string, weight int64) error {
+	c.calls = append(c.calls, "update:"+name)
+	return c.HAProxy.SetWeight(backend, name, weight)
+}
+
+// batchTestConfig は、1つのグループに n 台のサーバーを持つ設定を読み込みます
+func batchTestConfig(tb testing.TB, n int) *Config {
+	tb.Helper()
+	backends := make([]string, n)
+	for i := range backends {
+		backends[i] = fmt.Sprintf(`{"name": "web-%d", "ip": "10.0.%d.%d", "port": 80, "weight": 10, "group": "web"}`, i+1, i/250, i%250+1)
+	}
+	path := writeTestFile(tb, "config.json", `{"haproxy_endpoint": ["memory://batch"], "load_balancing_algorithm": "roundrobin", "backends": [`+strings.Join(backends, ",")+`]}`)
+	config, err := loadConfig(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := config.Validate(); err != nil {
+		tb.Fatal(err)
+	}
+	return config
+}
+
+func TestBatchedApplyMatchesPerServerApply(t *testing.T) {
+	captureOutput(t)
+	config := batchTestConfig(t, 25)
+
+	batched, perServer := haproxyfake.New(), haproxyfake.New()
+	batchedResult, err := applyConfig(batched, config, applyOptions{})
+	if err != nil {
+		t.Fatalf("一括追加での applyConfig がエラーを返しました: %v", err)
+	}
+	perServerResult, err := applyConfig(perServerClient{perServer}, config, applyOptions{})
+	if err != nil {
+		t.Fatalf("1台ずつの applyConfig がエラーを返しました: %v", err)
+	}
+
+	got, _ := batched.GetServers()
+	want, _ := perServer.GetServers()
+	if len(got) != 25 || !reflect.DeepEqual(got, want) {
+		t.Errorf("一括追加の結果のサーバー（%d 台）が1台ずつの追加の結果（%d 台）と異なります", len(got), len(want))
+	}
+	if !reflect.DeepEqual(batchedResult.Backends, perServerResult.Backends) {
+		t.Errorf("一括追加の結果 = %+v, want %+v（1台ずつの追加と同じ順序と状態）", batchedResult.Backends, perServerResult.Backends)
+	}
+	if batched.Reloads() >= perServer.Reloads() {
+		t.Errorf("一括追加の再読み込み回数 = %d, want 1台ずつの追加（%d 回）より少ないこと", batched.Reloads(), perServer.Reloads())
+	}
+}
+
+func TestBatchedAddKeepsApplyOrder(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://batch-order"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web", "order": 1},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web", "order": 2},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "group": "web", "order": 3},
+			{"name": "web-4", "ip": "10.0.0.4", "port": 80, "weight": 10, "group": "web", "order": 4}
+		]
+	}`)
+	client := &orderRecordingClient{HAProxy: haproxyfake.New()}
+	// web-1 と web-4 は既存で重みが異なるため更新、web-2 と web-3 は新規に追加します
+	for _, s := range []haproxy.Server{
+		{Backend: "web", Name: "web-1", IP: "10.0.0.1", Port: 80, Weight: 50},
+		{Backend: "web", Name: "web-4", IP: "10.0.0.4", Port: 80, Weight: 50},
+	} {
+		s := s
+		if err := client.HAProxy.AddServer(&s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := applyConfig(client, config, applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	want := []string{"update:web-1", "add-batch:web-2+web-3", "update:web-4"}
+	if !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("適用の順序 = %v, want %v（一括追加も order の順に行うこと）", client.calls, want)
+	}
+}
+
+func TestBatchedAddSplitsIntoChunks(t *testing.T) {
+	captureOutput(t)
+	config := batchTestConfig(t, maxServerBatch+5)
+	client := &orderRecordingClient{HAProxy: haproxyfake.New()}
+	result, err := applyConfig(client, config, applyOptions{})
+	if err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	if len(client.calls) != 2 || strings.Count(client.calls[0], "+") != maxServerBatch-1 || client.calls[1] != "add-batch:web-1001+web-1002+web-1003+web-1004+web-1005" {
+		t.Errorf("一括追加の呼び出し = %d 回, want %d 台と残りの 5 台の2回", len(client.calls), maxServerBatch)
+	}
+	for _, b := range result.Backends {
+		if b.Status != StatusAdded {
+			t.Fatalf("%s の結果 = %s, want %s", b.Name, b.Status, StatusAdded)
+		}
+	}
+}
+
+func TestBatchedAddFailureFailsWholeChunk(t *testing.T) {
+	captureOutput(t)
+	config := batchTestConfig(t, 3)
+	client := &orderRecordingClient{HAProxy: haproxyfake.New(), batchErr: errors.New("一括追加に失敗")}
+	result, _ := applyConfig(client, config, applyOptions{})
+	if len(client.calls) != 3 {
+		t.Errorf("一括追加の呼び出し = %v, want 3回（リトライすること）", client.calls)
+	}
+	if len(result.Backends) != 3 {
+		t.Fatalf("サーバーの結果 = %+v, want 3台", result.Backends)
+	}
+	for _, b := range result.Backends {
+		if b.Status != StatusFailedAPI {
+			t.Errorf("%s の結果 = %s, want %s（送ったサーバーをすべて失敗とすること）", b.Name, b.Status, StatusFailedAPI)
+		}
+	}
+	if servers, _ := client.GetServers(); len(servers) != 0 {
+		t.Errorf("失敗した一括追加の後のサーバー数 = %d, want 0", len(servers))
+	}
+}
+
+// benchmarkApply は、空のインスタンスに 2000 台を適用する時間と、1回の適用あたりの再読み込み回数（reloads/op）を計測します。
+// 実際の HAProxy では再読み込みのたびに設定の検証とプロセスの入れ替えが発生するため、reloads/op が主な比較の対象です
+// benchmarkAddServers は、Data Plane API を模したサーバー（rawConfigAPI）に、空のバックエンドへ 2000 台を追加する時間と
+// 1回の追加あたりの HTTP リクエスト数（requests/op）を計測します。ループバックでも実際に HTTP で送受信するため、
+// サーバーごとのリクエストの往復と JSON の組み立ての費用が ns/op に表れます
+func benchmarkAddServers(b *testing.B, add func(client *dataPlaneClient, backends []BackendConfig, servers []haproxy.Server) error) {
+	captureOutput(b)
+	config := batchTestConfig(b, 2000)
+	backends := config.Backends
+	servers := make([]haproxy.Server, len(backends))
+	for i, backend := range backends {
+		servers[i] = buildServer(config, backend)
+	}
+	api, client := newRawConfigAPI(b, "")
+	requests := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		api.mu.Lock()
+		api.cfg, api.requests = "backend web\n    balance roundrobin\n", 0
+		api.mu.Unlock()
+		if err := add(client, backends, servers); err != nil {
+			b.Fatal(err)
+		}
+		requests += api.requests
+	}
+	b.ReportMetric(float64(requests)/float64(b.N), "requests/op")
+}
+
+// BenchmarkAddServersBatched は、2000 台を maxServerBatch 台ずつ raw 設定の1回の取得と送信で追加します
+func BenchmarkAddServersBatched(b *testing.B) {
+	benchmarkAddServers(b, func(client *dataPlaneClient, backends []BackendConfig, servers []haproxy.Server) error {
+		for _, r := range addServersInBatches(context.Background(), client, backends, servers, 1) {
+			if r.Status != StatusAdded {
+				return fmt.Errorf("%s: %s", r.Name, r.Status)
+			}
+		}
+		return nil
+	})
+}
+
+// BenchmarkAddServersPerRequest は、同じ 2000 台をサーバーごとに1回のリクエストで追加します（BenchmarkAddServersBatched との比較用）
+func BenchmarkAddServersPerRequest(b *testing.B) {
+	benchmarkAddServers(b, func(client *dataPlaneClient, _ []BackendConfig, servers []haproxy.Server) error {
+		for _, s := range servers {
+			body, err := json.Marshal(s)
+			if err != nil {
+				return err
+			}
+			req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(client.Endpoint, "/")+perServerPath+"?backend="+s.Backend, bytes.NewReader(body))
+			if err != nil {
+				return err
+			}
+			if _, err := client.doRaw(req); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errCircuitOpen は、サーキットブレーカーが開いているためインスタンスへの適用を見送った場合のエラーです
+var errCircuitOpen = errors.New("連続して失敗しているため一時的に適用を見送りました")
+
+// breakerState はサーキットブレーカーの状態です
+type breakerState string
+
+const (
+	breakerClosed   breakerState = "closed"    // 通常どおり適用する
+	breakerOpen     breakerState = "open"      // 適用を見送る
+	breakerHalfOpen breakerState = "half-open" // 待機時間経過後、試しに1回だけ適用する
+)
+
+// endpointBreaker は、1つのインスタンスの連続失敗回数と状態です
+type endpointBreaker struct {
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// circuitBreaker は、失敗が続くインスタンスへの適用を一時的に見送るためのインスタンスごとのサーキットブレーカーです。
+// threshold 回連続で失敗すると open になり、cooldown 経過後に half-open として1回だけ適用を試み、
+// 成功すれば closed に、失敗すれば再び open に戻ります。threshold が 0 の場合は常に適用します
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time // 現在時刻（テストで差し替えるため。nil の場合は time.Now）
+
+	mu        sync.Mutex
+	endpoints map[string]*endpointBreaker
+}
+
+// newCircuitBreaker は、閾値と待機時間を指定してサーキットブレーカーを作成します
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, endpoints: map[string]*endpointBreaker{}}
+}
+
+func (b *circuitBreaker) get(endpoint string) *endpointBreaker {
+	eb, ok := b.endpoints[endpoint]
+	if !ok {
+		eb = &endpointBreaker{state: breakerClosed}
+		b.endpoints[endpoint] = eb
+	}
+	return eb
+}
+
+func (b *circuitBreaker) currentTime() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+// transition は、状態を変更して変更内容をログに出力します
+func (b *circuitBreaker) transition(endpoint string, eb *endpointBreaker, to breakerState) {
+	logf("インスタンス[%s]: サーキットブレーカーが %s から %s になりました（連続失敗 %d 回）\n", endpoint, eb.state, to, eb.failures)
+	eb.state = to
+}
+
+// allow は、インスタンスへ適用してよいかを返します。open の状態で待機時間を過ぎていれば half-open にします
+func (b *circuitBreaker) allow(endpoint string) error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	eb := b.get(endpoint)
+	if eb.state != breakerOpen {
+		return nil
+	}
+	if wait := eb.openedAt.Add(b.cooldown).Sub(b.currentTime()); wait > 0 {
+		return fmt.Errorf("%w（あと %s）", errCircuitOpen, wait.Round(time.Second))
+	}
+	b.transition(endpoint, eb, breakerHalfOpen)
+	return nil
+}
+
+// record は、適用結果に応じて連続失敗回数と状態を更新します。
+// 見送り（errCircuitOpen）と max_apply_duration による打ち切り（errApplyDeadline）はインスタンスの異常ではないため、
+// 成功とも失敗とも数えません
+func (b *circuitBreaker) record(endpoint string, err error) {
+	if b.threshold <= 0 || errors.Is(err, errCircuitOpen) || errors.Is(err, errApplyDeadline) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	eb := b.get(endpoint)
+	if err == nil {
+		eb.failures = 0
+		if eb.state != breakerClosed {
+			b.transition(endpoint, eb, breakerClosed)
+		}
+		return
+	}
+	eb.failures++
+	if eb.state == breakerHalfOpen || (eb.state == breakerClosed && eb.failures >= b.threshold) {
+		eb.openedAt = b.currentTime()
+		b.transition(endpoint, eb, breakerOpen)
+	}
+}
+
+// endpointBreakers は、-repeat の周期をまたいで共有するサーキットブレーカーです
+var (
+	endpointBreakers     *circuitBreaker
+	endpointBreakersOnce sync.Once
+)
+
+// sharedBreaker は、フラグの閾値と待機時間で作成したサーキットブレーカーを返します
+func sharedBreaker() *circuitBreaker {
+	endpointBreakersOnce.Do(func() {
+		endpointBreakers = newCircuitBreaker(*breakerThresholdFlag, *breakerCooldownFlag)
+	})
+	return endpointBreakers
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	logs, _ := captureOutput(t)
+	now := time.Unix(0, 0)
+	b := newCircuitBreaker(3, time.Minute)
+	b.now = func() time.Time { return now }
+	failure := errors.New("connection refused")
+
+	for i := 0; i < 3; i++ {
+		if err := b.allow("lb-1"); err != nil {
+			t.Fatalf("%d 回目の失敗の前に適用が見送られました: %v", i+1, err)
+		}
+		b.record("lb-1", failure)
+	}
+	err := b.allow("lb-1")
+	if !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("3回連続の失敗後の allow() = %v, want errCircuitOpen", err)
+	}
+	b.record("lb-1", err) // 見送りは失敗として数えないこと
+	if err := b.allow("lb-2"); err != nil {
+		t.Errorf("他のインスタンスの allow() = %v, want nil", err)
+	}
+
+	now = now.Add(59 * time.Second)
+	if err := b.allow("lb-1"); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("待機時間内の allow() = %v, want errCircuitOpen", err)
+	}
+
+	// 待機時間の経過後は1回だけ試し、失敗すれば再び open になること
+	now = now.Add(time.Second)
+	if err := b.allow("lb-1"); err != nil {
+		t.Fatalf("待機時間経過後の allow() = %v, want nil（half-open）", err)
+	}
+	b.record("lb-1", failure)
+	if err := b.allow("lb-1"); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("half-open での失敗後の allow() = %v, want errCircuitOpen", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.allow("lb-1"); err != nil {
+		t.Fatal(err)
+	}
+	b.record("lb-1", nil)
+	if eb := b.endpoints["lb-1"]; eb.state != breakerClosed || eb.failures != 0 {
+		t.Errorf("成功後の状態 = %s（連続失敗 %d 回）, want closed（0 回）", eb.state, eb.failures)
+	}
+	for _, transition := range []string{"closed から open", "open から half-open", "half-open から open", "half-open から closed"} {
+		if !strings.Contains(logs.String(), transition) {
+			t.Errorf("状態の変化 %q がログに出力されていません", transition)
+		}
+	}
+}
+
+func TestCircuitBreakerIgnoresApplyDeadline(t *testing.T) {
+	captureOutput(t)
+	b := newCircuitBreaker(2, time.Minute)
+	failure := errors.New("connection refused")
+
+	// 打ち切りが続いても open にならないこと
+	for i := 0; i < 3; i++ {
+		b.record("lb-1", fmt.Errorf("インスタンス[lb-1]: %w", errApplyDeadline))
+	}
+	if err := b.allow("lb-1"); err != nil {
+		t.Errorf("打ち切りが続いた後の allow() = %v, want nil（打ち切りは失敗として数えないこと）", err)
+	}
+
+	// 打ち切りは連続失敗回数をリセットしないこと
+	b.record("lb-1", failure)
+	b.record("lb-1", errApplyDeadline)
+	b.record("lb-1", failure)
+	if err := b.allow("lb-1"); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("失敗・打ち切り・失敗の後の allow() = %v, want errCircuitOpen（打ち切りを挟んでも連続失敗とすること）", err)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		b.record("lb-1", errors.New("connection refused"))
+	}
+	if err := b.allow("lb-1"); err != nil {
+		t.Errorf("閾値 0 の allow() = %v, want nil（常に適用）", err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// CacheConfig はHAProxyの cache セクション（小さな静的レスポンスのキャッシュ）の設定を表します。
+// groups / frontends の cache でこのセクションを指定すると、そのバックエンド・frontend でキャッシュを使います
+type CacheConfig struct {
+	Name          string `json:"name"`
+	TotalMaxSize  int    `json:"total_max_size"`            // キャッシュ全体の大きさ（MB、1〜4095）
+	MaxObjectSize int    `json:"max_object_size,omitempty"` // キャッシュするレスポンスの最大の大きさ（バイト、未指定時は total_max_size の 1/256）
+	MaxAge        int    `json:"max_age,omitempty"`         // キャッシュを保持する最大の秒数（未指定時は HAProxy 既定の 60）
+}
+
+// cacheMaxTotalSize は、total-max-size に指定できる最大の大きさ（MB）です
+const cacheMaxTotalSize = 4095
+
+// validate は、cache セクションの設定値を検証します
+func (c CacheConfig) validate() error {
+	if c.Name == "" {
+		return errors.New("name が指定されていません")
+	}
+	if c.TotalMaxSize < 1 || c.TotalMaxSize > cacheMaxTotalSize {
+		return fmt.Errorf("total_max_size は 1〜%d の範囲（MB）で指定してください（指定値: %d）", cacheMaxTotalSize, c.TotalMaxSize)
+	}
+	// HAProxy はキャッシュ全体の半分を超えるオブジェクトを受け付けません
+	if limit := c.TotalMaxSize * 1024 * 1024 / 2; c.MaxObjectSize < 0 || c.MaxObjectSize > limit {
+		return fmt.Errorf("max_object_size は 0〜%d の範囲（バイト、total_max_size の半分まで）で指定してください（指定値: %d）", limit, c.MaxObjectSize)
+	}
+	if c.MaxAge < 0 {
+		return fmt.Errorf("max_age は 0 以上の秒数で指定してください（指定値: %d）", c.MaxAge)
+	}
+	return nil
+}
+
+// findCache は、名前に一致する cache の設定を返します。定義されていなければ nil を返します
+func findCache(config *Config, name string) *CacheConfig {
+	for i := range config.Caches {
+		if config.Caches[i].Name == name {
+			return &config.Caches[i]
+		}
+	}
+	return nil
+}
+
+// buildCache は、cache の設定から HAProxy の cache セクションの定義を組み立てます
+func buildCache(c CacheConfig) haproxy.Cache {
+	return haproxy.Cache{
+		Name:          c.Name,
+		TotalMaxSize:  c.TotalMaxSize,
+		MaxObjectSize: c.MaxObjectSize,
+		MaxAge:        c.MaxAge,
+	}
+}
+
+// cacheDirectives は、キャッシュを使うバックエンド・frontend に設定するキーと値の組を返します
+// （リクエストでキャッシュを参照し、レスポンスをキャッシュに格納します）
+func cacheDirectives(name string) [][2]string {
+	return [][2]string{
+		{"http-request cache-use", name},
+		{"http-response cache-store", name},
+	}
+}
+
+// cacheGroups は、cache を指定したグループ（削除対象を除く）を定義順に返します
+func cacheGroups(config *Config) []GroupConfig {
+	var groups []GroupConfig
+	for _, g := range config.Groups {
+		if g.Cache != "" && !g.absent() {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// applyCache は、cache セクションを作成し、内容が異なる場合は更新したうえで、
+// cache を指定したグループのバックエンドと frontend でキャッシュを有効にします
+func applyCache(client haproxyClient, config *Config) error {
+	if len(config.Caches) == 0 {
+		return nil
+	}
+	current, err := client.GetCaches()
+	if err != nil {
+		return fmt.Errorf("現在の cache の取得に失敗: %w", err)
+	}
+	existing := make(map[string]haproxy.Cache, len(current))
+	for _, c := range current {
+		existing[c.Name] = c
+	}
+
+	for _, c := range config.Caches {
+		desired := buildCache(c)
+		cur, ok := existing[c.Name]
+		switch {
+		case !ok:
+			if err := client.AddCache(&desired); err != nil {
+				return fmt.Errorf("cache[%s]の作成失敗: %w", c.Name, err)
+			}
+			logf("cache[%s]を作成しました\n", c.Name)
+		case cur == desired:
+			logf("cache[%s]は既に同じ内容のためスキップしました\n", c.Name)
+		default:
+			if err := client.UpdateCache(&desired); err != nil {
+				return fmt.Errorf("cache[%s]の更新失敗: %w", c.Name, err)
+			}
+			logf("cache[%s]を更新しました\n", c.Name)
+		}
+	}
+
+	for _, g := range cacheGroups(config) {
+		for _, d := range cacheDirectives(g.Cache) {
+			if err := client.SetBackendConfig(g.Name, d[0], d[1]); err != nil {
+				return fmt.Errorf("バックエンド[%s]の %s の設定失敗: %w", g.Name, d[0], err)
+			}
+		}
+		logf("バックエンド[%s]でキャッシュを有効にしました（cache[%s]）\n", g.Name, g.Cache)
+	}
+	for _, f := range config.Frontends {
+		if f.Cache == "" {
+			continue
+		}
+		for _, d := range cacheDirectives(f.Cache) {
+			if err := client.SetFrontendConfig(f.Name, d[0], d[1]); err != nil {
+				return fmt.Errorf("frontend[%s]の %s の設定失敗: %w", f.Name, d[0], err)
+			}
+		}
+		logf("frontend[%s]でキャッシュを有効にしました（cache[%s]）\n", f.Name, f.Cache)
+	}
+	return nil
+}
+
+// cacheLines は、cache セクションの定義を haproxy.cfg の cache セクションの各行に変換します（未指定の項目は含みません）
+func cacheLines(c haproxy.Cache) []string {
+	lines := []string{fmt.Sprintf("total-max-size %d", c.TotalMaxSize)}
+	if c.MaxObjectSize > 0 {
+		lines = append(lines, fmt.Sprintf("max-object-size %d", c.MaxObjectSize))
+	}
+	if c.MaxAge > 0 {
+		lines = append(lines, fmt.Sprintf("max-age %d", c.MaxAge))
+	}
+	return lines
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// cacheTestConfig は、static の cache セクションを web グループと www frontend で使う設定です
+func cacheTestConfig(t *testing.T, maxAge int) *Config {
+	t.Helper()
+	return loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://cache"],
+		"load_balancing_algorithm": "roundrobin",
+		"caches": [{"name": "static", "total_max_size": 64, "max_object_size": 65536, "max_age": `+strconv.Itoa(maxAge)+`}],
+		"groups": [{"name": "web", "cache": "static"}, {"name": "api"}],
+		"frontends": [{"name": "www", "cache": "static"}],
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "api-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "api"}
+		]
+	}`)
+}
+
+func TestApplyCache(t *testing.T) {
+	captureOutput(t)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, cacheTestConfig(t, 300), applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	want := haproxy.Cache{Name: "static", TotalMaxSize: 64, MaxObjectSize: 65536, MaxAge: 300}
+	if caches, _ := fake.GetCaches(); len(caches) != 1 || caches[0] != want {
+		t.Fatalf("作成した cache = %+v, want %+v", caches, want)
+	}
+	for _, key := range []string{"http-request cache-use", "http-response cache-store"} {
+		if got := fake.BackendConfig("web", key); got != "static" {
+			t.Errorf("web の %s = %q, want static", key, got)
+		}
+		if got := fake.BackendConfig("api", key); got != "" {
+			t.Errorf("api の %s = %q, want 未設定（cache のないグループ）", key, got)
+		}
+		if got := fake.FrontendConfig("www", key); got != "static" {
+			t.Errorf("frontend[www] の %s = %q, want static", key, got)
+		}
+	}
+
+	logs, _ := captureOutput(t)
+	if _, err := applyConfig(fake, cacheTestConfig(t, 300), applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "cache[static]は既に同じ内容のためスキップしました") {
+		t.Errorf("同じ内容での再適用のログ =\n%s\nwant スキップしたこと", logs.String())
+	}
+	if _, err := applyConfig(fake, cacheTestConfig(t, 600), applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if caches, _ := fake.GetCaches(); len(caches) != 1 || caches[0].MaxAge != 600 {
+		t.Errorf("変更後の cache = %+v, want max_age 600 に更新", caches)
+	}
+}
+
+func TestValidateCache(t *testing.T) {
+	valid := CacheConfig{Name: "static", TotalMaxSize: 4}
+	if err := valid.validate(); err != nil {
+		t.Fatalf("正しい cache の検証がエラーになりました: %v", err)
+	}
+	for name, modify := range map[string]func(*CacheConfig){
+		"名前なし":                 func(c *CacheConfig) { c.Name = "" },
+		"total_max_size なし":    func(c *CacheConfig) { c.TotalMaxSize = 0 },
+		"total_max_size が上限超え": func(c *CacheConfig) { c.TotalMaxSize = cacheMaxTotalSize + 1 },
+		"全体の半分を超えるオブジェクト":      func(c *CacheConfig) { c.MaxObjectSize = 2*1024*1024 + 1 },
+		"負の max_age":           func(c *CacheConfig) { c.MaxAge = -1 },
+	} {
+		c := valid
+		modify(&c)
+		if err := c.validate(); err == nil {
+			t.Errorf("%s の cache の検証がエラーになりませんでした", name)
+		}
+	}
+
+	for name, config := range map[string]string{
+		"未定義の cache":   `"groups": [{"name": "web", "cache": "missing"}]`,
+		"mode tcp":     `"caches": [{"name": "static", "total_max_size": 4}], "groups": [{"name": "db", "mode": "tcp", "cache": "static"}]`,
+		"frontend の参照": `"frontends": [{"name": "www", "cache": "missing"}]`,
+		"重複した cache":   `"caches": [{"name": "static", "total_max_size": 4}, {"name": "static", "total_max_size": 8}]`,
+	} {
+		err := validateTestConfig(t, `{"haproxy_endpoint": ["memory://cache"], "load_balancing_algorithm": "roundrobin", `+config+`, "backends": []}`)
+		if err == nil || !strings.Contains(err.Error(), "cache") {
+			t.Errorf("%s の検証のエラー = %v, want cache に関するエラー", name, err)
+		}
+	}
+}
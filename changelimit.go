@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// errChangeLimitExceeded は、変更するサーバーの割合が -max-change-percent を超えたため適用を中止した場合のエラーです
+var errChangeLimitExceeded = errors.New("変更するサーバーの割合が上限を超えています")
+
+// plannedChanges は、追加・更新するサーバーと削除するサーバーの数を返します（変更のないサーバーは数えません）
+func plannedChanges(config *Config, state *liveState, groups []backendGroup, opts applyOptions, removals []haproxy.Server) int {
+	changes := len(removals)
+	for _, group := range groups {
+		for _, backend := range opts.tags.filter(group.backends) {
+			if validateBackend(backend) != nil {
+				continue
+			}
+			var d serverDecision
+			if backend.SRV != "" {
+				d = decideTemplate(state, buildServerTemplate(config, backend))
+			} else {
+				d = decideServer(state, buildServer(config, backend))
+			}
+			if d.action != actionSkip {
+				changes++
+			}
+		}
+	}
+	return changes
+}
+
+// checkChangeLimit は、変更するサーバーの数が現在のサーバー数に対して limit（%）を超える場合にエラーを返します。
+// 誤った設定で全台が一度に入れ替わるのを防ぐためのもので、現在サーバーが1台もない場合は判定しません
+func checkChangeLimit(changes, current int, limit float64) error {
+	if current == 0 {
+		return nil
+	}
+	percent := float64(changes) * 100 / float64(current)
+	if percent > limit {
+		return fmt.Errorf("%w: 現在の %d 台に対して %d 台（%.1f%%）を変更します（上限 %.1f%%、適用するには -force を指定してください）", errChangeLimitExceeded, current, changes, percent, limit)
+	}
+	if changes > 0 {
+		logf("変更するサーバーは現在の %d 台に対して %d 台（%.1f%%、上限 %.1f%%）です\n", current, changes, percent, limit)
+	}
+	return nil
+}
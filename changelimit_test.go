@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// changeLimitTestConfig は、web-1〜web-4 のうち先頭の changed 台の重みを 20 に変えた設定を読み込みます
+func changeLimitTestConfig(t *testing.T, changed int) *Config {
+	t.Helper()
+	backends := make([]string, 4)
+	for i := range backends {
+		weight := 10
+		if i < changed {
+			weight = 20
+		}
+		backends[i] = fmt.Sprintf(`{"name": "web-%d", "ip": "10.0.0.%d", "port": 80, "weight": %d, "group": "web"}`, i+1, i+1, weight)
+	}
+	return loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://change-limit"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [`+strings.Join(backends, ",")+`]
+	}`)
+}
+
+func TestMaxChangePercentBlocksOversizedChange(t *testing.T) {
+	captureOutput(t)
+	_, fake := testMemoryEndpoint(t)
+	// 空の接続先への初回の適用は判定しません
+	if _, err := applyConfig(fake, changeLimitTestConfig(t, 0), applyOptions{maxChangePercent: 50}); err != nil {
+		t.Fatalf("初回の applyConfig がエラーを返しました: %v", err)
+	}
+
+	_, err := applyConfig(fake, changeLimitTestConfig(t, 3), applyOptions{maxChangePercent: 50})
+	if !errors.Is(err, errChangeLimitExceeded) {
+		t.Fatalf("4台中3台を変更する applyConfig のエラー = %v, want errChangeLimitExceeded", err)
+	}
+	if !strings.Contains(err.Error(), "75.0%") || !strings.Contains(err.Error(), "上限 50.0%") {
+		t.Errorf("エラーに変更の割合と上限が含まれていません: %v", err)
+	}
+	servers, _ := fake.GetServers()
+	for _, s := range servers {
+		if s.Weight != 10 {
+			t.Errorf("中止した後の %s の重み = %d, want 10（何も変更しないこと）", s.Name, s.Weight)
+		}
+	}
+
+	if _, err := applyConfig(fake, changeLimitTestConfig(t, 1), applyOptions{maxChangePercent: 50}); err != nil {
+		t.Fatalf("4台中1台を変更する applyConfig がエラーを返しました: %v", err)
+	}
+	if _, err := applyConfig(fake, changeLimitTestConfig(t, 4), applyOptions{maxChangePercent: 50, force: true}); err != nil {
+		t.Fatalf("-force を指定した applyConfig がエラーを返しました: %v", err)
+	}
+	servers, _ = fake.GetServers()
+	for _, s := range servers {
+		if s.Weight != 20 {
+			t.Errorf("-force で適用した後の %s の重み = %d, want 20", s.Name, s.Weight)
+		}
+	}
+}
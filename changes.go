@@ -0,0 +1,143 @@
+package main
+
+import "github.com/haproxytech/client-go/v2/haproxy"
+
+// 変更イベントの段階です（計画時は -dry-run -explain、適用時は実際の変更の完了後に出力します）
+const (
+	changeStagePlanned = "planned"
+	changeStageApplied = "applied"
+)
+
+// changeTypes は、変更イベントの type に出力する操作の種類です（ログを集計するツール向けに英語の識別子とします）
+var changeTypes = map[reconcileAction]string{
+	actionAdd:    "add",
+	actionUpdate: "update",
+	actionCheck:  "health-check",
+	actionRename: "rename",
+	actionRemove: "remove",
+}
+
+// changeRunID は、変更イベントに含める実行ID（-run-id または開始時刻から生成した値）です
+var changeRunID string
+
+// fieldChange は、サーバー定義の1つの項目の変更です
+type fieldChange struct {
+	field string
+	from  interface{}
+	to    interface{}
+}
+
+// serverChanges は、サーバー定義の異なる項目を比較順に返します
+func serverChanges(cur, desired haproxy.Server) []fieldChange {
+	var changes []fieldChange
+	add := func(field string, from, to interface{}) {
+		if from != to {
+			changes = append(changes, fieldChange{field, from, to})
+		}
+	}
+	add("name", cur.Name, desired.Name)
+	add("id", cur.ID, desired.ID)
+	add("address", serverAddress(cur), serverAddress(desired))
+	add("weight", cur.Weight, desired.Weight)
+	add("maxconn", cur.Maxconn, desired.Maxconn)
+	add("source", cur.Source, desired.Source)
+	add("check", cur.Check, desired.Check)
+	add("inter", cur.Inter, desired.Inter)
+	add("fall", cur.Fall, desired.Fall)
+	add("rise", cur.Rise, desired.Rise)
+	add("downinter", cur.Downinter, desired.Downinter)
+	add("fastinter", cur.Fastinter, desired.Fastinter)
+	add("check address", cur.CheckAddr, desired.CheckAddr)
+	add("check port", cur.CheckPort, desired.CheckPort)
+	add("ssl", cur.SSL, desired.SSL)
+	add("alpn", cur.Alpn, desired.Alpn)
+	add("npn", cur.Npn, desired.Npn)
+	add("verify", cur.Verify, desired.Verify)
+	add("sni", cur.Sni, desired.Sni)
+	add("crt", cur.SSLCertificate, desired.SSLCertificate)
+	add("send_proxy", cur.SendProxy, desired.SendProxy)
+	add("proxy_v2_options", cur.ProxyV2Options, desired.ProxyV2Options)
+	add("track", cur.Track, desired.Track)
+	add("labels", formatLabels(cur.Metadata), formatLabels(desired.Metadata))
+	return changes
+}
+
+// templateChanges は、server-template の異なる項目を比較順に返します
+func templateChanges(cur, desired haproxy.ServerTemplate) []fieldChange {
+	var changes []fieldChange
+	add := func(field string, from, to interface{}) {
+		if from != to {
+			changes = append(changes, fieldChange{field, from, to})
+		}
+	}
+	add("count", cur.NumOrRange, desired.NumOrRange)
+	add("srv", cur.Fqdn, desired.Fqdn)
+	add("resolvers", cur.Resolvers, desired.Resolvers)
+	add("weight", cur.Weight, desired.Weight)
+	add("check", cur.Check, desired.Check)
+	add("inter", cur.Inter, desired.Inter)
+	add("fall", cur.Fall, desired.Fall)
+	add("rise", cur.Rise, desired.Rise)
+	return changes
+}
+
+// emitChange は、JSONログ（-log-format json）の場合に1件の変更を event: "change" のイベントとして出力します。
+// old / new は追加・削除ではサーバー行、更新では変更された項目の値です（テキスト形式のログでは何も出力しません）
+func emitChange(stage string, action reconcileAction, target, field string, old, new interface{}) {
+	if !jsonLogEnabled {
+		return
+	}
+	fields := map[string]interface{}{
+		"event":  "change",
+		"stage":  stage,
+		"type":   changeTypes[action],
+		"target": target,
+		"old":    old,
+		"new":    new,
+	}
+	if field != "" {
+		fields["field"] = field
+	}
+	if changeRunID != "" {
+		fields["run_id"] = changeRunID
+	}
+	logEvent("info", "変更: "+target, fields)
+}
+
+// emitServerChanges は、サーバーの操作を変更イベントとして出力します（更新は異なる項目ごとに1件）
+func emitServerChanges(stage string, action reconcileAction, cur *haproxy.Server, desired haproxy.Server) {
+	if !jsonLogEnabled {
+		return // 多数のサーバーを適用する場合に差分やサーバー行を組み立てないよう、先に判定します
+	}
+	target := serverKey(desired.Backend, desired.Name)
+	if cur == nil {
+		emitChange(stage, action, target, "", nil, serverLine(desired))
+		return
+	}
+	for _, c := range serverChanges(*cur, desired) {
+		emitChange(stage, action, target, c.field, c.from, c.to)
+	}
+}
+
+// emitTemplateChanges は、server-template の操作を変更イベントとして出力します（更新は異なる項目ごとに1件）
+func emitTemplateChanges(stage string, action reconcileAction, cur *haproxy.ServerTemplate, desired haproxy.ServerTemplate) {
+	if !jsonLogEnabled {
+		return
+	}
+	target := serverKey(desired.Backend, desired.Prefix)
+	if cur == nil {
+		emitChange(stage, action, target, "", nil, serverTemplateLine(desired))
+		return
+	}
+	for _, c := range templateChanges(*cur, desired) {
+		emitChange(stage, action, target, c.field, c.from, c.to)
+	}
+}
+
+// emitRemoval は、サーバーの削除を変更イベントとして出力します
+func emitRemoval(stage string, s haproxy.Server) {
+	if !jsonLogEnabled {
+		return
+	}
+	emitChange(stage, actionRemove, serverKey(s.Backend, s.Name), "", serverLine(s), nil)
+}
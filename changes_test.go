@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// changeEvents は、JSONログの出力から event: "change" のイベントを順に取り出します
+func changeEvents(t *testing.T, data []byte) []map[string]interface{} {
+	t.Helper()
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var event map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("JSONとして解釈できない行があります: %q: %v", scanner.Text(), err)
+		}
+		if event["event"] == "change" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func TestApplyEmitsChangeEvents(t *testing.T) {
+	logs, _ := captureOutput(t)
+	configWith := func(weight, extra string) *Config {
+		return loadTestConfig(t, `{
+			"haproxy_endpoint": ["memory://changes"],
+			"load_balancing_algorithm": "roundrobin",
+			"backends": [
+				{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": `+weight+`, "group": "web"}`+extra+`
+			]
+		}`)
+	}
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, configWith("10", ""), applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	logs.Reset()
+
+	setupJSONLog()
+	changeRunID = "run-1"
+	t.Cleanup(func() { jsonLogEnabled, changeRunID = false, "" })
+	added := `, {"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}`
+	if _, err := applyConfig(fake, configWith("20", added), applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := changeEvents(t, logs.Bytes())
+	byTarget := map[string]map[string]interface{}{}
+	for _, e := range events {
+		if e["stage"] != changeStageApplied || e["run_id"] != "run-1" {
+			t.Errorf("変更イベント = %v, want stage applied, run_id run-1", e)
+		}
+		byTarget[e["target"].(string)] = e
+	}
+	if len(events) != 2 {
+		t.Fatalf("変更イベントの件数 = %d, want 2（web-1 の重みの更新と web-2 の追加）: %v", len(events), events)
+	}
+	update := byTarget["web/web-1"]
+	// JSON の数値は float64 として読み込まれます
+	if update["type"] != "update" || update["field"] != "weight" || update["old"] != 10.0 || update["new"] != 20.0 {
+		t.Errorf("web-1 の変更イベント = %v, want update weight 10 -> 20", update)
+	}
+	add := byTarget["web/web-2"]
+	if add["type"] != "add" || add["old"] != nil || add["new"] == nil {
+		t.Errorf("web-2 の変更イベント = %v, want add（old なし、new にサーバー行）", add)
+	}
+}
+
+func TestChangeEventsDisabledInTextLog(t *testing.T) {
+	logs, _ := captureOutput(t)
+	emitChange(changeStageApplied, actionAdd, "web/web-1", "", nil, "server web-1 10.0.0.1:80")
+	if logs.Len() != 0 {
+		t.Errorf("テキスト形式のログで変更イベントが出力されました: %q", logs)
+	}
+}
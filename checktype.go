@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// backendModes は対応しているバックエンドのモードです
+var backendModes = map[string]bool{
+	"tcp":  true,
+	"http": true,
+}
+
+// checkTypesByMode は、バックエンドのモードごとに使用できるヘルスチェックの種類です。
+// http チェックはHTTPリクエストを送るため、tcp モードのバックエンド（redis など）では使用できません
+var checkTypesByMode = map[string]map[string]bool{
+	"tcp":  {"tcp": true},
+	"http": {"tcp": true, "http": true},
+}
+
+// checkTypeOptions は、ヘルスチェックの種類に対応するバックエンドの option です
+var checkTypeOptions = map[string]string{
+	"tcp":  "tcp-check",
+	"http": "httpchk",
+}
+
+// resolveCheckType は、バックエンドのモードとヘルスチェック設定から使用するチェックの種類を決定します。
+// type が未指定の場合はモードと同じ種類（tcp → tcp, http → http）とし、
+// モードも未指定の場合は空文字列（HAProxy既定の接続チェック）を返します。
+// type を明示的に指定し、それがモードと両立しない場合はエラーを返します
+func resolveCheckType(mode string, hc HealthCheckConfig) (string, error) {
+	if !hc.Enabled {
+		return "", nil
+	}
+	if hc.Type == "" {
+		return mode, nil
+	}
+	if mode != "" && !checkTypesByMode[mode][hc.Type] {
+		return "", fmt.Errorf("mode %s のバックエンドでは %s ヘルスチェックは使用できません", mode, hc.Type)
+	}
+	return hc.Type, nil
+}
+
+// groupCheckType は、グループ内のサーバーに共通するヘルスチェックの種類を返します。
+// HAProxyではチェックの種類はバックエンド単位の設定のため、グループ内で異なる種類は指定できません
+func groupCheckType(config *Config, group backendGroup) (string, error) {
+	mode := ""
+	if g := findGroup(config, group.name); g != nil {
+		mode = g.Mode
+	}
+	checkType := ""
+	for _, b := range group.backends {
+		t, err := resolveCheckType(mode, effectiveHealthCheck(config, applyServerDefaults(config, b)))
+		if err != nil {
+			return "", fmt.Errorf("グループ[%s]のサーバー[%s]: %w", group.name, b.Name, err)
+		}
+		if t == "" {
+			continue
+		}
+		if checkType != "" && t != checkType {
+			return "", fmt.Errorf("グループ[%s]でヘルスチェックの種類（%s, %s）が混在しています", group.name, checkType, t)
+		}
+		checkType = t
+	}
+	return checkType, nil
+}
+
+// tcpCheck は、tcp チェックで送信する文字列と期待する応答です
+type tcpCheck struct {
+	send   string
+	expect string
+}
+
+// groupTCPCheck は、グループ内のサーバーに共通する check_send / check_expect を返します。
+// tcp-check send / expect はバックエンド単位の設定のため、tcp チェックのグループでのみ、かつ共通の値のみ指定できます
+func groupTCPCheck(config *Config, group backendGroup) (tcpCheck, error) {
+	checkType, err := groupCheckType(config, group)
+	if err != nil {
+		return tcpCheck{}, err
+	}
+	var check tcpCheck
+	seen := false
+	for _, b := range group.backends {
+		// ヘルスチェックを行わないサーバーは対象外
+		hc := effectiveHealthCheck(config, applyServerDefaults(config, b))
+		if !hc.Enabled {
+			continue
+		}
+		c := tcpCheck{send: hc.CheckSend, expect: hc.CheckExpect}
+		if c != (tcpCheck{}) && checkType != "tcp" {
+			return tcpCheck{}, fmt.Errorf("グループ[%s]のサーバー[%s]: check_send / check_expect は tcp ヘルスチェックでのみ使用できます（現在: %s）", group.name, b.Name, valueOrDash(checkType))
+		}
+		if seen && c != check {
+			return tcpCheck{}, fmt.Errorf("グループ[%s]で check_send / check_expect の値が混在しています", group.name)
+		}
+		check, seen = c, true
+	}
+	return check, nil
+}
+
+// tcpCheckDirectives は、tcp チェックの送受信内容を tcp-check のキーと値の組に変換します
+func tcpCheckDirectives(check tcpCheck) [][2]string {
+	var directives [][2]string
+	if check.send != "" {
+		directives = append(directives, [2]string{"tcp-check send", haproxyQuote(check.send)})
+	}
+	if check.expect != "" {
+		directives = append(directives, [2]string{"tcp-check expect", "string " + haproxyQuote(check.expect)})
+	}
+	return directives
+}
+
+// haproxyQuote は、文字列をHAProxyの設定で使える二重引用符付きの文字列にします（改行などはエスケープします）
+func haproxyQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", `\r`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// applyBackendMode は、グループのモードとヘルスチェックの種類（および log-health-checks）をバックエンドに設定します
+func applyBackendMode(client haproxyClient, config *Config, group backendGroup) error {
+	if group.name == "" {
+		return nil
+	}
+	if g := findGroup(config, group.name); g != nil && g.Mode != "" {
+		if err := client.SetBackendConfig(group.name, "mode", g.Mode); err != nil {
+			return fmt.Errorf("バックエンド[%s]の mode の設定失敗: %w", group.name, err)
+		}
+		logf("バックエンド[%s]の mode を %s に設定しました\n", group.name, g.Mode)
+	}
+	if config.HealthCheck.LogHealthChecks {
+		if err := client.SetBackendConfig(group.name, "option log-health-checks", "on"); err != nil {
+			return fmt.Errorf("バックエンド[%s]の log-health-checks の設定失敗: %w", group.name, err)
+		}
+		logf("バックエンド[%s]でヘルスチェックの状態変化のログ出力を有効にしました\n", group.name)
+	}
+	checkType, err := groupCheckType(config, group)
+	if err != nil {
+		return err
+	}
+	if checkType != "" {
+		if err := client.SetBackendConfig(group.name, "adv_check", checkTypeOptions[checkType]); err != nil {
+			return fmt.Errorf("バックエンド[%s]のヘルスチェックの種類の設定失敗: %w", group.name, err)
+		}
+		logf("バックエンド[%s]のヘルスチェックを %s チェックに設定しました\n", group.name, checkType)
+	}
+	check, err := groupTCPCheck(config, group)
+	if err != nil {
+		return err
+	}
+	for _, d := range tcpCheckDirectives(check) {
+		if err := client.SetBackendConfig(group.name, d[0], d[1]); err != nil {
+			return fmt.Errorf("バックエンド[%s]の %s の設定失敗: %w", group.name, d[0], err)
+		}
+		logf("バックエンド[%s]に %s %s を設定しました\n", group.name, d[0], d[1])
+	}
+	return nil
+}
+
+// describeBackendMode は、applyBackendMode が行う設定を dry-run 用に説明します
+func describeBackendMode(config *Config, group backendGroup) string {
+	if group.name == "" {
+		return ""
+	}
+	mode := ""
+	if g := findGroup(config, group.name); g != nil {
+		mode = g.Mode
+	}
+	checkType, _ := groupCheckType(config, group)
+	if mode == "" && checkType == "" && !config.HealthCheck.LogHealthChecks {
+		return ""
+	}
+	line := fmt.Sprintf("バックエンド[%s]: mode %s, ヘルスチェック %s", group.name, valueOrDash(mode), valueOrDash(checkType))
+	if config.HealthCheck.LogHealthChecks {
+		line += ", option log-health-checks"
+	}
+	check, _ := groupTCPCheck(config, group)
+	for _, d := range tcpCheckDirectives(check) {
+		line += fmt.Sprintf(", %s %s", d[0], d[1])
+	}
+	return line
+}
+
+// valueOrDash は、空文字列の場合に "-" を返します
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
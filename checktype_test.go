@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveCheckType(t *testing.T) {
+	for _, tt := range []struct {
+		mode, checkType string
+		enabled         bool
+		want            string
+		wantErr         bool
+	}{
+		{mode: "tcp", enabled: true, want: "tcp"},
+		{mode: "http", enabled: true, want: "http"},
+		{mode: "", enabled: true, want: ""},
+		{mode: "http", checkType: "tcp", enabled: true, want: "tcp"},
+		{mode: "tcp", checkType: "http", enabled: true, wantErr: true},
+		{mode: "tcp", checkType: "http", enabled: false, want: ""},
+	} {
+		got, err := resolveCheckType(tt.mode, HealthCheckConfig{Enabled: tt.enabled, Type: tt.checkType})
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("resolveCheckType(%q, type %q, enabled %v) = %q, %v, want %q, エラー %v", tt.mode, tt.checkType, tt.enabled, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestApplyBackendModeDefaultsCheckTypeFromMode(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://checktype"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+		"groups": [{"name": "redis", "mode": "tcp"}, {"name": "web", "mode": "http"}],
+		"backends": [
+			{"name": "redis-1", "ip": "10.0.0.1", "port": 6379, "weight": 10, "group": "redis"},
+			{"name": "web-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if err := applyGroupSettings(fake, config); err != nil {
+		t.Fatalf("applyGroupSettings がエラーを返しました: %v", err)
+	}
+	for backend, want := range map[string]string{"redis": "tcp-check", "web": "httpchk"} {
+		if got := fake.BackendConfig(backend, "adv_check"); got != want {
+			t.Errorf("%s の adv_check = %q, want %q（mode から決定）", backend, got, want)
+		}
+		if got := fake.BackendConfig(backend, "mode"); got == "" {
+			t.Errorf("%s の mode が設定されていません", backend)
+		}
+	}
+}
+
+func TestIncompatibleCheckTypeIsRejected(t *testing.T) {
+	err := validateTestConfig(t, `{
+		"haproxy_endpoint": ["memory://checktype"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+		"groups": [{"name": "redis", "mode": "tcp"}],
+		"backends": [{"name": "redis-1", "ip": "10.0.0.1", "port": 6379, "weight": 10, "group": "redis", "health_check": {"type": "http"}}]
+	}`)
+	if err == nil || !strings.Contains(err.Error(), "mode tcp のバックエンドでは http ヘルスチェックは使用できません") {
+		t.Errorf("Validate() = %v, want mode と種類の組み合わせのエラー", err)
+	}
+}
+
+func TestApplyTCPCheckSendExpect(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://tcpcheck"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2, "check_send": "PING\r\n", "check_expect": "+PONG"},
+		"groups": [{"name": "redis", "mode": "tcp"}],
+		"backends": [
+			{"name": "redis-1", "ip": "10.0.0.1", "port": 6379, "weight": 10, "group": "redis"},
+			{"name": "redis-2", "ip": "10.0.0.2", "port": 6379, "weight": 10, "group": "redis"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if err := applyGroupSettings(fake, config); err != nil {
+		t.Fatalf("applyGroupSettings がエラーを返しました: %v", err)
+	}
+	if got := fake.BackendConfig("redis", "tcp-check send"); got != `"PING\r\n"` {
+		t.Errorf("tcp-check send = %s, want \"PING\\r\\n\"（改行をエスケープして引用符で囲むこと）", got)
+	}
+	if got := fake.BackendConfig("redis", "tcp-check expect"); got != `string "+PONG"` {
+		t.Errorf("tcp-check expect = %s, want string \"+PONG\"", got)
+	}
+}
+
+func TestTCPCheckSendExpectIsRejected(t *testing.T) {
+	for name, tt := range map[string]struct{ mode, backends string }{
+		"http モード": {"http", `{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web", "health_check": {"check_send": "PING"}}`},
+		"値の混在": {"tcp", `{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web", "health_check": {"check_send": "PING"}},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web", "health_check": {"check_send": "HELLO"}}`},
+	} {
+		err := validateTestConfig(t, `{
+			"haproxy_endpoint": ["memory://tcpcheck"],
+			"load_balancing_algorithm": "roundrobin",
+			"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+			"groups": [{"name": "web", "mode": "`+tt.mode+`"}],
+			"backends": [`+tt.backends+`]
+		}`)
+		if err == nil {
+			t.Errorf("%s の check_send の検証がエラーになりませんでした", name)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package main
+
+import "github.com/limonene213u/lb_haproxy/haproxyfake"
+
+// haproxyClient は、適用処理が利用するHAProxy操作をまとめたインターフェースです。
+// Data Plane API（*haproxy.HAProxy）と runtime socket（*socketClient）、メモリ上のインスタンス（*haproxyfake.HAProxy）のどれでも
+// 同じ適用処理を使えるようにするためのもので、ライブラリの利用者がテストで参照できるよう haproxyfake パッケージで定義しています
+type haproxyClient = haproxyfake.Client
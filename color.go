@@ -0,0 +1,34 @@
+package main
+
+// ANSI エスケープシーケンスによる文字色
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+)
+
+// colorEnabled が true の場合、plan や doctor の出力を色付けします
+var colorEnabled bool
+
+// resolveColor は、出力を色付けするかを決定します。
+// -color / -no-color の指定が最優先で、どちらもなければ出力先が端末でかつ
+// 環境変数 NO_COLOR が設定されていない場合のみ色付けします（https://no-color.org/）
+func resolveColor(force, disable bool, getenv func(string) string, terminal bool) bool {
+	switch {
+	case disable:
+		return false
+	case force:
+		return true
+	}
+	return terminal && getenv("NO_COLOR") == ""
+}
+
+// colorize は、色付けが有効な場合のみ文字列を指定した色で囲みます
+func colorize(color, s string) string {
+	if !colorEnabled || s == "" {
+		return s
+	}
+	return color + s + colorReset
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveColor(t *testing.T) {
+	noColor := func(key string) string {
+		if key == "NO_COLOR" {
+			return "1"
+		}
+		return ""
+	}
+	unset := func(string) string { return "" }
+	for _, tt := range []struct {
+		name           string
+		force, disable bool
+		getenv         func(string) string
+		terminal, want bool
+	}{
+		{"端末", false, false, unset, true, true},
+		{"端末以外", false, false, unset, false, false},
+		{"NO_COLOR", false, false, noColor, true, false},
+		{"-color は NO_COLOR より優先", true, false, noColor, false, true},
+		{"-no-color が最優先", true, true, unset, true, false},
+	} {
+		if got := resolveColor(tt.force, tt.disable, tt.getenv, tt.terminal); got != tt.want {
+			t.Errorf("%s: resolveColor() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// setColorEnabled は、テストの間だけ色付けの有無を切り替えます
+func setColorEnabled(t *testing.T, enabled bool) {
+	t.Helper()
+	prev := colorEnabled
+	colorEnabled = enabled
+	t.Cleanup(func() { colorEnabled = prev })
+}
+
+func TestNoANSICodesWhenColorDisabled(t *testing.T) {
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://color"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10}]
+	}`)
+	results := []diagnosis{
+		{Check: "設定の検証", Level: levelPass, Message: "設定は正常です"},
+		{Check: "エンドポイントへの接続", Level: levelFail, Message: "接続できません", Hint: "確認してください"},
+	}
+
+	setColorEnabled(t, false)
+	output := strings.Join(planConfig(config, applyOptions{}), "\n") + formatDiagnoses(results)
+	if strings.Contains(output, "\x1b[") {
+		t.Errorf("色付けが無効な出力にANSIエスケープシーケンスが含まれています: %q", output)
+	}
+
+	setColorEnabled(t, true)
+	if colored := formatDiagnoses(results); !strings.Contains(colored, colorRed+"[FAIL]"+colorReset) {
+		t.Errorf("色付けが有効な doctor の出力 = %q, want FAIL を赤で表示", colored)
+	}
+}
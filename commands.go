@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// runApply は、設定内容をHAProxyへ適用し、失敗した場合は終了します（apply サブコマンド）
+func runApply(config *Config) {
+	if *maxChangePercentFlag < 0 {
+		log.Fatalf("-max-change-percent は 0 以上で指定してください（指定値: %v）", *maxChangePercentFlag)
+	}
+	if *validateOnlyFlag {
+		runValidateOnly(config)
+		return
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	if err := applyOnce(ctx, config); err != nil {
+		// max_apply_duration による打ち切りは、CI などで失敗と区別できるよう専用の終了コードで終了します
+		if errors.Is(err, errApplyDeadline) {
+			reportError(errorCategoryApply, "", "適用を打ち切りました", err)
+			os.Exit(exitDeadlineExceeded)
+		}
+		fatalError(errorCategoryApply, err)
+	}
+}
+
+// interruptContext は、SIGINT / SIGTERM を受け取るとキャンセルされるコンテキストを返します。
+// 1回目のシグナルでは再試行の待機を中断して適用を終え、2回目のシグナルでは通常どおり直ちに終了します
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// applyOnce は、HAProxyクライアントを初期化して設定内容を1回適用します。
+// ctx がキャンセルされた場合や max_apply_duration を過ぎた場合は、HAProxy への操作の再試行の待機を中断します
+func applyOnce(ctx context.Context, config *Config) error {
+	opts := applyOptions{
+		parallelBackends: *parallelBackendsFlag,
+		prune:            *pruneFlag || *pruneOnlyFlag,
+		pruneOnly:        *pruneOnlyFlag,
+		force:            *forceFlag,
+		seed:             *seedFlag,
+		maxChangePercent: *maxChangePercentFlag,
+		attempts:         *maxRetriesFlag + 1, // リトライ回数に最初の1回を加えた試行回数（未指定の -1 は 0 となり既定の回数）
+		tags:             tagFilter{include: tagFlag, exclude: excludeTagFlag},
+		skipPhases:       map[string]string{},
+	}
+	servers, err := compileServerFilter(*serverFilterFlag)
+	if err != nil {
+		return err
+	}
+	opts.tags.servers = servers
+	if *noAlgorithmFlag {
+		opts.skipPhases["algorithm"] = "-no-algorithm"
+	}
+	if *noRetryPolicyFlag {
+		opts.skipPhases["retry-policy"] = "-no-retry-policy"
+	}
+	if *gracefulRemoveFlag {
+		drain, err := newDrainPolicy(*drainTimeoutFlag, *drainOnTimeoutFlag)
+		if err != nil {
+			return err
+		}
+		opts.drain = drain
+	}
+	if *skipUnresolvableFlag {
+		opts.resolver = net.DefaultResolver
+	}
+
+	// 実行IDはメトリクス、監査ログ、JSONログの変更イベントで共通です
+	start := time.Now()
+	runID := *runIDFlag
+	if runID == "" {
+		runID = defaultRunID(start)
+	}
+	changeRunID = runID
+	// max_apply_duration は -interactive の確認や適用前フックを含む、この時点からの所要時間の上限です
+	opts.deadline = newApplyDeadline(start, config.maxApplyDuration())
+	opts.ctx = ctx
+	if opts.deadline != nil {
+		var cancel context.CancelFunc
+		opts.ctx, cancel = context.WithDeadline(ctx, opts.deadline.at)
+		defer cancel()
+	}
+
+	// -dry-run 指定時は実際の適用と同じ順序で計画を表示し、各インスタンスの現在の状態を読み取って
+	// サーバーの差分を表示します（読み取りのみで、HAProxyへの変更は行いません）
+	if *dryRunFlag {
+		logf("[dry-run] 以下の順序で適用します:\n%s", formatPlan(planConfig(config, opts)))
+		if *explainFlag {
+			return explainEndpoints(config, opts)
+		}
+		return planEndpoints(config, opts)
+	}
+
+	// 変更を行う適用では、接続できないインスタンスに途中まで適用しないよう常にPingで確認します
+	if *skipPingFlag {
+		warnf("-skip-ping は変更を行う apply では無視されます（Pingで疎通を確認します）")
+	}
+
+	// -interactive では計画を表示し、確認されてから適用します（確認済みの場合は削除前の確認を省略します）
+	confirmed, err := interactiveConfirm(config, opts, func() (bool, error) { return confirmApply(os.Stdin, os.Stdout) })
+	if err != nil {
+		return err
+	}
+
+	// 設定で指定されたフックを解決します
+	hooks, err := resolveHooks(config.Hooks)
+	if err != nil {
+		return fmt.Errorf("フックの解決に失敗: %w", err)
+	}
+
+	// 適用前フックの実行（失敗した場合は適用を中止）
+	if err := runPreApplyHooks(hooks, config); err != nil {
+		return fmt.Errorf("適用前フックの実行に失敗: %w", err)
+	}
+
+	// 端末から実行され -yes が指定されていない場合のみ、削除前に確認を求めます
+	// （複数インスタンスへの並列適用中でもプロンプトが重ならないよう1つずつ確認します）
+	if !*yesFlag && !confirmed && stdinIsTerminal() {
+		var confirmMu sync.Mutex
+		opts.confirmRemoval = func(removals []haproxy.Server) (bool, error) {
+			confirmMu.Lock()
+			defer confirmMu.Unlock()
+			return stdinConfirm(removals)
+		}
+		opts.confirmBackendRemoval = func(backends []string) (bool, error) {
+			confirmMu.Lock()
+			defer confirmMu.Unlock()
+			return stdinConfirmBackends(backends)
+		}
+	}
+
+	// -pushgateway 指定時は適用結果のメトリクスを集計します
+	var metrics *applyMetrics
+	if *pushgatewayFlag != "" {
+		metrics = newApplyMetrics(start)
+	}
+
+	// -profile 指定時はフェーズと操作ごとの所要時間を計測します
+	profile := startProfiling()
+
+	// -audit-log 指定時は変更操作ごとに監査ログへ追記します
+	var audit *auditLog
+	if *auditLogFlag != "" {
+		audit, err = openAuditLog(*auditLogFlag, runID, firstNonEmpty(*operatorFlag, os.Getenv("USER")))
+		if err != nil {
+			return fmt.Errorf("監査ログ[%s]を開けません: %w", *auditLogFlag, err)
+		}
+		defer audit.Close()
+	}
+
+	// 各HAProxyインスタンスにバックエンドサーバー、ロードバランシングアルゴリズム、再接続ポリシーを適用
+	// 失敗が続くインスタンスはサーキットブレーカーにより一時的に適用を見送ります
+	breaker := sharedBreaker()
+	outcomes := applyToEndpoints(config.HaproxyEndpoint, *concurrencyFlag, *failFastFlag, func(endpoint string) (*Result, error) {
+		if opts.deadline.expired() {
+			return notStartedResult(), errApplyDeadline
+		}
+		if err := breaker.allow(endpoint); err != nil {
+			return &Result{}, err
+		}
+		result, err := applyToEndpoint(endpoint, config, opts, metrics, audit)
+		breaker.record(endpoint, err)
+		return result, err
+	})
+
+	var applyErr error
+	var results []*Result
+	for _, o := range outcomes {
+		if o.result != nil {
+			results = append(results, o.result)
+		}
+		if o.err != nil && applyErr == nil {
+			applyErr = o.err
+		}
+	}
+	if len(outcomes) > 1 {
+		if failures := logEndpointOutcomes(outcomes); failures > 0 {
+			applyErr = fmt.Errorf("%d/%d 台のインスタンスで適用に失敗しました（最初のエラー: %v）", failures, len(outcomes), applyErr)
+		}
+	}
+
+	// 適用後フックの実行（失敗しても警告のみ）
+	runPostApplyHooks(hooks, config, applyErr)
+
+	// メトリクスの送信（失敗しても警告のみ）
+	if metrics != nil {
+		metrics.finish(time.Now())
+		if err := pushMetrics(&http.Client{Timeout: 10 * time.Second}, *pushgatewayFlag, *environmentFlag, runID, metrics); err != nil {
+			warnf("Pushgateway へのメトリクスの送信に失敗: %v", err)
+		}
+	}
+
+	if profile != nil {
+		logf("%s", profile.format(*profileTopFlag))
+	}
+
+	// 指定されていればバックエンドごとの結果をJSONレポートとして出力
+	if *reportFlag != "" && len(results) > 0 {
+		if err := writeReport(*reportFlag, results); err != nil {
+			log.Printf("レポートの書き出しに失敗: %v", err)
+		}
+	}
+
+	// -format env 指定時は、適用結果の件数をシェル変数の代入として標準出力に書き出します（失敗時も出力）
+	if *resultFormatFlag == "env" {
+		failed := 0
+		for _, o := range outcomes {
+			if o.err != nil || o.skipped {
+				failed++
+			}
+		}
+		fmt.Print(formatEnvResults(results, len(outcomes), failed, runID))
+	}
+
+	// max_apply_duration により打ち切った場合は、適用しなかった操作を出力します。
+	// 打ち切り以外の理由で失敗したインスタンスがある場合は、通常の失敗として扱います
+	if remaining := deferredSummary(results); len(remaining) > 0 && !hasNonDeadlineFailure(outcomes) {
+		for _, line := range remaining {
+			logf("未適用: %s\n", line)
+		}
+		return fmt.Errorf("%w（%d 台のインスタンスに未適用の操作があります）", errApplyDeadline, len(remaining))
+	}
+
+	if applyErr != nil {
+		return fmt.Errorf("設定の適用に失敗: %w", applyErr)
+	}
+	return nil
+}
+
+// applyToEndpoint は、1つのインスタンスに接続して設定を適用します
+func applyToEndpoint(endpoint string, config *Config, opts applyOptions, metrics *applyMetrics, audit *auditLog) (*Result, error) {
+	// HAProxyクライアントの初期化（接続テスト付き）
+	client, err := newHAProxyClient(endpoint, config.APIKey, config.APIBasePath)
+	if err != nil {
+		err = fmt.Errorf("HAProxyクライアントの初期化に失敗: %w", err)
+		if metrics != nil {
+			metrics.record(endpoint, nil, err, nil, config)
+		}
+		return &Result{}, err
+	}
+	effective, skipped := config, []string(nil)
+	if *degradeFlag && !strings.HasPrefix(endpoint, socketScheme) {
+		if effective, skipped, err = degradeForEndpoint(client, config); err != nil {
+			return &Result{}, err
+		}
+	}
+	var result *Result
+	if *atomicFlag {
+		result, err = applyAtomically(client, func(tx haproxyClient) (*Result, error) {
+			return applyConfig(withAudit(tx, audit, endpoint), effective, opts)
+		})
+	} else {
+		result, err = applyConfig(withAudit(client, audit, endpoint), effective, opts)
+	}
+	if result != nil {
+		result.SkippedFeatures = skipped
+	}
+	// -flap-window 指定時は、適用後に直近で状態が変化したサーバーを報告します（失敗しても警告のみ）
+	if err == nil && *flapWindowFlag > 0 {
+		if ferr := reportFlapping(client, endpoint, *flapWindowFlag); ferr != nil {
+			warnf("インスタンス[%s]: 状態変化の確認に失敗: %v", endpoint, ferr)
+		}
+	}
+	// -output-state 指定時は、適用に失敗した場合も含めて適用後の実際の状態を書き出します
+	if *outputStateFlag != "" {
+		path := outputStatePath(*outputStateFlag, endpoint, len(config.HaproxyEndpoint))
+		if serr := writeStateSnapshot(client, endpoint, path); serr != nil {
+			log.Printf("インスタンス[%s]: 適用後の状態の書き出しに失敗: %v", endpoint, serr)
+		}
+	}
+	if metrics != nil {
+		metrics.record(endpoint, result, err, client, config)
+	}
+	return result, err
+}
+
+// planEndpoints は、各インスタンスの現在の状態を読み取り、実際の適用で行うサーバーの追加・更新・削除を表示します（-dry-run）。
+// 接続できないインスタンスは警告を出力し、設定ファイルから組み立てた計画のみとします
+func planEndpoints(config *Config, opts applyOptions) error {
+	for _, endpoint := range config.HaproxyEndpoint {
+		client, err := newReadOnlyClient(endpoint, config.APIKey, config.APIBasePath)
+		if err != nil {
+			warnf("[dry-run] インスタンス[%s]に接続できないため、現在の状態との差分は表示しません: %v", endpoint, err)
+			continue
+		}
+		entries, err := planServers(client, config, opts)
+		if err != nil {
+			return fmt.Errorf("インスタンス[%s]: %w", endpoint, err)
+		}
+		// -plan-format markdown では、PR のコメントに貼り付けられるよう計画を標準出力に書き出します
+		if *planFormatFlag == planFormatMarkdown {
+			fmt.Print(formatPlanMarkdown(fmt.Sprintf("インスタンス[%s]", endpoint), entries))
+			continue
+		}
+		var lines []string
+		for _, e := range entries {
+			if e.action != actionSkip {
+				lines = append(lines, e.String())
+			}
+		}
+		added, updated, removed := countPlanChanges(entries)
+		if len(lines) == 0 {
+			logf("[dry-run] インスタンス[%s]: 現在の状態からのサーバーの変更はありません\n", endpoint)
+			continue
+		}
+		logf("[dry-run] インスタンス[%s]の現在の状態に対するサーバーの変更（追加 %d, 更新 %d, 削除 %d）:\n%s", endpoint, added, updated, removed, formatPlan(lines))
+	}
+	return nil
+}
+
+// explainEndpoints は、各インスタンスの現在の状態を読み取り、サーバーごとの操作の理由を表示します（-explain）
+func explainEndpoints(config *Config, opts applyOptions) error {
+	for _, endpoint := range config.HaproxyEndpoint {
+		client, err := newReadOnlyClient(endpoint, config.APIKey, config.APIBasePath)
+		if err != nil {
+			return fmt.Errorf("インスタンス[%s]: HAProxyクライアントの初期化に失敗: %w", endpoint, err)
+		}
+		lines, err := explainServers(client, config, opts)
+		if err != nil {
+			return fmt.Errorf("インスタンス[%s]: %w", endpoint, err)
+		}
+		logf("[dry-run] インスタンス[%s]のサーバーごとの操作と理由:\n%s", endpoint, formatPlan(lines))
+	}
+	return nil
+}
+
+// runRender は、設定内容を haproxy.cfg 形式で標準出力に書き出します（render サブコマンド）
+func runRender(config *Config) {
+	out, err := renderConfig(config)
+	if err != nil {
+		log.Fatalf("haproxy.cfg の生成に失敗: %v", err)
+	}
+	fmt.Print(out)
+}
+
+// runHealth は、正常なサーバーの割合が閾値に達するまで待ち、達しなければ終了コード 1 で終了します
+// （health サブコマンド、CIでの apply 後のゲート用）
+func runHealth(config *Config) {
+	if *healthyRatioFlag < 0 || *healthyRatioFlag > 1 {
+		log.Fatalf("-healthy-ratio は 0〜1 の範囲で指定してください（指定値: %v）", *healthyRatioFlag)
+	}
+	if *nagiosFlag {
+		runNagiosHealth(config)
+		return
+	}
+	// 全てのインスタンスで条件を満たした場合のみ合格とします
+	failed := false
+	for _, endpoint := range config.HaproxyEndpoint {
+		client, err := newReadOnlyClient(endpoint, config.APIKey, config.APIBasePath)
+		if err != nil {
+			log.Printf("インスタンス[%s]: HAProxyクライアントの初期化に失敗: %v", endpoint, err)
+			failed = true
+			continue
+		}
+
+		summary, err := waitForHealthy(client, config, healthGateOptions{
+			minHealthyRatio: *healthyRatioFlag,
+			timeout:         *healthTimeoutFlag,
+			interval:        *healthIntervalFlag,
+		})
+		for _, s := range summary.Unhealthy {
+			logf("インスタンス[%s]: 異常なサーバー: %s\n", endpoint, s)
+		}
+		if err != nil {
+			log.Printf("インスタンス[%s]: ヘルスチェックゲートに失敗: %v", endpoint, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+	logf("ヘルスチェックゲートに合格しました\n")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// stateClientFromConfig は、設定ファイル（export で書き出した状態など）のサーバーと server-template を
+// 現在の状態として持つメモリ上のクライアントを返します。HAProxyには接続しません
+func stateClientFromConfig(name string, state *Config) (haproxyClient, error) {
+	client := newMemoryClient(name)
+	for _, backend := range state.Backends {
+		if backend.SRV != "" {
+			template := buildServerTemplate(state, backend)
+			if err := client.AddServerTemplate(&template); err != nil {
+				return nil, fmt.Errorf("server-template[%s]の読み込みに失敗: %w", serverKey(backend.Group, backend.Name), err)
+			}
+			continue
+		}
+		server := buildServer(state, backend)
+		if err := client.AddServer(&server); err != nil {
+			return nil, fmt.Errorf("サーバー[%s]の読み込みに失敗: %w", serverKey(backend.Group, backend.Name), err)
+		}
+	}
+	return client, nil
+}
+
+// runCompare は、設定ファイルと -compare-file のファイル（以前に export した状態、または別の設定ファイル）を
+// 比較し、-explain と同じ形式でサーバーごとの差分を表示します（compare サブコマンド）。
+// -compare-file のサーバーを現在の状態とみなすため、設定ファイルに記載のないサーバーは削除として表示します
+// （差分の確認のため、min_servers による削除の保護は無視します）
+func runCompare(config *Config) {
+	if *compareFileFlag == "" {
+		log.Fatal("compare には -compare-file で比較するファイルを指定してください")
+	}
+	state, err := loadConfig(*compareFileFlag)
+	if err != nil {
+		log.Fatalf("比較するファイル[%s]の読み込みに失敗: %v", *compareFileFlag, err)
+	}
+	client, err := stateClientFromConfig("compare-file:"+*compareFileFlag, state)
+	if err != nil {
+		log.Fatalf("比較するファイル[%s]: %v", *compareFileFlag, err)
+	}
+	opts := applyOptions{prune: true, force: true}
+	if *planFormatFlag == planFormatMarkdown {
+		entries, err := planServers(client, config, opts)
+		if err != nil {
+			log.Fatalf("差分の算出に失敗: %v", err)
+		}
+		fmt.Print(formatPlanMarkdown(fmt.Sprintf("%s と %s の差分", *configFlag, *compareFileFlag), entries))
+		return
+	}
+	lines, err := explainServers(client, config, opts)
+	if err != nil {
+		log.Fatalf("差分の算出に失敗: %v", err)
+	}
+	fmt.Printf("%s と %s の差分（%s を現在の状態とした場合のサーバーごとの操作）:\n%s", *configFlag, *compareFileFlag, *compareFileFlag, formatPlan(lines))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareConfigAgainstExportedState(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://compare"],
+		"load_balancing_algorithm": "roundrobin",
+		"groups": [{"name": "web", "min_servers": 3}],
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 20, "group": "web"},
+			{"name": "web-4", "ip": "10.0.0.4", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	state := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://exported"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	client, err := stateClientFromConfig(t.Name(), state)
+	if err != nil {
+		t.Fatalf("stateClientFromConfig がエラーを返しました: %v", err)
+	}
+	lines, err := explainServers(client, config, applyOptions{prune: true, force: true})
+	if err != nil {
+		t.Fatalf("explainServers がエラーを返しました: %v", err)
+	}
+
+	want := []string{
+		"サーバー[web/web-1]: 変更なし（設定ファイルと同じ内容です）",
+		"サーバー[web/web-2]: 更新（weight が異なります 10->20）",
+		"サーバー[web/web-4]: 追加（HAProxy上に存在しません）",
+		"サーバー[web/web-3]: 削除（設定ファイルに記載がありません）",
+	}
+	if got := strings.Join(lines, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("差分 =\n%s\nwant\n%s（min_servers による削除の保護は無視すること）", got, strings.Join(want, "\n"))
+	}
+	if servers, _ := client.GetServers(); len(servers) != 3 {
+		t.Errorf("比較後の状態のサーバー数 = %d, want 3（比較では変更しないこと）", len(servers))
+	}
+}
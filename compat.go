@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// apiFeature は、設定ファイルで使える機能と、それを扱える Data Plane API の最小バージョンです
+type apiFeature struct {
+	id         string // critical_features やレポートで使う識別子
+	name       string
+	minVersion string
+	critical   bool // 未対応の場合に適用全体を中止するかどうかの既定値（critical_features で変更可）
+	used       func(config *Config) bool
+	strip      func(config *Config) // 設定からこの機能を取り除きます（nil の場合は取り除けないため常に critical）
+}
+
+// apiFeatures は機能と最小バージョンの対応表です。新しい設定項目を追加した場合はここにも追加してください
+var apiFeatures = []apiFeature{
+	{id: "servers", name: "サーバーの追加・更新", minVersion: "2.0", critical: true, used: func(c *Config) bool { return len(c.Backends) > 0 }},
+	{id: "maxconn", name: "maxconn", minVersion: "2.0", used: anyBackend(func(b BackendConfig) bool { return b.Maxconn > 0 }),
+		strip: stripBackends(func(b *BackendConfig) { b.Maxconn = 0 })},
+	{id: "source", name: "source", minVersion: "2.0", critical: true, used: anyBackend(func(b BackendConfig) bool { return b.Source != "" }),
+		strip: stripBackends(func(b *BackendConfig) { b.Source = "" })},
+	{id: "tls", name: "TLS（ssl, verify, sni）", minVersion: "2.0", critical: true, used: anyBackend(func(b BackendConfig) bool { return b.SSL })},
+	{id: "client-cert", name: "クライアント証明書（ssl_client_cert）", minVersion: "2.0", critical: true,
+		used: anyBackend(func(b BackendConfig) bool { return b.SSLClientCert != "" })},
+	{id: "server-id", name: "サーバーの id", minVersion: "2.0", used: anyBackend(func(b BackendConfig) bool { return b.ID > 0 }),
+		strip: stripBackends(func(b *BackendConfig) { b.ID = 0 })},
+	{id: "alpn-npn", name: "ALPN / NPN", minVersion: "2.1", used: anyBackend(func(b BackendConfig) bool { return len(applyWebsocketServerDefaults(b).ALPN) > 0 || len(b.NPN) > 0 }),
+		strip: stripBackends(func(b *BackendConfig) { b.ALPN, b.NPN = nil, nil })},
+	{id: "state-intervals", name: "downinter / fastinter", minVersion: "2.1", used: usesStateIntervals, strip: stripStateIntervals},
+	{id: "tcp-check", name: "check_send / check_expect", minVersion: "2.2", critical: true, used: usesTCPCheck},
+	{id: "stick-table", name: "stick-table", minVersion: "2.1", used: anyGroup(func(g GroupConfig) bool { return g.Stick != nil }),
+		strip: stripGroups(func(g *GroupConfig) { g.Stick = nil })},
+	{id: "retry-on", name: "retry_on", minVersion: "2.1", used: anyBackend(func(b BackendConfig) bool { return len(b.RetryOn) > 0 }),
+		strip: stripBackends(func(b *BackendConfig) { b.RetryOn = nil })},
+	{id: "fullconn", name: "fullconn", minVersion: "2.0", used: anyBackend(func(b BackendConfig) bool { return b.Fullconn > 0 }),
+		strip: stripBackends(func(b *BackendConfig) { b.Fullconn = 0 })},
+	{id: "websocket", name: "websocket / http_reuse / tunnel_timeout", minVersion: "2.0",
+		used: func(c *Config) bool {
+			return anyBackend(func(b BackendConfig) bool { return b.Websocket || b.HTTPReuse != "" || b.TunnelTimeout != "" })(c) ||
+				anyGroup(func(g GroupConfig) bool { return g.HTTPReuse != "" })(c)
+		},
+		strip: func(c *Config) {
+			stripBackends(func(b *BackendConfig) { b.Websocket, b.HTTPReuse, b.TunnelTimeout = false, "", "" })(c)
+			stripGroups(func(g *GroupConfig) { g.HTTPReuse = "" })(c)
+		}},
+	{id: "labels", name: "サーバーのラベル（labels）", minVersion: "3.0", used: anyBackend(func(b BackendConfig) bool { return len(b.Labels) > 0 }),
+		strip: stripBackends(func(b *BackendConfig) { b.Labels = nil })},
+	{id: "backend-mode", name: "バックエンドの mode", minVersion: "2.1", used: anyGroup(func(g GroupConfig) bool { return g.Mode != "" }),
+		strip: stripGroups(func(g *GroupConfig) { g.Mode = "" })},
+	{id: "http-rules", name: "ヘッダー操作ルール（http_rules）", minVersion: "2.1", used: func(c *Config) bool { return len(c.HTTPRules) > 0 },
+		strip: func(c *Config) { c.HTTPRules = nil }},
+	{id: "frontend-logging", name: "frontend のログの形式（httplog, tcplog, log_format）", minVersion: "2.0", used: func(c *Config) bool { return len(c.Frontends) > 0 },
+		strip: func(c *Config) { c.Frontends = nil }},
+	{id: "proxy-protocol", name: "PROXY プロトコル（send_proxy, proxy_v2_options）", minVersion: "2.0", critical: true,
+		used: anyBackend(func(b BackendConfig) bool { return b.SendProxy != "" })},
+	{id: "unix-socket", name: "unix ソケットのサーバー（socket）", minVersion: "2.0", critical: true, used: anyBackend(func(b BackendConfig) bool { return b.Socket != "" })},
+	{id: "resolvers", name: "resolvers セクション（nameservers）", minVersion: "2.0", used: func(c *Config) bool { return len(managedResolvers(c)) > 0 },
+		strip: func(c *Config) {
+			for i := range c.Resolvers {
+				c.Resolvers[i].Nameservers = nil
+				c.Resolvers[i].TimeoutResolve, c.Resolvers[i].TimeoutRetry, c.Resolvers[i].HoldValid = "", "", ""
+			}
+		}},
+	{id: "cache", name: "cache セクションとキャッシュの利用（caches, cache）", minVersion: "2.0", used: func(c *Config) bool { return len(c.Caches) > 0 },
+		strip: func(c *Config) {
+			c.Caches = nil
+			for i := range c.Groups {
+				c.Groups[i].Cache = ""
+			}
+			for i := range c.Frontends {
+				c.Frontends[i].Cache = ""
+			}
+		}},
+	{id: "peers", name: "peers セクションと stick-table の共有（peers, stick.peers）", minVersion: "2.1", used: func(c *Config) bool { return len(c.Peers) > 0 },
+		strip: func(c *Config) {
+			c.Peers = nil
+			for i := range c.Groups {
+				if c.Groups[i].Stick != nil {
+					c.Groups[i].Stick.Peers = ""
+				}
+			}
+		}},
+	{id: "mailers", name: "mailers セクションとメール通知（mailers, email_alert）", minVersion: "2.2", used: func(c *Config) bool { return len(c.Mailers) > 0 },
+		strip: func(c *Config) {
+			c.Mailers = nil
+			for i := range c.Groups {
+				c.Groups[i].EmailAlert = ""
+			}
+		}},
+	{id: "server-template", name: "server-template（srv）", minVersion: "2.2", critical: true, used: anyBackend(func(b BackendConfig) bool { return b.SRV != "" })},
+}
+
+// anyBackend は、条件を満たすバックエンドが1つでもあるかを判定する関数を返します
+func anyBackend(match func(b BackendConfig) bool) func(config *Config) bool {
+	return func(config *Config) bool {
+		for _, b := range config.Backends {
+			if match(b) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// anyGroup は、条件を満たすグループが1つでもあるかを判定する関数を返します
+func anyGroup(match func(g GroupConfig) bool) func(config *Config) bool {
+	return func(config *Config) bool {
+		for _, g := range config.Groups {
+			if match(g) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// usesStateIntervals は、全体またはサーバー個別のヘルスチェックで downinter / fastinter を使っているかを返します
+func usesStateIntervals(config *Config) bool {
+	if config.HealthCheck.Downinter != "" || config.HealthCheck.Fastinter != "" {
+		return true
+	}
+	return anyBackend(func(b BackendConfig) bool {
+		return b.HealthCheck != nil && (b.HealthCheck.Downinter != nil || b.HealthCheck.Fastinter != nil)
+	})(config)
+}
+
+// usesTCPCheck は、全体またはサーバー個別のヘルスチェック設定で check_send / check_expect を使っているかを返します
+func usesTCPCheck(config *Config) bool {
+	if config.HealthCheck.CheckSend != "" || config.HealthCheck.CheckExpect != "" {
+		return true
+	}
+	return anyBackend(func(b BackendConfig) bool {
+		return b.HealthCheck != nil && (b.HealthCheck.CheckSend != nil || b.HealthCheck.CheckExpect != nil)
+	})(config)
+}
+
+// unsupportedFeatures は、設定で使われている機能のうち、指定した API バージョンで使えない機能を返します
+func unsupportedFeatures(config *Config, version string) ([]apiFeature, error) {
+	current, err := parseVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	var unsupported []apiFeature
+	for _, f := range apiFeatures {
+		if !f.used(config) {
+			continue
+		}
+		required, err := parseVersion(f.minVersion)
+		if err != nil {
+			return nil, fmt.Errorf("機能[%s]の最小バージョンが不正です: %w", f.name, err)
+		}
+		if compareVersions(current, required) < 0 {
+			unsupported = append(unsupported, f)
+		}
+	}
+	return unsupported, nil
+}
+
+// parseVersion は、"v2.1.3" や "2.2" などのバージョン文字列を数値の列に変換します
+func parseVersion(version string) ([]int, error) {
+	v := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	// "2.4.1-abcdef" のような付加情報は無視します
+	if i := strings.IndexAny(v, "-+ "); i >= 0 {
+		v = v[:i]
+	}
+	var parts []int
+	for _, p := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("バージョン[%s]を解釈できません", version)
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
+
+// compareVersions は、a が b より古ければ負、同じなら 0、新しければ正の値を返します。
+// 桁数が異なる場合、足りない桁は 0 として扱います
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// runValidateOnly は、各インスタンスの API バージョンを取得し、設定で使う機能に対応しているかのみを確認します。
+// 変更は一切行わず、対応していない機能があれば終了コード 1 で終了します（apply -validate-only）
+func runValidateOnly(config *Config) {
+	failed := false
+	for _, endpoint := range config.HaproxyEndpoint {
+		client, err := newReadOnlyClient(endpoint, config.APIKey, config.APIBasePath)
+		if err != nil {
+			log.Printf("インスタンス[%s]: HAProxyクライアントの初期化に失敗: %v", endpoint, err)
+			failed = true
+			continue
+		}
+		version, err := client.GetAPIVersion()
+		if err != nil {
+			log.Printf("インスタンス[%s]: APIバージョンの取得に失敗: %v", endpoint, err)
+			failed = true
+			continue
+		}
+		// runtime socket は Data Plane API ではないため、バージョンによる判定は行いません
+		if strings.HasPrefix(endpoint, socketScheme) {
+			logf("インスタンス[%s]: runtime socket のためAPIバージョンの確認をスキップしました\n", endpoint)
+			continue
+		}
+		unsupported, err := unsupportedFeatures(config, version)
+		if err != nil {
+			log.Printf("インスタンス[%s]: %v", endpoint, err)
+			failed = true
+			continue
+		}
+		if len(unsupported) == 0 {
+			logf("インスタンス[%s]: APIバージョン %s で設定内容の全ての機能を使用できます\n", endpoint, version)
+			continue
+		}
+		failed = true
+		for _, f := range unsupported {
+			log.Printf("インスタンス[%s]: %s は APIバージョン %s 以降が必要です（現在: %s）", endpoint, f.name, f.minVersion, version)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
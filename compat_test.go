@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// compatTestConfig は、stick-table（2.1）と server-template（2.2）を使う設定です
+const compatTestConfig = `{
+	"haproxy_endpoint": ["memory://compat"],
+	"load_balancing_algorithm": "roundrobin",
+	"resolvers": [{"name": "consul"}],
+	"groups": [{"name": "web", "stick": {"type": "ip", "size": "200k", "on": "src"}}],
+	"backends": [
+		{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+		{"name": "api", "srv": "_http._tcp.api.service.consul", "resolver": "consul", "count": 3, "weight": 10, "group": "api"}
+	]
+}`
+
+func TestUnsupportedFeaturesByAPIVersion(t *testing.T) {
+	config := loadTestConfig(t, compatTestConfig)
+	for _, tt := range []struct {
+		version string
+		want    []string
+	}{
+		{"v2.2.1", nil},
+		{"3.0", nil},
+		{"v2.1.4-5ba1d3c", []string{"server-template"}},
+		{"v2.0", []string{"stick-table", "server-template"}},
+	} {
+		unsupported, err := unsupportedFeatures(config, tt.version)
+		if err != nil {
+			t.Fatalf("unsupportedFeatures(%s) がエラーを返しました: %v", tt.version, err)
+		}
+		var ids []string
+		for _, f := range unsupported {
+			ids = append(ids, f.id)
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("APIバージョン %s で未対応の機能 = %v, want %v", tt.version, ids, tt.want)
+		}
+	}
+	if _, err := unsupportedFeatures(config, "unknown"); err == nil {
+		t.Error("解釈できないバージョンがエラーになりませんでした")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		sign int
+	}{
+		{"2.1", "2.1.0", 0},
+		{"v2.10", "2.9", 1},
+		{"2.0.9", "2.1", -1},
+	} {
+		a, _ := parseVersion(tt.a)
+		b, _ := parseVersion(tt.b)
+		got := compareVersions(a, b)
+		if (got > 0) != (tt.sign > 0) || (got < 0) != (tt.sign < 0) {
+			t.Errorf("compareVersions(%s, %s) = %d, want 符号 %d", tt.a, tt.b, got, tt.sign)
+		}
+	}
+}
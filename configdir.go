@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// loadConfigDir は、ディレクトリ内の設定ファイル（*.json, *.yaml, *.yml）を形式に関わらずファイル名の辞書順に読み込んでマージします。
+// Kubernetes の ConfigMap をマウントした場合の ..data などの隠しファイルは無視します
+func loadConfigDir(dir string) (*Config, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	merged := map[string]interface{}{}
+	loaded := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		// ConfigMap のファイルはシンボリックリンクのため、リンク先で判定します
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		var read func(string, interface{}) error
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".json":
+			read = readJSONFile
+		case ".yaml", ".yml":
+			read = readYAMLFile
+		default:
+			continue
+		}
+
+		var fragment interface{}
+		if err := read(path, &fragment); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		// apiVersion はファイルごとに異なり得るため、マージする前にそれぞれ現在のスキーマに移行します
+		if fragment, err = migrateConfig(path, fragment); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if _, ok := fragment.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("%s: 設定ファイルはオブジェクト（YAML ではマッピング）で記述してください", path)
+		}
+		for key := range replacedConfigKeys {
+			if _, ok := fragment.(map[string]interface{})[key]; ok {
+				delete(merged, key)
+			}
+		}
+		merged = mergeConfigValues(merged, fragment).(map[string]interface{})
+		loaded++
+	}
+	if loaded == 0 {
+		return nil, errors.New(dir + " に設定ファイル（*.json, *.yaml, *.yml）がありません")
+	}
+
+	// マージ結果を通常の設定ファイルと同じ手順で読み込みます
+	return decodeConfig(merged)
+}
+
+// replacedConfigKeys は、配列でも連結せずに後のファイルの値で置き換える設定項目です。
+// 接続先は v2 で常に配列になりますが、複数のファイルで指定した場合に連結すると意図しないインスタンスにも適用されてしまいます
+var replacedConfigKeys = map[string]bool{"haproxy_endpoint": true}
+
+// mergeConfigValues は、設定ファイルの断片 src を dst にマージした値を返します。
+// オブジェクトはキーごとに再帰的にマージし、配列同士は連結し、それ以外は後のファイルの値で上書きします（replacedConfigKeys は呼び出し側で除きます）
+func mergeConfigValues(dst, src interface{}) interface{} {
+	switch s := src.(type) {
+	case map[string]interface{}:
+		d, ok := dst.(map[string]interface{})
+		if !ok {
+			return s
+		}
+		for k, v := range s {
+			d[k] = mergeConfigValues(d[k], v)
+		}
+		return d
+	case []interface{}:
+		if d, ok := dst.([]interface{}); ok {
+			return append(d, s...)
+		}
+		return s
+	default:
+		return src
+	}
+}
+
+// 書き込み途中の設定ファイルを読んだ場合に再読み込みする回数と間隔です
+// （合計で約1秒待っても読めなければ、書き込み途中ではなく内容の誤りとみなします）
+var (
+	configReadRetries    = 5
+	configReadRetryDelay = 200 * time.Millisecond
+)
+
+// readJSONFile は、JSONファイルを読み込んで v にパースします。
+// 別のプロセスがファイルを切り詰めてから書き込んでいる途中に読んだ場合（空や途中までの内容）に備え、
+// JSONの構文エラーの場合のみ少し待って読み直します
+func readJSONFile(path string, v interface{}) error {
+	var err error
+	for i := 0; i < configReadRetries; i++ {
+		if i > 0 {
+			time.Sleep(configReadRetryDelay)
+		}
+		var data []byte
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return err
+		}
+		err = json.Unmarshal(data, v)
+		var syntaxErr *json.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			return err
+		}
+	}
+	return err
+}
+
+// readYAMLFile は、YAMLファイルを読み込んで v にパースします。
+// JSON に変換してからパースするため、JSON の設定ファイルと同じ項目名・同じ値の型で読み込めます。
+// 書き込み途中に備え、readJSONFile と同様に YAML の構文エラーの場合のみ少し待って読み直します
+func readYAMLFile(path string, v interface{}) error {
+	var err error
+	for i := 0; i < configReadRetries; i++ {
+		if i > 0 {
+			time.Sleep(configReadRetryDelay)
+		}
+		var data []byte
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return err
+		}
+		if data, err = yaml.YAMLToJSON(data); err == nil {
+			return json.Unmarshal(data, v)
+		}
+	}
+	return err
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigDirMergesFragments(t *testing.T) {
+	captureOutput(t)
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"00-base.json":   `{"apiVersion": "v2", "haproxy_endpoint": ["memory://base"], "backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10}]}`,
+		"10-web.json":    `{"apiVersion": "v2", "haproxy_endpoint": ["memory://override"], "backends": [{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10}]}`,
+		".hidden.json":   `{"backends": [{"name": "hidden", "ip": "10.0.0.9", "port": 80, "weight": 10}]}`,
+		"20-legacy.json": `{"haproxy_endpoint": "memory://legacy"}`,
+		"README.txt":     `設定ファイルではありません`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := loadConfigDir(dir)
+	if err != nil {
+		t.Fatalf("loadConfigDir がエラーを返しました: %v", err)
+	}
+	if len(config.Backends) != 2 || config.Backends[0].Name != "web-1" || config.Backends[1].Name != "web-2" {
+		t.Errorf("マージ後の backends = %+v, want web-1, web-2（配列は連結し、隠しファイルは無視すること）", config.Backends)
+	}
+	if len(config.HaproxyEndpoint) != 1 || config.HaproxyEndpoint[0] != "memory://legacy" {
+		t.Errorf("マージ後の haproxy_endpoint = %v, want [memory://legacy]（連結せず後のファイルで置き換えること）", config.HaproxyEndpoint)
+	}
+}
+
+func TestLoadConfigDirMergesObjects(t *testing.T) {
+	captureOutput(t)
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"a.json": `{"apiVersion": "v2", "haproxy_endpoint": ["memory://a"], "load_balancing_algorithm": "roundrobin",
+			"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2}, "backends": []}`,
+		"b.json": `{"load_balancing_algorithm": "leastconn", "health_check": {"interval": 10}}`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config, err := loadConfigDir(dir)
+	if err != nil {
+		t.Fatalf("loadConfigDir がエラーを返しました: %v", err)
+	}
+	if config.LoadBalancingAlgorithm != "leastconn" {
+		t.Errorf("load_balancing_algorithm = %q, want leastconn（辞書順で後のファイルが優先）", config.LoadBalancingAlgorithm)
+	}
+	if hc := config.HealthCheck; !hc.Enabled || hc.Interval != 10 || hc.Fall != 3 {
+		t.Errorf("health_check = %+v, want 指定したキーのみ上書き（enabled true, interval 10, fall 3）", hc)
+	}
+}
+
+func TestLoadConfigDirMergesJSONAndYAML(t *testing.T) {
+	captureOutput(t)
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"00-base.yaml": `apiVersion: v2
+haproxy_endpoint: ["memory://base"]
+load_balancing_algorithm: roundrobin
+health_check: {enabled: true, interval: 2, fall: 3, rise: 2}
+backends:
+  - {name: web-1, ip: 10.0.0.1, port: 80, weight: 10}
+`,
+		"10-web.json": `{"apiVersion": "v2", "load_balancing_algorithm": "leastconn", "health_check": {"interval": 10},
+			"backends": [{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10}]}`,
+		"20-endpoint.yml": `haproxy_endpoint:
+  - memory://yml
+backends:
+  - name: web-3
+    ip: 10.0.0.3
+    port: 80
+    weight: 20
+`,
+		".hidden.yaml": "backends: [{name: hidden, ip: 10.0.0.9, port: 80, weight: 10}]\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := loadConfigDir(dir)
+	if err != nil {
+		t.Fatalf("loadConfigDir がエラーを返しました: %v", err)
+	}
+	var names []string
+	for _, b := range config.Backends {
+		names = append(names, b.Name)
+	}
+	if len(names) != 3 || names[0] != "web-1" || names[1] != "web-2" || names[2] != "web-3" {
+		t.Errorf("マージ後の backends = %v, want web-1, web-2, web-3（形式に関わらずファイル名の辞書順に連結すること）", names)
+	}
+	if config.Backends[2].Weight != 20 || config.Backends[2].Port != 80 {
+		t.Errorf("YAML の web-3 = %+v, want weight 20, port 80", config.Backends[2])
+	}
+	if config.LoadBalancingAlgorithm != "leastconn" {
+		t.Errorf("load_balancing_algorithm = %q, want leastconn（辞書順で後の JSON が YAML より優先）", config.LoadBalancingAlgorithm)
+	}
+	if hc := config.HealthCheck; !hc.Enabled || hc.Interval != 10 || hc.Fall != 3 {
+		t.Errorf("health_check = %+v, want 指定したキーのみ上書き（enabled true, interval 10, fall 3）", hc)
+	}
+	if len(config.HaproxyEndpoint) != 1 || config.HaproxyEndpoint[0] != "memory://yml" {
+		t.Errorf("マージ後の haproxy_endpoint = %v, want [memory://yml]（連結せず後のファイルで置き換えること）", config.HaproxyEndpoint)
+	}
+}
+
+func TestLoadConfigDirErrors(t *testing.T) {
+	prevDelay := configReadRetryDelay
+	configReadRetryDelay = 0 // 不正な JSON の再読み込みを待たないようにします
+	t.Cleanup(func() { configReadRetryDelay = prevDelay })
+	for name, files := range map[string]map[string]string{
+		"不正な YAML": {"a.json": `{"backends": []}`, "b.yaml": "backends: [\n"},
+		"YAML の配列": {"a.yml": "- name: web-1\n"},
+		"空":        {"README.txt": "設定ファイルではありません", ".hidden.json": `{}`},
+		"配列":       {"a.json": `[]`},
+		"不正な JSON": {"a.json": `{"backends": [`},
+	} {
+		dir := t.TempDir()
+		for file, data := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := loadConfigDir(dir); err == nil {
+			t.Errorf("%s のディレクトリの読み込みがエラーになりませんでした", name)
+		}
+	}
+}
+
+func TestReadJSONFileRetriesTruncatedRead(t *testing.T) {
+	prevDelay := configReadRetryDelay
+	configReadRetryDelay = 50 * time.Millisecond
+	t.Cleanup(func() { configReadRetryDelay = prevDelay })
+	path := writeTestFile(t, "config.json", `{"backends": [{"name": "web-1"`)
+
+	// 書き込み中のプロセスを模して、最初の読み込みの後に完全な内容へ置き換えます
+	written := make(chan error, 1)
+	go func() {
+		time.Sleep(configReadRetryDelay / 2)
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, []byte(`{"backends": [{"name": "web-1"}]}`), 0o644); err != nil {
+			written <- err
+			return
+		}
+		written <- os.Rename(tmp, path)
+	}()
+
+	var v struct {
+		Backends []struct{ Name string } `json:"backends"`
+	}
+	if err := readJSONFile(path, &v); err != nil {
+		t.Fatalf("書き込み途中の読み込みの後の readJSONFile がエラーを返しました: %v", err)
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Backends) != 1 || v.Backends[0].Name != "web-1" {
+		t.Errorf("readJSONFile の結果 = %+v, want 書き込み完了後の内容", v)
+	}
+}
+
+func TestReadJSONFileGivesUp(t *testing.T) {
+	prevDelay := configReadRetryDelay
+	configReadRetryDelay = 0
+	t.Cleanup(func() { configReadRetryDelay = prevDelay })
+	var v interface{}
+	if err := readJSONFile(writeTestFile(t, "config.json", `{"backends": [`), &v); err == nil {
+		t.Error("途中までの内容のままのファイルの readJSONFile がエラーになりませんでした")
+	}
+	// 構文は正しく型が異なる場合は内容の誤りのため、読み直さずにエラーを返します
+	var n int
+	if err := readJSONFile(writeTestFile(t, "config.json", `{}`), &n); err == nil {
+		t.Error("型の異なる JSON の readJSONFile がエラーになりませんでした")
+	}
+}
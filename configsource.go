@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// 設定の読み込み元のスキームです（スキームのないパスはファイルまたはディレクトリとして読み込みます）
+const (
+	fileSourceScheme  = "file://"
+	envSourceScheme   = "env://"
+	vaultSourceScheme = "vault://"
+)
+
+// 設定の読み込み元に関する環境変数です
+const (
+	envVaultAddr  = "VAULT_ADDR"
+	envVaultToken = "VAULT_TOKEN"
+)
+
+// configSourceTimeout は、HTTP や Vault から設定を取得する際のタイムアウトです
+const configSourceTimeout = 10 * time.Second
+
+// defaultVaultField は、vault:// で # によるフィールドの指定がない場合に設定を読み込むシークレットのフィールドです
+const defaultVaultField = "config"
+
+// configSource は、設定の読み込み元です。-config の値のスキームによって実装を選びます
+type configSource interface {
+	// Load は、設定を読み込み、現在のスキーマに移行して返します
+	Load() (*Config, error)
+}
+
+// fileSource は、ファイルまたはディレクトリ（中の *.json, *.yaml をマージ）から設定を読み込みます
+type fileSource struct {
+	path string
+}
+
+// httpSource は、HTTP(S) の GET で取得した JSON を設定として読み込みます
+type httpSource struct {
+	url    string
+	client *http.Client
+}
+
+// envSource は、環境変数に格納された JSON を設定として読み込みます（例: env://LB_HAPROXY_CONFIG）
+type envSource struct {
+	name   string
+	getenv func(string) string
+}
+
+// vaultSource は、Vault の KV シークレットのフィールドに格納された設定を読み込みます
+// （例: vault://secret/data/lb_haproxy#config。接続先とトークンは VAULT_ADDR / VAULT_TOKEN で指定します）
+type vaultSource struct {
+	path   string
+	field  string
+	getenv func(string) string
+	client *http.Client
+}
+
+// newConfigSource は、-config の値のスキームに対応する読み込み元を返します
+func newConfigSource(location string) configSource {
+	client := &http.Client{Timeout: configSourceTimeout}
+	switch {
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		return &httpSource{url: location, client: client}
+	case strings.HasPrefix(location, envSourceScheme):
+		return &envSource{name: strings.TrimPrefix(location, envSourceScheme), getenv: os.Getenv}
+	case strings.HasPrefix(location, vaultSourceScheme):
+		path, field := strings.TrimPrefix(location, vaultSourceScheme), defaultVaultField
+		if i := strings.LastIndex(path, "#"); i >= 0 {
+			path, field = path[:i], path[i+1:]
+		}
+		return &vaultSource{path: strings.Trim(path, "/"), field: field, getenv: os.Getenv, client: client}
+	}
+	return &fileSource{path: strings.TrimPrefix(location, fileSourceScheme)}
+}
+
+// decodeConfigValue は、読み込み元（source はログ用の名前）から取得した JSON の値を現在のスキーマに移行して変換します
+func decodeConfigValue(source string, value interface{}) (*Config, error) {
+	value, err := migrateConfig(source, value)
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfig(value)
+}
+
+// Load は、ファイルまたはディレクトリから設定を読み込みます
+func (s *fileSource) Load() (*Config, error) {
+	if info, err := os.Stat(s.path); err == nil && info.IsDir() {
+		return loadConfigDir(s.path)
+	}
+	var value interface{}
+	if err := readJSONFile(s.path, &value); err != nil {
+		return nil, err
+	}
+	return decodeConfigValue(s.path, value)
+}
+
+// Load は、URL から設定を取得して読み込みます。2xx 以外の応答はエラーとします
+func (s *httpSource) Load() (*Config, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("リクエストの作成に失敗: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	data, err := fetchConfigSource(s.client, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.url, err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.url, err)
+	}
+	return decodeConfigValue(s.url, value)
+}
+
+// Load は、環境変数の値を JSON の設定として読み込みます
+func (s *envSource) Load() (*Config, error) {
+	if s.name == "" {
+		return nil, errors.New("env:// の後に環境変数名を指定してください（例: env://LB_HAPROXY_CONFIG）")
+	}
+	data := s.getenv(s.name)
+	if strings.TrimSpace(data) == "" {
+		return nil, fmt.Errorf("環境変数 %s が設定されていません", s.name)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return nil, fmt.Errorf("環境変数 %s: %w", s.name, err)
+	}
+	return decodeConfigValue(envSourceScheme+s.name, value)
+}
+
+// Load は、Vault の HTTP API からシークレットを読み取り、フィールドの値を設定として読み込みます。
+// KV v2（data.data）と KV v1（data）のどちらの応答にも対応し、フィールドの値は JSON の文字列またはオブジェクトとします
+func (s *vaultSource) Load() (*Config, error) {
+	addr, token := strings.TrimRight(s.getenv(envVaultAddr), "/"), s.getenv(envVaultToken)
+	if addr == "" || token == "" {
+		return nil, fmt.Errorf("vault:// から読み込むには環境変数 %s と %s を指定してください", envVaultAddr, envVaultToken)
+	}
+	req, err := http.NewRequest(http.MethodGet, addr+"/v1/"+s.path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("リクエストの作成に失敗: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	data, err := fetchConfigSource(s.client, req)
+	if err != nil {
+		return nil, fmt.Errorf("Vault のシークレット[%s]: %w", s.path, err)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return nil, fmt.Errorf("Vault のシークレット[%s]の応答を解釈できません: %w", s.path, err)
+	}
+	fields := secret.Data
+	if inner, ok := fields["data"].(map[string]interface{}); ok {
+		if _, isV2 := fields["metadata"]; isV2 {
+			fields = inner
+		}
+	}
+	value, ok := fields[s.field]
+	if !ok {
+		return nil, fmt.Errorf("Vault のシークレット[%s]にフィールド[%s]がありません", s.path, s.field)
+	}
+	if text, isString := value.(string); isString {
+		if err := json.Unmarshal([]byte(text), &value); err != nil {
+			return nil, fmt.Errorf("Vault のシークレット[%s]のフィールド[%s]: %w", s.path, s.field, err)
+		}
+	}
+	return decodeConfigValue(vaultSourceScheme+s.path, value)
+}
+
+// fetchConfigSource は、リクエストを送信して応答の本文を返します。2xx 以外の応答はエラーとします
+func fetchConfigSource(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("取得に失敗しました: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
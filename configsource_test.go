@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sourceTestConfig は、読み込み元のテストで使う最小限の設定です
+const sourceTestConfig = `{
+	"haproxy_endpoint": ["memory://source"],
+	"load_balancing_algorithm": "roundrobin",
+	"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10}]
+}`
+
+// assertSourceConfig は、読み込んだ設定が sourceTestConfig の内容であることを確認します
+func assertSourceConfig(t *testing.T, config *Config, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Load がエラーを返しました: %v", err)
+	}
+	if len(config.Backends) != 1 || config.Backends[0].Name != "web-1" {
+		t.Errorf("読み込んだバックエンド = %+v, want web-1 のみ", config.Backends)
+	}
+}
+
+func TestNewConfigSourceSelectsByScheme(t *testing.T) {
+	for location, want := range map[string]string{
+		"config.json":                    "*main.fileSource",
+		"file:///etc/lb/config.json":     "*main.fileSource",
+		"https://config.example.com/lb":  "*main.httpSource",
+		"http://config.example.com/lb":   "*main.httpSource",
+		"env://LB_HAPROXY_CONFIG":        "*main.envSource",
+		"vault://secret/data/lb#haproxy": "*main.vaultSource",
+	} {
+		if got := fmt.Sprintf("%T", newConfigSource(location)); got != want {
+			t.Errorf("newConfigSource(%q) = %s, want %s", location, got, want)
+		}
+	}
+	if s := newConfigSource("file:///etc/lb/config.json").(*fileSource); s.path != "/etc/lb/config.json" {
+		t.Errorf("file:// のパス = %q, want /etc/lb/config.json（スキームを除くこと）", s.path)
+	}
+	s := newConfigSource("vault:///secret/data/lb/#haproxy").(*vaultSource)
+	if s.path != "secret/data/lb" || s.field != "haproxy" {
+		t.Errorf("vault:// のパスとフィールド = %q, %q, want secret/data/lb, haproxy", s.path, s.field)
+	}
+	if s := newConfigSource("vault://secret/data/lb").(*vaultSource); s.field != defaultVaultField {
+		t.Errorf("フィールドの指定がない vault:// のフィールド = %q, want %s", s.field, defaultVaultField)
+	}
+}
+
+func TestFileSourceLoad(t *testing.T) {
+	path := writeTestFile(t, "config.json", sourceTestConfig)
+	config, err := (&fileSource{path: path}).Load()
+	assertSourceConfig(t, config, err)
+}
+
+func TestHTTPSourceLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/config" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(sourceTestConfig))
+	}))
+	defer server.Close()
+
+	config, err := (&httpSource{url: server.URL + "/config", client: server.Client()}).Load()
+	assertSourceConfig(t, config, err)
+
+	_, err = (&httpSource{url: server.URL + "/missing", client: server.Client()}).Load()
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("404 の応答での Load のエラー = %v, want 404 を含むエラー", err)
+	}
+}
+
+func TestEnvSourceLoad(t *testing.T) {
+	env := map[string]string{"LB_HAPROXY_CONFIG": sourceTestConfig, "BROKEN": "{"}
+	getenv := func(name string) string { return env[name] }
+
+	config, err := (&envSource{name: "LB_HAPROXY_CONFIG", getenv: getenv}).Load()
+	assertSourceConfig(t, config, err)
+
+	for _, name := range []string{"", "MISSING", "BROKEN"} {
+		if _, err := (&envSource{name: name, getenv: getenv}).Load(); err == nil {
+			t.Errorf("環境変数[%s]からの Load がエラーになりませんでした", name)
+		}
+	}
+}
+
+func TestVaultSourceLoad(t *testing.T) {
+	quoted, _ := json.Marshal(sourceTestConfig) // KV v2 では、設定を JSON の文字列としてフィールドに格納します
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/lb":
+			w.Write([]byte(`{"data": {"data": {"config": ` + string(quoted) + `}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/lb":
+			w.Write([]byte(`{"data": {"haproxy": ` + sourceTestConfig + `}}`))
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	env := map[string]string{envVaultAddr: server.URL + "/", envVaultToken: "s.token"}
+	getenv := func(name string) string { return env[name] }
+
+	t.Run("KV v2 の文字列のフィールド", func(t *testing.T) {
+		config, err := (&vaultSource{path: "secret/data/lb", field: "config", getenv: getenv, client: server.Client()}).Load()
+		assertSourceConfig(t, config, err)
+	})
+	t.Run("KV v1 のオブジェクトのフィールド", func(t *testing.T) {
+		config, err := (&vaultSource{path: "kv/lb", field: "haproxy", getenv: getenv, client: server.Client()}).Load()
+		assertSourceConfig(t, config, err)
+	})
+	t.Run("存在しないフィールド", func(t *testing.T) {
+		_, err := (&vaultSource{path: "kv/lb", field: "missing", getenv: getenv, client: server.Client()}).Load()
+		if err == nil || !strings.Contains(err.Error(), "フィールド[missing]") {
+			t.Errorf("Load のエラー = %v, want フィールド[missing]がない旨のエラー", err)
+		}
+	})
+	t.Run("トークンなし", func(t *testing.T) {
+		noToken := func(name string) string {
+			if name == envVaultToken {
+				return ""
+			}
+			return getenv(name)
+		}
+		if _, err := (&vaultSource{path: "kv/lb", field: "haproxy", getenv: noToken, client: server.Client()}).Load(); err == nil {
+			t.Error("VAULT_TOKEN のない Load がエラーになりませんでした")
+		}
+	})
+}
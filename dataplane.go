@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// dataPlaneClient は、Data Plane API のクライアントです。
+// *haproxy.HAProxy の操作に加え、変更をトランザクションに積むクライアント（InTransaction）と
+// 1回のリクエストと再読み込みでのサーバーの一括追加（AddServers）を提供します
+type dataPlaneClient struct {
+	*haproxy.HAProxy
+	// http は、ライブラリに対応する操作のない raw 設定の取得・送信に使います
+	http *http.Client
+}
+
+// rawConfigPath は、Data Plane API の raw 設定（haproxy.cfg 全体）のパスです
+const rawConfigPath = "/services/haproxy/configuration/raw"
+
+// apiKeyHeader は、raw 設定のリクエストで api_key を送るヘッダーです
+const apiKeyHeader = "X-Api-Key"
+
+// rawConfigTimeout は、raw 設定の取得・送信のタイムアウトです
+const rawConfigTimeout = 30 * time.Second
+
+// newDataPlaneClient は、エンドポイントと API キーから Data Plane API のクライアントを作成します。
+// transactionID を指定すると、そのクライアントの変更はトランザクションに積まれます
+func newDataPlaneClient(endpoint, apiKey, transactionID string) *dataPlaneClient {
+	return &dataPlaneClient{
+		HAProxy: &haproxy.HAProxy{
+			Endpoint:      endpoint,
+			ApiKey:        apiKey,
+			TransactionID: transactionID,
+		},
+		http: &http.Client{Timeout: rawConfigTimeout},
+	}
+}
+
+// InTransaction は、同じ接続先で変更をトランザクション id に積むクライアントを返します。
+// 元のクライアントの内部状態を複製せず、接続情報から新しいクライアントを作成します
+func (c *dataPlaneClient) InTransaction(id string) (haproxyClient, error) {
+	return newDataPlaneClient(c.Endpoint, c.ApiKey, id), nil
+}
+
+// AddServers は、複数のサーバーを raw 設定の1回の取得と1回の送信で追加し、送信時の1回の再読み込みで反映します。
+// サーバーごとのリクエストを送らないため、台数によらずリクエスト数は一定です。
+// raw 設定はバージョンを指定して送るため、取得から送信までの間に別の変更があった場合は 409 で失敗し、何も追加しません。
+// server 行で表せないラベル（Data Plane API のメタデータ）や、追加先のセクションを決められない group 未指定のサーバーを含む場合は、
+// 1つのトランザクションでサーバーごとに追加します。
+// トランザクション内のクライアント（-atomic）では、raw 設定はトランザクションに積めないため、サーバーごとにそのトランザクションに積みます
+func (c *dataPlaneClient) AddServers(servers []haproxy.Server) error {
+	if c.TransactionID != "" {
+		return addEachServer(c.HAProxy, servers)
+	}
+	for _, s := range servers {
+		if len(s.Metadata) > 0 || s.Backend == "" {
+			return c.addServersInTransaction(servers)
+		}
+	}
+	version, cfg, err := c.getRawConfig()
+	if err != nil {
+		return fmt.Errorf("raw 設定の取得に失敗: %w", err)
+	}
+	if cfg, err = insertServerLines(cfg, servers); err != nil {
+		return err
+	}
+	if err := c.postRawConfig(version, cfg); err != nil {
+		return fmt.Errorf("raw 設定（バージョン %d）の送信に失敗: %w", version, err)
+	}
+	return nil
+}
+
+// addServersInTransaction は、複数のサーバーを1つのトランザクションでサーバーごとに追加し、コミット時の1回の再読み込みで反映します。
+// いずれかの追加に失敗した場合はトランザクションを破棄し、何も追加しません
+func (c *dataPlaneClient) addServersInTransaction(servers []haproxy.Server) error {
+	id, err := c.StartTransaction()
+	if err != nil {
+		return fmt.Errorf("トランザクションの開始に失敗: %w", err)
+	}
+	if err := addEachServer(newDataPlaneClient(c.Endpoint, c.ApiKey, id).HAProxy, servers); err != nil {
+		if derr := c.DeleteTransaction(id); derr != nil {
+			log.Printf("トランザクション[%s]の破棄に失敗: %v", id, derr)
+		}
+		return err
+	}
+	if err := c.CommitTransaction(id); err != nil {
+		return fmt.Errorf("トランザクション[%s]のコミットに失敗: %w", id, err)
+	}
+	return nil
+}
+
+// getRawConfig は、現在の raw 設定とそのバージョンを取得します
+func (c *dataPlaneClient) getRawConfig() (int64, string, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(c.Endpoint, "/")+rawConfigPath, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	body, err := c.doRaw(req)
+	if err != nil {
+		return 0, "", err
+	}
+	var raw struct {
+		Version int64  `json:"_version"`
+		Data    string `json:"data"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return 0, "", fmt.Errorf("応答を解釈できません: %w", err)
+	}
+	return raw.Version, raw.Data, nil
+}
+
+// postRawConfig は、raw 設定をバージョンを指定して送信し、HAProxy を再読み込みさせます
+func (c *dataPlaneClient) postRawConfig(version int64, cfg string) error {
+	u := fmt.Sprintf("%s%s?version=%d", strings.TrimSuffix(c.Endpoint, "/"), rawConfigPath, version)
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewBufferString(cfg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	_, err = c.doRaw(req)
+	return err
+}
+
+// doRaw は、api_key を付けてリクエストを送信し、応答の本文を返します。
+// 2xx 以外の応答は、ライブラリの操作と同じく *haproxy.APIError として返します（409 などの再試行の判定を共通にするため）
+func (c *dataPlaneClient) doRaw(req *http.Request) ([]byte, error) {
+	if c.ApiKey != "" {
+		req.Header.Set(apiKeyHeader, c.ApiKey)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, &haproxy.APIError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))}
+	}
+	return body, nil
+}
+
+// cfgSectionKeywords は、haproxy.cfg のセクションを開始するキーワードです
+var cfgSectionKeywords = map[string]bool{
+	"global": true, "defaults": true, "frontend": true, "backend": true, "listen": true,
+	"resolvers": true, "peers": true, "mailers": true, "userlist": true, "cache": true,
+	"program": true, "http-errors": true, "ring": true, "fcgi-app": true, "log-forward": true,
+}
+
+// insertServerLines は、haproxy.cfg の各バックエンド（backend / listen）のセクションの末尾に、サーバーの server 行を
+// 同じバックエンドの中では指定した順に追加した設定を返します。
+// バックエンドのセクションがない場合や、同じ名前のサーバーが既にある場合は、何も追加せずにエラーを返します
+func insertServerLines(cfg string, servers []haproxy.Server) (string, error) {
+	lines := strings.Split(cfg, "\n")
+	// セクションごとに、最後の空行でない行の位置と既存のサーバー名を集めます
+	type section struct {
+		last    int
+		servers map[string]bool
+	}
+	sections := map[string]*section{}
+	var current *section
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' && cfgSectionKeywords[fields[0]] {
+			current = nil
+			if (fields[0] == "backend" || fields[0] == "listen") && len(fields) > 1 {
+				current = &section{servers: map[string]bool{}}
+				sections[fields[1]] = current
+			}
+		}
+		if current == nil {
+			continue
+		}
+		current.last = i
+		if fields[0] == "server" && len(fields) > 1 {
+			current.servers[fields[1]] = true
+		}
+	}
+
+	added := map[int][]string{}
+	for _, s := range servers {
+		sec, ok := sections[s.Backend]
+		if !ok {
+			return "", fmt.Errorf("サーバー[%s/%s]の追加に失敗: バックエンド[%s]が haproxy.cfg にありません", s.Backend, s.Name, s.Backend)
+		}
+		if sec.servers[s.Name] {
+			return "", fmt.Errorf("サーバー[%s/%s]の追加に失敗: 既に存在します", s.Backend, s.Name)
+		}
+		sec.servers[s.Name] = true
+		added[sec.last] = append(added[sec.last], "    "+serverLine(s))
+	}
+	out := make([]string, 0, len(lines)+len(servers))
+	for i, line := range lines {
+		out = append(out, line)
+		out = append(out, added[i]...)
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// addEachServer は、サーバーを順に追加し、最初に失敗したサーバーのエラーを返します
+func addEachServer(client *haproxy.HAProxy, servers []haproxy.Server) error {
+	for i := range servers {
+		if err := client.AddServer(&servers[i]); err != nil {
+			return fmt.Errorf("サーバー[%s/%s]の追加に失敗: %w", servers[i].Backend, servers[i].Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// rawConfigAPI は、Data Plane API の raw 設定と、サーバーを1台ずつ追加する API を模したテスト用のサーバーです。
+// 受け取ったリクエスト数を数え、raw 設定の送信ごとに再読み込みしたものとしてバージョンを上げます
+type rawConfigAPI struct {
+	mu       sync.Mutex
+	version  int64
+	cfg      string
+	requests int
+	reloads  int
+	apiKey   string
+}
+
+func (a *rawConfigAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests++
+	body, _ := ioutil.ReadAll(r.Body)
+	switch {
+	case r.URL.Path == rawConfigPath && r.Method == http.MethodGet:
+		a.apiKey = r.Header.Get(apiKeyHeader)
+		json.NewEncoder(w).Encode(map[string]interface{}{"_version": a.version, "data": a.cfg})
+	case r.URL.Path == rawConfigPath && r.Method == http.MethodPost:
+		if r.URL.Query().Get("version") != strconv.FormatInt(a.version, 10) {
+			http.Error(w, "version mismatch", http.StatusConflict)
+			return
+		}
+		a.cfg = string(body)
+		a.version++
+		a.reloads++
+		w.WriteHeader(http.StatusAccepted)
+	case r.URL.Path == perServerPath && r.Method == http.MethodPost:
+		// サーバーごとの追加（ライブラリの AddServer に相当）は、ベンチマークの比較対象として server 行を末尾に追加するのみです
+		var s haproxy.Server
+		if err := json.Unmarshal(body, &s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.cfg += "    " + serverLine(s) + "\n"
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// perServerPath は、rawConfigAPI でサーバーを1台ずつ追加するパスです
+const perServerPath = "/services/haproxy/configuration/servers"
+
+// newRawConfigAPI は、cfg を現在の raw 設定とするテスト用のサーバーと、そこに接続する Data Plane API のクライアントを返します
+func newRawConfigAPI(tb testing.TB, cfg string) (*rawConfigAPI, *dataPlaneClient) {
+	tb.Helper()
+	api := &rawConfigAPI{version: 1, cfg: cfg}
+	server := httptest.NewServer(api)
+	tb.Cleanup(server.Close)
+	return api, newDataPlaneClient(server.URL+"/", "secret", "")
+}
+
+const rawConfigTestCfg = `global
+    daemon
+
+backend web
+    balance roundrobin
+    server web-1 10.0.0.1:80 weight 10
+
+frontend http
+    bind :80
+    default_backend web
+
+backend api
+    balance leastconn
+
+`
+
+func TestDataPlaneAddServersSendsOneRawConfig(t *testing.T) {
+	api, client := newRawConfigAPI(t, rawConfigTestCfg)
+	err := client.AddServers([]haproxy.Server{
+		{Backend: "web", Name: "web-2", IP: "10.0.0.2", Port: 80, Weight: 10, Check: true, Inter: "2s"},
+		{Backend: "api", Name: "api-1", IP: "10.0.1.1", Port: 8080, Weight: 5},
+		{Backend: "web", Name: "web-3", IP: "10.0.0.3", Port: 80, Weight: 10},
+	})
+	if err != nil {
+		t.Fatalf("AddServers がエラーを返しました: %v", err)
+	}
+	want := `global
+    daemon
+
+backend web
+    balance roundrobin
+    server web-1 10.0.0.1:80 weight 10
+    server web-2 10.0.0.2:80 weight 10 check inter 2s
+    server web-3 10.0.0.3:80 weight 10
+
+frontend http
+    bind :80
+    default_backend web
+
+backend api
+    balance leastconn
+    server api-1 10.0.1.1:8080 weight 5
+
+`
+	if api.cfg != want {
+		t.Errorf("送信した raw 設定 =\n%s\nwant\n%s", api.cfg, want)
+	}
+	if api.requests != 2 || api.reloads != 1 {
+		t.Errorf("リクエスト数 = %d, 再読み込み = %d, want 2, 1（台数によらず取得と送信の1回ずつ）", api.requests, api.reloads)
+	}
+	if api.apiKey != "secret" {
+		t.Errorf("%s ヘッダー = %q, want secret", apiKeyHeader, api.apiKey)
+	}
+}
+
+func TestDataPlaneAddServersRejectsWithoutChange(t *testing.T) {
+	for name, servers := range map[string][]haproxy.Server{
+		"バックエンドなし": {{Backend: "web", Name: "web-2", IP: "10.0.0.2", Port: 80}, {Backend: "missing", Name: "m-1", IP: "10.0.9.1", Port: 80}},
+		"既存のサーバー":  {{Backend: "api", Name: "api-1", IP: "10.0.1.1", Port: 80}, {Backend: "web", Name: "web-1", IP: "10.0.0.1", Port: 80}},
+		"同じ名前を2台":  {{Backend: "api", Name: "api-1", IP: "10.0.1.1", Port: 80}, {Backend: "api", Name: "api-1", IP: "10.0.1.2", Port: 80}},
+	} {
+		api, client := newRawConfigAPI(t, rawConfigTestCfg)
+		if err := client.AddServers(servers); err == nil {
+			t.Errorf("%s: AddServers がエラーになりませんでした", name)
+		}
+		if api.cfg != rawConfigTestCfg || api.reloads != 0 {
+			t.Errorf("%s: raw 設定を送信しました（再読み込み %d 回）, want 何も追加しないこと", name, api.reloads)
+		}
+	}
+}
+
+func TestDataPlaneAddServersConflict(t *testing.T) {
+	api, client := newRawConfigAPI(t, rawConfigTestCfg)
+	// 取得から送信までの間に別の変更があった場合を模して、送信時にバージョンを上げます
+	client.http.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method == http.MethodPost {
+			api.mu.Lock()
+			api.version++
+			api.mu.Unlock()
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	err := client.AddServers([]haproxy.Server{{Backend: "api", Name: "api-1", IP: "10.0.1.1", Port: 80}})
+	var apiErr *haproxy.APIError
+	if !errors.As(err, &apiErr) || !isConflictError(err) || !isRetryableError(err) {
+		t.Fatalf("AddServers のエラー = %v, want 再試行できる 409 の *haproxy.APIError", err)
+	}
+	if api.cfg != rawConfigTestCfg {
+		t.Errorf("バージョンの異なる raw 設定が反映されました:\n%s", api.cfg)
+	}
+}
+
+func TestDataPlaneAddServersInTransactionSkipsRawConfig(t *testing.T) {
+	api, client := newRawConfigAPI(t, rawConfigTestCfg)
+	for name, c := range map[string]*dataPlaneClient{
+		"トランザクション内": newDataPlaneClient(client.Endpoint, client.ApiKey, "tx-1"),
+		"ラベルあり":     client,
+	} {
+		server := haproxy.Server{Backend: "api", Name: "api-1", IP: "10.0.1.1", Port: 80}
+		if name == "ラベルあり" {
+			server.Metadata = map[string]string{"app": "api"}
+		}
+		if err := c.AddServers([]haproxy.Server{server}); err != nil {
+			t.Fatalf("%s: AddServers がエラーを返しました: %v", name, err)
+		}
+		if api.requests != 0 {
+			t.Errorf("%s: raw 設定へのリクエスト数 = %d, want 0（サーバーごとの追加を使うこと）", name, api.requests)
+		}
+	}
+}
+
+// roundTripFunc は、関数を http.RoundTripper として使うための型です
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
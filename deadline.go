@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// exitDeadlineExceeded は、max_apply_duration を過ぎて適用を打ち切った場合の終了コードです（通常の失敗の 1 と区別します）
+const exitDeadlineExceeded = 4
+
+// errApplyDeadline は、max_apply_duration を過ぎたため残りの操作を開始しなかったことを表します
+var errApplyDeadline = errors.New("max_apply_duration を過ぎたため、残りの操作を開始せずに適用を打ち切りました")
+
+// applyDeadline は、適用全体の所要時間の上限（max_apply_duration）です。
+// 上限を過ぎると新しい操作を開始しませんが、実行中の操作は中断せずに完了させます
+type applyDeadline struct {
+	at  time.Time
+	now func() time.Time // テスト用に差し替えられる現在時刻（nil の場合は time.Now）
+}
+
+// newApplyDeadline は、start から limit 後を上限とします（limit が 0 の場合は上限を設けず nil を返します）
+func newApplyDeadline(start time.Time, limit time.Duration) *applyDeadline {
+	if limit <= 0 {
+		return nil
+	}
+	return &applyDeadline{at: start.Add(limit)}
+}
+
+// expired は、上限を過ぎたかどうかを返します（nil の場合は常に false）
+func (d *applyDeadline) expired() bool {
+	if d == nil {
+		return false
+	}
+	now := d.now
+	if now == nil {
+		now = time.Now
+	}
+	return !now().Before(d.at)
+}
+
+// maxApplyDuration は、max_apply_duration を期間として返します（未指定の場合は 0）
+func (c *Config) maxApplyDuration() time.Duration {
+	d, _ := time.ParseDuration(c.MaxApplyDuration)
+	return d
+}
+
+// validateMaxApplyDuration は、max_apply_duration が正の期間表記（"10m" など）かを検証します
+func (c *Config) validateMaxApplyDuration() error {
+	if c.MaxApplyDuration == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(c.MaxApplyDuration)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("max_apply_duration[%s]は \"10m\" のような正の期間で指定してください", c.MaxApplyDuration)
+	}
+	return nil
+}
+
+// notStartedResult は、上限を過ぎたため適用を開始しなかったインスタンスの結果です（すべてのフェーズが未適用になります）
+func notStartedResult() *Result {
+	result := &Result{DeadlineExceeded: true}
+	for _, phase := range applyPhases {
+		result.DeferredPhases = append(result.DeferredPhases, phase.name)
+	}
+	return result
+}
+
+// hasNonDeadlineFailure は、max_apply_duration による打ち切り以外の理由で失敗したインスタンスがあるかを返します
+func hasNonDeadlineFailure(outcomes []endpointOutcome) bool {
+	for _, o := range outcomes {
+		if o.skipped || (o.err != nil && !errors.Is(o.err, errApplyDeadline)) {
+			return true
+		}
+	}
+	return false
+}
+
+// deferredSummary は、上限により適用しなかった操作をインスタンスごとに "インスタンス[...]: サーバー 3 台, フェーズ algorithm, retry-policy" の形式でまとめます。
+// 上限を過ぎていない場合は空を返します
+func deferredSummary(results []*Result) []string {
+	var lines []string
+	for _, r := range results {
+		if !r.DeadlineExceeded {
+			continue
+		}
+		var parts []string
+		servers := 0
+		for _, b := range append(append([]BackendResult(nil), r.Backends...), r.Removed...) {
+			if b.Status == StatusDeferred {
+				servers++
+			}
+		}
+		if servers > 0 {
+			parts = append(parts, fmt.Sprintf("サーバー %d 台", servers))
+		}
+		if len(r.DeferredPhases) > 0 {
+			parts = append(parts, "フェーズ "+strings.Join(r.DeferredPhases, ", "))
+		}
+		if len(parts) == 0 {
+			parts = append(parts, "なし")
+		}
+		lines = append(lines, fmt.Sprintf("インスタンス[%s]: %s", r.Endpoint, strings.Join(parts, ", ")))
+	}
+	return lines
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// deadlineClient は、サーバーを1台追加した時点で max_apply_duration の上限を過ぎたものとするクライアントです
+// （perServerClient で包み、1台ずつ追加させます）
+type deadlineClient struct {
+	*haproxyfake.HAProxy
+	expired bool
+}
+
+func (c *deadlineClient) AddServer(server *haproxy.Server) error {
+	c.expired = true
+	return c.HAProxy.AddServer(server)
+}
+
+// clock は、c.expired に応じて上限の前後の時刻を返します
+func (c *deadlineClient) clock(at time.Time) func() time.Time {
+	return func() time.Time {
+		if c.expired {
+			return at
+		}
+		return at.Add(-time.Second)
+	}
+}
+
+func TestApplyDeadlineExpired(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var nilDeadline *applyDeadline
+	if nilDeadline.expired() {
+		t.Error("nil の expired() = true, want false（上限なし）")
+	}
+	if d := newApplyDeadline(at, 0); d != nil {
+		t.Errorf("newApplyDeadline(0) = %+v, want nil", d)
+	}
+	for _, tc := range []struct {
+		now  time.Time
+		want bool
+	}{
+		{at.Add(-time.Nanosecond), false},
+		{at, true},
+		{at.Add(time.Minute), true},
+	} {
+		d := &applyDeadline{at: at, now: func() time.Time { return tc.now }}
+		if got := d.expired(); got != tc.want {
+			t.Errorf("現在時刻 %v の expired() = %v, want %v", tc.now, got, tc.want)
+		}
+	}
+}
+
+func TestValidateMaxApplyDuration(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		ok    bool
+	}{
+		{"", true},
+		{"10m", true},
+		{"90s", true},
+		{"10", false},
+		{"0s", false},
+		{"-1m", false},
+	} {
+		err := (&Config{MaxApplyDuration: tc.value}).validateMaxApplyDuration()
+		if (err == nil) != tc.ok {
+			t.Errorf("max_apply_duration %q の検証結果 = %v, want 成功 %v", tc.value, err, tc.ok)
+		}
+	}
+	if got := (&Config{MaxApplyDuration: "2m30s"}).maxApplyDuration(); got != 150*time.Second {
+		t.Errorf("maxApplyDuration() = %v, want 2m30s", got)
+	}
+}
+
+func TestApplyConfigDefersAfterDeadline(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://deadline"],
+		"load_balancing_algorithm": "leastconn",
+		"max_apply_duration": "1m",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	client := &deadlineClient{HAProxy: haproxyfake.New()}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts := applyOptions{deadline: &applyDeadline{at: at, now: client.clock(at)}}
+
+	result, err := applyConfig(perServerClient{client}, config, opts)
+	if !errors.Is(err, errApplyDeadline) {
+		t.Fatalf("applyConfig のエラー = %v, want errApplyDeadline", err)
+	}
+	if !result.DeadlineExceeded {
+		t.Error("DeadlineExceeded = false, want true")
+	}
+	var statuses []string
+	for _, b := range result.Backends {
+		statuses = append(statuses, b.Name+":"+string(b.Status))
+	}
+	want := []string{"web-1:" + string(StatusAdded), "web-2:" + string(StatusDeferred), "web-3:" + string(StatusDeferred)}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("サーバーの結果 = %v, want %v（上限を過ぎた後のサーバーは開始しないこと）", statuses, want)
+	}
+	if servers, _ := client.GetServers(); len(servers) != 1 {
+		t.Errorf("HAProxy のサーバー数 = %d, want 1", len(servers))
+	}
+	for _, phase := range []string{"algorithm", "retry-policy"} {
+		found := false
+		for _, p := range result.DeferredPhases {
+			found = found || p == phase
+		}
+		if !found {
+			t.Errorf("DeferredPhases = %v, want %s を含む", result.DeferredPhases, phase)
+		}
+	}
+	if got := client.Algorithm(); got == "leastconn" {
+		t.Error("上限を過ぎた後にアルゴリズムが変更されました")
+	}
+
+	result.Endpoint = "memory://deadline"
+	lines := deferredSummary([]*Result{result, {Endpoint: "memory://other"}})
+	if len(lines) != 1 {
+		t.Fatalf("deferredSummary() = %v, want 1行（打ち切ったインスタンスのみ）", lines)
+	}
+	if !strings.HasPrefix(lines[0], "インスタンス[memory://deadline]: サーバー 2 台, フェーズ ") || !strings.Contains(lines[0], "algorithm") {
+		t.Errorf("deferredSummary()[0] = %q, want サーバー 2 台と未適用のフェーズ", lines[0])
+	}
+}
+
+func TestApplyConfigWithoutDeadline(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://deadline"],
+		"load_balancing_algorithm": "leastconn",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	client := &deadlineClient{HAProxy: haproxyfake.New()}
+	result, err := applyConfig(perServerClient{client}, config, applyOptions{})
+	if err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	if result.DeadlineExceeded || len(result.DeferredPhases) != 0 {
+		t.Errorf("DeadlineExceeded = %v, DeferredPhases = %v, want 打ち切りなし", result.DeadlineExceeded, result.DeferredPhases)
+	}
+	if lines := deferredSummary([]*Result{result}); len(lines) != 0 {
+		t.Errorf("deferredSummary() = %v, want 空", lines)
+	}
+}
+
+func TestNotStartedResultDefersAllPhases(t *testing.T) {
+	result := notStartedResult()
+	if !result.DeadlineExceeded || len(result.DeferredPhases) != len(applyPhases) {
+		t.Errorf("notStartedResult() = %+v, want すべてのフェーズが未適用", result)
+	}
+	result.Endpoint = "memory://late"
+	lines := deferredSummary([]*Result{result})
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "インスタンス[memory://late]: フェーズ resolvers, ") {
+		t.Errorf("deferredSummary() = %v, want フェーズのみの1行", lines)
+	}
+}
+
+func TestHasNonDeadlineFailure(t *testing.T) {
+	wrapped := fmt.Errorf("インスタンス[a]: %w", errApplyDeadline)
+	for _, tc := range []struct {
+		name     string
+		outcomes []endpointOutcome
+		want     bool
+	}{
+		{"成功のみ", []endpointOutcome{{endpoint: "a"}}, false},
+		{"打ち切りのみ", []endpointOutcome{{endpoint: "a", err: wrapped}, {endpoint: "b", err: errApplyDeadline}}, false},
+		{"通常の失敗", []endpointOutcome{{endpoint: "a", err: errApplyDeadline}, {endpoint: "b", err: errors.New("接続できません")}}, true},
+		{"fail-fast による見送り", []endpointOutcome{{endpoint: "a", skipped: true}}, true},
+	} {
+		if got := hasNonDeadlineFailure(tc.outcomes); got != tc.want {
+			t.Errorf("%s: hasNonDeadlineFailure() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	if exitDeadlineExceeded == 1 {
+		t.Error("exitDeadlineExceeded = 1, want 通常の失敗と異なる終了コード")
+	}
+}
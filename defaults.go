@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// applyServerDefaults は、グループの weight と defaults をサーバー設定に反映した設定を返します。
+// サーバー側で指定した値が常に優先され、グループの値は次の場合にのみ使われます。
+//
+//   - weight（グループの weight または defaults の weight）, maxconn: サーバー側が 0（未指定）の場合
+//   - check, interval, fall, rise: サーバー側の health_check でその項目を指定していない場合
+//     （全体の health_check より defaults が優先されます）
+func applyServerDefaults(config *Config, backend BackendConfig) BackendConfig {
+	g := findGroup(config, backend.Group)
+	if g == nil {
+		return backend
+	}
+	if backend.Weight == 0 && g.Weight != nil {
+		backend.Weight = *g.Weight
+	}
+	if g.Defaults == nil {
+		return backend
+	}
+	d := g.Defaults
+
+	if backend.Weight == 0 && d.Weight != nil {
+		backend.Weight = *d.Weight
+	}
+	if backend.Maxconn == 0 && d.Maxconn != nil {
+		backend.Maxconn = *d.Maxconn
+	}
+	if d.Check != nil || d.Interval != nil || d.Fall != nil || d.Rise != nil {
+		// 元の設定を書き換えないよう、上書き設定を複製してから未指定の項目を補います
+		var hc HealthCheckOverride
+		if backend.HealthCheck != nil {
+			hc = *backend.HealthCheck
+		}
+		if hc.Enabled == nil {
+			hc.Enabled = d.Check
+		}
+		if hc.Interval == nil {
+			hc.Interval = d.Interval
+		}
+		if hc.Fall == nil {
+			hc.Fall = d.Fall
+		}
+		if hc.Rise == nil {
+			hc.Rise = d.Rise
+		}
+		backend.HealthCheck = &hc
+	}
+	return backend
+}
+
+// validate は、defaults の値を検証します
+func (d *ServerDefaults) validate() error {
+	if d.Weight != nil && (*d.Weight < 0 || *d.Weight > 256) {
+		return fmt.Errorf("weight は 0〜256 の範囲で指定してください（指定値: %d）", *d.Weight)
+	}
+	if d.Maxconn != nil && *d.Maxconn < 0 {
+		return fmt.Errorf("maxconn は 0 以上で指定してください（指定値: %d）", *d.Maxconn)
+	}
+	if d.Interval != nil && *d.Interval <= 0 {
+		return fmt.Errorf("interval は 1 以上で指定してください（指定値: %d）", *d.Interval)
+	}
+	return nil
+}
+
+// defaultServerLine は、defaults を haproxy.cfg の default-server 行に変換します
+func defaultServerLine(d *ServerDefaults) string {
+	var opts []string
+	if d.Check != nil && *d.Check {
+		opts = append(opts, "check")
+	}
+	if d.Interval != nil {
+		opts = append(opts, fmt.Sprintf("inter %ds", *d.Interval))
+	}
+	if d.Fall != nil {
+		opts = append(opts, fmt.Sprintf("fall %d", *d.Fall))
+	}
+	if d.Rise != nil {
+		opts = append(opts, fmt.Sprintf("rise %d", *d.Rise))
+	}
+	if d.Weight != nil {
+		opts = append(opts, fmt.Sprintf("weight %d", *d.Weight))
+	}
+	if d.Maxconn != nil {
+		opts = append(opts, fmt.Sprintf("maxconn %d", *d.Maxconn))
+	}
+	if len(opts) == 0 {
+		return ""
+	}
+	return "default-server " + strings.Join(opts, " ")
+}
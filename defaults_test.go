@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServerDefaultsApplyUnlessOverridden(t *testing.T) {
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://defaults"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+		"groups": [{"name": "web", "defaults": {"check": true, "interval": 5, "fall": 5, "weight": 20, "maxconn": 100}}],
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "group": "web", "weight": 50, "maxconn": 300,
+				"health_check": {"interval": 10, "enabled": false}},
+			{"name": "api-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "api"}
+		]
+	}`)
+
+	web1 := buildServer(config, config.Backends[0])
+	if web1.Weight != 20 || web1.Maxconn != 100 || !web1.Check || web1.Inter != "5s" || web1.Fall != 5 || web1.Rise != 2 {
+		t.Errorf("web-1 = weight %d maxconn %d check %v inter %q fall %d rise %d, want defaults の値（20, 100, true, 5s, 5）と全体の rise 2",
+			web1.Weight, web1.Maxconn, web1.Check, web1.Inter, web1.Fall, web1.Rise)
+	}
+	web2 := buildServer(config, config.Backends[1])
+	if web2.Weight != 50 || web2.Maxconn != 300 || web2.Check {
+		t.Errorf("web-2 = weight %d maxconn %d check %v, want サーバー側の値（50, 300, false）", web2.Weight, web2.Maxconn, web2.Check)
+	}
+	api1 := buildServer(config, config.Backends[2])
+	if api1.Maxconn != 0 || api1.Inter != "2s" || api1.Fall != 3 {
+		t.Errorf("api-1 = maxconn %d inter %q fall %d, want defaults のないグループは全体の設定（0, 2s, 3）", api1.Maxconn, api1.Inter, api1.Fall)
+	}
+	if config.Backends[1].HealthCheck.Fall != nil {
+		t.Error("applyServerDefaults が元の設定の health_check を書き換えました")
+	}
+
+	out, err := renderConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "    default-server check inter 5s fall 5 weight 20 maxconn 100\n") {
+		t.Errorf("renderConfig の出力に web の default-server 行がありません:\n%s", out)
+	}
+}
+
+func TestServerDefaultsValidate(t *testing.T) {
+	for _, defaults := range []string{`{"weight": 257}`, `{"maxconn": -1}`, `{"interval": 0}`} {
+		err := validateTestConfig(t, `{
+			"haproxy_endpoint": ["memory://defaults"],
+			"load_balancing_algorithm": "roundrobin",
+			"groups": [{"name": "web", "defaults": `+defaults+`}],
+			"backends": []
+		}`)
+		if err == nil {
+			t.Errorf("defaults %s の検証がエラーになりませんでした", defaults)
+		}
+	}
+}
+
+func TestGroupWeightInheritedUnlessOverridden(t *testing.T) {
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://group-weight"],
+		"load_balancing_algorithm": "roundrobin",
+		"groups": [{"name": "web", "weight": 30}],
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "group": "web", "weight": 5},
+			{"name": "api-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "api"}
+		]
+	}`)
+	for i, want := range []int64{30, 5, 10} {
+		if got := buildServer(config, config.Backends[i]).Weight; got != want {
+			t.Errorf("%s の weight = %d, want %d（サーバー側の指定が優先、未指定はグループの weight）", config.Backends[i].Name, got, want)
+		}
+	}
+	if config.Backends[0].Weight != 0 {
+		t.Error("applyServerDefaults が元の設定の weight を書き換えました")
+	}
+}
+
+func TestGroupWeightValidate(t *testing.T) {
+	for _, group := range []string{
+		`{"name": "web", "weight": 257}`,
+		`{"name": "web", "weight": -1}`,
+		`{"name": "web", "weight": 20, "defaults": {"weight": 20}}`,
+	} {
+		err := validateTestConfig(t, `{
+			"haproxy_endpoint": ["memory://group-weight"],
+			"load_balancing_algorithm": "roundrobin",
+			"groups": [`+group+`],
+			"backends": []
+		}`)
+		if err == nil {
+			t.Errorf("groups %s の検証がエラーになりませんでした", group)
+		}
+	}
+}
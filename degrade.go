@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// findFeature は、識別子に一致する機能を返します。存在しなければ nil を返します
+func findFeature(id string) *apiFeature {
+	for i := range apiFeatures {
+		if apiFeatures[i].id == id {
+			return &apiFeatures[i]
+		}
+	}
+	return nil
+}
+
+// isCritical は、機能が未対応の場合に適用を中止すべきかを返します。
+// 設定ファイルの critical_features で既定値を変更できますが、取り除けない機能は常に critical です
+func (f apiFeature) isCritical(config *Config) bool {
+	if f.strip == nil {
+		return true
+	}
+	if critical, ok := config.CriticalFeatures[f.id]; ok {
+		return critical
+	}
+	return f.critical
+}
+
+// degradeConfig は、API バージョンが対応していない機能のうち critical でないものを取り除いた設定を返します。
+// 取り除いた機能は警告として出力し、その識別子を返します。critical な機能が未対応の場合はエラーを返します。
+// 元の設定は変更しません（複数インスタンスへの並列適用で共有されるため）
+func degradeConfig(config *Config, version string) (*Config, []string, error) {
+	unsupported, err := unsupportedFeatures(config, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(unsupported) == 0 {
+		return config, nil, nil
+	}
+
+	var critical []string
+	for _, f := range unsupported {
+		if f.isCritical(config) {
+			critical = append(critical, fmt.Sprintf("%s（%s 以降）", f.name, f.minVersion))
+		}
+	}
+	if len(critical) > 0 {
+		return nil, nil, fmt.Errorf("APIバージョン %s は次の機能に対応していません: %s", version, strings.Join(critical, ", "))
+	}
+
+	degraded := copyConfig(config)
+	var skipped []string
+	for _, f := range unsupported {
+		f.strip(degraded)
+		skipped = append(skipped, f.id)
+		warnf("APIバージョン %s は %s に対応していないため、この設定を除いて適用します（%s 以降が必要）", version, f.name, f.minVersion)
+	}
+	return degraded, skipped, nil
+}
+
+// copyConfig は、機能を取り除く際に元の設定へ影響しないよう、バックエンドとグループを複製した設定を返します
+func copyConfig(config *Config) *Config {
+	c := *config
+	c.Backends = make([]BackendConfig, len(config.Backends))
+	for i, b := range config.Backends {
+		if b.HealthCheck != nil {
+			hc := *b.HealthCheck
+			b.HealthCheck = &hc
+		}
+		c.Backends[i] = b
+	}
+	c.Groups = append([]GroupConfig(nil), config.Groups...)
+	return &c
+}
+
+// stripBackends は、全てのバックエンドに fn を適用して機能を取り除く関数を返します
+func stripBackends(fn func(b *BackendConfig)) func(config *Config) {
+	return func(config *Config) {
+		for i := range config.Backends {
+			fn(&config.Backends[i])
+		}
+	}
+}
+
+// stripGroups は、全てのグループに fn を適用して機能を取り除く関数を返します
+func stripGroups(fn func(g *GroupConfig)) func(config *Config) {
+	return func(config *Config) {
+		for i := range config.Groups {
+			fn(&config.Groups[i])
+		}
+	}
+}
+
+// stripStateIntervals は、全体とサーバー個別のヘルスチェックから downinter / fastinter を取り除きます
+func stripStateIntervals(config *Config) {
+	config.HealthCheck.Downinter, config.HealthCheck.Fastinter = "", ""
+	stripBackends(func(b *BackendConfig) {
+		if b.HealthCheck != nil {
+			b.HealthCheck.Downinter, b.HealthCheck.Fastinter = nil, nil
+		}
+	})(config)
+}
+
+// degradeForEndpoint は、接続先の API バージョンを取得して degradeConfig を適用します
+func degradeForEndpoint(client haproxyClient, config *Config) (*Config, []string, error) {
+	version, err := client.GetAPIVersion()
+	if err != nil {
+		return nil, nil, fmt.Errorf("APIバージョンの取得に失敗: %w", err)
+	}
+	return degradeConfig(config, version)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// degradeTestConfig は、stick-table（2.1 以降、critical ではない）を使う設定です
+const degradeTestConfig = `{
+	"haproxy_endpoint": ["memory://degrade"],
+	"load_balancing_algorithm": "roundrobin",
+	"groups": [{"name": "web", "stick": {"type": "ip", "size": "200k", "on": "src"}}],
+	"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"}]
+}`
+
+func TestDegradeSkipsUnsupportedFeatureWithWarning(t *testing.T) {
+	_, errs := captureOutput(t)
+	config := loadTestConfig(t, degradeTestConfig)
+	fake := haproxyfake.New()
+	client := versionClient{fake, "v2.0.3"}
+
+	degraded, skipped, err := degradeForEndpoint(client, config)
+	if err != nil {
+		t.Fatalf("degradeForEndpoint がエラーを返しました: %v", err)
+	}
+	if strings.Join(skipped, ",") != "stick-table" {
+		t.Errorf("取り除いた機能 = %v, want [stick-table]", skipped)
+	}
+	if warnings.count() != 1 || !strings.Contains(errs.String(), "stick-table に対応していないため") {
+		t.Errorf("警告 = %q, want stick-table を除いて適用する警告", errs.String())
+	}
+	if config.Groups[0].Stick == nil {
+		t.Error("degradeForEndpoint が元の設定を変更しました")
+	}
+
+	// 残りの設定はそのまま適用できること
+	if _, err := applyConfig(client, degraded, applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	if servers, _ := fake.GetServers(); len(servers) != 1 {
+		t.Errorf("適用後のサーバー数 = %d, want 1", len(servers))
+	}
+	if got := fake.BackendConfig("web", "stick-table"); got != "" {
+		t.Errorf("stick-table = %q, want 未設定", got)
+	}
+}
+
+func TestDegradeFailsOnCriticalFeature(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, strings.Replace(degradeTestConfig, `"groups"`, `"critical_features": {"stick-table": true}, "groups"`, 1))
+	_, _, err := degradeConfig(config, "v2.0.3")
+	if err == nil || !strings.Contains(err.Error(), "stick-table（2.1 以降）") {
+		t.Errorf("degradeConfig() = %v, want critical_features で critical とした機能のエラー", err)
+	}
+
+	if degraded, skipped, err := degradeConfig(config, "v2.1"); err != nil || degraded != config || skipped != nil {
+		t.Errorf("対応バージョンでの degradeConfig() = %v, %v, want 元の設定をそのまま返す", skipped, err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// deprecatedField は、非推奨になった設定ファイルの項目です。
+// path は設定ファイル内の位置で、配列の各要素を "backends[].npn" のように [] で表します
+type deprecatedField struct {
+	path        string
+	replacement string // 代わりに使う項目
+	reason      string // 非推奨になった理由
+}
+
+// deprecatedFields は、非推奨の項目の一覧です。項目を非推奨にする場合はここに追加し、
+// 削除するまでの間は従来どおり値を反映してください（-strict 指定時はエラーになります）
+var deprecatedFields = []deprecatedField{
+	{path: "backends[].npn", replacement: "alpn", reason: "NPN は TLS 1.3 と OpenSSL 3.0 以降で使用できないため"},
+}
+
+// deprecatedUsage は、設定ファイルで使用されている非推奨の項目1件です（location は "backends[2].npn" のような実際の位置）
+type deprecatedUsage struct {
+	field    deprecatedField
+	location string
+}
+
+func (u deprecatedUsage) String() string {
+	return fmt.Sprintf("非推奨の項目 %s が使用されています（代わりに %s を使用してください。%s）", u.location, u.field.replacement, u.field.reason)
+}
+
+// findDeprecatedFields は、JSONとして読み込んだ設定内容で使用されている非推奨の項目を位置の順に返します
+func findDeprecatedFields(value interface{}) []deprecatedUsage {
+	var usages []deprecatedUsage
+	for _, f := range deprecatedFields {
+		for _, location := range findConfigPath(value, strings.Split(f.path, "."), "") {
+			usages = append(usages, deprecatedUsage{field: f, location: location})
+		}
+	}
+	sort.SliceStable(usages, func(i, j int) bool { return usages[i].location < usages[j].location })
+	return usages
+}
+
+// findConfigPath は、"." で区切った path の各要素を value から辿り、値が存在する位置（prefix からの表記）を返します。
+// "[]" で終わる要素は配列とみなし、各要素を辿ります。null の値は指定されていないものとします
+func findConfigPath(value interface{}, path []string, prefix string) []string {
+	if len(path) == 0 {
+		if value == nil {
+			return nil
+		}
+		return []string{prefix}
+	}
+	config, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	key := strings.TrimSuffix(path[0], "[]")
+	location := key
+	if prefix != "" {
+		location = prefix + "." + key
+	}
+	child, ok := config[key]
+	if !ok {
+		return nil
+	}
+	if key == path[0] {
+		return findConfigPath(child, path[1:], location)
+	}
+	items, _ := child.([]interface{})
+	var locations []string
+	for i, item := range items {
+		locations = append(locations, findConfigPath(item, path[1:], fmt.Sprintf("%s[%d]", location, i))...)
+	}
+	return locations
+}
+
+// checkDeprecatedFields は、設定内容で使用されている非推奨の項目ごとに警告を出力します。
+// -strict 指定時は警告の代わりに、使用されている項目をまとめたエラーを返します
+func checkDeprecatedFields(value interface{}) error {
+	usages := findDeprecatedFields(value)
+	if len(usages) == 0 {
+		return nil
+	}
+	if *strictFlag {
+		messages := make([]string, len(usages))
+		for i, u := range usages {
+			messages[i] = u.String()
+		}
+		return fmt.Errorf("-strict が指定されているため非推奨の項目は使用できません: %s", strings.Join(messages, "; "))
+	}
+	for _, u := range usages {
+		warnWithFields(map[string]interface{}{
+			"deprecated_field": u.location,
+			"replacement":      u.field.replacement,
+		}, "%s", u)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// deprecationTestConfig は、2台目のサーバーで非推奨の npn を使う設定です
+const deprecationTestConfig = `{
+	"haproxy_endpoint": ["memory://deprecations"],
+	"load_balancing_algorithm": "roundrobin",
+	"backends": [
+		{"name": "web-1", "ip": "10.0.0.1", "port": 443, "weight": 10, "ssl": true, "alpn": ["h2"]},
+		{"name": "web-2", "ip": "10.0.0.2", "port": 443, "weight": 10, "ssl": true, "npn": ["http/1.1"]},
+		{"name": "web-3", "ip": "10.0.0.3", "port": 443, "weight": 10, "npn": null}
+	]
+}`
+
+func TestDeprecatedFieldWarns(t *testing.T) {
+	_, errs := captureOutput(t)
+	config := loadTestConfig(t, deprecationTestConfig)
+
+	if !strings.Contains(errs.String(), "非推奨の項目 backends[1].npn が使用されています（代わりに alpn を使用してください。") {
+		t.Errorf("警告 = %q, want backends[1].npn と代わりの alpn を示すこと", errs.String())
+	}
+	if got := strings.Count(errs.String(), "非推奨の項目"); got != 1 {
+		t.Errorf("非推奨の警告の件数 = %d, want 1（null の npn は指定なしとすること）", got)
+	}
+	if got := config.Backends[1].NPN; len(got) != 1 || got[0] != "http/1.1" {
+		t.Errorf("web-2 の npn = %v, want [http/1.1]（非推奨でも値を反映すること）", got)
+	}
+}
+
+func TestDeprecatedFieldJSONWarning(t *testing.T) {
+	logs, _ := captureOutput(t)
+	prev := jsonLogEnabled
+	jsonLogEnabled = true
+	t.Cleanup(func() { jsonLogEnabled = prev })
+
+	loadTestConfig(t, deprecationTestConfig)
+
+	for _, want := range []string{`"deprecated_field":"backends[1].npn"`, `"replacement":"alpn"`} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("JSON の警告 = %q, want %s を含むこと", logs.String(), want)
+		}
+	}
+}
+
+func TestDeprecatedFieldStrict(t *testing.T) {
+	captureOutput(t)
+	setFlag(t, "strict", "true")
+	path := writeTestFile(t, "config.json", deprecationTestConfig)
+	_, err := loadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "backends[1].npn") {
+		t.Errorf("-strict での loadConfig のエラー = %v, want backends[1].npn を示すエラー", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// discoveryResponse は、-endpoint-from-discovery の URL が JSON で返す接続先です。
+// endpoint には1つの文字列と文字列の配列のどちらでも指定できます
+type discoveryResponse struct {
+	Endpoint endpointList `json:"endpoint"`
+}
+
+// discoverEndpoints は、ディスカバリーの URL に GET で問い合わせ、現在の HAProxy API の接続先を返します。
+// 応答の本文は {"endpoint": "http://..."} 形式の JSON、または接続先をカンマ区切りで記述したテキストです。
+// 接続先が1つも含まれない場合はエラーとします
+func discoverEndpoints(client *http.Client, url string) (endpointList, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("リクエストの作成に失敗: %w", err)
+	}
+	req.Header.Set("Accept", "application/json, text/plain")
+	data, err := fetchConfigSource(client, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+
+	body := strings.TrimSpace(string(data))
+	var endpoints endpointList
+	if strings.HasPrefix(body, "{") {
+		var resp discoveryResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("%s: 応答を解釈できません: %w", url, err)
+		}
+		endpoints = splitEndpoints(resp.Endpoint.String())
+	} else {
+		endpoints = splitEndpoints(body)
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("%s: 応答に接続先が含まれていません", url)
+	}
+	return endpoints, nil
+}
+
+// resolveEndpointDiscovery は、-endpoint-from-discovery の URL から接続先を起動時に1回だけ取得し、
+// -endpoint として指定された場合と同じように使用させます（-repeat の間も問い合わせ直しません）
+func resolveEndpointDiscovery() error {
+	if *discoveryURLFlag == "" {
+		return nil
+	}
+	if *endpointFlag != "" {
+		return errors.New("-endpoint と -endpoint-from-discovery は同時に指定できません")
+	}
+	endpoints, err := discoverEndpoints(&http.Client{Timeout: configSourceTimeout}, *discoveryURLFlag)
+	if err != nil {
+		return fmt.Errorf("接続先のディスカバリーに失敗: %w", err)
+	}
+	logf("接続先のディスカバリーで %s を取得しました\n", endpoints)
+	*endpointFlag = endpoints.String()
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newDiscoveryServer は、パスごとに決まった応答を返すディスカバリーのサーバーを起動し、問い合わせの回数を数えます
+func newDiscoveryServer(t *testing.T, requests *int) *httptest.Server {
+	t.Helper()
+	responses := map[string]string{
+		"/json":  `{"endpoint": "http://haproxy1:5555"}`,
+		"/array": `{"endpoint": ["http://haproxy1:5555", "http://haproxy2:5555"]}`,
+		"/text":  "http://haproxy1:5555, http://haproxy2:5555\n",
+		"/empty": `{"endpoint": []}`,
+		"/blank": "  \n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			http.Error(w, "service not registered", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDiscoverEndpoints(t *testing.T) {
+	requests := 0
+	server := newDiscoveryServer(t, &requests)
+	for path, want := range map[string]string{
+		"/json":  "http://haproxy1:5555",
+		"/array": "http://haproxy1:5555,http://haproxy2:5555",
+		"/text":  "http://haproxy1:5555,http://haproxy2:5555",
+	} {
+		got, err := discoverEndpoints(server.Client(), server.URL+path)
+		if err != nil {
+			t.Errorf("%s の discoverEndpoints がエラーを返しました: %v", path, err)
+			continue
+		}
+		if got.String() != want {
+			t.Errorf("%s の discoverEndpoints() = %s, want %s", path, got, want)
+		}
+	}
+	for path, want := range map[string]string{
+		"/empty":   "接続先が含まれていません",
+		"/blank":   "接続先が含まれていません",
+		"/missing": "503",
+	} {
+		if _, err := discoverEndpoints(server.Client(), server.URL+path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s の discoverEndpoints のエラー = %v, want %s を含むエラー", path, err, want)
+		}
+	}
+}
+
+func TestResolveEndpointDiscoverySetsEndpointOnce(t *testing.T) {
+	captureOutput(t)
+	requests := 0
+	server := newDiscoveryServer(t, &requests)
+	setFlag(t, "endpoint", "")
+	setFlag(t, "endpoint-from-discovery", server.URL+"/array")
+
+	if err := resolveEndpointDiscovery(); err != nil {
+		t.Fatalf("resolveEndpointDiscovery がエラーを返しました: %v", err)
+	}
+	if got, want := *endpointFlag, "http://haproxy1:5555,http://haproxy2:5555"; got != want {
+		t.Errorf("-endpoint = %q, want %q（取得した接続先を -endpoint として使うこと）", got, want)
+	}
+	if requests != 1 {
+		t.Errorf("ディスカバリーへの問い合わせ回数 = %d, want 1", requests)
+	}
+
+	if err := resolveEndpointDiscovery(); err == nil || !strings.Contains(err.Error(), "同時に指定できません") {
+		t.Errorf("-endpoint 指定済みでの resolveEndpointDiscovery のエラー = %v, want 同時に指定できない旨のエラー", err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// resolveTimeout は、-skip-unresolvable でのホスト名1件の名前解決を待つ最大時間です
+const resolveTimeout = 5 * time.Second
+
+// hostResolver は、-skip-unresolvable でサーバーのホスト名を名前解決する処理です（*net.Resolver が満たします。テスト用に差し替えられます）
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// backendHostname は、サーバーの ip に IP アドレスではなくホスト名が指定されている場合にそのホスト名を返します。
+// unix ソケットと SRV レコードのサーバー（server-template）は名前解決の対象外です
+func backendHostname(backend BackendConfig) (string, bool) {
+	if backend.Socket != "" || backend.SRV != "" || backend.IP == "" {
+		return "", false
+	}
+	if net.ParseIP(backend.IP) != nil {
+		return "", false
+	}
+	return backend.IP, true
+}
+
+// lookupBackendHost は、ホスト名を名前解決し、アドレスが1件も得られない場合はエラーを返します
+func lookupBackendHost(resolver hostResolver, host string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	addrs, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("ホスト名[%s]のアドレスが見つかりません", host)
+	}
+	return nil
+}
+
+// skipUnresolvable は、ホスト名が今回の適用で名前解決できないサーバーを警告を出力して除き、残りのサーバーを返します。
+// 除いたサーバーは skipped-unresolvable として result に記録し、追加・更新しません（HAProxy 上の既存のサーバーもそのまま残します）。
+// resolver が nil の場合（-skip-unresolvable の指定なし）はそのまま返します
+func skipUnresolvable(resolver hostResolver, result *Result, backends []BackendConfig) []BackendConfig {
+	if resolver == nil {
+		return backends
+	}
+	rest := make([]BackendConfig, 0, len(backends))
+	lookups := map[string]error{} // 同じホスト名を何度も問い合わせないよう、グループ内で結果を共有します
+	for _, backend := range backends {
+		host, ok := backendHostname(backend)
+		if !ok {
+			rest = append(rest, backend)
+			continue
+		}
+		err, checked := lookups[host]
+		if !checked {
+			err = lookupBackendHost(resolver, host)
+			lookups[host] = err
+		}
+		if err == nil {
+			rest = append(rest, backend)
+			continue
+		}
+		warnf("サーバー%sのホスト名[%s]を名前解決できないため、今回の適用ではスキップします: %v", backendLabel(backend), host, err)
+		err = fmt.Errorf("ホスト名[%s]を名前解決できません: %w", host, err)
+		result.Backends = append(result.Backends, newBackendResultFor(backend, StatusSkippedUnresolvable, err))
+	}
+	return rest
+}
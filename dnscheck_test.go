@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// stubResolver は、登録したホスト名のみ名前解決でき、それ以外は NXDOMAIN を返すテスト用の名前解決です
+type stubResolver struct {
+	hosts   map[string][]string
+	lookups int
+}
+
+func (r *stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.lookups++
+	if addrs, ok := r.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// unresolvableTestConfig は、名前解決できる web-1 と、名前解決できないホスト名を持つ web-2 の設定を返します
+func unresolvableTestConfig(t *testing.T) *Config {
+	return loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://unresolvable"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "web-1.internal", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "web-2.internal", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+}
+
+func TestSkipUnresolvableSkipsNXDOMAIN(t *testing.T) {
+	_, errs := captureOutput(t)
+	config := unresolvableTestConfig(t)
+	client := haproxyfake.New()
+	resolver := &stubResolver{hosts: map[string][]string{"web-1.internal": {"10.0.0.1"}}}
+
+	result, err := applyConfig(client, config, applyOptions{resolver: resolver})
+	if err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	servers, _ := client.GetServers()
+	if len(servers) != 2 || servers[0].Name != "web-1" || servers[1].Name != "web-3" {
+		t.Errorf("適用後のサーバー = %+v, want web-1, web-3（名前解決できない web-2 は追加しないこと）", servers)
+	}
+	var skipped *BackendResult
+	for i := range result.Backends {
+		if result.Backends[i].Name == "web-2" {
+			skipped = &result.Backends[i]
+		}
+	}
+	if skipped == nil || skipped.Status != StatusSkippedUnresolvable {
+		t.Errorf("web-2 の結果 = %+v, want %s", skipped, StatusSkippedUnresolvable)
+	}
+	var dnsErr *net.DNSError
+	if skipped != nil && !errors.As(skipped.Err, &dnsErr) {
+		t.Errorf("web-2 のエラー = %v, want 名前解決のエラーを含むこと", skipped.Err)
+	}
+	if !strings.Contains(errs.String(), "web-2.internal") {
+		t.Errorf("スキップの警告が出力されていません: %q", errs.String())
+	}
+	if resolver.lookups != 2 {
+		t.Errorf("名前解決の回数 = %d, want 2（IP アドレスのサーバーは名前解決しないこと）", resolver.lookups)
+	}
+}
+
+func TestPlanServersSkipsUnresolvable(t *testing.T) {
+	captureOutput(t)
+	config := unresolvableTestConfig(t)
+	resolver := &stubResolver{hosts: map[string][]string{"web-1.internal": {"10.0.0.1"}}}
+
+	entries, err := planServers(haproxyfake.New(), config, applyOptions{resolver: resolver})
+	if err != nil {
+		t.Fatalf("planServers がエラーを返しました: %v", err)
+	}
+	actions := map[string]reconcileAction{}
+	for _, e := range entries {
+		actions[e.target] = e.action
+	}
+	if actions["web/web-2"] != actionInvalid {
+		t.Errorf("web-2 の計画 = %q, want %q（適用と同様にスキップすること）", actions["web/web-2"], actionInvalid)
+	}
+	if actions["web/web-1"] != actionAdd || actions["web/web-3"] != actionAdd {
+		t.Errorf("計画 = %v, want web-1 と web-3 は追加", actions)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// diagnosisLevel は診断結果の重大度です
+type diagnosisLevel string
+
+const (
+	levelPass diagnosisLevel = "PASS"
+	levelWarn diagnosisLevel = "WARN"
+	levelFail diagnosisLevel = "FAIL"
+)
+
+// diagnosis は1つの診断項目の結果です
+type diagnosis struct {
+	Check   string         // 診断項目名
+	Level   diagnosisLevel // 重大度
+	Message string         // 結果の説明
+	Hint    string         // 対処方法（PASS の場合は空）
+}
+
+// doctorCheck は、設定とクライアントを読み取るだけの診断処理です。HAProxy への変更は行いません
+type doctorCheck func(config *Config, endpoint string, client haproxyClient) diagnosis
+
+// configChecks は設定ファイルのみを対象とする診断の一覧（実行順）です
+var configChecks = []doctorCheck{
+	checkConfigValid,
+	checkDuplicateNames,
+	checkAlgorithm,
+}
+
+// endpointChecks はHAProxyインスタンスごとに実行する診断の一覧（実行順）です
+var endpointChecks = []doctorCheck{
+	checkEndpointReachable,
+	checkAPIVersion,
+}
+
+// knownAlgorithms は HAProxy の balance に指定できるアルゴリズムです
+var knownAlgorithms = []string{
+	"roundrobin", "static-rr", "leastconn", "first", "source",
+	"uri", "url_param", "hdr", "random", "rdp-cookie", "hash",
+}
+
+// supportedAPIMajorVersions は、このツールが対応している Data Plane API のメジャーバージョンです
+var supportedAPIMajorVersions = []string{"2"}
+
+// runDiagnostics は、設定の診断と各インスタンスの診断を順に実行して結果を返します
+func runDiagnostics(config *Config, newClient func(endpoint string) haproxyClient) []diagnosis {
+	var results []diagnosis
+	for _, check := range configChecks {
+		results = append(results, check(config, "", nil))
+	}
+	for _, endpoint := range config.HaproxyEndpoint {
+		client := newClient(endpoint)
+		for _, check := range endpointChecks {
+			results = append(results, check(config, endpoint, client))
+		}
+	}
+	return results
+}
+
+// levelColors は、診断結果のレベルごとの表示色です
+var levelColors = map[diagnosisLevel]string{
+	levelPass: colorGreen,
+	levelWarn: colorYellow,
+	levelFail: colorRed,
+}
+
+// formatDiagnoses は、診断結果を pass/warn/fail のレポート形式の文字列にします
+func formatDiagnoses(results []diagnosis) string {
+	var b strings.Builder
+	counts := map[diagnosisLevel]int{}
+	for _, d := range results {
+		counts[d.Level]++
+		fmt.Fprintf(&b, "%s %s: %s\n", colorize(levelColors[d.Level], "["+string(d.Level)+"]"), d.Check, d.Message)
+		if d.Hint != "" {
+			fmt.Fprintf(&b, "       対処: %s\n", d.Hint)
+		}
+	}
+	fmt.Fprintf(&b, "\n結果: PASS %d / WARN %d / FAIL %d\n", counts[levelPass], counts[levelWarn], counts[levelFail])
+	return b.String()
+}
+
+// runDoctor は、よくある設定ミスを読み取り専用で診断し、FAIL があれば終了コード 1 で終了します（doctor サブコマンド）
+func runDoctor() {
+	config, err := loadConfig(*configFlag)
+	if err != nil {
+		if *nagiosFlag {
+			nagiosExit("DOCTOR", nagiosUnknown, fmt.Sprintf("設定ファイルの読み込みに失敗: %v", err), "")
+		}
+		log.Fatalf("設定ファイルの読み込みに失敗: %v（JSONの構文とファイルパスを確認してください）", err)
+	}
+	if err := substituteVars(config, os.Getenv); err != nil {
+		if *nagiosFlag {
+			nagiosExit("DOCTOR", nagiosUnknown, fmt.Sprintf("設定ファイルの変数の展開に失敗: %v", err), "")
+		}
+		log.Fatalf("設定ファイルの変数の展開に失敗: %v（vars の定義と環境変数を確認してください）", err)
+	}
+	applyConnectionOverrides(config, *endpointFlag, *apiKeyFlag, os.Getenv)
+	config.DisabledAlgorithms = append(config.DisabledAlgorithms, forbidAlgorithmFlag...)
+
+	results := runDiagnostics(config, func(endpoint string) haproxyClient {
+		return buildHAProxyClient(endpoint, config.APIKey, config.APIBasePath)
+	})
+	if *nagiosFlag {
+		status, message, perfdata := formatNagiosDoctor(results)
+		nagiosExit("DOCTOR", status, message, perfdata)
+	}
+	fmt.Print(formatDiagnoses(results))
+	for _, d := range results {
+		if d.Level == levelFail {
+			os.Exit(1)
+		}
+	}
+}
+
+// checkConfigValid は、Validate と各バックエンドの検証が通るかを確認します
+func checkConfigValid(config *Config, endpoint string, client haproxyClient) diagnosis {
+	d := diagnosis{Check: "設定の検証"}
+	if err := config.Validate(); err != nil {
+		d.Level, d.Message = levelFail, err.Error()
+		d.Hint = "エラーメッセージが示す項目を修正してください"
+		return d
+	}
+	var invalid []string
+	for _, b := range config.Backends {
+		if err := validateBackend(b); err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s: %v", b.Name, err))
+		}
+	}
+	if len(invalid) > 0 {
+		d.Level, d.Message = levelFail, "不正なバックエンドがあります: "+strings.Join(invalid, "; ")
+		d.Hint = "該当するバックエンドの設定を修正してください（そのままでは適用時にスキップされます）"
+		return d
+	}
+	d.Level, d.Message = levelPass, "設定は正常です"
+	return d
+}
+
+// checkDuplicateNames は、同じグループ内でのサーバー名の重複とアドレスの重複を確認します
+func checkDuplicateNames(config *Config, endpoint string, client haproxyClient) diagnosis {
+	d := diagnosis{Check: "重複の確認"}
+	names := map[string]int{}
+	addrs := map[string][]string{}
+	for _, b := range config.Backends {
+		names[serverKey(b.Group, b.Name)]++
+		// server-template のアドレスは名前解決で決まるため対象外
+		if b.SRV != "" {
+			continue
+		}
+		addr := fmt.Sprintf("%s:%d", b.IP, b.Port)
+		if b.Socket != "" {
+			addr = unixAddressPrefix + b.Socket
+		}
+		addrs[addr] = append(addrs[addr], b.Name)
+	}
+
+	var dupNames []string
+	for key, n := range names {
+		if n > 1 {
+			dupNames = append(dupNames, key)
+		}
+	}
+	if len(dupNames) > 0 {
+		sort.Strings(dupNames)
+		d.Level, d.Message = levelFail, "サーバー名が重複しています: "+strings.Join(dupNames, ", ")
+		d.Hint = "同じグループ内のサーバー名は一意にしてください（後の定義が前の定義を上書きします）"
+		return d
+	}
+
+	var dupAddrs []string
+	for addr, servers := range addrs {
+		if len(servers) > 1 {
+			dupAddrs = append(dupAddrs, fmt.Sprintf("%s (%s)", addr, strings.Join(servers, ", ")))
+		}
+	}
+	if len(dupAddrs) > 0 {
+		sort.Strings(dupAddrs)
+		d.Level, d.Message = levelWarn, "同じアドレスのサーバーがあります: "+strings.Join(dupAddrs, ", ")
+		d.Hint = "意図的でなければ ip / port の記載ミスを確認してください"
+		return d
+	}
+	d.Level, d.Message = levelPass, "重複はありません"
+	return d
+}
+
+// checkAlgorithm は、ロードバランシングアルゴリズムが既知の値かを確認します
+func checkAlgorithm(config *Config, endpoint string, client haproxyClient) diagnosis {
+	d := diagnosis{Check: "ロードバランシングアルゴリズム"}
+	algo := config.balanceAlgorithm()
+	if isKnownAlgorithm(algo) {
+		d.Level, d.Message = levelPass, fmt.Sprintf("%s は有効なアルゴリズムです", algo)
+		return d
+	}
+	d.Level = levelFail
+	d.Message = fmt.Sprintf("%q は未知のアルゴリズムです", algo)
+	if suggestion := closestString(algo, knownAlgorithms); suggestion != "" {
+		d.Hint = fmt.Sprintf("%q の誤りではありませんか？（有効な値: %s）", suggestion, strings.Join(knownAlgorithms, ", "))
+	} else {
+		d.Hint = "有効な値: " + strings.Join(knownAlgorithms, ", ")
+	}
+	return d
+}
+
+// checkEndpointReachable は、HAProxy API に Ping が届くかを確認します
+func checkEndpointReachable(config *Config, endpoint string, client haproxyClient) diagnosis {
+	d := diagnosis{Check: "エンドポイントへの接続 " + endpoint}
+	if err := client.Ping(); err != nil {
+		d.Level, d.Message = levelFail, fmt.Sprintf("%s に接続できません: %v", endpoint, err)
+		d.Hint = "haproxy_endpoint（または -endpoint / " + envEndpoint + "）と api_key、HAProxy側のAPIの起動状態を確認してください"
+		return d
+	}
+	d.Level, d.Message = levelPass, fmt.Sprintf("%s に接続できました", endpoint)
+	return d
+}
+
+// checkAPIVersion は、接続先の API バージョンが対応範囲かを確認します
+func checkAPIVersion(config *Config, endpoint string, client haproxyClient) diagnosis {
+	d := diagnosis{Check: "APIバージョン " + endpoint}
+	version, err := client.GetAPIVersion()
+	if err != nil {
+		d.Level, d.Message = levelWarn, fmt.Sprintf("APIバージョンを取得できません: %v", err)
+		d.Hint = "エンドポイントへの接続の診断結果もあわせて確認してください"
+		return d
+	}
+	if strings.HasPrefix(endpoint, socketScheme) {
+		d.Level, d.Message = levelPass, fmt.Sprintf("runtime socket（HAProxy %s）を使用します", version)
+		return d
+	}
+	major := strings.SplitN(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".", 2)[0]
+	for _, supported := range supportedAPIMajorVersions {
+		if major == supported {
+			d.Level, d.Message = levelPass, fmt.Sprintf("APIバージョン %s に対応しています", version)
+			return d
+		}
+	}
+	d.Level = levelFail
+	d.Message = fmt.Sprintf("APIバージョン %s には対応していません（対応: v%s）", version, strings.Join(supportedAPIMajorVersions, ", v"))
+	d.Hint = "対応バージョンの Data Plane API を使用するか、エンドポイントのURLを確認してください"
+	return d
+}
+
+// closestString は、候補のうち編集距離が最も近く、かつ十分に近い文字列を返します（typo の推測用）
+func closestString(s string, candidates []string) string {
+	best, bestDist := "", len(s)/2+2
+	for _, c := range candidates {
+		if dist := levenshtein(s, c); dist < bestDist {
+			best, bestDist = c, dist
+		}
+	}
+	return best
+}
+
+// levenshtein は、2つの文字列の編集距離を返します
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+// minInt は2つの整数の小さい方を返します
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
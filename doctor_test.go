@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// unreachableClient は、接続できない HAProxy を再現するクライアントです
+type unreachableClient struct {
+	*haproxyfake.HAProxy
+}
+
+func (unreachableClient) Ping() error { return errors.New("connection refused") }
+
+func (unreachableClient) GetAPIVersion() (string, error) { return "", errors.New("connection refused") }
+
+// versionClient は、指定した API バージョンを返すクライアントです
+type versionClient struct {
+	*haproxyfake.HAProxy
+	version string
+}
+
+func (c versionClient) GetAPIVersion() (string, error) { return c.version, nil }
+
+func TestRunDiagnosticsReportsEachEndpoint(t *testing.T) {
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://doctor-ok", "http://lb-2:5555", "http://lb-3:5555"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10}]
+	}`)
+	fake := haproxyfake.New()
+	clients := map[string]haproxyClient{
+		"memory://doctor-ok": fake,
+		"http://lb-2:5555":   unreachableClient{fake},
+		"http://lb-3:5555":   versionClient{fake, "v3.0.1"},
+	}
+	results := runDiagnostics(config, func(endpoint string) haproxyClient { return clients[endpoint] })
+
+	want := map[string]diagnosisLevel{
+		"設定の検証": levelPass,
+		"重複の確認": levelPass,
+		"ロードバランシングアルゴリズム":                levelPass,
+		"エンドポイントへの接続 memory://doctor-ok": levelPass,
+		"APIバージョン memory://doctor-ok":    levelPass,
+		"エンドポイントへの接続 http://lb-2:5555":   levelFail,
+		"APIバージョン http://lb-2:5555":      levelWarn,
+		"エンドポイントへの接続 http://lb-3:5555":   levelPass,
+		"APIバージョン http://lb-3:5555":      levelFail,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("診断結果の件数 = %d, want %d: %+v", len(results), len(want), results)
+	}
+	for _, d := range results {
+		if d.Level != want[d.Check] {
+			t.Errorf("%s = %s, want %s（%s）", d.Check, d.Level, want[d.Check], d.Message)
+		}
+		if d.Level != levelPass && d.Hint == "" {
+			t.Errorf("%s に対処方法がありません", d.Check)
+		}
+	}
+	if servers, _ := fake.GetServers(); len(servers) != 0 || fake.Reloads() != 0 {
+		t.Errorf("診断後のサーバー数 %d、reload %d 回, want 0, 0（HAProxy を変更しないこと）", len(servers), fake.Reloads())
+	}
+}
+
+func TestCheckAlgorithmSuggestsTypoFix(t *testing.T) {
+	d := checkAlgorithm(&Config{LoadBalancingAlgorithm: "leastconnn"}, "", nil)
+	if d.Level != levelFail || !strings.Contains(d.Hint, `"leastconn" の誤り`) {
+		t.Errorf("checkAlgorithm = %s（%s）, want FAIL と leastconn の提案", d.Level, d.Hint)
+	}
+}
+
+func TestCheckDuplicateNames(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		backends []BackendConfig
+		want     diagnosisLevel
+	}{
+		{"重複なし", []BackendConfig{{Name: "web-1", IP: "10.0.0.1", Port: 80}, {Name: "web-2", IP: "10.0.0.2", Port: 80}}, levelPass},
+		{"別グループの同名サーバー", []BackendConfig{{Name: "app-1", Group: "web", IP: "10.0.0.1", Port: 80}, {Name: "app-1", Group: "api", IP: "10.0.0.2", Port: 80}}, levelPass},
+		{"同じグループの同名サーバー", []BackendConfig{{Name: "web-1", IP: "10.0.0.1", Port: 80}, {Name: "web-1", IP: "10.0.0.2", Port: 80}}, levelFail},
+		{"同じアドレス", []BackendConfig{{Name: "web-1", IP: "10.0.0.1", Port: 80}, {Name: "web-2", IP: "10.0.0.1", Port: 80}}, levelWarn},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if d := checkDuplicateNames(&Config{Backends: tt.backends}, "", nil); d.Level != tt.want {
+				t.Errorf("checkDuplicateNames = %s（%s）, want %s", d.Level, d.Message, tt.want)
+			}
+		})
+	}
+}
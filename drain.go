@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// -graceful-remove の接続の確認に関する既定値です
+const (
+	defaultDrainTimeout       = 60 * time.Second
+	drainPollInterval         = 2 * time.Second
+	drainActionSkip           = "skip"  // タイムアウトしたサーバーは drain のまま残し、削除しない
+	drainActionForce          = "force" // タイムアウトしたサーバーも削除する
+	defaultDrainTimeoutAction = drainActionSkip
+)
+
+// drainPolicy は、サーバーを削除する前に drain 状態にして接続がなくなるのを待つ方法です（-graceful-remove）
+type drainPolicy struct {
+	timeout  time.Duration // 接続がなくなるのを待つ最大時間
+	interval time.Duration // 接続数を確認する間隔
+	force    bool          // タイムアウトした場合も削除するかどうか
+
+	sleep func(time.Duration) // テスト用に差し替えられる待機処理（nil の場合は time.Sleep）
+	now   func() time.Time    // テスト用に差し替えられる現在時刻（nil の場合は time.Now）
+}
+
+// newDrainPolicy は、タイムアウトとタイムアウト時の動作（skip または force）から drain の方法を返します
+func newDrainPolicy(timeout time.Duration, onTimeout string) (*drainPolicy, error) {
+	if timeout <= 0 {
+		return nil, fmt.Errorf("-drain-timeout は正の時間で指定してください（指定値: %v）", timeout)
+	}
+	switch onTimeout {
+	case drainActionSkip, drainActionForce:
+	default:
+		return nil, fmt.Errorf("-drain-timeout-action には %s または %s を指定してください（指定値: %s）", drainActionSkip, drainActionForce, onTimeout)
+	}
+	return &drainPolicy{timeout: timeout, interval: drainPollInterval, force: onTimeout == drainActionForce}, nil
+}
+
+// drainServer は、サーバーを drain 状態にし、現在の接続数が 0 になるまで最大 timeout の間待ちます。
+// 接続がなくなれば true、タイムアウトした場合は false を返します
+func drainServer(client haproxyClient, server haproxy.Server, policy *drainPolicy) (bool, error) {
+	sleep, now := policy.sleep, policy.now
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	if now == nil {
+		now = time.Now
+	}
+
+	if err := client.DrainServer(server.Backend, server.Name); err != nil {
+		return false, fmt.Errorf("サーバー[%s]を drain 状態にできません: %w", server.Name, err)
+	}
+	logf("サーバー[%s]を drain 状態にしました。接続がなくなるまで最大 %v 待ちます\n", server.Name, policy.timeout)
+
+	deadline := now().Add(policy.timeout)
+	for {
+		sessions, err := client.GetServerSessions(server.Backend, server.Name)
+		if err != nil {
+			return false, fmt.Errorf("サーバー[%s]の接続数の取得に失敗: %w", server.Name, err)
+		}
+		if sessions == 0 {
+			return true, nil
+		}
+		if !now().Before(deadline) {
+			return false, nil
+		}
+		sleep(policy.interval)
+	}
+}
+
+// drainBeforeRemove は、削除の前にサーバーを drain します。削除してよい場合は true を返します。
+// タイムアウトした場合は、force ならそのまま削除し、そうでなければ警告を出力して削除しません
+func drainBeforeRemove(client haproxyClient, server haproxy.Server, policy *drainPolicy) (bool, error) {
+	drained, err := drainServer(client, server, policy)
+	if err != nil || drained {
+		return drained, err
+	}
+	if policy.force {
+		warnf("サーバー[%s]の接続が %v 以内になくならなかったため、接続が残ったまま削除します", server.Name, policy.timeout)
+		return true, nil
+	}
+	warnf("サーバー[%s]の接続が %v 以内になくならなかったため、drain 状態のまま削除しません（次回の適用で再試行します）", server.Name, policy.timeout)
+	return false, nil
+}
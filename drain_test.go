@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// drainRecordingClient は、drain・接続数の取得・削除の呼び出し順を記録するクライアントです。
+// 接続数は sessions の値を返し、取得するたびに1ずつ減らします（負の値は減らさず常に接続が残るものとします）
+type drainRecordingClient struct {
+	*haproxyfake.HAProxy
+	sessions map[string]int64
+	calls    []string
+}
+
+func (c *drainRecordingClient) DrainServer(backend, name string) error {
+	c.calls = append(c.calls, "drain:"+name)
+	return c.HAProxy.DrainServer(backend, name)
+}
+
+func (c *drainRecordingClient) GetServerSessions(backend, name string) (int64, error) {
+	n := c.sessions[name]
+	if n < 0 {
+		return 1, nil
+	}
+	if n > 0 {
+		c.sessions[name] = n - 1
+	}
+	return n, nil
+}
+
+func (c *drainRecordingClient) RemoveServer(server *haproxy.Server) error {
+	c.calls = append(c.calls, "remove:"+server.Name)
+	return c.HAProxy.RemoveServer(server)
+}
+
+// testDrainPolicy は、実際には待たず、待機のたびに時計を interval だけ進める drain の方法を返します
+func testDrainPolicy(force bool) *drainPolicy {
+	clock := time.Unix(0, 0)
+	return &drainPolicy{
+		timeout:  10 * time.Second,
+		interval: 2 * time.Second,
+		force:    force,
+		sleep:    func(d time.Duration) { clock = clock.Add(d) },
+		now:      func() time.Time { return clock },
+	}
+}
+
+func newDrainTestClient(t *testing.T, sessions map[string]int64) (*drainRecordingClient, []haproxy.Server) {
+	t.Helper()
+	client := &drainRecordingClient{HAProxy: haproxyfake.New(), sessions: sessions}
+	var servers []haproxy.Server
+	for _, name := range []string{"web-1", "web-2"} {
+		s := haproxy.Server{Backend: "web", Name: name, IP: "10.0.0.1", Port: 80}
+		if err := client.HAProxy.AddServer(&s); err != nil {
+			t.Fatal(err)
+		}
+		servers = append(servers, s)
+	}
+	return client, servers
+}
+
+func TestGracefulRemoveDrainsBeforeRemove(t *testing.T) {
+	captureOutput(t)
+	client, servers := newDrainTestClient(t, map[string]int64{"web-1": 2, "web-2": 0})
+	results := removeServers(context.Background(), client, servers, 1, testDrainPolicy(false), nil)
+
+	if got, want := strings.Join(client.calls, ","), "drain:web-1,remove:web-1,drain:web-2,remove:web-2"; got != want {
+		t.Errorf("呼び出し順 = %s, want %s（drain してから削除すること）", got, want)
+	}
+	for _, r := range results {
+		if r.Status != StatusRemoved {
+			t.Errorf("%s の結果 = %s, want %s", r.Name, r.Status, StatusRemoved)
+		}
+	}
+}
+
+func TestGracefulRemoveTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		force      bool
+		wantCalls  string
+		wantStatus BackendStatus
+		wantLeft   int
+	}{
+		{"skip", false, "drain:web-1,drain:web-2,remove:web-2", StatusRemovalBlocked, 1},
+		{"force", true, "drain:web-1,remove:web-1,drain:web-2,remove:web-2", StatusRemoved, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := captureOutput(t)
+			client, servers := newDrainTestClient(t, map[string]int64{"web-1": -1, "web-2": 0})
+			results := removeServers(context.Background(), client, servers, 1, testDrainPolicy(tt.force), nil)
+
+			if got := strings.Join(client.calls, ","); got != tt.wantCalls {
+				t.Errorf("呼び出し順 = %s, want %s", got, tt.wantCalls)
+			}
+			if len(results) != 2 || results[0].Status != tt.wantStatus || results[1].Status != StatusRemoved {
+				t.Errorf("結果 = %+v, want web-1 が %s、web-2 が %s", results, tt.wantStatus, StatusRemoved)
+			}
+			if servers, _ := client.GetServers(); len(servers) != tt.wantLeft {
+				t.Errorf("残ったサーバー数 = %d, want %d", len(servers), tt.wantLeft)
+			}
+			if !strings.Contains(errs.String(), "以内になくならなかった") {
+				t.Errorf("タイムアウトの警告 = %q, want 接続がなくならなかった旨の警告", errs.String())
+			}
+		})
+	}
+}
+
+func TestNewDrainPolicy(t *testing.T) {
+	if p, err := newDrainPolicy(time.Minute, drainActionForce); err != nil || !p.force || p.timeout != time.Minute {
+		t.Errorf("newDrainPolicy(1m, force) = %+v, %v, want force の drain", p, err)
+	}
+	if _, err := newDrainPolicy(0, drainActionSkip); err == nil {
+		t.Error("-drain-timeout 0 がエラーになりませんでした")
+	}
+	if _, err := newDrainPolicy(time.Minute, "wait"); err == nil {
+		t.Error("未対応の -drain-timeout-action がエラーになりませんでした")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// envStatusVariables は、-format env で出力する結果の件数の変数名と、数える状態です。
+// ラッパースクリプトから参照されるため、既存の変数名と順序は変更しないでください
+var envStatusVariables = []struct {
+	name     string
+	statuses []BackendStatus
+}{
+	{"LB_ADDED", []BackendStatus{StatusAdded}},
+	{"LB_UPDATED", []BackendStatus{StatusUpdated}},
+	{"LB_SKIPPED", []BackendStatus{StatusSkippedExists}},
+	{"LB_FAILED", []BackendStatus{StatusFailedValidation, StatusFailedAPI}},
+	{"LB_REMOVED", []BackendStatus{StatusRemoved}},
+	{"LB_REMOVAL_BLOCKED", []BackendStatus{StatusRemovalBlocked}},
+	{"LB_BACKENDS_REMOVED", []BackendStatus{StatusBackendRemoved}},
+	{"LB_UNRESOLVABLE", []BackendStatus{StatusSkippedUnresolvable}},
+}
+
+// formatEnvResults は、適用結果を source できるシェル変数の代入（LB_ADDED=3 など）として1行ずつ返します。
+// 件数は全インスタンスの合計で、instances は適用先の数、failedInstances は適用に失敗したインスタンスの数です
+func formatEnvResults(results []*Result, instances, failedInstances int, runID string) string {
+	counts := map[BackendStatus]int{}
+	for _, r := range results {
+		for _, list := range [][]BackendResult{r.Backends, r.Removed} {
+			for _, br := range list {
+				counts[br.Status]++
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, v := range envStatusVariables {
+		n := 0
+		for _, status := range v.statuses {
+			n += counts[status]
+		}
+		fmt.Fprintf(&b, "%s=%d\n", v.name, n)
+	}
+	fmt.Fprintf(&b, "LB_INSTANCES=%d\n", instances)
+	fmt.Fprintf(&b, "LB_FAILED_INSTANCES=%d\n", failedInstances)
+	status := "ok"
+	if failedInstances > 0 {
+		status = "failed"
+	}
+	fmt.Fprintf(&b, "LB_STATUS=%s\n", status)
+	fmt.Fprintf(&b, "LB_RUN_ID=%s\n", shellQuote(runID))
+	return b.String()
+}
+
+// shellQuote は、文字列をシェルの単一引用符で囲みます（英数字と一部の記号のみの場合はそのまま返します）
+func shellQuote(s string) string {
+	safe := s != ""
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:/+@", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestFormatEnvResultsLines(t *testing.T) {
+	results := []*Result{
+		{
+			Backends: []BackendResult{
+				newBackendResult("web/web-1", StatusAdded, nil),
+				newBackendResult("web/web-2", StatusAdded, nil),
+				newBackendResult("web/web-3", StatusSkippedExists, nil),
+				newBackendResult("web/web-4", StatusFailedValidation, errors.New("port が不正です")),
+			},
+			Removed: []BackendResult{newBackendResult("web/web-9", StatusRemoved, nil)},
+		},
+		{
+			Backends: []BackendResult{
+				newBackendResult("web/web-1", StatusAdded, nil),
+				newBackendResult("web/web-2", StatusFailedAPI, errors.New("timeout")),
+			},
+			Removed: []BackendResult{newBackendResult("web/web-8", StatusRemovalBlocked, nil)},
+		},
+	}
+	want := strings.Join([]string{
+		"LB_ADDED=3",
+		"LB_UPDATED=0",
+		"LB_SKIPPED=1",
+		"LB_FAILED=2",
+		"LB_REMOVED=1",
+		"LB_REMOVAL_BLOCKED=1",
+		"LB_BACKENDS_REMOVED=0",
+		"LB_UNRESOLVABLE=0",
+		"LB_INSTANCES=3",
+		"LB_FAILED_INSTANCES=1",
+		"LB_STATUS=failed",
+		"LB_RUN_ID=20261014-081104",
+	}, "\n") + "\n"
+	if got := formatEnvResults(results, 3, 1, "20261014-081104"); got != want {
+		t.Errorf("formatEnvResults() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatEnvResultsAllSucceeded(t *testing.T) {
+	got := formatEnvResults(nil, 2, 0, "")
+	if !strings.Contains(got, "LB_STATUS=ok\n") || !strings.HasSuffix(got, "LB_RUN_ID=''\n") {
+		t.Errorf("formatEnvResults() = %q, want LB_STATUS=ok、空の LB_RUN_ID は引用符で囲むこと", got)
+	}
+}
+
+func TestShellQuoteCanBeSourced(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh がありません")
+	}
+	for _, value := range []string{"run-1", "it's $HOME `date`", "a b;c", ""} {
+		var out bytes.Buffer
+		cmd := exec.Command(sh, "-c", "LB_RUN_ID="+shellQuote(value)+`; printf %s "$LB_RUN_ID"`)
+		cmd.Stdout = &out
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("sh の実行に失敗: %v", err)
+		}
+		if out.String() != value {
+			t.Errorf("shellQuote(%q) を sh で評価した値 = %q, want 元の文字列", value, out.String())
+		}
+	}
+}
+
+func TestQuietSuppressesProgressButNotWarnings(t *testing.T) {
+	logs, errs := captureOutput(t)
+	quietLog = true
+	t.Cleanup(func() { quietLog = false })
+	logf("サーバー[%s]を追加しました\n", "web-1")
+	warnf("ホスト名[%s]を名前解決できません", "db.internal")
+	if logs.Len() != 0 {
+		t.Errorf("-quiet で処理状況のメッセージが出力されました: %q", logs)
+	}
+	if !strings.Contains(errs.String(), "db.internal") {
+		t.Errorf("-quiet で警告が出力されませんでした: %q", errs)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// reconcileAction は、サーバーごとに行う操作の種類です
+type reconcileAction string
+
+const (
+	actionAdd    reconcileAction = "追加"
+	actionUpdate reconcileAction = "更新"
+	actionCheck  reconcileAction = "ヘルスチェックの切り替え"
+	actionRename reconcileAction = "名前の変更"
+	actionSkip   reconcileAction = "変更なし"
+	actionRemove reconcileAction = "削除"
+
+	// 計画の表示のみで使う、操作を行わない理由の種類です
+	actionInvalid reconcileAction = "スキップ"  // 設定が不正なため適用しない
+	actionKeep    reconcileAction = "削除しない" // min_servers を下回るため削除しない
+)
+
+// serverDecision は、サーバーに対して行う操作とその理由です。
+// 実際の適用（reconcileBackend）と -explain の表示で同じ判断を使います
+type serverDecision struct {
+	action reconcileAction
+	reason string
+}
+
+// decideServer は、現在の状態と設定から組み立てたサーバー定義を比較し、行う操作を決定します
+func decideServer(state *liveState, desired haproxy.Server) serverDecision {
+	found := state.server(desired)
+	if found == nil {
+		return serverDecision{actionAdd, "HAProxy上に存在しません"}
+	}
+	cur := *found
+	switch {
+	case cur.Name != desired.Name:
+		return serverDecision{actionRename, fmt.Sprintf("id %d のサーバーの名前が異なります %s->%s", desired.ID, cur.Name, desired.Name)}
+	case serverMatches(cur, desired):
+		return serverDecision{actionSkip, "設定ファイルと同じ内容です"}
+	case cur.Check != desired.Check && serverMatches(withoutHealthCheck(cur), withoutHealthCheck(desired)):
+		return serverDecision{actionCheck, fmt.Sprintf("check のみが異なります %v->%v", cur.Check, desired.Check)}
+	default:
+		return serverDecision{actionUpdate, strings.Join(serverDifferences(cur, desired), ", ")}
+	}
+}
+
+// withoutHealthCheck は、ヘルスチェックに関する項目（check と inter などのパラメータ）を除いたサーバー定義を返します。
+// check を無効にするとパラメータも設定されなくなるため、ヘルスチェックの切り替えかどうかはこれらを除いて比較します
+func withoutHealthCheck(s haproxy.Server) haproxy.Server {
+	s.Check, s.Inter, s.Fall, s.Rise, s.Downinter, s.Fastinter = false, "", 0, 0, "", ""
+	s.CheckAddr, s.CheckPort = "", 0
+	return s
+}
+
+// decideTemplate は、現在の状態と server-template の定義を比較し、行う操作を決定します
+func decideTemplate(state *liveState, desired haproxy.ServerTemplate) serverDecision {
+	cur, ok := state.templates[serverKey(desired.Backend, desired.Prefix)]
+	switch {
+	case !ok:
+		return serverDecision{actionAdd, "HAProxy上に存在しません"}
+	case cur == desired:
+		return serverDecision{actionSkip, "設定ファイルと同じ内容です"}
+	default:
+		return serverDecision{actionUpdate, strings.Join(templateDifferences(cur, desired), ", ")}
+	}
+}
+
+// serverDifferences は、サーバー定義の異なる項目を "weight が異なります 10->20" の形式で返します
+func serverDifferences(cur, desired haproxy.Server) []string {
+	return formatChanges(serverChanges(cur, desired))
+}
+
+// templateDifferences は、server-template の異なる項目を serverDifferences と同じ形式で返します
+func templateDifferences(cur, desired haproxy.ServerTemplate) []string {
+	return formatChanges(templateChanges(cur, desired))
+}
+
+// formatChanges は、項目ごとの変更を表示用の文字列にします
+func formatChanges(changes []fieldChange) []string {
+	diffs := make([]string, 0, len(changes))
+	for _, c := range changes {
+		diffs = append(diffs, fmt.Sprintf("%s が異なります %v->%v", c.field, c.from, c.to))
+	}
+	return diffs
+}
+
+// serverPlanEntry は、サーバーごとの操作の計画の1件です。target が空の場合は reason のみを表示する注記です
+type serverPlanEntry struct {
+	target string
+	action reconcileAction
+	reason string
+}
+
+// String は、計画の1件を "サーバー[backend/name]: 操作（理由）" の形式で返します
+func (e serverPlanEntry) String() string {
+	if e.target == "" {
+		return e.reason
+	}
+	return fmt.Sprintf("サーバー[%s]: %s（%s）", e.target, e.action, e.reason)
+}
+
+// planServers は、現在の状態を読み取り、サーバーごとの操作とその理由を適用順に返します（-dry-run / -explain 用）。
+// 読み取り（GetServers, GetServerTemplates）のみを行い、HAProxyへの変更は行いません
+func planServers(client haproxyClient, config *Config, opts applyOptions) ([]serverPlanEntry, error) {
+	groups, err := orderGroups(config)
+	if err != nil {
+		return nil, err
+	}
+	state, current, err := loadLiveState(client, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.pruneOnly {
+		groups = nil // -prune-only ではサーバーの追加・更新を行いません
+	}
+
+	var entries []serverPlanEntry
+	for _, group := range groups {
+		// -skip-unresolvable 指定時は、適用と同様にホスト名を名前解決できないサーバーを除きます
+		skipped := &Result{}
+		backends := skipUnresolvable(opts.resolver, skipped, opts.tags.filter(group.backends))
+		for _, r := range skipped.Backends {
+			entries = append(entries, serverPlanEntry{serverKey(group.name, r.Name), actionInvalid, r.Error})
+		}
+		for _, backend := range backends {
+			if err := validateBackend(backend); err != nil {
+				entries = append(entries, serverPlanEntry{serverKey(backend.Group, backend.Name), actionInvalid, fmt.Sprintf("設定が不正です: %v", err)})
+				continue
+			}
+			var d serverDecision
+			if backend.SRV != "" {
+				template := buildServerTemplate(config, backend)
+				d = decideTemplate(state, template)
+				if d.action != actionSkip {
+					emitTemplateChanges(changeStagePlanned, d.action, state.template(template), template)
+				}
+			} else {
+				server := buildServer(config, backend)
+				d = decideServer(state, server)
+				if d.action != actionSkip {
+					emitServerChanges(changeStagePlanned, d.action, state.server(server), server)
+				}
+			}
+			entries = append(entries, serverPlanEntry{serverKey(backend.Group, backend.Name), d.action, d.reason})
+		}
+	}
+	if opts.prune && opts.seed && isInitialTarget(config, state) {
+		entries = append(entries, serverPlanEntry{reason: "初回の適用（seed）のため、設定ファイルに記載のないサーバーは削除しません"})
+	} else if opts.prune {
+		removals, blocked := guardMinServers(config, opts.tags.filterRemovals(plannedRemovals(config, current)), opts.force)
+		for _, s := range removals {
+			entries = append(entries, serverPlanEntry{serverKey(s.Backend, s.Name), actionRemove, "設定ファイルに記載がありません"})
+			emitRemoval(changeStagePlanned, s)
+		}
+		for _, br := range blocked {
+			entries = append(entries, serverPlanEntry{br.Name, actionKeep, br.Error})
+		}
+	}
+	return entries, nil
+}
+
+// explainServers は、planServers の結果をサーバーごとの操作とその理由の一覧として返します（-explain 用）
+func explainServers(client haproxyClient, config *Config, opts applyOptions) ([]string, error) {
+	entries, err := planServers(client, config, opts)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		lines = append(lines, e.String())
+	}
+	return lines, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExplainServersReasons(t *testing.T) {
+	captureOutput(t)
+	before := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://explain"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-old", "ip": "10.0.0.9", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, before, applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	after := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://explain"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 20, "group": "web"},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "group": "web", "health_check": {"enabled": false}},
+			{"name": "web-4", "ip": "10.0.0.4", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-5", "ip": "10.0.0.5", "port": 80, "weight": 300, "group": "web"}
+		]
+	}`)
+	lines, err := explainServers(fake, after, applyOptions{prune: true})
+	if err != nil {
+		t.Fatalf("explainServers がエラーを返しました: %v", err)
+	}
+	want := []string{
+		"サーバー[web/web-1]: 変更なし（設定ファイルと同じ内容です）",
+		"サーバー[web/web-2]: 更新（weight が異なります 10->20）",
+		"サーバー[web/web-3]: ヘルスチェックの切り替え（check のみが異なります true->false）",
+		"サーバー[web/web-4]: 追加（HAProxy上に存在しません）",
+		"サーバー[web/web-5]: スキップ（設定が不正です: " + validateBackend(after.Backends[4]).Error() + "）",
+		"サーバー[web/web-old]: 削除（設定ファイルに記載がありません）",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("explainServers() =\n%q\nwant\n%q", lines, want)
+	}
+	if servers, _ := fake.GetServers(); len(servers) != 4 || fake.Reloads() != 4 {
+		t.Errorf("説明の後のサーバー数 %d、reload %d 回, want 4, 4（HAProxyを変更しないこと）", len(servers), fake.Reloads())
+	}
+}
+
+func TestDryRunPlansAgainstLiveState(t *testing.T) {
+	logs, errs := captureOutput(t)
+	endpoint, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://dry-run"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-old", "ip": "10.0.0.9", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`), applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	reloads := fake.Reloads()
+
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["`+endpoint+`", "unix:///nonexistent/haproxy.sock"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 20, "group": "web"},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	if err := planEndpoints(config, applyOptions{prune: true}); err != nil {
+		t.Fatalf("planEndpoints がエラーを返しました: %v", err)
+	}
+
+	want := "[dry-run] インスタンス[" + endpoint + "]の現在の状態に対するサーバーの変更（追加 1, 更新 1, 削除 1）:\n" + formatPlan([]string{
+		"サーバー[web/web-2]: 更新（weight が異なります 10->20）",
+		"サーバー[web/web-3]: 追加（HAProxy上に存在しません）",
+		"サーバー[web/web-old]: 削除（設定ファイルに記載がありません）",
+	})
+	if !strings.Contains(logs.String(), want) {
+		t.Errorf("dry-run の出力 =\n%s\nwant\n%s を含むこと（変更なしのサーバーは表示しないこと）", logs.String(), want)
+	}
+	if !strings.Contains(errs.String(), "インスタンス[unix:///nonexistent/haproxy.sock]に接続できない") {
+		t.Errorf("接続できないインスタンスの警告 = %q, want 接続できない旨の警告", errs.String())
+	}
+	if servers, _ := fake.GetServers(); len(servers) != 3 || fake.Reloads() != reloads {
+		t.Errorf("dry-run の後のサーバー数 %d、reload %d 回, want 3, %d（読み取りのみで変更しないこと）", len(servers), fake.Reloads(), reloads)
+	}
+}
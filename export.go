@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// exportConfig は、HAProxy上の現在の状態（バックエンド、サーバー、アルゴリズム、再接続ポリシー）から
+// apply でそのまま使える設定を組み立てます。runtime socket で取得できない項目は警告して省略します。
+// APIキーは秘匿情報のため出力しません（適用時は -api-key または環境変数で指定してください）
+func exportConfig(client haproxyClient, endpoint string) (*Config, error) {
+	config := &Config{APIVersion: currentConfigVersion, HaproxyEndpoint: endpointList{endpoint}}
+
+	servers, err := client.GetServers()
+	if err != nil {
+		return nil, fmt.Errorf("現在のサーバー一覧の取得に失敗: %w", err)
+	}
+	for _, s := range servers {
+		config.Backends = append(config.Backends, exportBackend(s))
+	}
+
+	// サーバーのないバックエンドも groups として出力します
+	backends, err := client.GetBackends()
+	switch {
+	case errors.Is(err, errRuntimeUnsupported):
+		warnf("バックエンド一覧を取得できないため、サーバーのあるバックエンドのみ出力します: %v", err)
+	case err != nil:
+		return nil, fmt.Errorf("バックエンド一覧の取得に失敗: %w", err)
+	}
+	for _, name := range backends {
+		config.Groups = append(config.Groups, GroupConfig{Name: name})
+	}
+
+	if err := exportGlobals(client, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// exportGlobals は、ロードバランシングアルゴリズムと再接続ポリシーを読み取って設定に反映します
+func exportGlobals(client haproxyClient, config *Config) error {
+	values := map[string]string{}
+	for _, key := range []string{"balance", "retries", "option redispatch"} {
+		v, err := client.GetConfig(key)
+		switch {
+		case errors.Is(err, errRuntimeUnsupported):
+			warnf("%s を取得できないため省略します: %v", key, err)
+			continue
+		case err != nil:
+			return fmt.Errorf("現在の %s の取得に失敗: %w", key, err)
+		}
+		values[key] = v
+	}
+
+	config.LoadBalancingAlgorithm = values["balance"]
+	if v := values["retries"]; v != "" {
+		retries, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("retries[%s]を解釈できません: %w", v, err)
+		}
+		config.RetryPolicy.Retries = retries
+	}
+	config.RetryPolicy.Redispatch = values["option redispatch"] == "on"
+	return nil
+}
+
+// exportBackend は、HAProxy上のサーバー定義を設定ファイルのバックエンド設定に変換します（buildServer の逆変換）
+func exportBackend(s haproxy.Server) BackendConfig {
+	b := BackendConfig{
+		Name:    s.Name,
+		IP:      s.IP,
+		Port:    s.Port,
+		Weight:  int(s.Weight),
+		Group:   s.Backend,
+		Maxconn: int(s.Maxconn),
+		Source:  s.Source,
+		SSL:     s.SSL,
+		ALPN:    splitList(s.Alpn),
+		NPN:     splitList(s.Npn),
+		Verify:  s.Verify,
+		SNI:     s.Sni,
+		ID:      int(s.ID),
+		Labels:  copyLabels(s.Metadata),
+
+		SSLClientCert:  s.SSLCertificate,
+		SendProxy:      s.SendProxy,
+		ProxyV2Options: splitList(s.ProxyV2Options),
+		Track:          s.Track,
+	}
+	if strings.HasPrefix(s.IP, unixAddressPrefix) {
+		b.Socket, b.IP, b.Port = strings.TrimPrefix(s.IP, unixAddressPrefix), "", 0
+	}
+
+	// ヘルスチェックはサーバーごとに異なり得るため、サーバー個別の設定として出力します
+	enabled := s.Check
+	hc := &HealthCheckOverride{Enabled: &enabled}
+	if s.Check {
+		if d, err := time.ParseDuration(s.Inter); err == nil {
+			interval := exportInterval(d)
+			if time.Duration(interval)*time.Second != d {
+				warnf("サーバー[%s/%s]のチェック間隔 %s は秒単位で指定できないため、%d 秒として出力します", s.Backend, s.Name, s.Inter, interval)
+			}
+			hc.Interval = &interval
+		}
+		fall, rise := s.Fall, s.Rise
+		hc.Fall, hc.Rise = &fall, &rise
+		if s.Downinter != "" {
+			downinter := s.Downinter
+			hc.Downinter = &downinter
+		}
+		if s.Fastinter != "" {
+			fastinter := s.Fastinter
+			hc.Fastinter = &fastinter
+		}
+		if s.CheckAddr != "" {
+			addr := s.CheckAddr
+			hc.Address = &addr
+		}
+		if s.CheckPort > 0 {
+			port := s.CheckPort
+			hc.Port = &port
+		}
+	}
+	b.HealthCheck = hc
+	return b
+}
+
+// exportInterval は、チェック間隔を health_check.interval の秒数に変換します。
+// 1 秒未満や端数のある間隔は切り上げ、validateCounts を満たす 1 秒以上の値にします
+func exportInterval(d time.Duration) int {
+	interval := int((d + time.Second - 1) / time.Second)
+	if interval < 1 {
+		interval = 1
+	}
+	return interval
+}
+
+// splitList は、カンマ区切りの文字列を一覧にします（空文字列なら nil）
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// runExport は、HAProxy上の現在の状態を設定ファイル形式のJSONで書き出します（export サブコマンド）。
+// 接続先は -endpoint、環境変数、設定ファイルの順に決定し、複数ある場合は最初のインスタンスから読み取ります
+func runExport() {
+	config, err := loadConfig(*configFlag)
+	if err != nil {
+		config = &Config{}
+	}
+	applyConnectionOverrides(config, *endpointFlag, *apiKeyFlag, os.Getenv)
+	if len(config.HaproxyEndpoint) == 0 {
+		log.Fatal("接続先が指定されていません（-endpoint または環境変数 " + envEndpoint + " を指定してください）")
+	}
+	endpoint := config.HaproxyEndpoint[0]
+
+	client, err := newReadOnlyClient(endpoint, config.APIKey, config.APIBasePath)
+	if err != nil {
+		log.Fatalf("HAProxyクライアントの初期化に失敗: %v", err)
+	}
+	exported, err := exportConfig(client, endpoint)
+	if err != nil {
+		log.Fatalf("現在の状態の書き出しに失敗: %v", err)
+	}
+	data, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		log.Fatalf("JSONへの変換に失敗: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *exportOutputFlag == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := ioutil.WriteFile(*exportOutputFlag, data, 0644); err != nil {
+		log.Fatalf("ファイル[%s]への書き出しに失敗: %v", *exportOutputFlag, err)
+	}
+	logf("現在の状態を %s に書き出しました（サーバー %d 台）\n", *exportOutputFlag, len(exported.Backends))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+func TestExportInterval(t *testing.T) {
+	for _, tt := range []struct {
+		inter time.Duration
+		want  int
+	}{
+		{500 * time.Millisecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{2 * time.Second, 2},
+		{0, 1},
+	} {
+		if got := exportInterval(tt.inter); got != tt.want {
+			t.Errorf("exportInterval(%s) = %d, want %d", tt.inter, got, tt.want)
+		}
+	}
+}
+
+func TestExportSubSecondInterRoundTrip(t *testing.T) {
+	_, errs := captureOutput(t)
+	endpoint, client := testMemoryEndpoint(t)
+	if err := client.AddServer(&haproxy.Server{
+		Backend: "web", Name: "web-1", IP: "10.0.0.1", Port: 80, Weight: 10,
+		Check: true, Inter: "500ms", Fall: 3, Rise: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := exportConfig(client, endpoint)
+	if err != nil {
+		t.Fatalf("exportConfig がエラーを返しました: %v", err)
+	}
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 書き出した設定がそのまま読み込み・検証を通ること（interval が 0 にならないこと）
+	config := loadTestConfig(t, string(data))
+	hc := config.Backends[0].HealthCheck
+	if hc == nil || hc.Interval == nil || *hc.Interval != 1 {
+		t.Errorf("書き出した health_check.interval = %+v, want 1（1 秒未満は切り上げ）", hc)
+	}
+	if !strings.Contains(errs.String(), "500ms") {
+		t.Errorf("切り上げの警告が出力されていません: %q", errs.String())
+	}
+}
+
+func TestExportConfigRoundTrip(t *testing.T) {
+	captureOutput(t)
+	client := haproxyfake.New()
+	for _, s := range []haproxy.Server{
+		{Backend: "web", Name: "web-1", IP: "10.0.0.1", Port: 80, Weight: 10, Check: true, Inter: "2s", Fall: 3, Rise: 2},
+		{Backend: "web", Name: "web-2", IP: "10.0.0.2", Port: 80, Weight: 20},
+	} {
+		if err := client.AddServer(&s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.SetConfig("balance", "leastconn")
+	client.SetConfig("retries", "3")
+	client.SetConfig("option redispatch", "on")
+
+	exported, err := exportConfig(client, "memory://export")
+	if err != nil {
+		t.Fatalf("exportConfig がエラーを返しました: %v", err)
+	}
+	if len(exported.Groups) != 1 || exported.Groups[0].Name != "web" {
+		t.Errorf("groups = %+v, want web のみ", exported.Groups)
+	}
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 書き出した設定がそのまま読み込み・検証を通り、同じサーバー定義になること
+	config := loadTestConfig(t, string(data))
+	if config.LoadBalancingAlgorithm != "leastconn" || config.RetryPolicy.Retries != 3 || !config.RetryPolicy.Redispatch {
+		t.Errorf("アルゴリズム = %s, retry_policy = %+v, want leastconn, retries 3, redispatch true", config.LoadBalancingAlgorithm, config.RetryPolicy)
+	}
+	current, _ := client.GetServers()
+	for i, b := range config.Backends {
+		if got := buildServer(config, b); !serverMatches(current[i], got) {
+			t.Errorf("書き出した %s のサーバー定義 = %+v, want %+v", b.Name, got, current[i])
+		}
+	}
+}
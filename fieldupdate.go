@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// serverFieldUpdater は、サーバーの一部の項目だけを個別の呼び出しで変更できるクライアントです。
+// 重みや最大接続数だけが異なるサーバーを定義全体の更新で書き換えないようにし、変更の影響を小さくするために使います。
+// 監査ログのクライアント（-audit-log）は、包んだクライアントが実装する場合のみ実装し、項目ごとに記録します
+type serverFieldUpdater interface {
+	SetWeight(backend, name string, weight int64) error
+	SetMaxconn(backend, name string, maxconn int64) error
+	SetHealthCheck(backend, name string, enabled bool) error
+}
+
+// fieldUpdatableServerFields は、serverFieldUpdater で個別に変更できるサーバーの項目（serverChanges の field）です
+var fieldUpdatableServerFields = map[string]bool{
+	"weight":  true,
+	"maxconn": true,
+	"check":   true,
+}
+
+// fieldLevelChanges は、異なる項目がすべて個別に変更できる項目の場合にその一覧を返します。
+// 異なる項目がない、または個別に変更できない項目を含む場合は nil を返します（定義全体を更新します）
+func fieldLevelChanges(cur, desired haproxy.Server) []fieldChange {
+	changes := serverChanges(cur, desired)
+	for _, c := range changes {
+		if !fieldUpdatableServerFields[c.field] {
+			return nil
+		}
+	}
+	return changes
+}
+
+// updateServerFields は、異なる項目ごとに個別の呼び出しで変更します
+func updateServerFields(client serverFieldUpdater, server haproxy.Server, changes []fieldChange) error {
+	for _, c := range changes {
+		var err error
+		switch c.field {
+		case "weight":
+			err = client.SetWeight(server.Backend, server.Name, server.Weight)
+		case "maxconn":
+			err = client.SetMaxconn(server.Backend, server.Name, server.Maxconn)
+		case "check":
+			err = client.SetHealthCheck(server.Backend, server.Name, server.Check)
+		}
+		if err != nil {
+			return fmt.Errorf("%s の変更に失敗: %w", c.field, err)
+		}
+	}
+	return nil
+}
+
+// updateServerFieldsWithRetry は、異なる項目の個別の変更を指定回数リトライします（いずれの変更も冪等なためそのまま再送します）
+func updateServerFieldsWithRetry(ctx context.Context, client serverFieldUpdater, server haproxy.Server, changes []fieldChange, retries int) error {
+	fields := make([]string, len(changes))
+	for i, c := range changes {
+		fields[i] = c.field
+	}
+	defer profileOp("update-fields " + serverKey(server.Backend, server.Name))()
+	return runWithRetry(ctx, clientOperation{
+		subject:    fmt.Sprintf("サーバー[%s]の %s ", server.Name, strings.Join(fields, ", ")),
+		verb:       "変更",
+		success:    fmt.Sprintf("サーバー[%s]の %s を変更しました", server.Name, strings.Join(fields, ", ")),
+		idempotent: true,
+		run:        func() error { return updateServerFields(client, server, changes) },
+	}, retries)
+}
+
+// applyServerUpdate は、既存のサーバーを設定どおりに更新します。
+// クライアントが個別の変更に対応し、異なる項目がすべて個別に変更できる場合はその項目だけを変更し、それ以外は定義全体を更新します
+func applyServerUpdate(ctx context.Context, client haproxyClient, cur *haproxy.Server, server haproxy.Server, attempts int) error {
+	if updater, ok := client.(serverFieldUpdater); ok && cur != nil {
+		if changes := fieldLevelChanges(*cur, server); len(changes) > 0 {
+			return updateServerFieldsWithRetry(ctx, updater, server, changes, attempts)
+		}
+	}
+	return updateServerWithRetry(ctx, client, server, attempts)
+}
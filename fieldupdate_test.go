@@ -0,0 +1,132 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// fieldRecordingClient は、サーバーの定義全体の更新と項目ごとの変更の呼び出しを記録するクライアントです
+type fieldRecordingClient struct {
+	*haproxyfake.HAProxy
+	calls []string
+}
+
+func (c *fieldRecordingClient) UpdateServer(server *haproxy.Server) error {
+	c.calls = append(c.calls, "update:"+server.Name)
+	return c.HAProxy.UpdateServer(server)
+}
+
+func (c *fieldRecordingClient) SetWeight(backend, name string, weight int64) error {
+	c.calls = append(c.calls, "weight:"+name)
+	return c.HAProxy.SetWeight(backend, name, weight)
+}
+
+func (c *fieldRecordingClient) SetMaxconn(backend, name string, maxconn int64) error {
+	c.calls = append(c.calls, "maxconn:"+name)
+	return c.HAProxy.SetMaxconn(backend, name, maxconn)
+}
+
+func (c *fieldRecordingClient) SetHealthCheck(backend, name string, enabled bool) error {
+	c.calls = append(c.calls, "check:"+name)
+	return c.HAProxy.SetHealthCheck(backend, name, enabled)
+}
+
+func TestUpdateOnlyChangedFields(t *testing.T) {
+	captureOutput(t)
+	client := &fieldRecordingClient{HAProxy: haproxyfake.New()}
+	if _, err := applyConfig(client, loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://fields"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web", "maxconn": 100},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-4", "ip": "10.0.0.4", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`), applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	client.calls = nil
+
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://fields"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 20, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 30, "group": "web", "maxconn": 200},
+			{"name": "web-3", "ip": "10.0.0.33", "port": 80, "weight": 20, "group": "web"},
+			{"name": "web-4", "ip": "10.0.0.4", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	if _, err := applyConfig(client, config, applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	if got, want := strings.Join(client.calls, ","), "weight:web-1,weight:web-2,maxconn:web-2,update:web-3"; got != want {
+		t.Errorf("呼び出し = %s, want %s（異なる項目だけを変更し、個別に変更できない項目を含む場合のみ全体を更新すること）", got, want)
+	}
+	servers, _ := client.GetServers()
+	for i, s := range servers {
+		if want := buildServer(config, config.Backends[i]); !serverMatches(s, want) {
+			t.Errorf("サーバー[%s] = %+v, want %+v（設定どおりに変更されること）", s.Name, s, want)
+		}
+	}
+}
+
+func TestAuditLogKeepsFieldLevelUpdates(t *testing.T) {
+	captureOutput(t)
+	client := &fieldRecordingClient{HAProxy: haproxyfake.New()}
+	initial := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://fields"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	if _, err := applyConfig(client, initial, applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	client.calls = nil
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := openAuditLog(path, "run-1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://fields"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 20, "group": "web", "maxconn": 100},
+			{"name": "web-2", "ip": "10.0.0.22", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	if _, err := applyConfig(withAudit(client, audit, "memory://fields"), config, applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	if got, want := strings.Join(client.calls, ","), "weight:web-1,maxconn:web-1,update:web-2"; got != want {
+		t.Errorf("呼び出し = %s, want %s（-audit-log でも異なる項目だけを変更すること）", got, want)
+	}
+	var actions []string
+	for _, r := range readAuditRecords(t, path) {
+		if strings.HasPrefix(r.Target, "web/") {
+			actions = append(actions, r.Action+" "+r.Target)
+		}
+	}
+	want := []string{"set-weight web/web-1: weight=20", "set-maxconn web/web-1: maxconn=100", "update-server web/web-2"}
+	if strings.Join(actions, "\n") != strings.Join(want, "\n") {
+		t.Errorf("監査ログのサーバーの変更 = %q, want %q（1項目につき1レコード）", actions, want)
+	}
+
+	// 項目ごとの変更に対応しないクライアントを包んだ場合は、定義全体の更新のままにすること
+	if _, ok := withAudit(perServerClient{client}, audit, "memory://fields").(serverFieldUpdater); ok {
+		t.Error("serverFieldUpdater を実装しないクライアントを包んだ監査ログのクライアントが serverFieldUpdater になりました")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"time"
+)
+
+// コマンドラインフラグ
+var (
+	forbidAlgorithmFlag  stringListFlag
+	tagFlag              stringListFlag
+	excludeTagFlag       stringListFlag
+	configFlag           = flag.String("config", "config.json", "設定ファイルのパス（ディレクトリを指定した場合は中の *.json, *.yaml を辞書順にマージ）、または http(s)://, env://VAR, vault://path#field の読み込み元")
+	repeatFlag           = flag.Duration("repeat", 0, "指定した間隔で設定ファイルを読み直して適用を繰り返す（例: 30s、0で1回のみ）")
+	watchFlag            = flag.Bool("watch", false, "設定ファイル（またはディレクトリ）の変更を監視し、変更のたびに適用する")
+	watchIntervalFlag    = flag.Duration("watch-interval", 500*time.Millisecond, "-watch で、最後の変更からこの時間変更がなければ適用する（連続した変更を1回の適用にまとめる）")
+	endpointFlag         = flag.String("endpoint", "", "HAProxy APIのエンドポイント（設定ファイルと環境変数 "+envEndpoint+" より優先）")
+	discoveryURLFlag     = flag.String("endpoint-from-discovery", "", "起動時に HAProxy APIのエンドポイントを取得するディスカバリーのURL（-endpoint と同様に設定ファイルと環境変数 "+envEndpoint+" より優先）")
+	apiKeyFlag           = flag.String("api-key", "", "HAProxy APIのAPIキー（設定ファイルと環境変数 "+envAPIKey+" より優先）")
+	strictNumbersFlag    = flag.Bool("strict-numbers", false, "設定ファイルの数値の項目に文字列（\"80\" など）を指定した場合にエラーとする")
+	strictFlag           = flag.Bool("strict", false, "設定ファイルで非推奨の項目を使用した場合に、警告ではなくエラーとする")
+	exportOutputFlag     = flag.String("export-output", "", "export サブコマンドの書き出し先ファイル（未指定時は標準出力）")
+	reportFlag           = flag.String("report", "", "バックエンドごとの適用結果を書き出すJSONレポートのパス")
+	outputStateFlag      = flag.String("output-state", "", "適用後に読み取った HAProxy の実際の状態を設定ファイルの形式で書き出すパス（接続先が複数の場合はインスタンスごとに分けます）")
+	logFormatFlag        = flag.String("log-format", "text", "ログの形式（text または json。json は1行1イベントのJSON Lines）")
+	jsonErrorsFlag       = flag.Bool("json-errors", false, "エラーを分類・対象・原因の連鎖を含む1行1件のJSONオブジェクトで標準エラー出力に書き出す（処理状況と警告は -log-format のまま）")
+	colorFlag            = flag.Bool("color", false, "出力を常に色付けする（未指定時は端末への出力で NO_COLOR が未設定の場合のみ）")
+	noColorFlag          = flag.Bool("no-color", false, "出力を色付けしない")
+	planFormatFlag       = flag.String("plan-format", planFormatText, "plan / -dry-run と compare のサーバーの差分の出力形式（text または markdown。markdown は PR のコメント用に要約と diff のコードブロックを標準出力に出力）")
+	resultFormatFlag     = flag.String("format", "text", "適用結果の出力形式（text または env。env は LB_ADDED=3 のような source できるシェル変数の代入を標準出力に出力）")
+	quietFlag            = flag.Bool("quiet", false, "処理状況のメッセージを出力しない（警告とエラー、-format env の結果は出力する）")
+	outputFlag           = flag.String("output", "", "ログの出力先ファイル（未指定時は標準出力）")
+	outputMaxSizeFlag    = flag.Int("output-max-size", 0, "ログファイルをローテーションするサイズ（MB、0でローテーションしない）")
+	outputMaxFilesFlag   = flag.Int("output-max-files", 5, "保持するローテーション済みログファイルの数")
+	atomicFlag           = flag.Bool("atomic", false, "全ての変更を1つのトランザクションにまとめ、最後に1回だけ再読み込みする（Data Plane API のみ）")
+	degradeFlag          = flag.Bool("degrade-unsupported", false, "接続先のAPIが未対応の機能のうち critical でないものを除いて適用を続ける")
+	validateOnlyFlag     = flag.Bool("validate-only", false, "変更を加えず、接続先のAPIバージョンが設定で使う機能に対応しているかのみを確認する")
+	explainFlag          = flag.Bool("explain", false, "-dry-run / plan で現在の状態を読み取り、サーバーごとの操作の理由を表示する")
+	dryRunFlag           = flag.Bool("dry-run", false, "HAProxyに変更を加えず、適用する内容を順序どおりに表示する")
+	pruneFlag            = flag.Bool("prune", false, "設定ファイルに記載のないサーバーを削除する")
+	serverFilterFlag     = flag.String("server-filter", "", "名前がこの正規表現に一致するサーバーのみ追加・更新・削除する（全バックエンドが対象。一致しないサーバーは -prune でも削除しない）")
+	gracefulRemoveFlag   = flag.Bool("graceful-remove", false, "サーバーを削除する前に drain 状態にし、接続がなくなるのを待ってから削除する")
+	drainTimeoutFlag     = flag.Duration("drain-timeout", defaultDrainTimeout, "-graceful-remove で接続がなくなるのを待つ最大時間")
+	drainOnTimeoutFlag   = flag.String("drain-timeout-action", defaultDrainTimeoutAction, "-drain-timeout までに接続がなくならなかったサーバーの扱い（skip: drain のまま削除しない、force: 削除する）")
+	yesFlag              = flag.Bool("yes", false, "削除などの破壊的な操作の確認を省略する")
+	interactiveFlag      = flag.Bool("interactive", false, "適用前に計画と現在の状態との差分を表示し、確認されてから適用する（-yes または端末以外からの実行では確認しない）")
+	noAlgorithmFlag      = flag.Bool("no-algorithm", false, "ロードバランシングアルゴリズムを設定しない（他のチームが管理している場合など）")
+	noRetryPolicyFlag    = flag.Bool("no-retry-policy", false, "再接続ポリシー（retries, option redispatch）を設定しない")
+	pruneOnlyFlag        = flag.Bool("prune-only", false, "設定ファイルに記載のないサーバーの削除のみを行う（追加・更新やアルゴリズムなどの変更は行わない）")
+	skipUnresolvableFlag = flag.Bool("skip-unresolvable", false, "ip にホスト名を指定したサーバーのうち、今回の適用で名前解決できないものを警告を出力してスキップする（エラーにしない）")
+	seedFlag             = flag.Bool("seed", false, "管理対象のサーバーが1台もない接続先（初回の適用）では -prune や state: absent による削除を行わない")
+	forceFlag            = flag.Bool("force", false, "min_servers や -max-change-percent による制限を無視して適用する")
+	maxChangePercentFlag = flag.Float64("max-change-percent", 0, "追加・更新・削除するサーバーが現在のサーバー数のこの割合（%）を超える場合は適用を中止する（0で制限なし）")
+	healthyRatioFlag     = flag.Float64("healthy-ratio", 0.8, "health サブコマンドで合格とする正常なサーバーの割合（0〜1）")
+	healthTimeoutFlag    = flag.Duration("health-timeout", 60*time.Second, "health サブコマンドで条件を満たすまで待つ最大時間")
+	healthIntervalFlag   = flag.Duration("health-interval", 5*time.Second, "health サブコマンドでヘルス状態を取得する間隔")
+	waitForAPIFlag       = flag.Duration("wait-for-api", 0, "起動時にAPIへ接続できるまで待つ最大時間（例: 60s、0で待たない）")
+	compareFileFlag      = flag.String("compare-file", "", "compare サブコマンドで設定ファイルと比較するファイル（export の出力または別の設定ファイル）")
+	maxRetriesFlag       = flag.Int("max-retries", -1, "設定ファイルの retry_policy.retries と、サーバーの追加・更新・削除などのリトライ回数を上書きする（0 でリトライしない、-1 で上書きしない）")
+	skipPingFlag         = flag.Bool("skip-ping", false, "読み取り専用の処理（export, health, orphans, -validate-only, -dry-run）で起動時のPingによる疎通確認を行わない")
+	nagiosFlag           = flag.Bool("nagios", false, "health と doctor の結果を Nagios のプラグインの形式（1行の出力と終了コード 0:OK 1:WARNING 2:CRITICAL 3:UNKNOWN）で出力する")
+	concurrencyFlag      = flag.Int("concurrency", 1, "複数のHAProxyインスタンスへ並列に適用する数（1で順番に適用）")
+	failOnWarningsFlag   = flag.Bool("fail-on-warnings", false, "警告が1件でも出力された場合、実行完了後に終了コード 1 で終了する")
+	breakerThresholdFlag = flag.Int("breaker-threshold", 0, "連続してこの回数失敗したインスタンスへの適用を一時的に見送る（0で無効、主に -repeat 用）")
+	breakerCooldownFlag  = flag.Duration("breaker-cooldown", 5*time.Minute, "適用を見送ったインスタンスに再度試行するまでの待機時間")
+	flapWindowFlag       = flag.Duration("flap-window", 0, "適用後、この時間内に状態が変化したサーバーを警告として報告する（例: 1m、0で無効）")
+	profileFlag          = flag.Bool("profile", false, "適用後にフェーズごとの所要時間と所要時間の長い操作を表示する")
+	profileTopFlag       = flag.Int("profile-top", 10, "-profile で表示する所要時間の長い操作の件数")
+	failFastFlag         = flag.Bool("fail-fast", false, "いずれかのインスタンスで失敗したら残りのインスタンスへの適用を中止する")
+	parallelBackendsFlag = flag.Bool("parallel-backends", false, "同じグループ内のサーバーを並列に適用する")
+	pushgatewayFlag      = flag.String("pushgateway", "", "適用後にメトリクスを送信する Prometheus Pushgateway のURL（例: http://pushgateway:9091）")
+	environmentFlag      = flag.String("environment", "", "Pushgateway に送信するメトリクスの environment ラベル")
+	runIDFlag            = flag.String("run-id", "", "Pushgateway のメトリクスと監査ログに記録する実行ID（未指定時は開始時刻）")
+	auditLogFlag         = flag.String("audit-log", "", "HAProxyへの変更操作ごとにJSONレコードを追記する監査ログのパス")
+	operatorFlag         = flag.String("operator", "", "監査ログに記録する実行者（未指定時は環境変数 USER）")
+)
+
+func init() {
+	flag.Var(&forbidAlgorithmFlag, "forbid-algorithm", "使用を禁止するロードバランシングアルゴリズム（カンマ区切り、複数回指定可）")
+	flag.Var(&tagFlag, "tag", "指定したタグを持つバックエンドのみ適用する（カンマ区切り、複数回指定可）")
+	flag.Var(&excludeTagFlag, "exclude-tag", "指定したタグを持つバックエンドを適用しない（カンマ区切り、複数回指定可）")
+}
+
+// stringListFlag は、カンマ区切りおよび複数回指定に対応した文字列リストのフラグです
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			*f = append(*f, v)
+		}
+	}
+	return nil
+}
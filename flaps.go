@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// flappingServer は、直近に状態が変化したサーバーです
+type flappingServer struct {
+	key    string
+	status string
+	since  time.Duration // 最後に状態が変化してからの経過時間
+}
+
+// findFlapping は、最後の状態変化が window 以内のサーバーを返します。
+// 接続先が状態変化の時刻を返さないサーバー（LastChange が nil）は対象外です
+func findFlapping(servers []haproxy.Server, window time.Duration) []flappingServer {
+	var flapping []flappingServer
+	for _, s := range servers {
+		if s.LastChange == nil || *s.LastChange < 0 {
+			continue
+		}
+		since := time.Duration(*s.LastChange) * time.Second
+		if since < window {
+			flapping = append(flapping, flappingServer{key: serverKey(s.Backend, s.Name), status: s.Status, since: since})
+		}
+	}
+	return flapping
+}
+
+// reportFlapping は、適用後に現在のサーバー状態を読み取り、直近に状態が変化したサーバーを警告として出力します
+func reportFlapping(client haproxyClient, endpoint string, window time.Duration) error {
+	servers, err := client.GetServers()
+	if err != nil {
+		return fmt.Errorf("サーバー状態の取得に失敗: %w", err)
+	}
+	for _, f := range findFlapping(servers, window) {
+		warnf("インスタンス[%s]: サーバー[%s]は %s 前に状態が変化しました（現在: %s）", endpoint, f.key, f.since, f.status)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+func TestParseServersStateLastChange(t *testing.T) {
+	resp := "1\n" + testServersStateHeader + "\n" +
+		"3 web 1 web-1 10.0.0.1 2 0 10 10 15 6 3 4 6 0 0 0 - 80 - 0 0 - - 0\n" +
+		"3 web 2 web-2 10.0.0.2 0 0 10 10 3600 6 3 4 6 0 0 0 - 80 - 0 0 - - 0"
+	servers, err := parseServersState(resp)
+	if err != nil {
+		t.Fatalf("parseServersState がエラーを返しました: %v", err)
+	}
+	if len(servers) != 2 {
+		t.Fatalf("サーバー数 = %d, want 2", len(servers))
+	}
+	for i, want := range []int64{15, 3600} {
+		if servers[i].LastChange == nil || *servers[i].LastChange != want {
+			t.Errorf("サーバー[%s]の LastChange = %v, want %d（srv_time_since_last_change の値）", servers[i].Name, servers[i].LastChange, want)
+		}
+	}
+	if servers[0].Status != "UP" || servers[1].Status != "DOWN" {
+		t.Errorf("状態 = %s, %s, want UP, DOWN", servers[0].Status, servers[1].Status)
+	}
+}
+
+func TestParseServersStateRequiresHeader(t *testing.T) {
+	if _, err := parseServersState("1\n3 web 1 web-1 10.0.0.1 2 0 10 10 15"); err == nil {
+		t.Error("ヘッダー行のない応答がエラーになりませんでした")
+	}
+}
+
+func TestFindFlapping(t *testing.T) {
+	since := func(seconds int64) *int64 { return &seconds }
+	servers := []haproxy.Server{
+		{Backend: "web", Name: "web-1", Status: "UP", LastChange: since(10)},
+		{Backend: "web", Name: "web-2", Status: "DOWN", LastChange: since(600)},
+		{Backend: "web", Name: "web-3", Status: "UP"}, // 状態変化の時刻を返さない接続先
+	}
+	flapping := findFlapping(servers, 5*time.Minute)
+	if len(flapping) != 1 || flapping[0].key != "web/web-1" || flapping[0].since != 10*time.Second {
+		t.Errorf("findFlapping() = %+v, want web/web-1（10s 前）のみ", flapping)
+	}
+}
+
+func TestReportFlappingOverSocket(t *testing.T) {
+	_, errs := captureOutput(t)
+	state := socketTestState()
+	state["show servers state"] = "1\n" + testServersStateHeader + "\n" +
+		"3 web 1 web-1 10.0.0.1 2 0 10 10 20 6 3 4 6 0 0 0 - 80 - 0 0 - - 0\n" +
+		"3 web 2 web-2 10.0.0.2 2 0 10 10 86400 6 3 4 6 0 0 0 - 80 - 0 0 - - 0"
+	socket := newFakeSocket(t, state)
+
+	if err := reportFlapping(newSocketClient(socket.path), "unix://"+socket.path, time.Minute); err != nil {
+		t.Fatalf("reportFlapping がエラーを返しました: %v", err)
+	}
+	if warnings.count() != 1 || !strings.Contains(errs.String(), "サーバー[web/web-1]は 20s 前に状態が変化しました") {
+		t.Errorf("状態が変化したばかりのサーバーの警告 = %q, want web-1 のみ", errs.String())
+	}
+}
+
+func TestReportFlappingWarns(t *testing.T) {
+	_, errs := captureOutput(t)
+	client := haproxyfake.New()
+	for name, seconds := range map[string]int64{"web-1": 20, "web-2": 86400} {
+		seconds := seconds
+		if err := client.AddServer(&haproxy.Server{Backend: "web", Name: name, Status: "UP", LastChange: &seconds}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := reportFlapping(client, "memory://flaps", time.Minute); err != nil {
+		t.Fatalf("reportFlapping がエラーを返しました: %v", err)
+	}
+	if warnings.count() != 1 || !strings.Contains(errs.String(), "サーバー[web/web-1]は 20s 前に状態が変化しました") {
+		t.Errorf("状態が変化したばかりのサーバーの警告 = %q, want web-1 のみ", errs.String())
+	}
+}
+
+func TestLogHealthChecksSetsBackendOption(t *testing.T) {
+	captureOutput(t)
+	_, client := testMemoryEndpoint(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://unused"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2, "log_health_checks": true},
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"}]
+	}`)
+	if err := applyBackendMode(client, config, backendGroup{name: "web"}); err != nil {
+		t.Fatalf("applyBackendMode がエラーを返しました: %v", err)
+	}
+	if got := client.BackendConfig("web", "option log-health-checks"); got != "on" {
+		t.Errorf("option log-health-checks = %q, want on", got)
+	}
+	if line := describeBackendMode(config, backendGroup{name: "web"}); !strings.Contains(line, "option log-health-checks") {
+		t.Errorf("dry-run の説明に option log-health-checks がありません: %s", line)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sync"
+)
+
+// endpointOutcome は、1つのHAProxyインスタンスへの適用結果です
+type endpointOutcome struct {
+	endpoint string
+	result   *Result
+	err      error
+	skipped  bool // -fail-fast により適用しなかった
+}
+
+// applyToEndpoints は、各エンドポイントに apply を実行し、エンドポイントごとの結果を設定の記載順で返します。
+// concurrency が 2 以上の場合は最大その数だけ並列に実行します。
+// 既定では1つのインスタンスが失敗しても他のインスタンスへの適用を続けますが、
+// failFast が有効な場合は失敗した時点で未着手のインスタンスへの適用を取りやめます
+func applyToEndpoints(endpoints []string, concurrency int, failFast bool, apply func(endpoint string) (*Result, error)) []endpointOutcome {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	outcomes := make([]endpointOutcome, len(endpoints))
+
+	var (
+		mu     sync.Mutex
+		failed bool
+		wg     sync.WaitGroup
+	)
+	sem := make(chan struct{}, concurrency)
+	for i, endpoint := range endpoints {
+		sem <- struct{}{}
+		mu.Lock()
+		stop := failFast && failed
+		mu.Unlock()
+		if stop {
+			<-sem
+			outcomes[i] = endpointOutcome{endpoint: endpoint, skipped: true}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, endpoint string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result, err := apply(endpoint)
+			if result != nil {
+				result.Endpoint = endpoint
+				if err != nil {
+					result.Error = err.Error()
+				}
+			}
+			outcomes[i] = endpointOutcome{endpoint: endpoint, result: result, err: err}
+			if err != nil {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}(i, endpoint)
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// logEndpointOutcomes は、エンドポイントごとの適用結果を出力し、失敗したエンドポイント数を返します
+func logEndpointOutcomes(outcomes []endpointOutcome) int {
+	failures := 0
+	for _, o := range outcomes {
+		switch {
+		case o.skipped:
+			failures++
+			logf("インスタンス[%s]: -fail-fast により適用をスキップしました\n", o.endpoint)
+		case o.err != nil:
+			failures++
+			logf("インスタンス[%s]: 失敗 (%v)\n", o.endpoint, o.err)
+		default:
+			logf("インスタンス[%s]: 成功\n", o.endpoint)
+		}
+	}
+	return failures
+}
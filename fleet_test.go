@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// failingAlgorithmClient は、ロードバランシングアルゴリズムの設定が常に失敗する HAProxy を再現するクライアントです
+type failingAlgorithmClient struct {
+	*haproxyfake.HAProxy
+}
+
+func (failingAlgorithmClient) SetLoadBalancingAlgorithm(algorithm string) error {
+	return errors.New("503 Service Unavailable")
+}
+
+func TestApplyToEndpointsContinuesAfterFailure(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://fleet-1", "memory://fleet-2", "memory://fleet-3"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"}]
+	}`)
+	healthy1, healthy3 := haproxyfake.New(), haproxyfake.New()
+	clients := map[string]haproxyClient{
+		"memory://fleet-1": healthy1,
+		"memory://fleet-2": failingAlgorithmClient{haproxyfake.New()},
+		"memory://fleet-3": healthy3,
+	}
+	outcomes := applyToEndpoints(config.HaproxyEndpoint, 2, false, func(endpoint string) (*Result, error) {
+		return applyConfig(clients[endpoint], config, applyOptions{attempts: 1})
+	})
+
+	if len(outcomes) != 3 {
+		t.Fatalf("結果の件数 = %d, want 3", len(outcomes))
+	}
+	for i, o := range outcomes {
+		if o.endpoint != config.HaproxyEndpoint[i] {
+			t.Errorf("outcomes[%d].endpoint = %s, want %s（設定の記載順）", i, o.endpoint, config.HaproxyEndpoint[i])
+		}
+		if failed := o.err != nil; failed != (i == 1) || o.skipped {
+			t.Errorf("%s: err = %v, skipped = %v, want fleet-2 のみ失敗", o.endpoint, o.err, o.skipped)
+		}
+	}
+	if r := outcomes[1].result; r == nil || r.Endpoint != "memory://fleet-2" || r.Error == "" {
+		t.Errorf("fleet-2 の結果 = %+v, want エンドポイントとエラーを記録", r)
+	}
+	for _, fake := range []*haproxyfake.HAProxy{healthy1, healthy3} {
+		if servers, _ := fake.GetServers(); len(servers) != 1 {
+			t.Errorf("正常なインスタンスのサーバー数 = %d, want 1（他のインスタンスの失敗で中断しないこと）", len(servers))
+		}
+	}
+	if n := logEndpointOutcomes(outcomes); n != 1 {
+		t.Errorf("logEndpointOutcomes() = %d, want 1", n)
+	}
+}
+
+func TestApplyToEndpointsFailFastSkipsRemaining(t *testing.T) {
+	captureOutput(t)
+	var applied []string
+	outcomes := applyToEndpoints([]string{"lb-1", "lb-2", "lb-3"}, 1, true, func(endpoint string) (*Result, error) {
+		applied = append(applied, endpoint)
+		if endpoint == "lb-1" {
+			return nil, errors.New("connection refused")
+		}
+		return &Result{}, nil
+	})
+	if len(applied) != 1 {
+		t.Errorf("適用したインスタンス = %v, want [lb-1]（失敗後は未着手のインスタンスに適用しないこと）", applied)
+	}
+	if !outcomes[1].skipped || !outcomes[2].skipped {
+		t.Errorf("lb-2, lb-3 の skipped = %v, %v, want true, true", outcomes[1].skipped, outcomes[2].skipped)
+	}
+	if n := logEndpointOutcomes(outcomes); n != 3 {
+		t.Errorf("logEndpointOutcomes() = %d, want 3（スキップも失敗として数える）", n)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// backendGroup は、同じグループに属するバックエンドサーバーの集まりです
+type backendGroup struct {
+	name     string
+	backends []BackendConfig
+}
+
+// orderGroups は、バックエンドをグループごとにまとめ、depends_on の依存関係を満たす順序で返します。
+// グループ内のサーバーは order の小さい順、グループは所属するサーバーの最小の order の順とし、
+// order が同じもの同士や依存関係のないグループ同士は設定ファイルでの登場順を保ちます。
+// 未定義のグループへの依存や循環依存がある場合はエラーを返します
+func orderGroups(config *Config) ([]backendGroup, error) {
+	// 登場順にグループを集める（groups セクションの定義順 → backends での登場順）
+	var names []string
+	members := map[string][]BackendConfig{}
+	deps := map[string][]string{}
+	seen := map[string]bool{}
+	addName := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, g := range config.Groups {
+		if seen[g.Name] {
+			return nil, fmt.Errorf("グループ[%s]が重複して定義されています", g.Name)
+		}
+		// 削除対象のグループは適用・出力の対象に含めません
+		if g.absent() {
+			seen[g.Name] = true
+			continue
+		}
+		addName(g.Name)
+		deps[g.Name] = g.DependsOn
+	}
+	for _, b := range config.Backends {
+		addName(b.Group)
+		members[b.Group] = append(members[b.Group], b)
+	}
+
+	// order の小さい順に並べ替えます（安定ソートのため、order が同じものは登場順のまま）
+	groupOrder := make(map[string]int, len(members))
+	for name, backends := range members {
+		sort.SliceStable(backends, func(i, j int) bool { return backends[i].Order < backends[j].Order })
+		groupOrder[name] = backends[0].Order
+	}
+	sort.SliceStable(names, func(i, j int) bool { return groupOrder[names[i]] < groupOrder[names[j]] })
+
+	for _, name := range names {
+		for _, dep := range deps[name] {
+			if !seen[dep] {
+				return nil, fmt.Errorf("グループ[%s]が未定義のグループ[%s]に依存しています", name, dep)
+			}
+		}
+	}
+
+	// 深さ優先探索によるトポロジカルソート（訪問中のグループに再び到達したら循環）
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	var ordered []backendGroup
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("グループの依存関係が循環しています: %s -> %s", strings.Join(path, " -> "), name)
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		ordered = append(ordered, backendGroup{name: name, backends: members[name]})
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
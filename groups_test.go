@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// groupNames は、orderGroups の結果のグループ名を順に返します
+func groupNames(groups []backendGroup) []string {
+	names := make([]string, len(groups))
+	for i, g := range groups {
+		names[i] = g.name
+	}
+	return names
+}
+
+func TestOrderGroupsFollowsDependencies(t *testing.T) {
+	config := &Config{
+		Groups: []GroupConfig{
+			{Name: "frontend", DependsOn: []string{"api", "web"}},
+			{Name: "api", DependsOn: []string{"db"}},
+		},
+		Backends: []BackendConfig{
+			{Name: "fe-1", Group: "frontend"},
+			{Name: "web-1", Group: "web"},
+			{Name: "api-1", Group: "api"},
+			{Name: "db-1", Group: "db"},
+		},
+	}
+	groups, err := orderGroups(config)
+	if err != nil {
+		t.Fatalf("orderGroups がエラーを返しました: %v", err)
+	}
+	if got, want := strings.Join(groupNames(groups), ","), "db,api,web,frontend"; got != want {
+		t.Errorf("グループの順序 = %s, want %s（依存先を先に適用すること）", got, want)
+	}
+}
+
+func TestOrderGroupsRejectsCycleAndUndefined(t *testing.T) {
+	cycle := &Config{Groups: []GroupConfig{
+		{Name: "a", DependsOn: []string{"b"}},
+		{Name: "b", DependsOn: []string{"a"}},
+	}}
+	if _, err := orderGroups(cycle); err == nil || !strings.Contains(err.Error(), "循環") {
+		t.Errorf("循環依存の orderGroups() = %v, want 循環のエラー", err)
+	}
+	undefined := &Config{Groups: []GroupConfig{{Name: "a", DependsOn: []string{"missing"}}}}
+	if _, err := orderGroups(undefined); err == nil || !strings.Contains(err.Error(), "未定義のグループ[missing]") {
+		t.Errorf("未定義のグループへの依存の orderGroups() = %v, want 未定義のエラー", err)
+	}
+	duplicate := &Config{Groups: []GroupConfig{{Name: "a"}, {Name: "a"}}}
+	if _, err := orderGroups(duplicate); err == nil {
+		t.Error("重複したグループの定義がエラーになりませんでした")
+	}
+}
+
+func TestParallelBackendsAppliesAllInOrder(t *testing.T) {
+	captureOutput(t)
+	config := batchTestConfig(t, 20)
+	client := perServerClient{haproxyfake.New()}
+
+	result, err := applyConfig(client, config, applyOptions{parallelBackends: true})
+	if err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	if servers, _ := client.GetServers(); len(servers) != 20 {
+		t.Errorf("並列の適用後のサーバー数 = %d, want 20", len(servers))
+	}
+	for i, b := range result.Backends {
+		if want := config.Backends[i].Name; b.Name != want || b.Status != StatusAdded {
+			t.Errorf("結果[%d] = %s %s, want %s added（設定の順に結果を返すこと）", i, b.Name, b.Status, want)
+		}
+	}
+}
+
+func TestOrderGroupsFollowsServerOrder(t *testing.T) {
+	config := &Config{
+		Groups: []GroupConfig{{Name: "api", DependsOn: []string{"db"}}},
+		Backends: []BackendConfig{
+			{Name: "web-a", Group: "web", Order: 2},
+			{Name: "web-b", Group: "web", Order: 1},
+			{Name: "db-1", Group: "db", Order: 5},
+			{Name: "api-1", Group: "api"},
+			{Name: "api-2", Group: "api"},
+			{Name: "cache-2", Group: "cache", Order: 1},
+			{Name: "cache-1", Group: "cache", Order: 1},
+		},
+	}
+	groups, err := orderGroups(config)
+	if err != nil {
+		t.Fatalf("orderGroups がエラーを返しました: %v", err)
+	}
+	var order []string
+	for _, g := range groups {
+		for _, b := range g.backends {
+			order = append(order, b.Name)
+		}
+	}
+	if got, want := strings.Join(groupNames(groups), ","), "db,api,web,cache"; got != want {
+		t.Errorf("グループの順序 = %s, want %s（最小の order の順とし、depends_on を優先すること）", got, want)
+	}
+	if got, want := strings.Join(order, ","), "db-1,api-1,api-2,web-b,web-a,cache-2,cache-1"; got != want {
+		t.Errorf("サーバーの順序 = %s, want %s（order の小さい順、同じ order は登場順とすること）", got, want)
+	}
+}
+
+func TestApplyFollowsServerOrder(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://order"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web", "order": 2},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web", "order": 1},
+			{"name": "api-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "api", "order": 0}
+		]
+	}`)
+	client := &orderRecordingClient{HAProxy: haproxyfake.New()}
+	if _, err := applyConfig(client, config, applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	if got, want := strings.Join(client.calls, ","), "add-batch:api-1,add-batch:web-2+web-1"; got != want {
+		t.Errorf("適用の順序 = %s, want %s", got, want)
+	}
+}
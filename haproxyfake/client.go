@@ -0,0 +1,42 @@
+package haproxyfake
+
+import "github.com/haproxytech/client-go/v2/haproxy"
+
+// Client は、適用処理が利用するHAProxy操作をまとめたインターフェースです。
+// Data Plane API、runtime socket、このパッケージの HAProxy のいずれでも同じ適用処理を使えるようにするために定義しています。
+// 独自の連携をテストする場合は、この Client を受け取るように書き、テストでは New の HAProxy を渡します
+type Client interface {
+	Ping() error
+	GetAPIVersion() (string, error)
+	GetServers() ([]haproxy.Server, error)
+	AddServer(server *haproxy.Server) error
+	UpdateServer(server *haproxy.Server) error
+	RenameServer(name string, server *haproxy.Server) error
+	RemoveServer(server *haproxy.Server) error
+	DrainServer(backend, name string) error
+	GetServerSessions(backend, name string) (int64, error)
+	GetServerTemplates() ([]haproxy.ServerTemplate, error)
+	AddServerTemplate(template *haproxy.ServerTemplate) error
+	UpdateServerTemplate(template *haproxy.ServerTemplate) error
+	SetLoadBalancingAlgorithm(algorithm string) error
+	GetConfig(key string) (string, error)
+	SetConfig(key, value string) error
+	SetBackendConfig(backend, key, value string) error
+	SetFrontendConfig(frontend, key, value string) error
+	GetBackends() ([]string, error)
+	GetFrontends() ([]haproxy.Frontend, error)
+	DeleteBackend(name string) error
+	ReplaceHTTPRules(parentType, parentName, direction string, rules []haproxy.HTTPRule) error
+	GetResolvers() ([]haproxy.Resolver, error)
+	AddResolver(resolver *haproxy.Resolver) error
+	UpdateResolver(resolver *haproxy.Resolver) error
+	GetMailers() ([]haproxy.MailersSection, error)
+	AddMailers(mailers *haproxy.MailersSection) error
+	UpdateMailers(mailers *haproxy.MailersSection) error
+	GetCaches() ([]haproxy.Cache, error)
+	AddCache(cache *haproxy.Cache) error
+	UpdateCache(cache *haproxy.Cache) error
+	GetPeers() ([]haproxy.PeerSection, error)
+	AddPeers(peers *haproxy.PeerSection) error
+	UpdatePeers(peers *haproxy.PeerSection) error
+}
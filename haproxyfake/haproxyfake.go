@@ -0,0 +1,568 @@
+// Package haproxyfake は、HAProxy に接続せずにサーバーや設定値をメモリ上に保持する HAProxy クライアントです。
+// 実機の HAProxy を用意せずに、適用処理やそれを利用する独自の連携を単体テストするために使います
+package haproxyfake
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// Version は、メモリ上の HAProxy が報告する Data Plane API のバージョンです
+const Version = "2.2"
+
+// HAProxy は、サーバーや設定値をメモリ上に保持する Client の実装です。
+// 複数の goroutine から同時に呼び出せます
+type HAProxy struct {
+	mu sync.Mutex
+	state
+
+	// reloads は、HAProxy の再読み込みを伴う変更の回数です（トランザクション内の変更はコミット時に1回と数えます）
+	reloads      int
+	txSeq        int
+	transactions map[string]*HAProxy // トランザクション ID → 変更を積んでいる作業用のインスタンス
+}
+
+// state は、HAProxy が保持するサーバーや設定値です（トランザクションでは複製した state に変更を積みます）
+type state struct {
+	servers        map[string]haproxy.Server
+	templates      map[string]haproxy.ServerTemplate
+	config         map[string]string
+	backends       map[string]map[string]string // バックエンド名 → SetBackendConfig で設定された値
+	frontends      []haproxy.Frontend
+	frontendConfig map[string]map[string]string  // frontend 名 → SetFrontendConfig で設定された値
+	httpRules      map[string][]haproxy.HTTPRule // "parentType/parentName/direction" をキーとするルール
+	resolvers      map[string]haproxy.Resolver
+	mailers        map[string]haproxy.MailersSection
+	caches         map[string]haproxy.Cache
+	peers          map[string]haproxy.PeerSection
+	algorithm      string
+}
+
+// New は、サーバーも設定値もない空の HAProxy を返します
+func New() *HAProxy {
+	return &HAProxy{
+		state: state{
+			servers:        make(map[string]haproxy.Server),
+			templates:      make(map[string]haproxy.ServerTemplate),
+			config:         make(map[string]string),
+			backends:       make(map[string]map[string]string),
+			frontendConfig: make(map[string]map[string]string),
+			httpRules:      make(map[string][]haproxy.HTTPRule),
+			resolvers:      make(map[string]haproxy.Resolver),
+			mailers:        make(map[string]haproxy.MailersSection),
+			caches:         make(map[string]haproxy.Cache),
+			peers:          make(map[string]haproxy.PeerSection),
+		},
+		transactions: make(map[string]*HAProxy),
+	}
+}
+
+// serverKey は、バックエンド名とサーバー名からサーバーを一意に識別するキーを返します
+func serverKey(backend, name string) string {
+	return backend + "/" + name
+}
+
+// Ping は、メモリ上の HAProxy のため常に成功します
+func (c *HAProxy) Ping() error {
+	return nil
+}
+
+// GetAPIVersion は、Version の API バージョンを返します
+func (c *HAProxy) GetAPIVersion() (string, error) {
+	return Version, nil
+}
+
+// GetServers は、保持しているサーバーをバックエンド名・サーバー名の順に並べて返します
+func (c *HAProxy) GetServers() ([]haproxy.Server, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.servers))
+	for k := range c.servers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	servers := make([]haproxy.Server, 0, len(keys))
+	for _, k := range keys {
+		servers = append(servers, c.servers[k])
+	}
+	return servers, nil
+}
+
+// AddServer は、サーバーを追加します（同じ名前のサーバーが既にある場合はエラー）
+func (c *HAProxy) AddServer(server *haproxy.Server) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := serverKey(server.Backend, server.Name)
+	if _, ok := c.servers[key]; ok {
+		return fmt.Errorf("サーバー[%s]は既に存在します", key)
+	}
+	c.servers[key] = *server
+	c.touchBackend(server.Backend)
+	c.reloads++
+	return nil
+}
+
+// AddServers は、複数のサーバーをまとめて追加します（1台でも既に存在する場合は何も追加せずエラー）
+func (c *HAProxy) AddServers(servers []haproxy.Server) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range servers {
+		if _, ok := c.servers[serverKey(s.Backend, s.Name)]; ok {
+			return fmt.Errorf("サーバー[%s]は既に存在します", serverKey(s.Backend, s.Name))
+		}
+	}
+	for _, s := range servers {
+		c.servers[serverKey(s.Backend, s.Name)] = s
+		c.touchBackend(s.Backend)
+	}
+	c.reloads++
+	return nil
+}
+
+// UpdateServer は、既存のサーバー定義を置き換えます
+func (c *HAProxy) UpdateServer(server *haproxy.Server) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := serverKey(server.Backend, server.Name)
+	if _, ok := c.servers[key]; !ok {
+		return fmt.Errorf("サーバー[%s]が見つかりません", key)
+	}
+	c.servers[key] = *server
+	c.reloads++
+	return nil
+}
+
+// RenameServer は、既存サーバー name を server の名前と内容で置き換えます
+func (c *HAProxy) RenameServer(name string, server *haproxy.Server) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := serverKey(server.Backend, name)
+	if _, ok := c.servers[key]; !ok {
+		return fmt.Errorf("サーバー[%s]が見つかりません", key)
+	}
+	newKey := serverKey(server.Backend, server.Name)
+	if _, ok := c.servers[newKey]; ok {
+		return fmt.Errorf("サーバー[%s]は既に存在します", newKey)
+	}
+	delete(c.servers, key)
+	c.servers[newKey] = *server
+	c.reloads++
+	return nil
+}
+
+// RemoveServer は、サーバーを削除します
+func (c *HAProxy) RemoveServer(server *haproxy.Server) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := serverKey(server.Backend, server.Name)
+	if _, ok := c.servers[key]; !ok {
+		return fmt.Errorf("サーバー[%s]が見つかりません", key)
+	}
+	delete(c.servers, key)
+	c.reloads++
+	return nil
+}
+
+// SetWeight は、サーバーの重みを変更します
+func (c *HAProxy) SetWeight(backend, name string, weight int64) error {
+	return c.setServerField(backend, name, func(s *haproxy.Server) { s.Weight = weight })
+}
+
+// SetMaxconn は、サーバーの最大同時接続数を変更します
+func (c *HAProxy) SetMaxconn(backend, name string, maxconn int64) error {
+	return c.setServerField(backend, name, func(s *haproxy.Server) { s.Maxconn = maxconn })
+}
+
+// SetHealthCheck は、サーバーのヘルスチェックの有効・無効を切り替えます
+func (c *HAProxy) SetHealthCheck(backend, name string, enabled bool) error {
+	return c.setServerField(backend, name, func(s *haproxy.Server) { s.Check = enabled })
+}
+
+// setServerField は、既存のサーバー定義の一部の項目を set で変更します
+func (c *HAProxy) setServerField(backend, name string, set func(*haproxy.Server)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := serverKey(backend, name)
+	server, ok := c.servers[key]
+	if !ok {
+		return fmt.Errorf("サーバー[%s]が見つかりません", key)
+	}
+	set(&server)
+	c.servers[key] = server
+	c.reloads++
+	return nil
+}
+
+// DrainServer は、サーバーの状態を DRAIN にします
+func (c *HAProxy) DrainServer(backend, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := serverKey(backend, name)
+	server, ok := c.servers[key]
+	if !ok {
+		return fmt.Errorf("サーバー[%s]が見つかりません", key)
+	}
+	server.Status = "DRAIN"
+	c.servers[key] = server
+	return nil
+}
+
+// GetServerSessions は、サーバーの現在の接続数を返します（メモリ上の HAProxy には接続がないため常に 0）
+func (c *HAProxy) GetServerSessions(backend, name string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := serverKey(backend, name)
+	if _, ok := c.servers[key]; !ok {
+		return 0, fmt.Errorf("サーバー[%s]が見つかりません", key)
+	}
+	return 0, nil
+}
+
+// GetServerTemplates は、保持しているサーバーテンプレートを返します
+func (c *HAProxy) GetServerTemplates() ([]haproxy.ServerTemplate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.templates))
+	for k := range c.templates {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	templates := make([]haproxy.ServerTemplate, 0, len(keys))
+	for _, k := range keys {
+		templates = append(templates, c.templates[k])
+	}
+	return templates, nil
+}
+
+// AddServerTemplate は、サーバーテンプレートを追加します（同じプレフィックスが既にある場合はエラー）
+func (c *HAProxy) AddServerTemplate(template *haproxy.ServerTemplate) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := serverKey(template.Backend, template.Prefix)
+	if _, ok := c.templates[key]; ok {
+		return fmt.Errorf("サーバーテンプレート[%s]は既に存在します", key)
+	}
+	c.templates[key] = *template
+	c.touchBackend(template.Backend)
+	c.reloads++
+	return nil
+}
+
+// UpdateServerTemplate は、既存のサーバーテンプレートを置き換えます
+func (c *HAProxy) UpdateServerTemplate(template *haproxy.ServerTemplate) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := serverKey(template.Backend, template.Prefix)
+	if _, ok := c.templates[key]; !ok {
+		return fmt.Errorf("サーバーテンプレート[%s]が見つかりません", key)
+	}
+	c.templates[key] = *template
+	c.reloads++
+	return nil
+}
+
+// SetLoadBalancingAlgorithm は、全体のロードバランシングアルゴリズムを記録します
+func (c *HAProxy) SetLoadBalancingAlgorithm(algorithm string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.algorithm = algorithm
+	c.reloads++
+	return nil
+}
+
+// GetConfig は、SetConfig で設定された値を返します（未設定の場合は空文字列）
+func (c *HAProxy) GetConfig(key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config[key], nil
+}
+
+// SetConfig は、全体の設定値を記録します
+func (c *HAProxy) SetConfig(key, value string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config[key] = value
+	c.reloads++
+	return nil
+}
+
+// SetBackendConfig は、バックエンド単位の設定値を記録します
+func (c *HAProxy) SetBackendConfig(backend, key, value string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.touchBackend(backend)[key] = value
+	c.reloads++
+	return nil
+}
+
+// SetFrontendConfig は、frontend 単位の設定値を記録します
+func (c *HAProxy) SetFrontendConfig(frontend, key, value string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values, ok := c.frontendConfig[frontend]
+	if !ok {
+		values = make(map[string]string)
+		c.frontendConfig[frontend] = values
+	}
+	values[key] = value
+	c.reloads++
+	return nil
+}
+
+// GetBackends は、サーバーの追加や設定によって作成されたバックエンドを名前順に返します
+func (c *HAProxy) GetBackends() ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.backends))
+	for name := range c.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetFrontends は、フロントエンドを返します（New で作成した直後は空です）
+func (c *HAProxy) GetFrontends() ([]haproxy.Frontend, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]haproxy.Frontend(nil), c.frontends...), nil
+}
+
+// DeleteBackend は、バックエンドとそのサーバー、テンプレート、設定値を削除します
+func (c *HAProxy) DeleteBackend(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.backends[name]; !ok {
+		return fmt.Errorf("バックエンド[%s]が見つかりません", name)
+	}
+	delete(c.backends, name)
+	for k, s := range c.servers {
+		if s.Backend == name {
+			delete(c.servers, k)
+		}
+	}
+	for k, t := range c.templates {
+		if t.Backend == name {
+			delete(c.templates, k)
+		}
+	}
+	c.reloads++
+	return nil
+}
+
+// ReplaceHTTPRules は、指定した対象と方向のヘッダー操作ルールを置き換えます
+func (c *HAProxy) ReplaceHTTPRules(parentType, parentName, direction string, rules []haproxy.HTTPRule) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.httpRules[parentType+"/"+parentName+"/"+direction] = append([]haproxy.HTTPRule(nil), rules...)
+	c.reloads++
+	return nil
+}
+
+// GetResolvers は、保持している resolvers セクションを名前順に返します
+func (c *HAProxy) GetResolvers() ([]haproxy.Resolver, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.resolvers))
+	for name := range c.resolvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	resolvers := make([]haproxy.Resolver, 0, len(names))
+	for _, name := range names {
+		resolvers = append(resolvers, c.resolvers[name])
+	}
+	return resolvers, nil
+}
+
+// AddResolver は、resolvers セクションを追加します（同じ名前のセクションが既にある場合はエラー）
+func (c *HAProxy) AddResolver(resolver *haproxy.Resolver) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.resolvers[resolver.Name]; ok {
+		return fmt.Errorf("resolvers[%s]は既に存在します", resolver.Name)
+	}
+	c.resolvers[resolver.Name] = *resolver
+	c.reloads++
+	return nil
+}
+
+// UpdateResolver は、既存の resolvers セクションを置き換えます
+func (c *HAProxy) UpdateResolver(resolver *haproxy.Resolver) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.resolvers[resolver.Name]; !ok {
+		return fmt.Errorf("resolvers[%s]が見つかりません", resolver.Name)
+	}
+	c.resolvers[resolver.Name] = *resolver
+	c.reloads++
+	return nil
+}
+
+// GetMailers は、保持している mailers セクションを名前順に返します
+func (c *HAProxy) GetMailers() ([]haproxy.MailersSection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.mailers))
+	for name := range c.mailers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	mailers := make([]haproxy.MailersSection, 0, len(names))
+	for _, name := range names {
+		mailers = append(mailers, c.mailers[name])
+	}
+	return mailers, nil
+}
+
+// AddMailers は、mailers セクションを追加します（同じ名前のセクションが既にある場合はエラー）
+func (c *HAProxy) AddMailers(mailers *haproxy.MailersSection) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.mailers[mailers.Name]; ok {
+		return fmt.Errorf("mailers[%s]は既に存在します", mailers.Name)
+	}
+	c.mailers[mailers.Name] = *mailers
+	c.reloads++
+	return nil
+}
+
+// UpdateMailers は、既存の mailers セクションを置き換えます
+func (c *HAProxy) UpdateMailers(mailers *haproxy.MailersSection) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.mailers[mailers.Name]; !ok {
+		return fmt.Errorf("mailers[%s]が見つかりません", mailers.Name)
+	}
+	c.mailers[mailers.Name] = *mailers
+	c.reloads++
+	return nil
+}
+
+// GetCaches は、保持している cache セクションを名前順に返します
+func (c *HAProxy) GetCaches() ([]haproxy.Cache, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.caches))
+	for name := range c.caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	caches := make([]haproxy.Cache, 0, len(names))
+	for _, name := range names {
+		caches = append(caches, c.caches[name])
+	}
+	return caches, nil
+}
+
+// AddCache は、cache セクションを追加します（同じ名前のセクションが既にある場合はエラー）
+func (c *HAProxy) AddCache(cache *haproxy.Cache) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.caches[cache.Name]; ok {
+		return fmt.Errorf("cache[%s]は既に存在します", cache.Name)
+	}
+	c.caches[cache.Name] = *cache
+	c.reloads++
+	return nil
+}
+
+// UpdateCache は、既存の cache セクションを置き換えます
+func (c *HAProxy) UpdateCache(cache *haproxy.Cache) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.caches[cache.Name]; !ok {
+		return fmt.Errorf("cache[%s]が見つかりません", cache.Name)
+	}
+	c.caches[cache.Name] = *cache
+	c.reloads++
+	return nil
+}
+
+// touchBackend は、バックエンドが未作成であれば作成し、その設定値を返します（呼び出し側でロック済みであること）
+func (c *HAProxy) touchBackend(name string) map[string]string {
+	values, ok := c.backends[name]
+	if !ok {
+		values = make(map[string]string)
+		c.backends[name] = values
+	}
+	return values
+}
+
+// GetPeers は、保持している peers セクションを名前順に返します
+func (c *HAProxy) GetPeers() ([]haproxy.PeerSection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.peers))
+	for name := range c.peers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	peers := make([]haproxy.PeerSection, 0, len(names))
+	for _, name := range names {
+		peers = append(peers, c.peers[name])
+	}
+	return peers, nil
+}
+
+// AddPeers は、peers セクションを追加します（同じ名前のセクションが既にある場合はエラー）
+func (c *HAProxy) AddPeers(peers *haproxy.PeerSection) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.peers[peers.Name]; ok {
+		return fmt.Errorf("peers[%s]は既に存在します", peers.Name)
+	}
+	c.peers[peers.Name] = *peers
+	c.reloads++
+	return nil
+}
+
+// UpdatePeers は、既存の peers セクションを置き換えます
+func (c *HAProxy) UpdatePeers(peers *haproxy.PeerSection) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.peers[peers.Name]; !ok {
+		return fmt.Errorf("peers[%s]が見つかりません", peers.Name)
+	}
+	c.peers[peers.Name] = *peers
+	c.reloads++
+	return nil
+}
+
+// Algorithm は、SetLoadBalancingAlgorithm で設定された全体のロードバランシングアルゴリズムを返します（テストでの確認用）
+func (c *HAProxy) Algorithm() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.algorithm
+}
+
+// BackendConfig は、SetBackendConfig で設定されたバックエンド単位の設定値を返します（未設定の場合は空文字列。テストでの確認用）
+func (c *HAProxy) BackendConfig(backend, key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.backends[backend][key]
+}
+
+// FrontendConfig は、SetFrontendConfig で設定された frontend 単位の設定値を返します（未設定の場合は空文字列。テストでの確認用）
+func (c *HAProxy) FrontendConfig(frontend, key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.frontendConfig[frontend][key]
+}
+
+// HTTPRules は、ReplaceHTTPRules で設定されたヘッダー操作ルールを返します（テストでの確認用）
+func (c *HAProxy) HTTPRules(parentType, parentName, direction string) []haproxy.HTTPRule {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]haproxy.HTTPRule(nil), c.httpRules[parentType+"/"+parentName+"/"+direction]...)
+}
+
+// SetFrontends は、GetFrontends が返すフロントエンドを設定します（HAProxy 側で定義済みの frontend を再現するテスト用）
+func (c *HAProxy) SetFrontends(frontends []haproxy.Frontend) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frontends = append([]haproxy.Frontend(nil), frontends...)
+}
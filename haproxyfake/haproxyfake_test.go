@@ -0,0 +1,249 @@
+package haproxyfake
+
+import (
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// HAProxy が Client を満たすこと（適用処理にそのまま渡せること）をコンパイル時に確認します
+var _ Client = (*HAProxy)(nil)
+
+func TestAddServerStoresAndLists(t *testing.T) {
+	c := New()
+	for _, s := range []haproxy.Server{
+		{Backend: "web", Name: "web-2", IP: "10.0.0.2", Port: 80},
+		{Backend: "api", Name: "api-1", IP: "10.0.1.1", Port: 8080},
+		{Backend: "web", Name: "web-1", IP: "10.0.0.1", Port: 80},
+	} {
+		s := s
+		if err := c.AddServer(&s); err != nil {
+			t.Fatalf("AddServer(%s) がエラーを返しました: %v", s.Name, err)
+		}
+	}
+
+	servers, err := c.GetServers()
+	if err != nil {
+		t.Fatalf("GetServers がエラーを返しました: %v", err)
+	}
+	want := []string{"api/api-1", "web/web-1", "web/web-2"}
+	if len(servers) != len(want) {
+		t.Fatalf("GetServers の件数 = %d, want %d", len(servers), len(want))
+	}
+	for i, s := range servers {
+		if got := serverKey(s.Backend, s.Name); got != want[i] {
+			t.Errorf("GetServers()[%d] = %s, want %s（バックエンド名・サーバー名の順）", i, got, want[i])
+		}
+	}
+	if servers[1].IP != "10.0.0.1" || servers[1].Port != 80 {
+		t.Errorf("保存したサーバーの内容が異なります: %+v", servers[1])
+	}
+
+	backends, _ := c.GetBackends()
+	if len(backends) != 2 || backends[0] != "api" || backends[1] != "web" {
+		t.Errorf("GetBackends() = %v, want [api web]（サーバーの追加で作成されます）", backends)
+	}
+}
+
+func TestAddServerRejectsDuplicate(t *testing.T) {
+	c := New()
+	s := haproxy.Server{Backend: "web", Name: "web-1"}
+	if err := c.AddServer(&s); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddServer(&s); err == nil {
+		t.Error("同じ名前のサーバーの追加がエラーになりませんでした")
+	}
+}
+
+func TestAddServersIsAllOrNothing(t *testing.T) {
+	c := New()
+	existing := haproxy.Server{Backend: "web", Name: "web-2"}
+	if err := c.AddServer(&existing); err != nil {
+		t.Fatal(err)
+	}
+	err := c.AddServers([]haproxy.Server{{Backend: "web", Name: "web-1"}, {Backend: "web", Name: "web-2"}})
+	if err == nil {
+		t.Fatal("既存のサーバーを含む一括追加がエラーになりませんでした")
+	}
+	servers, _ := c.GetServers()
+	if len(servers) != 1 {
+		t.Errorf("失敗した一括追加の後のサーバー数 = %d, want 1（何も追加しないこと）", len(servers))
+	}
+}
+
+func TestUpdateRenameRemoveServer(t *testing.T) {
+	c := New()
+	s := haproxy.Server{Backend: "web", Name: "web-1", Weight: 10}
+	if err := c.AddServer(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Weight = 50
+	if err := c.UpdateServer(&s); err != nil {
+		t.Fatalf("UpdateServer がエラーを返しました: %v", err)
+	}
+	if err := c.SetMaxconn("web", "web-1", 200); err != nil {
+		t.Fatalf("SetMaxconn がエラーを返しました: %v", err)
+	}
+	renamed := s
+	renamed.Name = "web-01"
+	renamed.Maxconn = 200
+	if err := c.RenameServer("web-1", &renamed); err != nil {
+		t.Fatalf("RenameServer がエラーを返しました: %v", err)
+	}
+	servers, _ := c.GetServers()
+	if len(servers) != 1 || servers[0].Name != "web-01" || servers[0].Weight != 50 || servers[0].Maxconn != 200 {
+		t.Fatalf("更新と名前の変更の後のサーバー = %+v", servers)
+	}
+
+	missing := haproxy.Server{Backend: "web", Name: "web-1"}
+	if err := c.UpdateServer(&missing); err == nil {
+		t.Error("存在しないサーバーの更新がエラーになりませんでした")
+	}
+	if err := c.RemoveServer(&renamed); err != nil {
+		t.Fatalf("RemoveServer がエラーを返しました: %v", err)
+	}
+	if err := c.RemoveServer(&renamed); err == nil {
+		t.Error("削除済みのサーバーの削除がエラーになりませんでした")
+	}
+	if servers, _ := c.GetServers(); len(servers) != 0 {
+		t.Errorf("削除後のサーバー数 = %d, want 0", len(servers))
+	}
+}
+
+func TestDrainServer(t *testing.T) {
+	c := New()
+	s := haproxy.Server{Backend: "web", Name: "web-1"}
+	if err := c.AddServer(&s); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DrainServer("web", "web-1"); err != nil {
+		t.Fatal(err)
+	}
+	servers, _ := c.GetServers()
+	if servers[0].Status != "DRAIN" {
+		t.Errorf("drain 後の状態 = %q, want DRAIN", servers[0].Status)
+	}
+	if n, err := c.GetServerSessions("web", "web-1"); err != nil || n != 0 {
+		t.Errorf("GetServerSessions() = %d, %v, want 0, nil", n, err)
+	}
+}
+
+func TestConfigValues(t *testing.T) {
+	c := New()
+	if err := c.SetLoadBalancingAlgorithm("leastconn"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetConfig("retries", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetBackendConfig("web", "option", "redispatch"); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Algorithm(); got != "leastconn" {
+		t.Errorf("Algorithm() = %q, want leastconn", got)
+	}
+	if got, _ := c.GetConfig("retries"); got != "3" {
+		t.Errorf("GetConfig(retries) = %q, want 3", got)
+	}
+	if got, _ := c.GetConfig("missing"); got != "" {
+		t.Errorf("未設定の GetConfig() = %q, want 空文字列", got)
+	}
+	if got := c.BackendConfig("web", "option"); got != "redispatch" {
+		t.Errorf("BackendConfig(web, option) = %q, want redispatch", got)
+	}
+}
+
+func TestDeleteBackendRemovesServersAndTemplates(t *testing.T) {
+	c := New()
+	for _, s := range []haproxy.Server{{Backend: "web", Name: "web-1"}, {Backend: "api", Name: "api-1"}} {
+		s := s
+		if err := c.AddServer(&s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.AddServerTemplate(&haproxy.ServerTemplate{Backend: "web", Prefix: "srv"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteBackend("web"); err != nil {
+		t.Fatalf("DeleteBackend がエラーを返しました: %v", err)
+	}
+	servers, _ := c.GetServers()
+	if len(servers) != 1 || servers[0].Backend != "api" {
+		t.Errorf("削除後のサーバー = %+v, want api のサーバーのみ", servers)
+	}
+	if templates, _ := c.GetServerTemplates(); len(templates) != 0 {
+		t.Errorf("削除後のサーバーテンプレート数 = %d, want 0", len(templates))
+	}
+	if err := c.DeleteBackend("web"); err == nil {
+		t.Error("存在しないバックエンドの削除がエラーになりませんでした")
+	}
+}
+
+func TestSectionsAddAndUpdate(t *testing.T) {
+	c := New()
+	if err := c.UpdateResolver(&haproxy.Resolver{Name: "dns"}); err == nil {
+		t.Error("存在しない resolvers の更新がエラーになりませんでした")
+	}
+	if err := c.AddResolver(&haproxy.Resolver{Name: "dns", ResolveRetries: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddResolver(&haproxy.Resolver{Name: "dns"}); err == nil {
+		t.Error("同じ名前の resolvers の追加がエラーになりませんでした")
+	}
+	if err := c.UpdateResolver(&haproxy.Resolver{Name: "dns", ResolveRetries: 5}); err != nil {
+		t.Fatal(err)
+	}
+	resolvers, _ := c.GetResolvers()
+	if len(resolvers) != 1 || resolvers[0].ResolveRetries != 5 {
+		t.Errorf("GetResolvers() = %+v, want 更新後の dns のみ", resolvers)
+	}
+}
+
+func TestTransactionCommitAndDiscard(t *testing.T) {
+	c := New()
+	id, err := c.StartTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := c.InTransaction(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"web-1", "web-2"} {
+		if err := tx.AddServer(&haproxy.Server{Backend: "web", Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if servers, _ := c.GetServers(); len(servers) != 0 {
+		t.Errorf("コミット前のサーバー数 = %d, want 0（トランザクションの外に反映しないこと）", len(servers))
+	}
+	if err := c.CommitTransaction(id); err != nil {
+		t.Fatalf("CommitTransaction がエラーを返しました: %v", err)
+	}
+	if servers, _ := c.GetServers(); len(servers) != 2 {
+		t.Errorf("コミット後のサーバー数 = %d, want 2", len(servers))
+	}
+	if got := c.Reloads(); got != 1 {
+		t.Errorf("Reloads() = %d, want 1（コミットごとに1回）", got)
+	}
+	if err := c.CommitTransaction(id); err == nil {
+		t.Error("コミット済みのトランザクションのコミットがエラーになりませんでした")
+	}
+
+	id, _ = c.StartTransaction()
+	tx, _ = c.InTransaction(id)
+	if err := tx.RemoveServer(&haproxy.Server{Backend: "web", Name: "web-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteTransaction(id); err != nil {
+		t.Fatalf("DeleteTransaction がエラーを返しました: %v", err)
+	}
+	if servers, _ := c.GetServers(); len(servers) != 2 {
+		t.Errorf("破棄後のサーバー数 = %d, want 2（変更を反映しないこと）", len(servers))
+	}
+	if got := c.Reloads(); got != 1 {
+		t.Errorf("破棄後の Reloads() = %d, want 1", got)
+	}
+}
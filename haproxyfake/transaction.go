@@ -0,0 +1,117 @@
+package haproxyfake
+
+import (
+	"fmt"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// StartTransaction は、現在の状態を複製した作業用のインスタンスを作成し、そのトランザクション ID を返します。
+// InTransaction で取得したクライアントへの変更は、CommitTransaction まで元のインスタンスに反映されません
+func (c *HAProxy) StartTransaction() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.txSeq++
+	id := fmt.Sprintf("tx-%d", c.txSeq)
+	c.transactions[id] = &HAProxy{state: c.state.clone(), transactions: make(map[string]*HAProxy)}
+	return id, nil
+}
+
+// InTransaction は、変更をトランザクション id に積むクライアントを返します
+func (c *HAProxy) InTransaction(id string) (Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tx, ok := c.transactions[id]
+	if !ok {
+		return nil, fmt.Errorf("トランザクション[%s]が見つかりません", id)
+	}
+	return tx, nil
+}
+
+// CommitTransaction は、トランザクションに積んだ変更をまとめて反映します（再読み込みは1回と数えます）
+func (c *HAProxy) CommitTransaction(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tx, ok := c.transactions[id]
+	if !ok {
+		return fmt.Errorf("トランザクション[%s]が見つかりません", id)
+	}
+	delete(c.transactions, id)
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	c.state = tx.state.clone()
+	c.reloads++
+	return nil
+}
+
+// DeleteTransaction は、トランザクションに積んだ変更を破棄します
+func (c *HAProxy) DeleteTransaction(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.transactions[id]; !ok {
+		return fmt.Errorf("トランザクション[%s]が見つかりません", id)
+	}
+	delete(c.transactions, id)
+	return nil
+}
+
+// Reloads は、これまでに HAProxy の再読み込みを伴った変更の回数を返します（テストでの確認用）。
+// トランザクションの外の変更は1件ごとに、トランザクション内の変更はコミットごとに1回と数えます
+func (c *HAProxy) Reloads() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reloads
+}
+
+// clone は、状態を複製します（値を置き換えて更新するため、各 map の値自体は共有します）
+func (s state) clone() state {
+	cp := s
+	cp.servers = make(map[string]haproxy.Server, len(s.servers))
+	for k, v := range s.servers {
+		cp.servers[k] = v
+	}
+	cp.templates = make(map[string]haproxy.ServerTemplate, len(s.templates))
+	for k, v := range s.templates {
+		cp.templates[k] = v
+	}
+	cp.config = copyValues(s.config)
+	cp.backends = make(map[string]map[string]string, len(s.backends))
+	for k, v := range s.backends {
+		cp.backends[k] = copyValues(v)
+	}
+	cp.frontends = append([]haproxy.Frontend(nil), s.frontends...)
+	cp.frontendConfig = make(map[string]map[string]string, len(s.frontendConfig))
+	for k, v := range s.frontendConfig {
+		cp.frontendConfig[k] = copyValues(v)
+	}
+	cp.httpRules = make(map[string][]haproxy.HTTPRule, len(s.httpRules))
+	for k, v := range s.httpRules {
+		cp.httpRules[k] = v
+	}
+	cp.resolvers = make(map[string]haproxy.Resolver, len(s.resolvers))
+	for k, v := range s.resolvers {
+		cp.resolvers[k] = v
+	}
+	cp.mailers = make(map[string]haproxy.MailersSection, len(s.mailers))
+	for k, v := range s.mailers {
+		cp.mailers[k] = v
+	}
+	cp.caches = make(map[string]haproxy.Cache, len(s.caches))
+	for k, v := range s.caches {
+		cp.caches[k] = v
+	}
+	cp.peers = make(map[string]haproxy.PeerSection, len(s.peers))
+	for k, v := range s.peers {
+		cp.peers[k] = v
+	}
+	return cp
+}
+
+// copyValues は、設定値の map を複製します
+func copyValues(values map[string]string) map[string]string {
+	cp := make(map[string]string, len(values))
+	for k, v := range values {
+		cp[k] = v
+	}
+	return cp
+}
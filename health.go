@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// healthGateOptions は、ヘルス状態の待ち合わせ条件です
+type healthGateOptions struct {
+	minHealthyRatio float64       // 合格とする正常なサーバーの割合（0〜1）
+	timeout         time.Duration // 条件を満たすまで待つ最大時間
+	interval        time.Duration // ヘルス状態を取得する間隔
+
+	// テストなどで時刻と待機処理を差し替えるための関数（nil の場合は time パッケージを使用）
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// healthSummary は、設定ファイルに記載されたサーバーのヘルス状態の集計です
+type healthSummary struct {
+	Total     int
+	Healthy   int
+	Unhealthy []string // "グループ/サーバー名 (状態)" の一覧
+}
+
+// ratio は、正常なサーバーの割合を返します。サーバーが1台もない場合は 1 とします
+func (s healthSummary) ratio() float64 {
+	if s.Total == 0 {
+		return 1
+	}
+	return float64(s.Healthy) / float64(s.Total)
+}
+
+// isHealthyStatus は、サーバーの状態が正常（トラフィックを受けられる状態）かを返します
+func isHealthyStatus(status string) bool {
+	status = strings.ToUpper(strings.TrimSpace(status))
+	return strings.HasPrefix(status, "UP") || status == "NO CHECK"
+}
+
+// summarizeHealth は、現在のサーバー状態から設定ファイルのサーバーのヘルス状態を集計します。
+// HAProxy上に存在しないサーバーは異常として数えます。server-template のサーバーは含めません
+func summarizeHealth(client haproxyClient, config *Config) (healthSummary, error) {
+	current, err := client.GetServers()
+	if err != nil {
+		return healthSummary{}, fmt.Errorf("サーバー状態の取得に失敗: %w", err)
+	}
+	status := make(map[string]string, len(current))
+	for _, s := range current {
+		status[serverKey(s.Backend, s.Name)] = s.Status
+	}
+
+	var summary healthSummary
+	for _, b := range config.Backends {
+		// server-template は名前解決できていない枠がメンテナンス状態になるため集計対象外とする
+		if b.SRV != "" {
+			continue
+		}
+		summary.Total++
+		st, ok := status[serverKey(b.Group, b.Name)]
+		switch {
+		case !ok:
+			summary.Unhealthy = append(summary.Unhealthy, fmt.Sprintf("%s (未登録)", serverKey(b.Group, b.Name)))
+		case isHealthyStatus(st):
+			summary.Healthy++
+		default:
+			summary.Unhealthy = append(summary.Unhealthy, fmt.Sprintf("%s (%s)", serverKey(b.Group, b.Name), st))
+		}
+	}
+	sort.Strings(summary.Unhealthy)
+	return summary, nil
+}
+
+// waitForHealthy は、正常なサーバーの割合が閾値以上になるまでヘルス状態を繰り返し取得します。
+// タイムアウトまでに条件を満たさなかった場合は、最後の集計結果とともにエラーを返します
+func waitForHealthy(client haproxyClient, config *Config, opts healthGateOptions) (healthSummary, error) {
+	now, sleep := opts.now, opts.sleep
+	if now == nil {
+		now = time.Now
+	}
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	deadline := now().Add(opts.timeout)
+	for {
+		summary, err := summarizeHealth(client, config)
+		if err != nil {
+			return summary, err
+		}
+		logf("ヘルス状態: 正常 %d/%d (%.0f%%、閾値 %.0f%%)\n", summary.Healthy, summary.Total, summary.ratio()*100, opts.minHealthyRatio*100)
+		if summary.ratio() >= opts.minHealthyRatio {
+			return summary, nil
+		}
+		if !now().Before(deadline) {
+			return summary, fmt.Errorf("%s 以内に正常なサーバーの割合が閾値 %.0f%% に達しませんでした（%.0f%%）",
+				opts.timeout, opts.minHealthyRatio*100, summary.ratio()*100)
+		}
+		sleep(opts.interval)
+	}
+}
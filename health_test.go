@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// healthTestConfig は、web-1〜web-5 の5台を持つヘルスチェックゲートのテスト用の設定を返します
+func healthTestConfig(t *testing.T) *Config {
+	t.Helper()
+	return loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://health"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-4", "ip": "10.0.0.4", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-5", "ip": "10.0.0.5", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+}
+
+// steppingClock は、sleep のたびに時刻を進め、onSleep を呼び出す時計です（ヘルス状態の変化を再現します）
+type steppingClock struct {
+	current time.Time
+	sleeps  int
+	onSleep func(n int)
+}
+
+func (c *steppingClock) now() time.Time { return c.current }
+
+func (c *steppingClock) sleep(d time.Duration) {
+	c.current = c.current.Add(d)
+	c.sleeps++
+	if c.onSleep != nil {
+		c.onSleep(c.sleeps)
+	}
+}
+
+// setServerStatus は、メモリ上の HAProxy のサーバーの状態を変更します
+func setServerStatus(t *testing.T, client haproxyClient, backend, name, status string) {
+	t.Helper()
+	s := haproxy.Server{Backend: backend, Name: name, Status: status}
+	if err := client.UpdateServer(&s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForHealthyPassesOnceServersRecover(t *testing.T) {
+	captureOutput(t)
+	config := healthTestConfig(t)
+	_, fake := testMemoryEndpoint(t)
+	for i, b := range config.Backends {
+		status := "UP"
+		if i < 3 {
+			status = "DOWN"
+		}
+		if err := fake.AddServer(&haproxy.Server{Backend: b.Group, Name: b.Name, Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 待機のたびに1台ずつ UP になり、2回目の待機で 4/5（80%）に達します
+	clock := &steppingClock{current: time.Unix(0, 0)}
+	clock.onSleep = func(n int) { setServerStatus(t, fake, "web", config.Backends[n-1].Name, "UP") }
+	summary, err := waitForHealthy(fake, config, healthGateOptions{
+		minHealthyRatio: 0.8, timeout: time.Minute, interval: 5 * time.Second, now: clock.now, sleep: clock.sleep,
+	})
+	if err != nil {
+		t.Fatalf("waitForHealthy がエラーを返しました: %v", err)
+	}
+	if clock.sleeps != 2 || summary.Healthy != 4 || summary.Total != 5 {
+		t.Errorf("待機 %d 回、正常 %d/%d, want 2 回、4/5", clock.sleeps, summary.Healthy, summary.Total)
+	}
+	if want := []string{"web/web-3 (DOWN)"}; !reflect.DeepEqual(summary.Unhealthy, want) {
+		t.Errorf("Unhealthy = %v, want %v", summary.Unhealthy, want)
+	}
+}
+
+func TestWaitForHealthyFailsAfterTimeout(t *testing.T) {
+	captureOutput(t)
+	config := healthTestConfig(t)
+	_, fake := testMemoryEndpoint(t)
+	// web-5 は HAProxy に登録しないため未登録として異常に数えます
+	for i, b := range config.Backends[:4] {
+		status := "UP"
+		if i == 0 {
+			status = "MAINT"
+		}
+		if err := fake.AddServer(&haproxy.Server{Backend: b.Group, Name: b.Name, Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clock := &steppingClock{current: time.Unix(0, 0)}
+	summary, err := waitForHealthy(fake, config, healthGateOptions{
+		minHealthyRatio: 0.8, timeout: time.Minute, interval: 10 * time.Second, now: clock.now, sleep: clock.sleep,
+	})
+	if err == nil || !strings.Contains(err.Error(), "閾値 80%") {
+		t.Fatalf("waitForHealthy() = %v, want 閾値に達しなかったエラー", err)
+	}
+	if clock.sleeps != 6 {
+		t.Errorf("待機回数 = %d, want 6（1分間、10秒間隔）", clock.sleeps)
+	}
+	if want := []string{"web/web-1 (MAINT)", "web/web-5 (未登録)"}; !reflect.DeepEqual(summary.Unhealthy, want) {
+		t.Errorf("Unhealthy = %v, want %v", summary.Unhealthy, want)
+	}
+}
+
+func TestSocketServerStatus(t *testing.T) {
+	for _, tt := range []struct {
+		opState, adminState int
+		want                string
+	}{
+		{2, 0, "UP"},
+		{0, 0, "DOWN"},
+		{2, 0x08, "DRAIN"},
+		{2, 0x01, "MAINT"},
+		{2, 0x08 | 0x20, "MAINT"},
+	} {
+		if got := socketServerStatus(tt.opState, tt.adminState); got != tt.want {
+			t.Errorf("socketServerStatus(%d, %#x) = %s, want %s", tt.opState, tt.adminState, got, tt.want)
+		}
+	}
+}
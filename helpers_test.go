@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// loadTestConfig は、JSON の設定内容を一時ファイルに書き出し、loadConfig で読み込んで検証した設定を返します
+func loadTestConfig(t *testing.T, data string) *Config {
+	t.Helper()
+	path := writeTestFile(t, "config.json", data)
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("設定の検証に失敗: %v", err)
+	}
+	return config
+}
+
+// validateTestConfig は、JSON の設定内容を loadConfig で読み込み、Validate の結果を返します（検証エラーのテスト用）
+func validateTestConfig(t *testing.T, data string) error {
+	t.Helper()
+	config, err := loadConfig(writeTestFile(t, "config.json", data))
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	return config.Validate()
+}
+
+// writeTestFile は、テスト用の一時ディレクトリにファイルを書き出してそのパスを返します
+func writeTestFile(t testing.TB, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testMemoryEndpoint は、テストごとに異なる memory:// のエンドポイントと、そのメモリ上のインスタンスを返します
+func testMemoryEndpoint(t *testing.T) (string, *haproxyfake.HAProxy) {
+	t.Helper()
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	memoryInstancesMu.Lock()
+	delete(memoryInstances, name)
+	memoryInstancesMu.Unlock()
+	return memoryScheme + name, newMemoryClient(name)
+}
+
+// captureOutput は、テストの間だけ処理状況のログ（logf）と log パッケージの出力（警告・エラー）をバッファに切り替えます。
+// 警告の集計もテストごとに空の状態から始めます
+func captureOutput(t testing.TB) (logs, errs *bytes.Buffer) {
+	t.Helper()
+	logs, errs = &bytes.Buffer{}, &bytes.Buffer{}
+	prevOutput, prevWriter, prevFlags := logOutput, log.Writer(), log.Flags()
+	prevWarnings := warnings
+	logOutput = logs
+	log.SetOutput(errs)
+	log.SetFlags(0)
+	warnings = &warningSink{}
+	t.Cleanup(func() {
+		logOutput = prevOutput
+		log.SetOutput(prevWriter)
+		log.SetFlags(prevFlags)
+		warnings = prevWarnings
+	})
+	return logs, errs
+}
+
+// setFlag は、テストの間だけフラグの値を変更します
+func setFlag(t *testing.T, name, value string) {
+	t.Helper()
+	f := flag.CommandLine.Lookup(name)
+	if f == nil {
+		t.Fatalf("フラグ -%s は定義されていません", name)
+	}
+	prev := f.Value.String()
+	if err := f.Value.Set(value); err != nil {
+		t.Fatalf("フラグ -%s に %q を設定できません: %v", name, value, err)
+	}
+	t.Cleanup(func() { f.Value.Set(prev) })
+}
+
+// withEnv は、テストの間だけ環境変数を設定します
+func withEnv(t *testing.T, key, value string) {
+	t.Helper()
+	prev, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, prev)
+			return
+		}
+		os.Unsetenv(key)
+	})
+}
@@ -0,0 +1,67 @@
+// Package hook は、設定の適用前後に独自の処理（サービスメッシュからのドレインなど）を差し込むためのフックです。
+// ライブラリとして組み込む場合は、init などで Register したフックを設定ファイルの hooks から名前で参照できます
+package hook
+
+import (
+	"sort"
+	"sync"
+)
+
+// Server は、フックに渡す適用対象のサーバー1台です
+type Server struct {
+	Group   string   // 所属するHAProxyバックエンド（グループ）名
+	Name    string   // サーバー名
+	Address string   // IP アドレスまたはホスト名（unix ソケットの場合はソケットのパス）
+	Port    int      // ポート（unix ソケットの場合は 0）
+	Weight  int      // 重み
+	Tags    []string // 設定ファイルのタグ
+	Owner   string   // 設定ファイルのメタデータ
+}
+
+// Config は、フックに渡す適用する設定の内容です
+type Config struct {
+	Endpoints []string // 適用先のHAProxyインスタンス
+	Servers   []Server // 設定ファイルに記載されたサーバー（記載順）
+}
+
+// Hook は、設定の適用前後に呼ばれる処理です
+type Hook interface {
+	// PreApply は適用前に呼ばれます。エラーを返すと適用は中止されます
+	PreApply(config *Config) error
+	// PostApply は適用後に呼ばれます。applyErr には適用処理の結果が渡されます。
+	// ここで返したエラーは警告として出力されるのみです
+	PostApply(config *Config, applyErr error) error
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]Hook{}
+)
+
+// Register は、設定ファイルの hooks から名前で参照できるフックを登録します。
+// 同じ名前で登録した場合は上書きされます
+func Register(name string, h Hook) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = h
+}
+
+// Lookup は、名前で登録されたフックを返します
+func Lookup(name string) (Hook, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	h, ok := registry[name]
+	return h, ok
+}
+
+// Names は、登録済みのフック名をソートして返します
+func Names() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,35 @@
+package hook
+
+import (
+	"reflect"
+	"testing"
+)
+
+type nopHook struct{ id int }
+
+func (nopHook) PreApply(config *Config) error                  { return nil }
+func (nopHook) PostApply(config *Config, applyErr error) error { return nil }
+
+func TestRegisterAndLookup(t *testing.T) {
+	Register("test-b", nopHook{id: 1})
+	Register("test-a", nopHook{id: 2})
+	Register("test-b", nopHook{id: 3})
+
+	h, ok := Lookup("test-b")
+	if !ok || h.(nopHook).id != 3 {
+		t.Errorf("Lookup(test-b) = %v, %v, want 上書きした id 3 のフック", h, ok)
+	}
+	if _, ok := Lookup("test-missing"); ok {
+		t.Error("未登録の名前で Lookup が成功しました")
+	}
+
+	got := []string{}
+	for _, name := range Names() {
+		if name == "test-a" || name == "test-b" {
+			got = append(got, name)
+		}
+	}
+	if want := []string{"test-a", "test-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() の登録したフック = %v, want %v（名前順）", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/limonene213u/lb_haproxy/hook"
+)
+
+func init() {
+	hook.Register("log", logHook{})
+}
+
+// namedHook は、ログ出力用に設定上の名前を保持したフックです
+type namedHook struct {
+	name string
+	hook.Hook
+}
+
+// resolveHooks は、フック名の一覧を登録済みのフック（hook.Register で登録したもの）に解決します
+func resolveHooks(names []string) ([]namedHook, error) {
+	hooks := make([]namedHook, 0, len(names))
+	for _, name := range names {
+		h, ok := hook.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("未登録のフック[%s]が指定されました（登録済み: %s）", name, strings.Join(hook.Names(), ", "))
+		}
+		hooks = append(hooks, namedHook{name: name, Hook: h})
+	}
+	return hooks, nil
+}
+
+// hookConfig は、フックに渡す設定の内容を組み立てます
+func hookConfig(config *Config) *hook.Config {
+	hc := &hook.Config{Endpoints: append([]string(nil), config.HaproxyEndpoint...)}
+	for _, b := range config.Backends {
+		address := b.IP
+		if b.Socket != "" {
+			address = b.Socket
+		}
+		hc.Servers = append(hc.Servers, hook.Server{
+			Group:   b.Group,
+			Name:    b.Name,
+			Address: address,
+			Port:    b.Port,
+			Weight:  b.Weight,
+			Tags:    append([]string(nil), b.Tags...),
+			Owner:   b.Owner,
+		})
+	}
+	return hc
+}
+
+// runPreApplyHooks は、各フックの PreApply を順に実行し、最初のエラーで中断します
+func runPreApplyHooks(hooks []namedHook, config *Config) error {
+	hc := hookConfig(config)
+	for _, h := range hooks {
+		if err := h.PreApply(hc); err != nil {
+			return fmt.Errorf("フック[%s]の適用前処理に失敗: %w", h.name, err)
+		}
+	}
+	return nil
+}
+
+// runPostApplyHooks は、各フックの PostApply を順に実行します。エラーは警告として出力します
+func runPostApplyHooks(hooks []namedHook, config *Config, applyErr error) {
+	hc := hookConfig(config)
+	for _, h := range hooks {
+		if err := h.PostApply(hc, applyErr); err != nil {
+			warnf("フック[%s]の適用後処理に失敗: %v", h.name, err)
+		}
+	}
+}
+
+// logHook は適用の開始と終了を出力するだけの組み込みフックです
+type logHook struct{}
+
+func (logHook) PreApply(config *hook.Config) error {
+	logf("設定の適用を開始します（サーバー数: %d）\n", len(config.Servers))
+	return nil
+}
+
+func (logHook) PostApply(config *hook.Config, applyErr error) error {
+	if applyErr != nil {
+		logf("設定の適用が失敗で終了しました: %v\n", applyErr)
+		return nil
+	}
+	logf("設定の適用が完了しました\n")
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+	"github.com/limonene213u/lb_haproxy/hook"
+)
+
+// fakeHook は、呼ばれた順序と呼ばれた時点のサーバー数を記録するテスト用のフックです
+type fakeHook struct {
+	client  *haproxyfake.HAProxy
+	calls   []string
+	preErr  error
+	postErr error
+	applied error // PostApply に渡された適用処理の結果
+}
+
+func (h *fakeHook) PreApply(config *hook.Config) error {
+	h.calls = append(h.calls, h.event("pre"))
+	return h.preErr
+}
+
+func (h *fakeHook) PostApply(config *hook.Config, applyErr error) error {
+	h.calls = append(h.calls, h.event("post"))
+	h.applied = applyErr
+	return h.postErr
+}
+
+// event は、呼ばれた時点でメモリ上のインスタンスにあるサーバー数を付けたイベント名を返します
+func (h *fakeHook) event(name string) string {
+	servers, _ := h.client.GetServers()
+	return fmt.Sprintf("%s:%d", name, len(servers))
+}
+
+// hookTestConfig は、フック fake-<テスト名> を指定した memory:// への適用の設定を返します
+func hookTestConfig(t *testing.T, h *fakeHook) *Config {
+	endpoint, client := testMemoryEndpoint(t)
+	h.client = client
+	name := "fake-" + t.Name()
+	hook.Register(name, h)
+	return loadTestConfig(t, `{
+		"haproxy_endpoint": ["`+endpoint+`"],
+		"load_balancing_algorithm": "roundrobin",
+		"hooks": ["`+name+`"],
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+}
+
+func TestHooksRunAroundReconcile(t *testing.T) {
+	captureOutput(t)
+	h := &fakeHook{}
+	config := hookTestConfig(t, h)
+
+	if err := applyOnce(context.Background(), config); err != nil {
+		t.Fatalf("applyOnce がエラーを返しました: %v", err)
+	}
+	want := []string{"pre:0", "post:2"}
+	if strings.Join(h.calls, ",") != strings.Join(want, ",") {
+		t.Errorf("フックの呼び出し = %v, want %v（適用前と適用後に1回ずつ）", h.calls, want)
+	}
+	if h.applied != nil {
+		t.Errorf("PostApply に渡された結果 = %v, want nil", h.applied)
+	}
+}
+
+func TestPreApplyHookErrorAbortsApply(t *testing.T) {
+	captureOutput(t)
+	h := &fakeHook{preErr: errors.New("サービスメッシュからのドレインに失敗")}
+	config := hookTestConfig(t, h)
+
+	err := applyOnce(context.Background(), config)
+	if err == nil || !errors.Is(err, h.preErr) {
+		t.Fatalf("applyOnce のエラー = %v, want PreApply のエラーを含むこと", err)
+	}
+	if servers, _ := h.client.GetServers(); len(servers) != 0 {
+		t.Errorf("PreApply の失敗後に %d 台のサーバーが追加されました（適用を中止すること）", len(servers))
+	}
+	if strings.Join(h.calls, ",") != "pre:0" {
+		t.Errorf("フックの呼び出し = %v, want [pre:0]（PostApply は呼ばれないこと）", h.calls)
+	}
+}
+
+func TestPostApplyHookErrorOnlyWarns(t *testing.T) {
+	_, errs := captureOutput(t)
+	h := &fakeHook{postErr: errors.New("通知の送信に失敗")}
+	config := hookTestConfig(t, h)
+
+	if err := applyOnce(context.Background(), config); err != nil {
+		t.Fatalf("applyOnce のエラー = %v, want nil（PostApply のエラーは警告のみ）", err)
+	}
+	if servers, _ := h.client.GetServers(); len(servers) != 2 {
+		t.Errorf("適用後のサーバー数 = %d, want 2", len(servers))
+	}
+	if warnings.count() != 1 || !strings.Contains(errs.String(), "警告: フック[fake-"+t.Name()+"]の適用後処理に失敗: 通知の送信に失敗") {
+		t.Errorf("PostApply の失敗の警告が出力されていません: %q", errs.String())
+	}
+}
+
+func TestResolveHooksRejectsUnknownName(t *testing.T) {
+	_, err := resolveHooks([]string{"log", "no-such-hook"})
+	if err == nil || !strings.Contains(err.Error(), "no-such-hook") {
+		t.Fatalf("resolveHooks のエラー = %v, want 未登録のフック名を含むこと", err)
+	}
+	if !strings.Contains(err.Error(), "log") {
+		t.Errorf("エラーに登録済みのフック名が含まれていません: %v", err)
+	}
+}
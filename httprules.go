@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// httpRuleTypes は対応しているヘッダー操作ルールの種類と、値（value）が必要かどうかです
+var httpRuleTypes = map[string]bool{
+	"set-header": true,
+	"add-header": true,
+	"del-header": false,
+}
+
+// httpRuleScopes はルールを設定できるセクションです
+var httpRuleScopes = map[string]bool{
+	"frontend": true,
+	"backend":  true,
+}
+
+// httpRuleDirections は、ルールを適用する方向と haproxy.cfg でのキーワードです
+var httpRuleDirections = map[string]string{
+	"request":  "http-request",
+	"response": "http-response",
+}
+
+// validate は、ヘッダー操作ルールの設定を検証します
+func (r HTTPRuleConfig) validate() error {
+	if !httpRuleScopes[r.Scope] {
+		return fmt.Errorf("scope[%s]は未対応です（frontend または backend）", r.Scope)
+	}
+	if r.Name == "" {
+		return errors.New("name（ルールを設定する frontend / backend 名）が指定されていません")
+	}
+	if httpRuleDirections[r.Direction] == "" {
+		return fmt.Errorf("direction[%s]は未対応です（request または response）", r.Direction)
+	}
+	needsValue, ok := httpRuleTypes[r.Type]
+	if !ok {
+		return fmt.Errorf("type[%s]は未対応です（set-header, add-header, del-header のいずれか）", r.Type)
+	}
+	if r.Header == "" || strings.ContainsAny(r.Header, " \t:") {
+		return fmt.Errorf("header[%s]が不正です", r.Header)
+	}
+	if needsValue && r.Value == "" {
+		return fmt.Errorf("type %s には value を指定してください", r.Type)
+	}
+	if !needsValue && r.Value != "" {
+		return fmt.Errorf("type %s には value を指定できません", r.Type)
+	}
+	if r.Cond != "" && !strings.HasPrefix(r.Cond, "if ") && !strings.HasPrefix(r.Cond, "unless ") {
+		return fmt.Errorf("cond[%s]は if または unless で始めてください", r.Cond)
+	}
+	return nil
+}
+
+// httpRuleTarget は、ルールをまとめて設定する単位（セクションと方向）です
+type httpRuleTarget struct {
+	scope, name, direction string
+}
+
+// groupHTTPRules は、ルールを設定先ごとに設定ファイルでの順序を保ってまとめます
+func groupHTTPRules(rules []HTTPRuleConfig) ([]httpRuleTarget, map[httpRuleTarget][]haproxy.HTTPRule) {
+	var targets []httpRuleTarget
+	grouped := map[httpRuleTarget][]haproxy.HTTPRule{}
+	for _, r := range rules {
+		t := httpRuleTarget{r.Scope, r.Name, r.Direction}
+		if _, ok := grouped[t]; !ok {
+			targets = append(targets, t)
+		}
+		grouped[t] = append(grouped[t], haproxy.HTTPRule{Type: r.Type, HdrName: r.Header, HdrFormat: r.Value, Cond: r.Cond})
+	}
+	return targets, grouped
+}
+
+// applyHTTPRules は、ヘッダー操作ルールを設定先ごとに設定ファイルの内容で置き換えます。
+// 置き換えのため、何度適用しても同じ結果になります
+func applyHTTPRules(client haproxyClient, config *Config) error {
+	targets, grouped := groupHTTPRules(config.HTTPRules)
+	for _, t := range targets {
+		if err := client.ReplaceHTTPRules(t.scope, t.name, t.direction, grouped[t]); err != nil {
+			return fmt.Errorf("%s[%s]の %s ルールの設定失敗: %w", t.scope, t.name, httpRuleDirections[t.direction], err)
+		}
+		logf("%s[%s]に %s ルールを %d 件設定しました\n", t.scope, t.name, httpRuleDirections[t.direction], len(grouped[t]))
+	}
+	return nil
+}
+
+// httpRuleLine は、ルールを haproxy.cfg の http-request / http-response 行に変換します
+func httpRuleLine(r HTTPRuleConfig) string {
+	line := fmt.Sprintf("%s %s %s", httpRuleDirections[r.Direction], r.Type, r.Header)
+	if r.Value != "" {
+		line += " " + r.Value
+	}
+	if r.Cond != "" {
+		line += " " + r.Cond
+	}
+	return line
+}
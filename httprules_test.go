@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// httpRulesTestConfig は、frontend と backend にヘッダー操作ルールを持つ設定です
+const httpRulesTestConfig = `{
+	"haproxy_endpoint": ["memory://httprules"],
+	"load_balancing_algorithm": "roundrobin",
+	"http_rules": [
+		{"scope": "frontend", "name": "www", "direction": "response", "type": "set-header", "header": "Strict-Transport-Security", "value": "max-age=31536000"},
+		{"scope": "backend", "name": "web", "direction": "request", "type": "add-header", "header": "X-Env", "value": "prod", "cond": "if { ssl_fc }"},
+		{"scope": "frontend", "name": "www", "direction": "response", "type": "del-header", "header": "Server"}
+	],
+	"backends": []
+}`
+
+func TestApplyHTTPRulesReplacesPerTarget(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, httpRulesTestConfig)
+	_, fake := testMemoryEndpoint(t)
+	for i := 0; i < 2; i++ { // 再適用しても同じ結果になること
+		if err := applyHTTPRules(fake, config); err != nil {
+			t.Fatalf("applyHTTPRules がエラーを返しました: %v", err)
+		}
+	}
+
+	want := []haproxy.HTTPRule{
+		{Type: "set-header", HdrName: "Strict-Transport-Security", HdrFormat: "max-age=31536000"},
+		{Type: "del-header", HdrName: "Server"},
+	}
+	if got := fake.HTTPRules("frontend", "www", "response"); !reflect.DeepEqual(got, want) {
+		t.Errorf("frontend[www]の http-response ルール = %+v, want %+v", got, want)
+	}
+	want = []haproxy.HTTPRule{{Type: "add-header", HdrName: "X-Env", HdrFormat: "prod", Cond: "if { ssl_fc }"}}
+	if got := fake.HTTPRules("backend", "web", "request"); !reflect.DeepEqual(got, want) {
+		t.Errorf("backend[web]の http-request ルール = %+v, want %+v", got, want)
+	}
+	if got, want := httpRuleLine(config.HTTPRules[1]), "http-request add-header X-Env prod if { ssl_fc }"; got != want {
+		t.Errorf("httpRuleLine() = %q, want %q", got, want)
+	}
+}
+
+func TestHTTPRuleValidate(t *testing.T) {
+	err := validateTestConfig(t, strings.Replace(httpRulesTestConfig, `"type": "add-header"`, `"type": "replace-header"`, 1))
+	if err == nil || !strings.Contains(err.Error(), "type[replace-header]は未対応です") {
+		t.Errorf("Validate() = %v, want 未対応のルールの種類のエラー", err)
+	}
+
+	valid := HTTPRuleConfig{Scope: "backend", Name: "web", Direction: "request", Type: "set-header", Header: "X-Env", Value: "prod"}
+	for name, modify := range map[string]func(*HTTPRuleConfig){
+		"不正な scope":          func(r *HTTPRuleConfig) { r.Scope = "defaults" },
+		"不正な direction":      func(r *HTTPRuleConfig) { r.Direction = "both" },
+		"不正なヘッダー名":           func(r *HTTPRuleConfig) { r.Header = "X-Env:" },
+		"value の指定なし":        func(r *HTTPRuleConfig) { r.Value = "" },
+		"del-header の value": func(r *HTTPRuleConfig) { r.Type = "del-header" },
+		"if のない cond":        func(r *HTTPRuleConfig) { r.Cond = "{ ssl_fc }" },
+	} {
+		r := valid
+		modify(&r)
+		if err := r.validate(); err == nil {
+			t.Errorf("%s: validate がエラーになりませんでした", name)
+		}
+	}
+}
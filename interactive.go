@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errApplyDeclined は、-interactive で適用が確認されなかったことを表すエラーです
+var errApplyDeclined = errors.New("適用が確認されなかったため中止しました")
+
+// confirmApply は、適用の確認を求め、y または yes（大文字小文字を区別しない）と入力された場合のみ true を返します
+func confirmApply(in io.Reader, out io.Writer) (bool, error) {
+	fmt.Fprint(out, "これらの変更を適用しますか？ [y/N]: ")
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("確認入力の読み込みに失敗: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// interactiveConfirm は、-interactive の確認を行います。-dry-run と同じ計画と各インスタンスの現在の状態との差分を表示し、
+// 適用してよいか確認します。確認を求めた場合は true を返し、確認されなかった場合は errApplyDeclined を返します。
+// -yes の指定時や端末以外（CI など）からの実行では確認を省略し、false を返します
+func interactiveConfirm(config *Config, opts applyOptions, confirm func() (bool, error)) (bool, error) {
+	if !*interactiveFlag || *yesFlag || !stdinIsTerminal() {
+		return false, nil
+	}
+	logf("以下の順序で適用します:\n%s", formatPlan(planConfig(config, opts)))
+	if err := planEndpoints(config, opts); err != nil {
+		return false, err
+	}
+	ok, err := confirm()
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, errApplyDeclined
+	}
+	return true, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConfirmApply(t *testing.T) {
+	for input, want := range map[string]bool{"y\n": true, "YES\n": true, " yes ": true, "n\n": false, "\n": false, "": false, "ok\n": false} {
+		var out bytes.Buffer
+		got, err := confirmApply(strings.NewReader(input), &out)
+		if err != nil {
+			t.Fatalf("confirmApply(%q) がエラーを返しました: %v", input, err)
+		}
+		if got != want {
+			t.Errorf("confirmApply(%q) = %v, want %v（y / yes のみ適用すること）", input, got, want)
+		}
+		if !strings.Contains(out.String(), "[y/N]") {
+			t.Errorf("確認の表示 = %q, want [y/N] を含むこと", out.String())
+		}
+	}
+}
+
+func TestInteractiveConfirmGatesApply(t *testing.T) {
+	endpoint, fake := testMemoryEndpoint(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["`+endpoint+`"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"}]
+	}`)
+	setFlag(t, "interactive", "true")
+	withStdinTerminal(t, true)
+
+	t.Run("確認されない場合", func(t *testing.T) {
+		logs, _ := captureOutput(t)
+		confirmed, err := interactiveConfirm(config, applyOptions{}, func() (bool, error) { return false, nil })
+		if err != errApplyDeclined || confirmed {
+			t.Fatalf("interactiveConfirm() = %v, %v, want false, errApplyDeclined", confirmed, err)
+		}
+		if !strings.Contains(logs.String(), "サーバー[web/web-1]: 追加") {
+			t.Errorf("確認の前の出力 =\n%s\nwant 現在の状態との差分を含むこと", logs.String())
+		}
+		if servers, _ := fake.GetServers(); len(servers) != 0 {
+			t.Errorf("確認されなかった後のサーバー数 = %d, want 0（変更しないこと）", len(servers))
+		}
+	})
+
+	t.Run("確認された場合", func(t *testing.T) {
+		captureOutput(t)
+		confirmed, err := interactiveConfirm(config, applyOptions{}, func() (bool, error) { return true, nil })
+		if err != nil || !confirmed {
+			t.Fatalf("interactiveConfirm() = %v, %v, want true, nil", confirmed, err)
+		}
+	})
+
+	t.Run("確認を省略する場合", func(t *testing.T) {
+		captureOutput(t)
+		asked := false
+		ask := func() (bool, error) { asked = true; return false, nil }
+		setFlag(t, "yes", "true")
+		if confirmed, err := interactiveConfirm(config, applyOptions{}, ask); err != nil || confirmed || asked {
+			t.Errorf("-yes での interactiveConfirm() = %v, %v（確認 %v）, want false, nil（確認しないこと）", confirmed, err, asked)
+		}
+		setFlag(t, "yes", "false")
+		withStdinTerminal(t, false)
+		if confirmed, err := interactiveConfirm(config, applyOptions{}, ask); err != nil || confirmed || asked {
+			t.Errorf("端末以外での interactiveConfirm() = %v, %v（確認 %v）, want false, nil（確認しないこと）", confirmed, err, asked)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// captureJSONErrors は、テストの間だけ -json-errors を有効にし、エラーの出力先をバッファに切り替えます
+func captureJSONErrors(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	prevEnabled, prevOutput := jsonErrorsEnabled, errorOutput
+	jsonErrorsEnabled, errorOutput = true, buf
+	t.Cleanup(func() { jsonErrorsEnabled, errorOutput = prevEnabled, prevOutput })
+	return buf
+}
+
+// decodeErrorEvents は、1行1件のJSONで書き出されたエラーを読み取ります
+func decodeErrorEvents(t *testing.T, data string) []errorEvent {
+	t.Helper()
+	var events []errorEvent
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		if line == "" {
+			continue
+		}
+		var e errorEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("エラーの出力 %q がJSONとして読み取れません: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestJSONErrorsReportServerFailure(t *testing.T) {
+	_, errs := captureOutput(t)
+	buf := captureJSONErrors(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://json-errors"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"}]
+	}`)
+	client := &failingAddClient{HAProxy: haproxyfake.New()}
+	if _, err := applyConfig(client, config, applyOptions{attempts: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := decodeErrorEvents(t, buf.String())
+	if len(events) != 1 {
+		t.Fatalf("エラーの件数 = %d, want 1:\n%s", len(events), buf.String())
+	}
+	e := events[0]
+	if e.Level != "error" || e.Category != errorCategoryServer || e.Target != "web-1" || e.Time == "" {
+		t.Errorf("エラー = %+v, want level error, category %s, target web-1", e, errorCategoryServer)
+	}
+	if len(e.Causes) == 0 || e.Causes[len(e.Causes)-1] != "接続できません" {
+		t.Errorf("causes = %q, want 最後が元のエラー（接続できません）", e.Causes)
+	}
+	if errs.Len() != 0 {
+		t.Errorf("log パッケージへの出力 = %q, want なし（JSON のみで出力すること）", errs.String())
+	}
+}
+
+func TestErrorCauses(t *testing.T) {
+	inner := fmt.Errorf("接続できません")
+	err := fmt.Errorf("サーバー[web-1]の追加失敗: %w", fmt.Errorf("3 回試行: %w", inner))
+	want := []string{err.Error(), "3 回試行: 接続できません", "接続できません"}
+	if got := errorCauses(err); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("errorCauses() = %q, want %q（外側から順に並べること）", got, want)
+	}
+	if got := errorCauses(nil); got != nil {
+		t.Errorf("errorCauses(nil) = %q, want nil", got)
+	}
+}
+
+func TestJSONErrorWriterPassesWarningsThrough(t *testing.T) {
+	buf := captureJSONErrors(t)
+	var logs bytes.Buffer
+	w := jsonErrorWriter{logs: log.New(&logs, "", 0)}
+	fmt.Fprint(w, "警告: 設定の一部を無視します\n")
+	fmt.Fprint(w, "予期しないエラー\n")
+
+	if got := logs.String(); got != "警告: 設定の一部を無視します\n" {
+		t.Errorf("通常のログへの出力 = %q, want 警告のみ", got)
+	}
+	events := decodeErrorEvents(t, buf.String())
+	if len(events) != 1 || events[0].Category != errorCategoryGeneral || events[0].Message != "予期しないエラー" {
+		t.Errorf("JSON のエラー = %+v, want category %s の「予期しないエラー」1件", events, errorCategoryGeneral)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ラベルのキーと値の形式です。サービスメッシュなどが読み取るため、Kubernetes のラベルと同じ規則とします
+// （キーは "example.com/" のような DNS 名の接頭辞を付けられ、名前と値は英数字で始まり英数字で終わる63文字以内）
+var (
+	labelNamePattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_.-]{0,61}[A-Za-z0-9])?$`)
+	labelPrefixPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+)
+
+// labelPrefixMaxLength は、ラベルのキーの接頭辞（"/" より前）の最大の長さです
+const labelPrefixMaxLength = 253
+
+// validateLabels は、サーバーのラベルのキーと値の形式を検証します（値は空でも構いません）
+func validateLabels(labels map[string]string) error {
+	for _, key := range sortedLabelKeys(labels) {
+		name := key
+		if i := strings.LastIndex(key, "/"); i >= 0 {
+			prefix := key[:i]
+			if len(prefix) > labelPrefixMaxLength || !labelPrefixPattern.MatchString(prefix) {
+				return fmt.Errorf("labels のキー[%s]の接頭辞は小文字の DNS 名で指定してください（例: mesh.example.com/service）", key)
+			}
+			name = key[i+1:]
+		}
+		if !labelNamePattern.MatchString(name) {
+			return fmt.Errorf("labels のキー[%s]は英数字で始まり英数字で終わる63文字以内（- _ . を含められます）で指定してください", key)
+		}
+		if value := labels[key]; value != "" && !labelNamePattern.MatchString(value) {
+			return fmt.Errorf("labels[%s]の値[%s]は英数字で始まり英数字で終わる63文字以内（- _ . を含められます）で指定してください", key, value)
+		}
+	}
+	return nil
+}
+
+// sortedLabelKeys は、ラベルのキーを名前順に返します
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// copyLabels は、ラベルの複製を返します（空の場合は nil）
+func copyLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	return copied
+}
+
+// formatLabels は、ラベルを "key=value,key=value" の形式でキーの順に並べた文字列にします（比較と表示用）
+func formatLabels(labels map[string]string) string {
+	parts := make([]string, 0, len(labels))
+	for _, k := range sortedLabelKeys(labels) {
+		parts = append(parts, k+"="+labels[k])
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// labelsTestConfig は、ラベルを指定した web-1 とラベルのない web-2 を持つ設定です
+func labelsTestConfig(t *testing.T, labels string) *Config {
+	t.Helper()
+	return loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://labels"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web", "labels": `+labels+`},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+}
+
+func TestApplyServerLabels(t *testing.T) {
+	captureOutput(t)
+	_, fake := testMemoryEndpoint(t)
+	result, err := applyConfig(fake, labelsTestConfig(t, `{"mesh.example.com/service": "web", "zone": "a"}`), applyOptions{})
+	if err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	metadata := map[string]string{}
+	servers, _ := fake.GetServers()
+	for _, s := range servers {
+		metadata[s.Name] = formatLabels(s.Metadata)
+	}
+	if want := "mesh.example.com/service=web,zone=a"; metadata["web-1"] != want || metadata["web-2"] != "" {
+		t.Errorf("サーバーのメタデータ = %v, want web-1 のみ %s", metadata, want)
+	}
+	for _, br := range result.Backends {
+		if br.Name == "web-1" && formatLabels(br.Labels) != "mesh.example.com/service=web,zone=a" {
+			t.Errorf("結果の web-1 のラベル = %v, want 設定したラベル", br.Labels)
+		}
+	}
+
+	result, err = applyConfig(fake, labelsTestConfig(t, `{"mesh.example.com/service": "web", "zone": "b"}`), applyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]BackendStatus{}
+	for _, br := range result.Backends {
+		statuses[br.Name] = br.Status
+	}
+	if statuses["web-1"] != StatusUpdated || statuses["web-2"] != StatusSkippedExists {
+		t.Errorf("ラベルの変更後の状態 = %v, want web-1 のみ %s（ラベルの違いで更新すること）", statuses, StatusUpdated)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	for _, tt := range []struct {
+		labels map[string]string
+		valid  bool
+	}{
+		{map[string]string{"app": "web", "mesh.example.com/service": "web-1.v2", "empty": ""}, true},
+		{map[string]string{"-app": "web"}, false},
+		{map[string]string{"app": "web_"}, false},
+		{map[string]string{strings.Repeat("a", 64): "web"}, false},
+		{map[string]string{"Mesh.Example.com/service": "web"}, false},
+		{map[string]string{"mesh.example.com/": "web"}, false},
+		{map[string]string{"app": "web server"}, false},
+	} {
+		if err := validateLabels(tt.labels); (err == nil) != tt.valid {
+			t.Errorf("validateLabels(%v) = %v, want 正しい形式=%v", tt.labels, err, tt.valid)
+		}
+	}
+}
+
+func TestLabelsAreRejectedForSRVServers(t *testing.T) {
+	err := validateBackend(BackendConfig{Name: "web", SRV: "_http._tcp.web.example.com", Labels: map[string]string{"app": "web"}})
+	if err == nil || !strings.Contains(err.Error(), "labels") {
+		t.Errorf("srv のサーバーのラベルの検証のエラー = %v, want labels を指定できない旨のエラー", err)
+	}
+}
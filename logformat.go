@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FrontendConfig は frontend 単位の設定です（現在はログの形式のみ）
+type FrontendConfig struct {
+	Name      string `json:"name"`
+	HTTPLog   bool   `json:"httplog,omitempty"`    // option httplog を有効にするかどうか
+	TCPLog    bool   `json:"tcplog,omitempty"`     // option tcplog を有効にするかどうか
+	LogFormat string `json:"log_format,omitempty"` // 独自のログ形式（log-format。httplog / tcplog とは同時に指定できません）
+	Cache     string `json:"cache,omitempty"`      // この frontend でレスポンスをキャッシュする場合に使う cache の名前
+}
+
+// logFormatVariables は、log-format で参照できる変数（%ci などの % に続く名前）です。
+// HAProxy のドキュメントの "Custom log format" の一覧に基づきます
+var logFormatVariables = map[string]bool{
+	"o": true, "B": true, "CC": true, "CS": true, "H": true, "HM": true, "HP": true, "HPO": true, "HQ": true,
+	"HU": true, "HV": true, "ID": true, "ST": true, "T": true, "Ta": true, "Tc": true, "Td": true, "Th": true,
+	"Ti": true, "Tl": true, "Tq": true, "TR": true, "Tr": true, "Ts": true, "Tt": true, "Tu": true, "Tw": true, "U": true,
+	"ac": true, "b": true, "bc": true, "bi": true, "bp": true, "bq": true, "ci": true, "cp": true, "f": true,
+	"fc": true, "fi": true, "fp": true, "ft": true, "hr": true, "hrl": true, "hs": true, "hsl": true, "lc": true,
+	"ms": true, "pid": true, "r": true, "rc": true, "rt": true, "s": true, "sc": true, "si": true, "sp": true,
+	"sq": true, "sslc": true, "sslv": true, "t": true, "tr": true, "trg": true, "trl": true, "ts": true, "tsc": true,
+}
+
+// validate は、frontend の設定を検証します
+func (f FrontendConfig) validate() error {
+	if f.Name == "" {
+		return errors.New("name が指定されていません")
+	}
+	if f.HTTPLog && f.TCPLog {
+		return errors.New("httplog と tcplog は同時に指定できません")
+	}
+	if f.LogFormat != "" {
+		if f.HTTPLog || f.TCPLog {
+			return errors.New("log_format と httplog / tcplog は同時に指定できません（log_format が優先されるため、どちらか一方を指定してください）")
+		}
+		if err := validateLogFormat(f.LogFormat); err != nil {
+			return fmt.Errorf("log_format が不正です: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateLogFormat は、log-format の変数参照が既知の変数か、%[...] のサンプル取得式であることを確認します。
+// サンプル取得式の中身やフラグ（%{+Q} など）の内容までは検証しません（厳密な検証は HAProxy に任せます）
+func validateLogFormat(format string) error {
+	if strings.ContainsAny(format, "\n\r") {
+		return errors.New("改行を含めることはできません")
+	}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			continue // %% は % そのもの
+		}
+		// %{+Q,+X} のようなフラグ
+		if i < len(format) && format[i] == '{' {
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				return errors.New("%{ に対応する } がありません")
+			}
+			i += end + 1
+		}
+		if i < len(format) && format[i] == '[' {
+			end := strings.IndexByte(format[i:], ']')
+			if end < 0 {
+				return errors.New("%[ に対応する ] がありません")
+			}
+			i += end
+			continue
+		}
+		start := i
+		for i < len(format) && isASCIILetter(format[i]) {
+			i++
+		}
+		name := format[start:i]
+		if name == "" {
+			return fmt.Errorf("%d 文字目の %% の後に変数名がありません（%% そのものは %%%% と記述してください）", start)
+		}
+		if !logFormatVariables[name] {
+			return fmt.Errorf("変数 %%%s は未知の変数です", name)
+		}
+		i--
+	}
+	return nil
+}
+
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// frontendLogSettings は、frontend に設定するログの項目と値を返します。
+// 指定のない項目も無効（off、log-format は空）として設定するため、設定ファイルから外した指定は解除されます
+func frontendLogSettings(f FrontendConfig) [][2]string {
+	return [][2]string{
+		{"option httplog", onOff(f.HTTPLog)},
+		{"option tcplog", onOff(f.TCPLog)},
+		{"log-format", f.LogFormat},
+	}
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
+// frontendLogLine は、frontend のログの設定を haproxy.cfg の表記で返します（dry-run 用）
+func frontendLogLine(f FrontendConfig) string {
+	switch {
+	case f.LogFormat != "":
+		return "log-format " + f.LogFormat
+	case f.HTTPLog:
+		return "option httplog"
+	case f.TCPLog:
+		return "option tcplog"
+	default:
+		return "ログ形式の指定なし（option httplog / tcplog と log-format を解除）"
+	}
+}
+
+// applyFrontendLogging は、設定ファイルの frontends のログの設定を反映します
+func applyFrontendLogging(client haproxyClient, config *Config) error {
+	for _, f := range config.Frontends {
+		for _, setting := range frontendLogSettings(f) {
+			if err := client.SetFrontendConfig(f.Name, setting[0], setting[1]); err != nil {
+				return fmt.Errorf("frontend[%s]の %s の設定に失敗: %w", f.Name, setting[0], err)
+			}
+		}
+		logf("frontend[%s]のログの設定を反映しました: %s\n", f.Name, frontendLogLine(f))
+	}
+	return nil
+}
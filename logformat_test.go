@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestApplyFrontendLogging(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://logformat"],
+		"load_balancing_algorithm": "roundrobin",
+		"frontends": [
+			{"name": "www", "httplog": true},
+			{"name": "db", "tcplog": true},
+			{"name": "api", "log_format": "%ci:%cp [%tr] %ft %b/%s %ST %B %{+Q}[capture.req.hdr(0)]"}
+		],
+		"backends": []
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, config, applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	for _, tt := range []struct{ frontend, httplog, tcplog, logFormat string }{
+		{"www", "on", "off", ""},
+		{"db", "off", "on", ""},
+		{"api", "off", "off", config.Frontends[2].LogFormat},
+	} {
+		got := [3]string{fake.FrontendConfig(tt.frontend, "option httplog"), fake.FrontendConfig(tt.frontend, "option tcplog"), fake.FrontendConfig(tt.frontend, "log-format")}
+		if want := [3]string{tt.httplog, tt.tcplog, tt.logFormat}; got != want {
+			t.Errorf("frontend[%s] の httplog / tcplog / log-format = %q, want %q（指定のない項目は解除すること）", tt.frontend, got, want)
+		}
+	}
+}
+
+func TestValidateLogFormat(t *testing.T) {
+	for format, valid := range map[string]bool{
+		"%ci:%cp [%tr] %ft %b/%s":    true,
+		"%{+Q}o %[req.hdr(host)] %%": true,
+		"%{+Q}[capture.req.hdr(0)]":  true,
+		"%ci %unknown":               false,
+		"100% done":                  false,
+		"%[req.hdr(host)":            false,
+		"%{+Q %ci":                   false,
+		"%ci\n%cp":                   false,
+	} {
+		if err := validateLogFormat(format); (err == nil) != valid {
+			t.Errorf("validateLogFormat(%q) = %v, want 有効 %v", format, err, valid)
+		}
+	}
+}
+
+func TestValidateFrontendLogging(t *testing.T) {
+	for name, frontend := range map[string]FrontendConfig{
+		"名前なし":                 {HTTPLog: true},
+		"httplog と tcplog":     {Name: "www", HTTPLog: true, TCPLog: true},
+		"log_format と httplog": {Name: "www", HTTPLog: true, LogFormat: "%ci"},
+		"不正な log_format":       {Name: "www", LogFormat: "%zz"},
+	} {
+		if err := frontend.validate(); err == nil {
+			t.Errorf("%s の frontend の検証がエラーになりませんでした", name)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logOutput は処理状況の出力先です。-output が指定された場合はファイルに切り替わります
+var logOutput io.Writer = os.Stdout
+
+// jsonLogEnabled が true の場合、ログを1行1イベントのJSON（JSON Lines）で出力します
+var jsonLogEnabled bool
+
+// quietLog が true の場合、logf による処理状況のメッセージを出力しません（-quiet）
+var quietLog bool
+
+// logMu は、並列処理からのログ出力が行単位で混ざらないようにするためのロックです
+var logMu sync.Mutex
+
+// logf は、処理状況のメッセージを出力先に書き出します
+func logf(format string, args ...interface{}) {
+	if quietLog {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if jsonLogEnabled {
+		logEvent("info", msg, nil)
+		return
+	}
+	logMu.Lock()
+	defer logMu.Unlock()
+	io.WriteString(logOutput, msg)
+}
+
+// logEvent は、1つのイベントをJSONオブジェクト1行として出力先に即座に書き出します。
+// time, level, message は常に含まれ、fields の内容は同じ階層に追加されます
+func logEvent(level, message string, fields map[string]interface{}) {
+	event := make(map[string]interface{}, len(fields)+3)
+	for k, v := range fields {
+		event[k] = v
+	}
+	event["time"] = time.Now().Format(time.RFC3339Nano)
+	event["level"] = level
+	event["message"] = strings.TrimRight(message, "\n")
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{"time": event["time"].(string), "level": "error", "message": err.Error()})
+	}
+	// バッファリングせず、1イベントを1回の書き込みで出力する
+	logMu.Lock()
+	defer logMu.Unlock()
+	logOutput.Write(append(line, '\n'))
+}
+
+// jsonLogWriter は、標準の log パッケージの出力をJSONイベントに変換する io.Writer です。
+// "警告: " で始まるメッセージは warn、それ以外は error として出力します
+type jsonLogWriter struct{}
+
+func (jsonLogWriter) Write(p []byte) (int, error) {
+	msg := string(p)
+	level := "error"
+	if strings.HasPrefix(msg, "警告: ") {
+		level = "warn"
+		msg = strings.TrimPrefix(msg, "警告: ")
+	}
+	logEvent(level, msg, nil)
+	return len(p), nil
+}
+
+// setupJSONLog は、ログ全体をJSON Lines形式に切り替えます
+func setupJSONLog() {
+	jsonLogEnabled = true
+	log.SetFlags(0)
+	log.SetOutput(jsonLogWriter{})
+}
+
+// rotatingWriter は、ファイルサイズが上限を超えたときにローテーションするログ出力先です。
+// 複数のゴルーチンから同時に書き込まれても安全です
+type rotatingWriter struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64 // ローテーションするサイズ（バイト）。0以下ならローテーションしない
+	maxFiles int   // 保持するローテーション済みファイル数（path.1 〜 path.N）
+	file     *os.File
+	size     int64
+}
+
+// newRotatingWriter は、指定したパスに追記するログ出力先を開きます
+func newRotatingWriter(path string, maxSize int64, maxFiles int) (*rotatingWriter, error) {
+	w := &rotatingWriter{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// open は、ログファイルを追記モードで開き、現在のサイズを記録します
+func (w *rotatingWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+// Write は、必要に応じてローテーションしてからログを書き込みます。
+// ローテーションに失敗した場合も元のファイルへの書き込みを続け、ローテーションのエラーを返します
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var rotateErr error
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			rotateErr = fmt.Errorf("ログファイルのローテーションに失敗: %w", err)
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// rotate は、path.N-1 → path.N のように既存ファイルを1つずつずらし、新しいファイルを開き直します。
+// 保持数を超えた最も古いファイルは削除されます。名前の変更に失敗した場合は元のパスを開き直してからエラーを返します
+func (w *rotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if err := w.shiftFiles(); err != nil {
+		if openErr := w.open(); openErr != nil {
+			return fmt.Errorf("%v（ログファイルを開き直せません: %v）", err, openErr)
+		}
+		return err
+	}
+	return w.open()
+}
+
+// shiftFiles は、ローテーション済みのファイルの番号を1つずつずらし、現在のファイルを path.1 にします
+// （maxFiles が 0 の場合は現在のファイルを削除します）
+func (w *rotatingWriter) shiftFiles() error {
+	if w.maxFiles <= 0 {
+		return os.Remove(w.path)
+	}
+	os.Remove(fmt.Sprintf("%s.%d", w.path, w.maxFiles))
+	for i := w.maxFiles - 1; i >= 1; i-- {
+		src := fmt.Sprintf("%s.%d", w.path, i)
+		if _, err := os.Stat(src); err == nil {
+			if err := os.Rename(src, fmt.Sprintf("%s.%d", w.path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(w.path, w.path+".1")
+}
+
+// Close は、ログファイルを閉じます
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotatingWriterRotatesAndKeepsMaxFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "apply.log")
+	w, err := newRotatingWriter(path, 10, 2)
+	if err != nil {
+		t.Fatalf("newRotatingWriter がエラーを返しました: %v", err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{"first-1\n", "second\n", "third-3\n", "fourth\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write(%q) がエラーを返しました: %v", line, err)
+		}
+	}
+	for file, want := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third-3\n",
+		path + ".2": "second\n",
+	} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("%s を読み込めません: %v", filepath.Base(file), err)
+		}
+		if string(data) != want {
+			t.Errorf("%s の内容 = %q, want %q", filepath.Base(file), data, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("保持数（2）を超えたファイルが残っています: %v", err)
+	}
+}
+
+func TestRotatingWriterKeepsWritingWhenRenameFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apply.log")
+	// path.1 を空でないディレクトリにして、ローテーションの名前の変更を失敗させます
+	if err := os.MkdirAll(filepath.Join(path+".1", "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	w, err := newRotatingWriter(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if _, err := w.Write([]byte("first-1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("second\n")); err == nil {
+		t.Error("ローテーションに失敗した Write がエラーを返しませんでした")
+	}
+	if _, err := w.Write([]byte("third\n")); err == nil {
+		t.Error("ローテーションに再び失敗した Write がエラーを返しませんでした")
+	}
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != "first-1\nsecond\nthird\n" {
+		t.Errorf("ログファイルの内容 = %q, want すべての行（ローテーションの失敗後も書き込みを続けること）", data)
+	}
+
+	// 原因が解消すれば次の書き込みでローテーションします
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("fourth\n")); err != nil {
+		t.Fatalf("原因の解消後の Write がエラーを返しました: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "fourth\n" {
+		t.Errorf("ローテーション後のログファイルの内容 = %q, want %q", data, "fourth\n")
+	}
+}
+
+func TestRotatingWriterAppendsToExistingFile(t *testing.T) {
+	path := writeTestFile(t, "apply.log", "前回の実行\n")
+	w, err := newRotatingWriter(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("今回の実行\n"))
+	w.Close()
+	data, _ := ioutil.ReadFile(path)
+	if !strings.HasPrefix(string(data), "前回の実行\n") || !strings.HasSuffix(string(data), "今回の実行\n") {
+		t.Errorf("ログファイルの内容 = %q, want 既存の内容に追記すること", data)
+	}
+}
+
+func TestJSONLogWritesOneEventPerLine(t *testing.T) {
+	logs, _ := captureOutput(t)
+	setupJSONLog()
+	t.Cleanup(func() { jsonLogEnabled = false })
+
+	// 並列に出力しても、各行が1つの完全なJSONオブジェクトになること
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			logf("サーバー[web-%d]を追加しました\n", i)
+		}(i)
+	}
+	wg.Wait()
+	warnf("ホスト名[%s]を名前解決できません", "db.internal")
+
+	levels := map[string]int{}
+	scanner := bufio.NewScanner(logs)
+	for scanner.Scan() {
+		var event map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("JSONとして解釈できない行があります: %q: %v", scanner.Text(), err)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, fmt.Sprint(event["time"])); err != nil {
+			t.Errorf("time = %v, want RFC 3339 の時刻", event["time"])
+		}
+		if msg := fmt.Sprint(event["message"]); strings.HasSuffix(msg, "\n") || strings.HasPrefix(msg, "警告: ") {
+			t.Errorf("message = %q, want 改行と「警告: 」を除いたメッセージ", msg)
+		}
+		levels[fmt.Sprint(event["level"])]++
+	}
+	if levels["info"] != 20 || levels["warn"] != 1 || len(levels) != 2 {
+		t.Errorf("イベントの level ごとの件数 = %v, want info 20 件、warn 1 件", levels)
+	}
+}
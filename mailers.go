@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// MailerConfig はHAProxyの mailers セクションと、それを使うメール通知（email-alert）の設定を表します。
+// groups の email_alert でこのセクションを指定したバックエンドで、サーバーの状態変化をメールで通知します
+type MailerConfig struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`         // 送信に使うSMTPサーバー（"host:port" 形式、記載順に smtp1, smtp2, ... ）
+	From    string   `json:"from"`            // 送信元のメールアドレス
+	To      string   `json:"to"`              // 送信先のメールアドレス
+	Level   string   `json:"level,omitempty"` // 通知するログレベル（未指定時は HAProxy 既定の alert）
+}
+
+// emailAlertLevels は、email-alert level に指定できるログレベルです
+var emailAlertLevels = map[string]bool{
+	"emerg":   true,
+	"alert":   true,
+	"crit":    true,
+	"err":     true,
+	"warning": true,
+	"notice":  true,
+	"info":    true,
+	"debug":   true,
+}
+
+// validate は、mailers セクションの設定値を検証します
+func (m MailerConfig) validate() error {
+	if m.Name == "" {
+		return errors.New("name が指定されていません")
+	}
+	if len(m.Members) == 0 {
+		return errors.New("members にSMTPサーバーを1つ以上指定してください")
+	}
+	for _, member := range m.Members {
+		if _, _, err := parseMailer(member); err != nil {
+			return err
+		}
+	}
+	for _, a := range []struct{ name, value string }{
+		{"from", m.From},
+		{"to", m.To},
+	} {
+		if err := validateMailAddress(a.value); err != nil {
+			return fmt.Errorf("%s が不正です: %w", a.name, err)
+		}
+	}
+	if m.Level != "" && !emailAlertLevels[m.Level] {
+		return fmt.Errorf("level[%s]は未対応です（emerg, alert, crit, err, warning, notice, info, debug のいずれか）", m.Level)
+	}
+	return nil
+}
+
+// parseMailer は、"host:port" 形式のSMTPサーバーのアドレスをホストとポートに分けます
+func parseMailer(member string) (string, int, error) {
+	host, p, err := net.SplitHostPort(member)
+	if err != nil || host == "" {
+		return "", 0, fmt.Errorf("members[%s]は \"host:port\" 形式で指定してください（例: smtp.example.com:25）", member)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("members[%s]のポートは 1〜65535 の範囲で指定してください", member)
+	}
+	return host, port, nil
+}
+
+// validateMailAddress は、表示名や山括弧を含まない1つのメールアドレス（alerts@example.com など）であることを確認します
+func validateMailAddress(address string) error {
+	if address == "" {
+		return errors.New("メールアドレスが指定されていません")
+	}
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address || strings.ContainsAny(address, " \t") {
+		return fmt.Errorf("メールアドレス[%s]は alerts@example.com の形式で指定してください", address)
+	}
+	return nil
+}
+
+// findMailer は、名前に一致する mailers の設定を返します。定義されていなければ nil を返します
+func findMailer(config *Config, name string) *MailerConfig {
+	for i := range config.Mailers {
+		if config.Mailers[i].Name == name {
+			return &config.Mailers[i]
+		}
+	}
+	return nil
+}
+
+// buildMailers は、mailers の設定から HAProxy の mailers セクションの定義を組み立てます（検証済みであること）
+func buildMailers(m MailerConfig) haproxy.MailersSection {
+	section := haproxy.MailersSection{Name: m.Name}
+	for i, member := range m.Members {
+		host, port, _ := parseMailer(member)
+		section.Mailers = append(section.Mailers, haproxy.Mailer{Name: fmt.Sprintf("smtp%d", i+1), Address: host, Port: port})
+	}
+	return section
+}
+
+// mailersMatches は、現在の mailers セクションが設定から組み立てた定義と一致するかを返します
+func mailersMatches(current, desired haproxy.MailersSection) bool {
+	if len(current.Mailers) != len(desired.Mailers) {
+		return false
+	}
+	for i := range current.Mailers {
+		if current.Mailers[i] != desired.Mailers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// emailAlertDirectives は、バックエンドに設定する email-alert のキーと値の組を返します
+func emailAlertDirectives(m MailerConfig) [][2]string {
+	directives := [][2]string{
+		{"email-alert mailers", m.Name},
+		{"email-alert from", m.From},
+		{"email-alert to", m.To},
+	}
+	if m.Level != "" {
+		directives = append(directives, [2]string{"email-alert level", m.Level})
+	}
+	return directives
+}
+
+// emailAlertGroups は、email_alert を指定したグループ（削除対象を除く）を定義順に返します
+func emailAlertGroups(config *Config) []GroupConfig {
+	var groups []GroupConfig
+	for _, g := range config.Groups {
+		if g.EmailAlert != "" && !g.absent() {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// applyMailers は、mailers セクションを作成し、内容が異なる場合は更新したうえで、
+// email_alert を指定したグループのバックエンドにメール通知（email-alert）を設定します
+func applyMailers(client haproxyClient, config *Config) error {
+	if len(config.Mailers) == 0 {
+		return nil
+	}
+	current, err := client.GetMailers()
+	if err != nil {
+		return fmt.Errorf("現在の mailers の取得に失敗: %w", err)
+	}
+	existing := make(map[string]haproxy.MailersSection, len(current))
+	for _, m := range current {
+		existing[m.Name] = m
+	}
+
+	for _, m := range config.Mailers {
+		desired := buildMailers(m)
+		cur, ok := existing[m.Name]
+		switch {
+		case !ok:
+			if err := client.AddMailers(&desired); err != nil {
+				return fmt.Errorf("mailers[%s]の作成失敗: %w", m.Name, err)
+			}
+			logf("mailers[%s]を作成しました\n", m.Name)
+		case mailersMatches(cur, desired):
+			logf("mailers[%s]は既に同じ内容のためスキップしました\n", m.Name)
+		default:
+			if err := client.UpdateMailers(&desired); err != nil {
+				return fmt.Errorf("mailers[%s]の更新失敗: %w", m.Name, err)
+			}
+			logf("mailers[%s]を更新しました\n", m.Name)
+		}
+	}
+
+	for _, g := range emailAlertGroups(config) {
+		m := findMailer(config, g.EmailAlert)
+		for _, d := range emailAlertDirectives(*m) {
+			if err := client.SetBackendConfig(g.Name, d[0], d[1]); err != nil {
+				return fmt.Errorf("バックエンド[%s]の %s の設定失敗: %w", g.Name, d[0], err)
+			}
+		}
+		logf("バックエンド[%s]でメール通知を有効にしました（mailers[%s], 送信先 %s）\n", g.Name, m.Name, m.To)
+	}
+	return nil
+}
+
+// mailerLines は、mailers セクションの定義を haproxy.cfg の mailers セクションの各行に変換します
+func mailerLines(m haproxy.MailersSection) []string {
+	lines := make([]string, 0, len(m.Mailers))
+	for _, mailer := range m.Mailers {
+		lines = append(lines, fmt.Sprintf("mailer %s %s", mailer.Name, net.JoinHostPort(mailer.Address, strconv.Itoa(mailer.Port))))
+	}
+	return lines
+}
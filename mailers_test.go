@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// mailersTestConfig は、mailers セクションと、それを email_alert で使う web グループを持つ設定です
+func mailersTestConfig(t *testing.T, members string) *Config {
+	t.Helper()
+	return loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://mailers"],
+		"load_balancing_algorithm": "roundrobin",
+		"mailers": [{"name": "ops", "members": `+members+`, "from": "haproxy@example.com", "to": "ops@example.com", "level": "warning"}],
+		"groups": [{"name": "web", "email_alert": "ops"}, {"name": "api"}],
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "api-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "api"}
+		]
+	}`)
+}
+
+func TestApplyMailers(t *testing.T) {
+	captureOutput(t)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, mailersTestConfig(t, `["smtp1.example.com:25", "10.0.0.25:587"]`), applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	sections, _ := fake.GetMailers()
+	want := []haproxy.Mailer{{Name: "smtp1", Address: "smtp1.example.com", Port: 25}, {Name: "smtp2", Address: "10.0.0.25", Port: 587}}
+	if len(sections) != 1 || sections[0].Name != "ops" || len(sections[0].Mailers) != 2 || sections[0].Mailers[0] != want[0] || sections[0].Mailers[1] != want[1] {
+		t.Fatalf("作成した mailers = %+v, want ops（smtp1, smtp2）", sections)
+	}
+	for key, want := range map[string]string{
+		"email-alert mailers": "ops",
+		"email-alert from":    "haproxy@example.com",
+		"email-alert to":      "ops@example.com",
+		"email-alert level":   "warning",
+	} {
+		if got := fake.BackendConfig("web", key); got != want {
+			t.Errorf("web の %s = %q, want %q", key, got, want)
+		}
+		if got := fake.BackendConfig("api", key); got != "" {
+			t.Errorf("api の %s = %q, want 未設定（email_alert のないグループ）", key, got)
+		}
+	}
+
+	if _, err := applyConfig(fake, mailersTestConfig(t, `["smtp2.example.com:25"]`), applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if sections, _ := fake.GetMailers(); len(sections) != 1 || len(sections[0].Mailers) != 1 || sections[0].Mailers[0].Address != "smtp2.example.com" {
+		t.Errorf("変更後の mailers = %+v, want smtp2.example.com のみに更新", sections)
+	}
+}
+
+func TestValidateMailers(t *testing.T) {
+	valid := MailerConfig{Name: "ops", Members: []string{"smtp.example.com:25"}, From: "haproxy@example.com", To: "ops@example.com"}
+	if err := valid.validate(); err != nil {
+		t.Fatalf("正しい mailers の検証がエラーになりました: %v", err)
+	}
+	for name, modify := range map[string]func(*MailerConfig){
+		"名前なし":        func(m *MailerConfig) { m.Name = "" },
+		"members なし":  func(m *MailerConfig) { m.Members = nil },
+		"ポートなし":       func(m *MailerConfig) { m.Members = []string{"smtp.example.com"} },
+		"範囲外のポート":     func(m *MailerConfig) { m.Members = []string{"smtp.example.com:0"} },
+		"表示名付きの from": func(m *MailerConfig) { m.From = "HAProxy <haproxy@example.com>" },
+		"不正な to":      func(m *MailerConfig) { m.To = "ops" },
+		"不正な level":   func(m *MailerConfig) { m.Level = "warn" },
+	} {
+		m := valid
+		modify(&m)
+		if err := m.validate(); err == nil {
+			t.Errorf("%s の mailers の検証がエラーになりませんでした", name)
+		}
+	}
+
+	err := validateTestConfig(t, `{
+		"haproxy_endpoint": ["memory://mailers"],
+		"load_balancing_algorithm": "roundrobin",
+		"groups": [{"name": "web", "email_alert": "missing"}],
+		"backends": []
+	}`)
+	if err == nil {
+		t.Error("未定義の mailers を参照する email_alert の検証がエラーになりませんでした")
+	}
+}
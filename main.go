@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/haproxytech/client-go/v2/haproxy"
 )
@@ -13,12 +17,74 @@ import (
 // Config はHAProxy接続情報、バックエンドサーバー設定に加え、
 // ヘルスチェックおよび再接続ポリシーの設定を含みます
 type Config struct {
-	HaproxyEndpoint        string             `json:"haproxy_endpoint"`
-	APIKey                 string             `json:"api_key"`
-	LoadBalancingAlgorithm string             `json:"load_balancing_algorithm"`
-	Backends               []BackendConfig    `json:"backends"`
-	HealthCheck            HealthCheckConfig  `json:"health_check"`
-	RetryPolicy            RetryPolicyConfig  `json:"retry_policy"`
+	APIVersion             string            `json:"apiVersion,omitempty"` // 設定ファイルのスキーマのバージョン（未指定時は v1 として移行）
+	HaproxyEndpoint        endpointList      `json:"haproxy_endpoint"`     // 1つまたは複数のHAProxyインスタンス
+	APIKey                 string            `json:"api_key"`
+	APIBasePath            string            `json:"api_base_path,omitempty"` // Data Plane API のベースパス（/v2 または /v3、未指定時はエンドポイントの URL のまま）
+	LoadBalancingAlgorithm string            `json:"load_balancing_algorithm"`
+	LoadBalancingParam     string            `json:"load_balancing_param,omitempty"` // url_param / hdr / hash などの引数（例: "sessionid"、"Host"）
+	Backends               []BackendConfig   `json:"backends"`
+	Groups                 []GroupConfig     `json:"groups"`            // バックエンドグループ間の依存関係
+	Resolvers              []ResolverConfig  `json:"resolvers"`         // server-template などが参照する resolvers セクション
+	Mailers                []MailerConfig    `json:"mailers,omitempty"` // メール通知（email-alert）に使う mailers セクション
+	Caches                 []CacheConfig     `json:"caches,omitempty"`  // 静的なレスポンスのキャッシュに使う cache セクション
+	Peers                  []PeersConfig     `json:"peers,omitempty"`   // stick-table の共有に使う peers セクション
+	HealthCheck            HealthCheckConfig `json:"health_check"`
+	HTTPRules              []HTTPRuleConfig  `json:"http_rules,omitempty"` // frontend / backend のヘッダー操作ルール
+	Frontends              []FrontendConfig  `json:"frontends,omitempty"`  // frontend 単位の設定（ログの形式）
+	RetryPolicy            RetryPolicyConfig `json:"retry_policy"`
+	Hooks                  []string          `json:"hooks"`               // 適用前後に実行する組み込みフック名
+	DisabledAlgorithms     []string          `json:"disabled_algorithms"` // 使用を禁止するロードバランシングアルゴリズム
+
+	// WeightsFile はオートスケーラーなどが書き出す weight の上書き用ファイル（サーバー名 → weight のJSON）です。
+	// 読み込みのたびに反映されるため、-repeat では各サイクルで最新の weight が使われます
+	WeightsFile string `json:"weights_file,omitempty"`
+
+	// MaxApplyDuration は適用全体の所要時間の上限（"10m" などの期間表記）です。上限を過ぎると新しい操作を開始せず、
+	// 実行中の操作の完了を待って、適用しなかった操作をレポートに記録して終了コード 4 で終了します
+	MaxApplyDuration string `json:"max_apply_duration,omitempty"`
+
+	// CriticalFeatures は、-degrade-unsupported 指定時に機能（"stick-table" など）が未対応だった場合、
+	// 適用を中止する（true）か、その設定を除いて適用を続ける（false）かの指定です
+	CriticalFeatures map[string]bool `json:"critical_features,omitempty"`
+
+	// Vars は文字列項目の ${VAR} で参照できる変数です（同名の環境変数が優先されます）
+	Vars map[string]string `json:"vars,omitempty"`
+}
+
+// endpointList はHAProxy APIのエンドポイントの一覧です。
+// 設定ファイルでは1つの文字列と文字列の配列のどちらでも指定できます
+type endpointList []string
+
+// UnmarshalJSON は、文字列または文字列の配列をエンドポイントの一覧として読み込みます
+func (e *endpointList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*e = nil
+		if single != "" {
+			*e = endpointList{single}
+		}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("haproxy_endpoint には文字列または文字列の配列を指定してください: %w", err)
+	}
+	*e = list
+	return nil
+}
+
+// MarshalJSON は、エンドポイントが1つの場合は文字列、複数の場合は配列として書き出します
+func (e endpointList) MarshalJSON() ([]byte, error) {
+	if len(e) == 1 {
+		return json.Marshal(e[0])
+	}
+	return json.Marshal([]string(e))
+}
+
+// String は、エンドポイントをカンマ区切りで返します
+func (e endpointList) String() string {
+	return strings.Join(e, ",")
 }
 
 // BackendConfig は各バックエンドサーバーの設定を表します
@@ -26,7 +92,147 @@ type BackendConfig struct {
 	Name   string `json:"name"`
 	IP     string `json:"ip"`
 	Port   int    `json:"port"`
+	Socket string `json:"socket,omitempty"` // ip / port の代わりに接続する unix ソケットのパス
 	Weight int    `json:"weight"`
+	Group  string `json:"group"` // 所属するHAProxyバックエンド（グループ）名
+
+	Tags []string `json:"tags,omitempty"` // -tag / -exclude-tag で適用対象を絞り込むためのタグ
+
+	// Order は適用する順序です。小さい順に適用し、同じ値（未指定は 0）のサーバーは設定ファイルでの登場順とします。
+	// グループの順序は所属するサーバーの最小の order で決まりますが、depends_on の依存関係が優先されます
+	Order int `json:"order,omitempty"`
+
+	// Algorithm を指定すると、所属するグループのみ全体の load_balancing_algorithm の代わりに使用します
+	Algorithm      string `json:"algorithm,omitempty"`
+	AlgorithmParam string `json:"algorithm_param,omitempty"` // algorithm の引数（load_balancing_param と同様）
+
+	Maxconn int    `json:"maxconn,omitempty"` // サーバーへの最大同時接続数（0は無制限）
+	Source  string `json:"source,omitempty"`  // サーバーへ接続する際の送信元アドレス（"10.0.0.5" または "10.0.0.5:0" 形式）
+
+	// RetryOn と Fullconn は所属するグループ（バックエンド）単位で設定されるため、同じグループでは同じ値を指定します。
+	// 指定しない場合、バックエンドの retry-on / fullconn は変更しません
+	RetryOn  []string `json:"retry_on,omitempty"` // リトライする条件（例: ["conn-failure", "503"]）
+	Fullconn int      `json:"fullconn,omitempty"` // minconn からの動的な maxconn の計算に使う、バックエンド全体の接続数
+
+	// Websocket を指定すると、websocket 向けの推奨設定（backendtuning.go の websocketHTTPReuse など）を適用します。
+	// http_reuse / tunnel_timeout / alpn を指定した場合は、その項目のみ推奨設定より優先します
+	Websocket     bool   `json:"websocket,omitempty"`
+	HTTPReuse     string `json:"http_reuse,omitempty"`     // バックエンドの接続の再利用（never, safe, aggressive, always）
+	TunnelTimeout string `json:"tunnel_timeout,omitempty"` // Upgrade 後の接続の無通信タイムアウト（HAProxy の時間表記、例: "1h"）
+
+	// SRV を指定すると、固定のサーバーの代わりに DNS SRV レコードから解決する server-template を作成します。
+	// その場合 name はサーバー名のプレフィックスとなり、ip / port は指定しません
+	SRV      string `json:"srv,omitempty"`      // SRVレコード名（例: "_http._tcp.api.service.consul"）
+	Resolver string `json:"resolver,omitempty"` // 名前解決に使う resolvers セクション名
+	Count    int    `json:"count,omitempty"`    // 作成するサーバーの台数
+
+	// ID はサーバーの固定の数値ID（HAProxyの id オプション）です。指定すると、名前を変更しても
+	// 同じIDのサーバーを更新（名前の変更）し、削除と追加による統計情報の途切れを防ぎます
+	ID int `json:"id,omitempty"`
+
+	// 運用上のメタデータ（HAProxyの動作には影響せず、ログ・レポート・render の出力にのみ含まれます）
+	Description string `json:"description,omitempty"` // 用途などの説明
+	Owner       string `json:"owner,omitempty"`       // 担当チームなどの管理者
+
+	// Labels は、サーバーのメタデータとして HAProxy に設定するラベルです（サービスメッシュなどがインスタンスの対応付けに使います）。
+	// Data Plane API の接続先でのみ設定でき、レポートにも含まれます
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// バックエンドへの接続にTLSを使う場合の設定
+	SSL    bool     `json:"ssl,omitempty"`    // バックエンド側のTLSを有効にするかどうか
+	ALPN   []string `json:"alpn,omitempty"`   // ALPNでネゴシエーションするプロトコル（例: ["h2", "http/1.1"]）
+	NPN    []string `json:"npn,omitempty"`    // NPNでネゴシエーションするプロトコル（旧方式、非推奨のため alpn を使用してください）
+	Verify string   `json:"verify,omitempty"` // サーバー証明書の検証（none または required）
+	SNI    string   `json:"sni,omitempty"`    // SNIに使うサンプル取得式（例: "str(api.example.com)"）
+
+	// バックエンドがクライアント証明書を要求する場合（mTLS）の証明書と秘密鍵のパス（HAProxyの crt オプション）。
+	// 秘密鍵を別ファイルにする場合、HAProxy は証明書のパスに .key を付けたファイルを読み込むため、その名前で配置します
+	SSLClientCert string `json:"ssl_client_cert,omitempty"` // クライアント証明書（PEM。秘密鍵を含めても可）
+	SSLClientKey  string `json:"ssl_client_key,omitempty"`  // クライアント証明書の秘密鍵（ssl_client_cert + ".key"）
+
+	// サーバーへの接続時に PROXY プロトコルのヘッダーを送る場合の設定
+	SendProxy      string   `json:"send_proxy,omitempty"`       // PROXY プロトコルのバージョン（v1 または v2）
+	ProxyV2Options []string `json:"proxy_v2_options,omitempty"` // v2 で転送する TLV（例: ["authority", "crc32c"]）
+
+	// HealthCheck を指定すると、指定した項目のみ全体のヘルスチェック設定を上書きします
+	HealthCheck *HealthCheckOverride `json:"health_check,omitempty"`
+
+	// Track を指定すると、自身ではヘルスチェックを行わず、参照するサーバーの状態に追従します（HAProxy の track オプション）。
+	// "backend/server" の形式で指定し、同じグループのサーバーはサーバー名のみでも指定できます
+	Track string `json:"track,omitempty"`
+}
+
+// GroupConfig はバックエンドグループの設定を表します
+type GroupConfig struct {
+	Name      string       `json:"name"`
+	DependsOn []string     `json:"depends_on"`      // 先に適用しておく必要があるグループ名
+	Stick     *StickConfig `json:"stick,omitempty"` // stick-table による永続化設定
+	Mode      string       `json:"mode,omitempty"`  // バックエンドのモード（tcp または http）
+	State     string       `json:"state,omitempty"` // absent を指定するとバックエンドをサーバーごと削除します（既定は present）
+
+	// MinServers は -prune 後も残すサーバー数の下限です（未指定時は 1、0 で制限なし）。
+	// 下回る場合はそのバックエンドのサーバーを削除しません（-force で無視）
+	MinServers *int `json:"min_servers,omitempty"`
+
+	// Weight はグループ内のサーバーの weight の既定値です。weight を指定していない（0 の）サーバーに使われ、
+	// サーバー側で指定した weight が常に優先されます（defaults の weight とは同時に指定できません）
+	Weight *int `json:"weight,omitempty"`
+
+	// EmailAlert は、サーバーの状態変化をメールで通知する場合に使う mailers の名前です
+	EmailAlert string `json:"email_alert,omitempty"`
+
+	// Cache は、このバックエンドのレスポンスをキャッシュする場合に使う cache の名前です（mode http のみ）
+	Cache string `json:"cache,omitempty"`
+
+	// HTTPReuse は、このバックエンドの接続の再利用（never, safe, aggressive, always）です。
+	// 未指定時は HAProxy の既定（safe）のままで、サーバー側で指定した http_reuse とは同じ値である必要があります
+	HTTPReuse string `json:"http_reuse,omitempty"`
+
+	// Defaults はグループ内の全サーバーに適用する既定値（haproxy.cfg の default-server 相当）です
+	Defaults *ServerDefaults `json:"defaults,omitempty"`
+}
+
+// ServerDefaults はグループ内のサーバーに共通する既定値です。
+// 未指定（null）の項目は既定値を持たず、サーバー側で指定した値が常に優先されます
+type ServerDefaults struct {
+	Check    *bool `json:"check,omitempty"`    // ヘルスチェックを有効にするかどうか
+	Interval *int  `json:"interval,omitempty"` // チェック間隔（秒単位）
+	Fall     *int  `json:"fall,omitempty"`     // 連続失敗回数の閾値
+	Rise     *int  `json:"rise,omitempty"`     // 復帰と判断する連続成功回数
+	Weight   *int  `json:"weight,omitempty"`   // 重み（サーバーの weight が 0 の場合に使用）
+	Maxconn  *int  `json:"maxconn,omitempty"`  // 最大同時接続数（サーバーの maxconn が 0 の場合に使用）
+}
+
+// HTTPRuleConfig は http-request / http-response によるヘッダー操作ルールを表します
+type HTTPRuleConfig struct {
+	Scope     string `json:"scope"`           // ルールを設定するセクション（frontend または backend）
+	Name      string `json:"name"`            // frontend / backend 名
+	Direction string `json:"direction"`       // request（http-request）または response（http-response）
+	Type      string `json:"type"`            // set-header, add-header, del-header のいずれか
+	Header    string `json:"header"`          // 対象のヘッダー名
+	Value     string `json:"value,omitempty"` // 設定する値（ログ形式の変数も使用可、del-header では指定しない）
+	Cond      string `json:"cond,omitempty"`  // 適用条件（例: "if { ssl_fc }"）
+}
+
+// ResolverConfig はHAProxyの resolvers セクションを表します。
+// nameservers を指定した場合のみ適用時に作成・更新し、省略した場合は既存のセクションを参照するのみとします
+type ResolverConfig struct {
+	Name        string   `json:"name"`
+	Nameservers []string `json:"nameservers,omitempty"` // 問い合わせ先のDNSサーバー（"ip:port" 形式）
+
+	ResolveRetries int    `json:"resolve_retries,omitempty"` // 問い合わせを諦めるまでの再試行回数
+	TimeoutResolve string `json:"timeout_resolve,omitempty"` // 名前解決を行う間隔（"1s" などの期間表記）
+	TimeoutRetry   string `json:"timeout_retry,omitempty"`   // 応答がない場合に再試行するまでの時間
+	HoldValid      string `json:"hold_valid,omitempty"`      // 解決結果を有効とみなす時間
+}
+
+// StickConfig はバックエンドの stick-table とその参照キーの設定を表します
+type StickConfig struct {
+	Type   string `json:"type"`            // テーブルのキーの型（ip, ipv6, integer, string, binary）
+	Size   string `json:"size"`            // 最大エントリ数（例: "200k"）
+	Expire string `json:"expire"`          // エントリの有効期限（例: "30m"）
+	On     string `json:"on"`              // stick on に指定するサンプル取得式（例: "src"）
+	Peers  string `json:"peers,omitempty"` // テーブルの内容を同期する peers セクションの名前
 }
 
 // HealthCheckConfig はヘルスチェックの設定値を保持します
@@ -35,6 +241,45 @@ type HealthCheckConfig struct {
 	Interval int  `json:"interval"` // チェック間隔（秒単位）
 	Fall     int  `json:"fall"`     // 連続失敗回数の閾値
 	Rise     int  `json:"rise"`     // 復帰と判断する連続成功回数
+
+	// チェックの種類（tcp または http）。未指定の場合はグループの mode から決定します
+	Type string `json:"type,omitempty"`
+
+	// LogHealthChecks を有効にすると、各バックエンドで option log-health-checks を設定し、
+	// ヘルスチェックによる状態変化をHAProxyのログに出力させます（全体の設定でのみ指定できます）
+	LogHealthChecks bool `json:"log_health_checks,omitempty"`
+
+	// 状態に応じたチェック間隔（"500ms", "2s" などの期間表記、未指定なら interval を使用）
+	Downinter string `json:"downinter,omitempty"` // サーバーがDOWNのときのチェック間隔
+	Fastinter string `json:"fastinter,omitempty"` // 状態が遷移中（UP/DOWN判定途中）のときのチェック間隔
+
+	// tcp チェックで送信する文字列と、応答に含まれることを期待する文字列（例: "PING\r\n" と "+PONG"）。
+	// バックエンド単位の tcp-check send / tcp-check expect string として設定します
+	CheckSend   string `json:"check_send,omitempty"`
+	CheckExpect string `json:"check_expect,omitempty"`
+
+	// ヘルスチェックの送信先（サーバーの addr / port オプション）。未指定の場合はサーバー自身のアドレスとポートです。
+	// HAProxyのサーバーごとのチェック先は1つのため、複数のアドレスやポートは指定できません
+	Address string `json:"address,omitempty"`
+	Port    int    `json:"port,omitempty"`
+}
+
+// HealthCheckOverride はサーバー個別のヘルスチェック設定です。
+// 未指定（null）の項目は全体の health_check（およびグループの defaults）の値を引き継ぎます
+type HealthCheckOverride struct {
+	Enabled   *bool   `json:"enabled,omitempty"`
+	Interval  *int    `json:"interval,omitempty"`
+	Fall      *int    `json:"fall,omitempty"`
+	Rise      *int    `json:"rise,omitempty"`
+	Type      *string `json:"type,omitempty"`
+	Downinter *string `json:"downinter,omitempty"`
+	Fastinter *string `json:"fastinter,omitempty"`
+
+	CheckSend   *string `json:"check_send,omitempty"`
+	CheckExpect *string `json:"check_expect,omitempty"`
+
+	Address *string `json:"address,omitempty"`
+	Port    *int    `json:"port,omitempty"`
 }
 
 // RetryPolicyConfig は再接続（リトライ）ポリシーの設定を保持します
@@ -44,122 +289,353 @@ type RetryPolicyConfig struct {
 }
 
 func main() {
-	// JSON形式の設定ファイルを読み込みます
-	config, err := loadConfig("config.json")
+	// サブコマンドはフラグの前後どちらにも指定できます（省略時は apply）
+	command, err := parseCommandLine(flag.CommandLine, os.Args[1:])
 	if err != nil {
-		log.Fatalf("設定ファイルの読み込みに失敗: %v", err)
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
 	}
 
-	// HAProxyクライアントの初期化（接続テスト付き）
-	client, err := newHAProxyClient(config.HaproxyEndpoint, config.APIKey)
-	if err != nil {
-		log.Fatalf("HAProxyクライアントの初期化に失敗: %v", err)
+	// -output 指定時はログをファイルへ出力します（サイズ指定時はローテーション付き）
+	if *outputFlag != "" {
+		w, err := newRotatingWriter(*outputFlag, int64(*outputMaxSizeFlag)*1024*1024, *outputMaxFilesFlag)
+		if err != nil {
+			log.Fatalf("ログファイル[%s]を開けません: %v", *outputFlag, err)
+		}
+		defer w.Close()
+		logOutput = w
+		log.SetOutput(w)
+	}
+
+	// ログ形式の切り替え（json の場合は log パッケージの出力もJSONイベントにする）
+	switch *logFormatFlag {
+	case "text":
+	case "json":
+		setupJSONLog()
+	default:
+		log.Fatalf("-log-format には text または json を指定してください（指定値: %s）", *logFormatFlag)
+	}
+	// -json-errors 指定時は、エラーのみを通常のログと分けてJSONで標準エラー出力に書き出します
+	if *jsonErrorsFlag {
+		setupJSONErrors()
+	}
+
+	// 適用結果の出力形式と、処理状況のメッセージの抑制
+	switch *resultFormatFlag {
+	case "text", "env":
+	default:
+		log.Fatalf("-format には text または env を指定してください（指定値: %s）", *resultFormatFlag)
+	}
+	switch *planFormatFlag {
+	case planFormatText, planFormatMarkdown:
+	default:
+		log.Fatalf("-plan-format には %s または %s を指定してください（指定値: %s）", planFormatText, planFormatMarkdown, *planFormatFlag)
+	}
+	// -nagios では監視ツールが1行の出力を解釈するため、処理状況のメッセージを出力しません
+	if *nagiosFlag && command != "health" && command != "doctor" {
+		log.Fatalf("-nagios は health と doctor でのみ指定できます（指定されたサブコマンド: %s）", command)
+	}
+	quietLog = *quietFlag || *nagiosFlag
+	if _, err := compileServerFilter(*serverFilterFlag); err != nil {
+		log.Fatal(err)
+	}
+	// -endpoint-from-discovery の接続先は起動時に1回だけ取得し、実行中はその値を使います
+	if err := resolveEndpointDiscovery(); err != nil {
+		fatalError(errorCategoryConfig, err)
 	}
 
-	// 設定ファイルに記載された各バックエンドサーバーを追加（リトライ付き）
-	for _, backend := range config.Backends {
-		server := haproxy.Server{
-			Name:   backend.Name,
-			IP:     backend.IP,
-			Port:   backend.Port,
-			Weight: int64(backend.Weight),
-			Check:  config.HealthCheck.Enabled,
+	// plan や doctor の色付け（ファイルへの出力やJSONログでは自動的に無効）
+	if *colorFlag && *noColorFlag {
+		log.Fatal("-color と -no-color は同時に指定できません")
+	}
+	colorEnabled = resolveColor(*colorFlag, *noColorFlag, os.Getenv, logOutput == io.Writer(os.Stdout) && !jsonLogEnabled && isTerminal(os.Stdout))
+
+	// -watch 指定時は、設定ファイルの変更を監視し、変更が落ち着くたびに適用します
+	if command == "apply" && *watchFlag {
+		switch {
+		case *repeatFlag > 0:
+			log.Fatal("-watch は -repeat と同時に指定できません")
+		case *interactiveFlag:
+			log.Fatal("-interactive は -watch と同時に指定できません")
+		case *watchIntervalFlag <= 0:
+			log.Fatal("-watch-interval には正の時間を指定してください")
 		}
-		// ヘルスチェックが有効な場合のパラメータを設定
-		if config.HealthCheck.Enabled {
-			server.Inter = fmt.Sprintf("%ds", config.HealthCheck.Interval)
-			server.Fall = config.HealthCheck.Fall
-			server.Rise = config.HealthCheck.Rise
+		if err := runWatch(*watchIntervalFlag); err != nil {
+			fatalError(errorCategoryConfig, err)
 		}
-		err := addServerWithRetry(client, server, 3)
-		if err != nil {
-			log.Printf("サーバー[%s]の追加に最終的に失敗: %v", backend.Name, err)
+		return
+	}
+
+	// -repeat 指定時は、設定ファイルを読み直しながら一定間隔で適用を繰り返します
+	if command == "apply" && *repeatFlag > 0 {
+		if *interactiveFlag {
+			log.Fatal("-interactive は -repeat と同時に指定できません")
 		}
+		runRepeat(*repeatFlag)
+		return
 	}
 
-	// ロードバランシングアルゴリズムの設定
-	err = client.SetLoadBalancingAlgorithm(config.LoadBalancingAlgorithm)
-	if err != nil {
-		log.Fatalf("ロードバランシングアルゴリズムの設定に失敗: %v", err)
+	// doctor は設定の検証自体も診断対象とするため、検証前の設定で実行します
+	if command == "doctor" {
+		runDoctor()
+		return
+	}
+
+	// export は既存のHAProxyから設定ファイルを作成するため、設定ファイルがなくても実行できます
+	if command == "export" {
+		runExport()
+		return
 	}
-	fmt.Printf("ロードバランシングアルゴリズムを [%s] に設定しました\n", config.LoadBalancingAlgorithm)
 
-	// 再接続ポリシー（リトライ設定と redispatch）の設定を反映
-	err = setRetryPolicy(client, config.RetryPolicy)
+	config, err := loadEffectiveConfig()
 	if err != nil {
-		log.Fatalf("再接続ポリシーの設定に失敗: %v", err)
+		if *nagiosFlag {
+			nagiosExit("HEALTH", nagiosUnknown, fmt.Sprintf("設定ファイルの読み込みに失敗: %v", err), "")
+		}
+		fatalError(errorCategoryConfig, err)
 	}
+
+	switch command {
+	case "apply":
+		runApply(config)
+	case "plan":
+		*dryRunFlag = true
+		runApply(config)
+	case "render":
+		runRender(config)
+	case "terraform":
+		runTerraform(config)
+	case "health":
+		runHealth(config)
+	case "orphans":
+		runOrphans(config)
+	case "compare":
+		runCompare(config)
+	default:
+		log.Fatalf("不明なサブコマンドです: %s（apply, plan, render, terraform, health, orphans, compare, doctor, export のいずれかを指定してください）", command)
+	}
+
+	// -fail-on-warnings 指定時は、警告があれば実行完了後に失敗として終了します
+	failOnWarnings()
 }
 
-// newHAProxyClient は、HAProxy APIにPingリクエストを送り接続できるか確認した上でクライアントを返します
-func newHAProxyClient(endpoint, apiKey string) (*haproxy.HAProxy, error) {
-	client := &haproxy.HAProxy{
-		Endpoint: endpoint,
-		ApiKey:   apiKey,
+// parseCommandLine は、コマンドラインの引数からサブコマンドを取り出し、フラグを fs に読み込みます。
+// サブコマンドは先頭（"plan -config c.json"）とフラグの後（"-config c.json plan"）のどちらにも指定できます。
+// それ以外に余った引数がある場合は、指定したつもりのサブコマンドの代わりに apply を実行しないようエラーとします
+func parseCommandLine(fs *flag.FlagSet, args []string) (string, error) {
+	command := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if command == "" && fs.NArg() > 0 {
+		command = fs.Arg(0)
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return "", err
+		}
+	}
+	if fs.NArg() > 0 {
+		return "", fmt.Errorf("サブコマンド[%s]の後の引数[%s]を解釈できません（サブコマンドは1つだけ指定してください）", command, strings.Join(fs.Args(), " "))
+	}
+	if command == "" {
+		command = "apply"
+	}
+	return command, nil
+}
+
+// loadEffectiveConfig は、設定ファイルを読み込み、フラグと環境変数による上書きを反映して検証した設定を返します
+func loadEffectiveConfig() (*Config, error) {
+	// JSON形式の設定ファイルを読み込みます
+	config, err := loadConfig(*configFlag)
+	if err != nil {
+		return nil, fmt.Errorf("設定ファイルの読み込みに失敗: %w", err)
+	}
+
+	// ${VAR} 形式の変数参照を環境変数と vars の値で展開します
+	if err := substituteVars(config, os.Getenv); err != nil {
+		return nil, fmt.Errorf("設定ファイルの変数の展開に失敗: %w", err)
+	}
+
+	// 接続情報はフラグ、環境変数の順に設定ファイルの値を上書きします
+	applyConnectionOverrides(config, *endpointFlag, *apiKeyFlag, os.Getenv)
+
+	// weights_file があれば、その weight で設定ファイルの weight を上書きします
+	if err := applyWeightsFile(config); err != nil {
+		return nil, err
+	}
+
+	// -max-retries は設定ファイルの retry_policy.retries より優先します
+	if *maxRetriesFlag < -1 {
+		return nil, fmt.Errorf("-max-retries は 0 以上で指定してください（指定値: %d）", *maxRetriesFlag)
+	}
+	if *maxRetriesFlag >= 0 {
+		config.RetryPolicy.Retries = *maxRetriesFlag
+	}
+
+	// API呼び出しの前に設定内容を検証します（フラグで指定された禁止アルゴリズムも含む）
+	config.DisabledAlgorithms = append(config.DisabledAlgorithms, forbidAlgorithmFlag...)
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("設定の検証に失敗: %w", err)
+	}
+	return config, nil
+}
+
+// newHAProxyClient は、HAProxy APIにPingリクエストを送り接続できるか確認した上でクライアントを返します。
+// -wait-for-api 指定時は、その時間内で接続できるまで待ちます
+func newHAProxyClient(endpoint, apiKey, basePath string) (haproxyClient, error) {
+	client := buildHAProxyClient(endpoint, apiKey, basePath)
 
 	// 実際にPingでAPIの疎通確認を行う
-	err := client.Ping()
+	done := profileOp("ping " + endpoint)
+	var err error
+	if *waitForAPIFlag > 0 {
+		err = waitForAPI(client, endpoint, *waitForAPIFlag, time.Sleep)
+	} else {
+		err = client.Ping()
+	}
+	done()
 	if err != nil {
 		return nil, fmt.Errorf("HAProxy APIへの接続失敗: %w", err)
 	}
 	return client, nil
 }
 
-// addServerWithRetry は、サーバー追加処理を指定回数リトライします
-func addServerWithRetry(client *haproxy.HAProxy, server haproxy.Server, retries int) error {
-	var err error
-	for i := 0; i < retries; i++ {
-		err = client.AddServer(&server)
-		if err == nil {
-			fmt.Printf("サーバー[%s]を正常に追加しました\n", server.Name)
-			return nil
-		}
-		fmt.Printf("サーバー[%s]追加失敗 (試行 %d/%d): %v\n", server.Name, i+1, retries, err)
+// newReadOnlyClient は、変更を行わない処理（export, health, orphans など）のためのクライアントを返します。
+// -skip-ping 指定時は起動時のPingを行わず、一時的なPingの失敗で中断しないようにします
+// （接続できない場合は、その後のAPI呼び出しのエラーとして報告されます）。変更を行う apply は常にPingで確認します
+func newReadOnlyClient(endpoint, apiKey, basePath string) (haproxyClient, error) {
+	if *skipPingFlag {
+		return buildHAProxyClient(endpoint, apiKey, basePath), nil
 	}
-	return fmt.Errorf("サーバー[%s]の追加に最終的に失敗しました: %w", server.Name, err)
+	return newHAProxyClient(endpoint, apiKey, basePath)
 }
 
-// setRetryPolicy は、HAProxy APIを通じて再接続ポリシー（retries と option redispatch）を設定します
-func setRetryPolicy(client *haproxy.HAProxy, rp RetryPolicyConfig) error {
-	// retries の設定
-	err := client.SetConfig("retries", fmt.Sprintf("%d", rp.Retries))
-	if err != nil {
-		return fmt.Errorf("再接続ポリシー（retries=%d）の設定失敗: %w", rp.Retries, err)
+// buildHAProxyClient は、疎通確認を行わずにクライアントを生成します。
+// エンドポイントが unix:// で始まる場合は Data Plane API の代わりに runtime socket を、
+// memory:// で始まる場合はHAProxyに接続しないメモリ上のインスタンスを使用します。
+// Data Plane API では、basePath（api_base_path）を指定した場合はエンドポイントにベースパスを付けて接続します
+func buildHAProxyClient(endpoint, apiKey, basePath string) haproxyClient {
+	if strings.HasPrefix(endpoint, socketScheme) {
+		return newSocketClient(strings.TrimPrefix(endpoint, socketScheme))
+	}
+	if strings.HasPrefix(endpoint, memoryScheme) {
+		return newMemoryClient(strings.TrimPrefix(endpoint, memoryScheme))
 	}
+	return newDataPlaneClient(apiEndpointURL(endpoint, basePath), apiKey, "")
+}
 
-	// redispatch の設定：有効なら "on", 無効なら "off" を指定
+// addServerWithRetry は、サーバー追加処理を指定回数リトライします。
+// 追加は冪等でないため、タイムアウト後はサーバーが存在するかを確認してから再送します
+func addServerWithRetry(ctx context.Context, client haproxyClient, server haproxy.Server, retries int) error {
+	defer profileOp("add " + serverKey(server.Backend, server.Name))()
+	return runWithRetry(ctx, clientOperation{
+		subject: fmt.Sprintf("サーバー[%s]", server.Name),
+		verb:    "追加",
+		run:     func() error { return client.AddServer(&server) },
+		applied: serverAddedCheck(client, server),
+	}, retries)
+}
+
+// updateServerWithRetry は、既存サーバーの更新処理を指定回数リトライします（更新は冪等なためそのまま再送します）
+func updateServerWithRetry(ctx context.Context, client haproxyClient, server haproxy.Server, retries int) error {
+	defer profileOp("update " + serverKey(server.Backend, server.Name))()
+	return runWithRetry(ctx, clientOperation{
+		subject:    fmt.Sprintf("サーバー[%s]", server.Name),
+		verb:       "更新",
+		idempotent: true,
+		run:        func() error { return client.UpdateServer(&server) },
+	}, retries)
+}
+
+// renameServerWithRetry は、既存サーバー name の名前を server.Name に変更し、内容を更新する処理を指定回数リトライします。
+// 名前の変更は冪等でないため、タイムアウト後は変更後の名前のサーバーがあり、変更前の名前のサーバーがないかを確認します
+func renameServerWithRetry(ctx context.Context, client haproxyClient, name string, server haproxy.Server, retries int) error {
+	defer profileOp("rename " + serverKey(server.Backend, name))()
+	return runWithRetry(ctx, clientOperation{
+		subject: fmt.Sprintf("サーバー[%s]", name),
+		verb:    "名前の変更",
+		success: fmt.Sprintf("サーバー[%s]の名前を[%s]に変更しました", name, server.Name),
+		run:     func() error { return client.RenameServer(name, &server) },
+		applied: func() (bool, error) {
+			keys, err := existingServers(client)
+			if err != nil {
+				return false, err
+			}
+			return keys[serverKey(server.Backend, server.Name)] && !keys[serverKey(server.Backend, name)], nil
+		},
+	}, retries)
+}
+
+// removeServerWithRetry は、サーバー削除処理を指定回数リトライします。
+// 削除は冪等でないため、タイムアウト後はサーバーが既になくなっていないかを確認してから再送します
+func removeServerWithRetry(ctx context.Context, client haproxyClient, server haproxy.Server, retries int) error {
+	defer profileOp("remove " + serverKey(server.Backend, server.Name))()
+	return runWithRetry(ctx, clientOperation{
+		subject: fmt.Sprintf("サーバー[%s]", server.Name),
+		verb:    "削除",
+		run:     func() error { return client.RemoveServer(&server) },
+		applied: func() (bool, error) {
+			keys, err := existingServers(client)
+			if err != nil {
+				return false, err
+			}
+			return !keys[serverKey(server.Backend, server.Name)], nil
+		},
+	}, retries)
+}
+
+// setRetryPolicy は、HAProxy APIを通じて再接続ポリシー（retries と option redispatch）を設定します。
+// 現在の値を先に取得し、異なる項目のみを設定します（取得と設定はそれぞれ最大 attempts 回試行します）
+func setRetryPolicy(ctx context.Context, client haproxyClient, rp RetryPolicyConfig, attempts int) error {
+	// redispatch は有効なら "on", 無効なら "off" を指定
 	var redispatchVal string
 	if rp.Redispatch {
 		redispatchVal = "on"
 	} else {
 		redispatchVal = "off"
 	}
-	err = client.SetConfig("option redispatch", redispatchVal)
-	if err != nil {
-		return fmt.Errorf("redispatchの設定失敗: %w", err)
+
+	// 現在の値と異なる項目のみ設定します（同じ値の設定でも設定の再読み込みが発生するため）
+	changed := false
+	for _, item := range []struct{ key, value string }{
+		{"retries", fmt.Sprintf("%d", rp.Retries)},
+		{"option redispatch", redispatchVal},
+	} {
+		// 取得と設定はどちらも冪等なため、失敗した場合はそのまま再試行します
+		var current string
+		err := retry(ctx, clientRetryPolicy(attempts), func(int) error {
+			var err error
+			current, err = client.GetConfig(item.key)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("現在の %s の取得失敗: %w", item.key, err)
+		}
+		if current == item.value {
+			continue
+		}
+		err = retry(ctx, clientRetryPolicy(attempts), func(int) error {
+			return client.SetConfig(item.key, item.value)
+		})
+		if err != nil {
+			return fmt.Errorf("再接続ポリシー（%s=%s）の設定失敗: %w", item.key, item.value, err)
+		}
+		changed = true
 	}
 
-	fmt.Printf("再接続ポリシーを設定しました: retries=%d, redispatch=%v\n", rp.Retries, rp.Redispatch)
+	if !changed {
+		logf("再接続ポリシーに変更はありません（retry policy unchanged）: retries=%d, redispatch=%v\n", rp.Retries, rp.Redispatch)
+		return nil
+	}
+	logf("再接続ポリシーを設定しました: retries=%d, redispatch=%v\n", rp.Retries, rp.Redispatch)
 	return nil
 }
 
-// loadConfig は、指定されたJSON設定ファイルを読み込み Config 構造体へパースします
-func loadConfig(filename string) (*Config, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	bytes, err := ioutil.ReadAll(file)
-	if err != nil {
-		return nil, err
-	}
-	var config Config
-	err = json.Unmarshal(bytes, &config)
-	if err != nil {
-		return nil, err
-	}
-	return &config, nil
+// loadConfig は、指定された読み込み元の設定を Config 構造体へパースします。
+// 読み込み元はスキーム（http(s)://, env://, vault://、なしの場合はファイルまたはディレクトリ）で選びます
+func loadConfig(location string) (*Config, error) {
+	return newConfigSource(location).Load()
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	tests := []struct {
+		args    []string
+		command string
+		config  string
+		dryRun  bool
+	}{
+		{args: nil, command: "apply"},
+		{args: []string{"-config", "c.json"}, command: "apply", config: "c.json"},
+		{args: []string{"plan", "-config", "c.json"}, command: "plan", config: "c.json"},
+		{args: []string{"-config", "c.json", "plan"}, command: "plan", config: "c.json"},
+		{args: []string{"-config", "c.json", "render", "-dry-run"}, command: "render", config: "c.json", dryRun: true},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("lb", flag.ContinueOnError)
+		config := fs.String("config", "", "")
+		dryRun := fs.Bool("dry-run", false, "")
+		command, err := parseCommandLine(fs, tt.args)
+		if err != nil {
+			t.Errorf("parseCommandLine(%q) がエラーを返しました: %v", tt.args, err)
+			continue
+		}
+		if command != tt.command || *config != tt.config || *dryRun != tt.dryRun {
+			t.Errorf("parseCommandLine(%q) = %s, -config %q, -dry-run %v, want %s, %q, %v", tt.args, command, *config, *dryRun, tt.command, tt.config, tt.dryRun)
+		}
+	}
+}
+
+func TestParseCommandLineRejectsLeftoverArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"plan", "extra"},
+		{"-config", "c.json", "plan", "apply"},
+		{"plan", "-config", "c.json", "render"},
+	} {
+		fs := flag.NewFlagSet("lb", flag.ContinueOnError)
+		fs.String("config", "", "")
+		if command, err := parseCommandLine(fs, args); err == nil {
+			t.Errorf("parseCommandLine(%q) = %s, want 余った引数のエラー", args, command)
+		}
+	}
+}
+
+func TestBackendMetadataInReportAndRender(t *testing.T) {
+	captureOutput(t)
+	endpoint, client := testMemoryEndpoint(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["`+endpoint+`"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web",
+			"owner": "team-web", "description": "フロントのAPI"}]
+	}`)
+
+	result, err := reconcileServers(client, config, applyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := writeReport(path, []*Result{result}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report Result
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("レポートを読み込めません: %v", err)
+	}
+	if b := report.Backends[0]; b.Owner != "team-web" || b.Description != "フロントのAPI" {
+		t.Errorf("レポートのメタデータ = owner %q, description %q", b.Owner, b.Description)
+	}
+
+	rendered, err := renderConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rendered, "    # owner: team-web / フロントのAPI\n    server web-1 10.0.0.1:80 weight 10") {
+		t.Errorf("render の出力にサーバー行の直前のメタデータのコメントがありません:\n%s", rendered)
+	}
+	if !strings.Contains(rendered, "\nbackend web\n    balance roundrobin\n") {
+		t.Errorf("render の出力に backend web セクションがありません:\n%s", rendered)
+	}
+}
+
+func TestSetRetryPolicyOnlySetsChangedValues(t *testing.T) {
+	logs, _ := captureOutput(t)
+	client := &phaseRecordingClient{HAProxy: haproxyfake.New()}
+	rp := RetryPolicyConfig{Retries: 3, Redispatch: true}
+	if err := setRetryPolicy(context.Background(), client, rp, 1); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"config:retries", "config:option redispatch"}; strings.Join(client.calls, ",") != strings.Join(want, ",") {
+		t.Errorf("初回の SetConfig の呼び出し = %v, want %v", client.calls, want)
+	}
+
+	client.calls = nil
+	if err := setRetryPolicy(context.Background(), client, rp, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.calls) != 0 {
+		t.Errorf("現在の値と同じ場合の SetConfig の呼び出し = %v, want なし", client.calls)
+	}
+	if !strings.Contains(logs.String(), "retry policy unchanged") {
+		t.Errorf("ログに変更なしのメッセージがありません:\n%s", logs)
+	}
+
+	rp.Redispatch = false
+	if err := setRetryPolicy(context.Background(), client, rp, 1); err != nil {
+		t.Fatal(err)
+	}
+	if want := "config:option redispatch"; strings.Join(client.calls, ",") != want {
+		t.Errorf("redispatch のみ変更した場合の呼び出し = %v, want [%s]", client.calls, want)
+	}
+}
+
+func TestSkipPingLetsReadOnlyClientProceed(t *testing.T) {
+	captureOutput(t)
+	// show info に応答しないため、Ping は失敗します
+	socket := newFakeSocket(t, socketTestState())
+	endpoint := socketScheme + socket.path
+	if _, err := newReadOnlyClient(endpoint, "", ""); err == nil {
+		t.Fatal("-skip-ping 未指定時に Ping の失敗がエラーになりませんでした")
+	}
+
+	setFlag(t, "skip-ping", "true")
+	client, err := newReadOnlyClient(endpoint, "", "")
+	if err != nil {
+		t.Fatalf("-skip-ping 指定時の newReadOnlyClient がエラーを返しました: %v", err)
+	}
+	servers, err := client.GetServers()
+	if err != nil || len(servers) != 2 {
+		t.Errorf("GetServers() = %d 台, %v, want 2 台（Ping の失敗に関係なく読み取れること）", len(servers), err)
+	}
+	// 変更を行う適用のクライアントは -skip-ping でも Ping で確認します
+	if _, err := newHAProxyClient(endpoint, "", ""); err == nil {
+		t.Error("-skip-ping 指定時に newHAProxyClient が Ping の失敗を無視しました")
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// memoryScheme は、HAProxyに接続せずプロセス内のメモリ上で適用を再現するエンドポイントのスキームです
+// （例: memory://staging。同じ名前のエンドポイントは -repeat の間も状態を共有します）
+const memoryScheme = "memory://"
+
+var (
+	memoryInstancesMu sync.Mutex
+	memoryInstances   = make(map[string]*haproxyfake.HAProxy)
+)
+
+// newMemoryClient は、名前に対応するメモリ上のインスタンスを返します（未作成の場合は空の状態で作成します）。
+// 実装は haproxyfake パッケージにあり、設定ファイルの適用結果や冪等性を実機のHAProxyなしで確認するために使います
+func newMemoryClient(name string) *haproxyfake.HAProxy {
+	memoryInstancesMu.Lock()
+	defer memoryInstancesMu.Unlock()
+	if c, ok := memoryInstances[name]; ok {
+		return c
+	}
+	c := haproxyfake.New()
+	memoryInstances[name] = c
+	return c
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestMemoryEndpointSharesStateByName(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://shared-state"],
+		"load_balancing_algorithm": "leastconn",
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"}]
+	}`)
+	if _, err := applyConfig(buildHAProxyClient("memory://shared-state", "", ""), config, applyOptions{}); err != nil {
+		t.Fatalf("1回目の適用がエラーを返しました: %v", err)
+	}
+
+	// 同じ名前のエンドポイントは、前回の適用結果を保持していること
+	client := buildHAProxyClient("memory://shared-state", "", "")
+	servers, _ := client.GetServers()
+	if len(servers) != 1 || servers[0].Name != "web-1" {
+		t.Fatalf("2回目に接続したインスタンスのサーバー = %+v, want web-1 のみ", servers)
+	}
+	result, err := applyConfig(client, config, applyOptions{})
+	if err != nil {
+		t.Fatalf("2回目の適用がエラーを返しました: %v", err)
+	}
+	for _, b := range result.Backends {
+		if b.Status != StatusSkippedExists {
+			t.Errorf("2回目の適用での %s の結果 = %s, want %s（冪等であること）", b.Name, b.Status, StatusSkippedExists)
+		}
+	}
+	if other, _ := buildHAProxyClient("memory://other-state", "", "").GetServers(); len(other) != 0 {
+		t.Errorf("別の名前のインスタンスのサーバー数 = %d, want 0", len(other))
+	}
+}
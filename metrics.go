@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pushgatewayJob は、Pushgateway に送信する際の job 名です
+const pushgatewayJob = "haproxy_loadbalancer"
+
+// 送信するメトリクス名（ダッシュボードから参照されるため変更しないこと）
+const (
+	metricServersAdded   = "haproxy_lb_servers_added"
+	metricServersUpdated = "haproxy_lb_servers_updated"
+	metricServersFailed  = "haproxy_lb_servers_failed"
+	metricApplySuccess   = "haproxy_lb_apply_success"
+	metricApplyDuration  = "haproxy_lb_apply_duration_seconds"
+	metricHealthyRatio   = "haproxy_lb_healthy_ratio"
+)
+
+// endpointMetrics は、1つのHAProxyインスタンスへの適用結果の集計です
+type endpointMetrics struct {
+	added, updated, failed int
+	success                bool
+	healthyRatio           float64
+	hasHealth              bool // healthyRatio を取得できたかどうか
+}
+
+// applyMetrics は、1回の適用で Pushgateway に送信するメトリクスを集めます。
+// 複数インスタンスへの並列適用から同時に記録されます
+type applyMetrics struct {
+	mu        sync.Mutex
+	start     time.Time
+	duration  time.Duration
+	endpoints map[string]*endpointMetrics
+}
+
+// newApplyMetrics は、適用開始時刻を記録したメトリクスの集計を作成します
+func newApplyMetrics(start time.Time) *applyMetrics {
+	return &applyMetrics{start: start, endpoints: map[string]*endpointMetrics{}}
+}
+
+// record は、1つのインスタンスへの適用結果と適用後のヘルス状態を記録します
+func (m *applyMetrics) record(endpoint string, result *Result, applyErr error, client haproxyClient, config *Config) {
+	em := &endpointMetrics{success: applyErr == nil}
+	if result != nil {
+		for _, b := range result.Backends {
+			switch b.Status {
+			case StatusAdded:
+				em.added++
+			case StatusUpdated:
+				em.updated++
+			case StatusFailedValidation, StatusFailedAPI:
+				em.failed++
+			}
+		}
+	}
+	if client != nil {
+		if summary, err := summarizeHealth(client, config); err == nil {
+			em.healthyRatio = summary.ratio()
+			em.hasHealth = true
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.endpoints[endpoint] = em
+}
+
+// finish は、適用終了時刻から所要時間を確定します
+func (m *applyMetrics) finish(end time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.duration = end.Sub(m.start)
+}
+
+// format は、集計したメトリクスを Prometheus のテキスト形式で返します
+func (m *applyMetrics) format() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	endpoints := make([]string, 0, len(m.endpoints))
+	for e := range m.endpoints {
+		endpoints = append(endpoints, e)
+	}
+	sort.Strings(endpoints)
+
+	var b strings.Builder
+	writeMetric := func(name, help string, value func(em *endpointMetrics) (float64, bool)) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, e := range endpoints {
+			if v, ok := value(m.endpoints[e]); ok {
+				fmt.Fprintf(&b, "%s{endpoint=\"%s\"} %g\n", name, escapeLabelValue(e), v)
+			}
+		}
+	}
+	writeMetric(metricServersAdded, "Number of servers added by the last apply.", func(em *endpointMetrics) (float64, bool) {
+		return float64(em.added), true
+	})
+	writeMetric(metricServersUpdated, "Number of servers updated by the last apply.", func(em *endpointMetrics) (float64, bool) {
+		return float64(em.updated), true
+	})
+	writeMetric(metricServersFailed, "Number of servers that failed validation or API calls in the last apply.", func(em *endpointMetrics) (float64, bool) {
+		return float64(em.failed), true
+	})
+	writeMetric(metricApplySuccess, "Whether the last apply succeeded (1) or failed (0).", func(em *endpointMetrics) (float64, bool) {
+		if em.success {
+			return 1, true
+		}
+		return 0, true
+	})
+	writeMetric(metricHealthyRatio, "Ratio of healthy servers after the last apply.", func(em *endpointMetrics) (float64, bool) {
+		return em.healthyRatio, em.hasHealth
+	})
+	fmt.Fprintf(&b, "# HELP %s Duration of the last apply in seconds.\n# TYPE %s gauge\n", metricApplyDuration, metricApplyDuration)
+	fmt.Fprintf(&b, "%s %g\n", metricApplyDuration, m.duration.Seconds())
+	return b.String()
+}
+
+// escapeLabelValue は、ラベル値を Prometheus のテキスト形式でエスケープします
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// pushgatewayURL は、job と environment / run_id ラベルをグルーピングキーとした送信先URLを返します
+func pushgatewayURL(base, environment, runID string) string {
+	u := strings.TrimRight(base, "/") + "/metrics/job/" + url.PathEscape(pushgatewayJob)
+	if environment != "" {
+		u += "/environment/" + url.PathEscape(environment)
+	}
+	if runID != "" {
+		u += "/run_id/" + url.PathEscape(runID)
+	}
+	return u
+}
+
+// pushMetrics は、メトリクスを Pushgateway に送信します（同じグルーピングキーのメトリクスは置き換えられます）
+func pushMetrics(client *http.Client, base, environment, runID string, m *applyMetrics) error {
+	req, err := http.NewRequest(http.MethodPut, pushgatewayURL(base, environment, runID), bytes.NewBufferString(m.format()))
+	if err != nil {
+		return fmt.Errorf("リクエストの作成に失敗: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Pushgateway がエラーを返しました: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// defaultRunID は、-run-id が指定されていない場合に使う実行IDを返します
+func defaultRunID(now time.Time) string {
+	return now.UTC().Format("20060102T150405Z")
+}
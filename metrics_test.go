@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushMetricsSendsPayload(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://metrics"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	result, err := applyConfig(fake, config, applyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setServerStatus(t, fake, "web", "web-1", "UP")
+	setServerStatus(t, fake, "web", "web-2", "DOWN")
+
+	start := time.Unix(1700000000, 0)
+	metrics := newApplyMetrics(start)
+	metrics.record("memory://metrics", result, nil, fake, config)
+	metrics.finish(start.Add(1500 * time.Millisecond))
+
+	var method, path, contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		method, path, contentType, body = r.Method, r.URL.EscapedPath(), r.Header.Get("Content-Type"), string(data)
+	}))
+	defer server.Close()
+
+	if err := pushMetrics(server.Client(), server.URL+"/", "prod", "run 42", metrics); err != nil {
+		t.Fatalf("pushMetrics がエラーを返しました: %v", err)
+	}
+	if method != http.MethodPut || path != "/metrics/job/haproxy_loadbalancer/environment/prod/run_id/run%2042" {
+		t.Errorf("リクエスト = %s %s, want PUT /metrics/job/haproxy_loadbalancer/environment/prod/run_id/run%%2042", method, path)
+	}
+	if !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want Prometheus のテキスト形式", contentType)
+	}
+	for _, line := range []string{
+		`haproxy_lb_servers_added{endpoint="memory://metrics"} 2`,
+		`haproxy_lb_servers_updated{endpoint="memory://metrics"} 0`,
+		`haproxy_lb_servers_failed{endpoint="memory://metrics"} 0`,
+		`haproxy_lb_apply_success{endpoint="memory://metrics"} 1`,
+		`haproxy_lb_healthy_ratio{endpoint="memory://metrics"} 0.5`,
+		`haproxy_lb_apply_duration_seconds 1.5`,
+		`# TYPE haproxy_lb_apply_success gauge`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("送信したメトリクスに %q がありません:\n%s", line, body)
+		}
+	}
+}
+
+func TestPushMetricsReportsGatewayError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid metric", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := pushMetrics(server.Client(), server.URL, "", "", newApplyMetrics(time.Now()))
+	if err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "invalid metric") {
+		t.Errorf("pushMetrics() = %v, want ステータスと応答本文を含むエラー", err)
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	if got, want := escapeLabelValue("a\"b\\c\nd"), `a\"b\\c\nd`; got != want {
+		t.Errorf("escapeLabelValue() = %s, want %s", got, want)
+	}
+}
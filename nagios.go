@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// nagiosStatus は、Nagios のプラグインの規約に従った終了コードです（-nagios）
+type nagiosStatus int
+
+const (
+	nagiosOK       nagiosStatus = 0
+	nagiosWarning  nagiosStatus = 1
+	nagiosCritical nagiosStatus = 2
+	nagiosUnknown  nagiosStatus = 3
+)
+
+// nagiosStatusNames は、出力の1行目に含める状態の名前です（監視ツールが解釈するため英語のままとします）
+var nagiosStatusNames = map[nagiosStatus]string{
+	nagiosOK:       "OK",
+	nagiosWarning:  "WARNING",
+	nagiosCritical: "CRITICAL",
+	nagiosUnknown:  "UNKNOWN",
+}
+
+// nagiosSeverity は、複数の結果をまとめる際の状態の重さです（CRITICAL が最も重く、UNKNOWN は WARNING より重く扱います）
+var nagiosSeverity = map[nagiosStatus]int{
+	nagiosOK:       0,
+	nagiosWarning:  1,
+	nagiosUnknown:  2,
+	nagiosCritical: 3,
+}
+
+// worseNagiosStatus は、2つの状態のうち重い方を返します
+func worseNagiosStatus(a, b nagiosStatus) nagiosStatus {
+	if nagiosSeverity[b] > nagiosSeverity[a] {
+		return b
+	}
+	return a
+}
+
+// nagiosLine は、"LB_HAPROXY HEALTH OK - メッセージ | perfdata" の形式の1行を返します（perfdata は省略可）
+func nagiosLine(service string, status nagiosStatus, message, perfdata string) string {
+	line := fmt.Sprintf("LB_HAPROXY %s %s - %s", service, nagiosStatusNames[status], strings.ReplaceAll(message, "\n", " "))
+	if perfdata != "" {
+		line += " | " + perfdata
+	}
+	return line + "\n"
+}
+
+// nagiosExit は、結果を1行で標準出力に書き出し、状態に対応する終了コードで終了します
+func nagiosExit(service string, status nagiosStatus, message, perfdata string) {
+	fmt.Print(nagiosLine(service, status, message, perfdata))
+	os.Exit(int(status))
+}
+
+// nagiosHealthStatus は、ヘルス状態の集計を状態に変換します。
+// 全台が正常なら OK、異常なサーバーがあっても正常な割合が閾値以上なら WARNING、閾値を下回れば CRITICAL です
+func nagiosHealthStatus(summary healthSummary, minHealthyRatio float64) nagiosStatus {
+	switch {
+	case summary.ratio() < minHealthyRatio:
+		return nagiosCritical
+	case len(summary.Unhealthy) > 0:
+		return nagiosWarning
+	default:
+		return nagiosOK
+	}
+}
+
+// nagiosHealthResult は、health サブコマンドのインスタンスごとの結果です（err が nil でなければ状態を確認できなかったもの）
+type nagiosHealthResult struct {
+	endpoint string
+	summary  healthSummary
+	err      error
+}
+
+// formatNagiosHealth は、インスタンスごとのヘルス状態をまとめた状態、メッセージ、perfdata を返します。
+// 状態を確認できなかったインスタンスは UNKNOWN とします
+func formatNagiosHealth(results []nagiosHealthResult, minHealthyRatio float64) (nagiosStatus, string, string) {
+	status := nagiosOK
+	messages := make([]string, 0, len(results))
+	healthy, total := 0, 0
+	for _, r := range results {
+		if r.err != nil {
+			status = worseNagiosStatus(status, nagiosUnknown)
+			messages = append(messages, fmt.Sprintf("インスタンス[%s]: 状態を確認できません: %v", r.endpoint, r.err))
+			continue
+		}
+		status = worseNagiosStatus(status, nagiosHealthStatus(r.summary, minHealthyRatio))
+		healthy, total = healthy+r.summary.Healthy, total+r.summary.Total
+		msg := fmt.Sprintf("インスタンス[%s]: 正常 %d/%d (%.0f%%、閾値 %.0f%%)", r.endpoint, r.summary.Healthy, r.summary.Total, r.summary.ratio()*100, minHealthyRatio*100)
+		if len(r.summary.Unhealthy) > 0 {
+			msg += " 異常: " + strings.Join(r.summary.Unhealthy, ", ")
+		}
+		messages = append(messages, msg)
+	}
+	perfdata := fmt.Sprintf("healthy=%d;;;0;%d unhealthy=%d;;;0;%d", healthy, total, total-healthy, total)
+	return status, strings.Join(messages, "; "), perfdata
+}
+
+// formatNagiosDoctor は、doctor の診断結果をまとめた状態、メッセージ、perfdata を返します。
+// FAIL があれば CRITICAL、WARN があれば WARNING とし、メッセージには PASS 以外の診断項目を含めます
+func formatNagiosDoctor(results []diagnosis) (nagiosStatus, string, string) {
+	status := nagiosOK
+	counts := map[diagnosisLevel]int{}
+	var problems []string
+	for _, d := range results {
+		counts[d.Level]++
+		switch d.Level {
+		case levelFail:
+			status = worseNagiosStatus(status, nagiosCritical)
+		case levelWarn:
+			status = worseNagiosStatus(status, nagiosWarning)
+		default:
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("[%s] %s: %s", d.Level, d.Check, d.Message))
+	}
+	message := fmt.Sprintf("PASS %d / WARN %d / FAIL %d", counts[levelPass], counts[levelWarn], counts[levelFail])
+	if len(problems) > 0 {
+		message += ": " + strings.Join(problems, "; ")
+	}
+	perfdata := fmt.Sprintf("pass=%d warn=%d fail=%d", counts[levelPass], counts[levelWarn], counts[levelFail])
+	return status, message, perfdata
+}
+
+// runNagiosHealth は、health サブコマンドの -nagios 指定時の処理です。
+// Nagios などが一定間隔で実行するため、条件を満たすまで待たずに現在のヘルス状態を1回だけ取得して判定します
+func runNagiosHealth(config *Config) {
+	results := make([]nagiosHealthResult, 0, len(config.HaproxyEndpoint))
+	for _, endpoint := range config.HaproxyEndpoint {
+		result := nagiosHealthResult{endpoint: endpoint}
+		client, err := newReadOnlyClient(endpoint, config.APIKey, config.APIBasePath)
+		if err != nil {
+			result.err = fmt.Errorf("HAProxyクライアントの初期化に失敗: %w", err)
+		} else {
+			result.summary, result.err = summarizeHealth(client, config)
+		}
+		results = append(results, result)
+	}
+	status, message, perfdata := formatNagiosHealth(results, *healthyRatioFlag)
+	nagiosExit("HEALTH", status, message, perfdata)
+}
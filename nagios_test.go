@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNagiosHealthStatus(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		summary healthSummary
+		want    nagiosStatus
+	}{
+		{"全台正常", healthSummary{Total: 4, Healthy: 4}, nagiosOK},
+		{"サーバーなし", healthSummary{}, nagiosOK},
+		{"閾値以上", healthSummary{Total: 4, Healthy: 3, Unhealthy: []string{"web/web-4 (DOWN)"}}, nagiosWarning},
+		{"閾値未満", healthSummary{Total: 4, Healthy: 2, Unhealthy: []string{"web/web-3 (DOWN)", "web/web-4 (DOWN)"}}, nagiosCritical},
+	} {
+		if got := nagiosHealthStatus(tt.summary, 0.75); got != tt.want {
+			t.Errorf("%s: nagiosHealthStatus() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatNagiosHealth(t *testing.T) {
+	status, message, perfdata := formatNagiosHealth([]nagiosHealthResult{
+		{endpoint: "http://lb1:5555", summary: healthSummary{Total: 2, Healthy: 1, Unhealthy: []string{"web/web-2 (DOWN)"}}},
+		{endpoint: "http://lb2:5555", err: errors.New("connection refused")},
+	}, 0.5)
+	if status != nagiosUnknown {
+		t.Errorf("状態 = %v, want UNKNOWN（WARNING より UNKNOWN を重く扱うこと）", status)
+	}
+	wantMessage := "インスタンス[http://lb1:5555]: 正常 1/2 (50%、閾値 50%) 異常: web/web-2 (DOWN); インスタンス[http://lb2:5555]: 状態を確認できません: connection refused"
+	if message != wantMessage {
+		t.Errorf("メッセージ = %q, want %q", message, wantMessage)
+	}
+	if want := "healthy=1;;;0;2 unhealthy=1;;;0;2"; perfdata != want {
+		t.Errorf("perfdata = %q, want %q（確認できたインスタンスのみ集計すること）", perfdata, want)
+	}
+
+	status, _, _ = formatNagiosHealth([]nagiosHealthResult{
+		{endpoint: "http://lb1:5555", summary: healthSummary{Total: 2}},
+		{endpoint: "http://lb2:5555", err: errors.New("timeout")},
+	}, 0.5)
+	if status != nagiosCritical {
+		t.Errorf("CRITICAL と UNKNOWN をまとめた状態 = %v, want CRITICAL", status)
+	}
+}
+
+func TestFormatNagiosDoctor(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		results     []diagnosis
+		wantStatus  nagiosStatus
+		wantMessage string
+	}{
+		{"全て PASS", []diagnosis{{Check: "config", Level: levelPass}}, nagiosOK, "PASS 1 / WARN 0 / FAIL 0"},
+		{"WARN あり", []diagnosis{{Check: "config", Level: levelPass}, {Check: "version", Level: levelWarn, Message: "古いバージョンです"}}, nagiosWarning, "PASS 1 / WARN 1 / FAIL 0: [" + string(levelWarn) + "] version: 古いバージョンです"},
+		{"FAIL あり", []diagnosis{{Check: "version", Level: levelWarn, Message: "古い"}, {Check: "api", Level: levelFail, Message: "接続できません"}}, nagiosCritical, "PASS 0 / WARN 1 / FAIL 1: [" + string(levelWarn) + "] version: 古い; [" + string(levelFail) + "] api: 接続できません"},
+	} {
+		status, message, _ := formatNagiosDoctor(tt.results)
+		if status != tt.wantStatus || message != tt.wantMessage {
+			t.Errorf("%s: formatNagiosDoctor() = %v, %q, want %v, %q", tt.name, status, message, tt.wantStatus, tt.wantMessage)
+		}
+	}
+}
+
+func TestNagiosLine(t *testing.T) {
+	if got, want := nagiosLine("HEALTH", nagiosWarning, "1行目\n2行目", "healthy=1"), "LB_HAPROXY HEALTH WARNING - 1行目 2行目 | healthy=1\n"; got != want {
+		t.Errorf("nagiosLine() = %q, want %q（改行を含めず1行にすること）", got, want)
+	}
+	if got, want := nagiosLine("DOCTOR", nagiosOK, "PASS 1", ""), "LB_HAPROXY DOCTOR OK - PASS 1\n"; got != want {
+		t.Errorf("perfdata なしの nagiosLine() = %q, want %q", got, want)
+	}
+	for status, code := range map[nagiosStatus]int{nagiosOK: 0, nagiosWarning: 1, nagiosCritical: 2, nagiosUnknown: 3} {
+		if int(status) != code {
+			t.Errorf("%s の終了コード = %d, want %d", nagiosStatusNames[status], int(status), code)
+		}
+	}
+}
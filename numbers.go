@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// numericConfigKeys は、数値の項目のうち文字列（"80" など）で指定されても数値として受け付けるキーです。
+// 設定ファイルを生成するツールによっては数値を文字列として書き出すため、-strict-numbers 未指定時は変換します
+var numericConfigKeys = map[string]bool{
+	"port":        true,
+	"weight":      true,
+	"maxconn":     true,
+	"count":       true,
+	"interval":    true,
+	"fall":        true,
+	"rise":        true,
+	"retries":     true,
+	"min_servers": true,
+}
+
+// lenientNumbers は、numericConfigKeys の項目のうち整数として解釈できる文字列を数値に変換した値を返します。
+// 任意の文字列を持つ vars の中は変換しません。数値として解釈できない文字列はそのまま残し、読み込み時のエラーとします
+func lenientNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if k == "vars" {
+				continue
+			}
+			if s, ok := child.(string); ok && numericConfigKeys[k] {
+				if n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+					v[k] = n
+				}
+				continue
+			}
+			v[k] = lenientNumbers(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = lenientNumbers(child)
+		}
+	}
+	return value
+}
+
+// decodeConfig は、JSONとして読み込んだ設定内容を Config 構造体に変換します（-strict-numbers 未指定時は lenientNumbers を適用）。
+// 非推奨の項目を使用している場合は警告を出力します（-strict 指定時はエラー）
+func decodeConfig(value interface{}) (*Config, error) {
+	if err := checkDeprecatedFields(value); err != nil {
+		return nil, err
+	}
+	if !*strictNumbersFlag {
+		value = lenientNumbers(value)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
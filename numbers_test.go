@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+const numbersTestConfig = `{
+	"haproxy_endpoint": ["memory://numbers"],
+	"load_balancing_algorithm": "roundrobin",
+	"vars": {"port": "8080"},
+	"health_check": {"enabled": true, "interval": "2", "fall": 3, "rise": " 2 "},
+	"backends": [
+		{"name": "web-1", "ip": "10.0.0.1", "port": "80", "weight": "10"},
+		{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10}
+	]
+}`
+
+func TestLenientNumbersAcceptsNumericStrings(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, numbersTestConfig)
+	for _, b := range config.Backends {
+		if b.Port != 80 || b.Weight != 10 {
+			t.Errorf("%s = port %d weight %d, want 80, 10（文字列と数値のどちらでも同じ値）", b.Name, b.Port, b.Weight)
+		}
+	}
+	if hc := config.HealthCheck; hc.Interval != 2 || hc.Rise != 2 {
+		t.Errorf("health_check = interval %d rise %d, want 2, 2", hc.Interval, hc.Rise)
+	}
+	if got := config.Vars["port"]; got != "8080" {
+		t.Errorf("vars.port = %q, want 8080（vars の中は変換しないこと）", got)
+	}
+}
+
+func TestLenientNumbersRejectsGarbage(t *testing.T) {
+	captureOutput(t)
+	path := writeTestFile(t, "config.json", `{
+		"haproxy_endpoint": ["memory://numbers"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": "eighty", "weight": 10}]
+	}`)
+	if _, err := loadConfig(path); err == nil {
+		t.Error(`port "eighty" の読み込みがエラーになりませんでした`)
+	}
+}
+
+func TestStrictNumbersRejectsNumericStrings(t *testing.T) {
+	captureOutput(t)
+	setFlag(t, "strict-numbers", "true")
+	path := writeTestFile(t, "config.json", numbersTestConfig)
+	if _, err := loadConfig(path); err == nil {
+		t.Error(`-strict-numbers 指定時に port "80" の読み込みがエラーになりませんでした`)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// configuredBackends は、設定ファイルに現れるバックエンド（グループ）名の集合です。
+// groups に定義されたもの（state: absent を含む）と、backends の group で参照されているものが含まれます
+func configuredBackends(config *Config) map[string]bool {
+	names := map[string]bool{}
+	for _, g := range config.Groups {
+		names[g.Name] = true
+	}
+	for _, b := range config.Backends {
+		names[b.Group] = true
+	}
+	return names
+}
+
+// findOrphans は、設定ファイルのどのバックエンドにも属さないサーバー（孤立したサーバー）を
+// バックエンド名・サーバー名の順に返します。-prune はバックエンド単位のため、これらのサーバーは削除されません
+func findOrphans(config *Config, current []haproxy.Server) []haproxy.Server {
+	configured := configuredBackends(config)
+	var orphans []haproxy.Server
+	for _, s := range current {
+		if !configured[s.Backend] {
+			orphans = append(orphans, s)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		return serverKey(orphans[i].Backend, orphans[i].Name) < serverKey(orphans[j].Backend, orphans[j].Name)
+	})
+	return orphans
+}
+
+// formatOrphans は、孤立したサーバーの一覧をバックエンドとアドレスの表として整形します
+func formatOrphans(endpoint string, orphans []haproxy.Server) string {
+	var b strings.Builder
+	if len(orphans) == 0 {
+		fmt.Fprintf(&b, "インスタンス[%s]: 孤立したサーバーはありません\n", endpoint)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "インスタンス[%s]: 設定ファイルのどのバックエンドにも属さないサーバー %d 台\n", endpoint, len(orphans))
+	backendWidth, nameWidth := len("backend"), len("server")
+	for _, s := range orphans {
+		if len(s.Backend) > backendWidth {
+			backendWidth = len(s.Backend)
+		}
+		if len(s.Name) > nameWidth {
+			nameWidth = len(s.Name)
+		}
+	}
+	fmt.Fprintf(&b, "  %-*s  %-*s  %s\n", backendWidth, "backend", nameWidth, "server", "address")
+	for _, s := range orphans {
+		fmt.Fprintf(&b, "  %-*s  %-*s  %s\n", backendWidth, s.Backend, nameWidth, s.Name, serverAddress(s))
+	}
+	return b.String()
+}
+
+// runOrphans は、各インスタンスの孤立したサーバーを読み取り専用で一覧表示します（orphans サブコマンド）。
+// 削除は行わないため、不要なサーバーは一覧を確認したうえで個別に片付けてください
+func runOrphans(config *Config) {
+	failed := false
+	for _, endpoint := range config.HaproxyEndpoint {
+		client, err := newReadOnlyClient(endpoint, config.APIKey, config.APIBasePath)
+		if err != nil {
+			log.Printf("インスタンス[%s]: HAProxyクライアントの初期化に失敗: %v", endpoint, err)
+			failed = true
+			continue
+		}
+		current, err := client.GetServers()
+		if err != nil {
+			log.Printf("インスタンス[%s]: 現在のサーバー一覧の取得に失敗: %v", endpoint, err)
+			failed = true
+			continue
+		}
+		fmt.Print(formatOrphans(endpoint, findOrphans(config, current)))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+func TestFindOrphansListsServersOutsideConfiguredBackends(t *testing.T) {
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://orphans"],
+		"load_balancing_algorithm": "roundrobin",
+		"groups": [{"name": "legacy", "state": "absent"}],
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"}]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	for _, s := range []haproxy.Server{
+		{Backend: "web", Name: "web-1", IP: "10.0.0.1", Port: 80},
+		{Backend: "web", Name: "web-9", IP: "10.0.0.9", Port: 80},
+		{Backend: "legacy", Name: "old-1", IP: "10.0.8.1", Port: 80},
+		{Backend: "stats", Name: "stats-2", IP: "10.0.7.2", Port: 9000},
+		{Backend: "cache", Name: "varnish-1", IP: "10.0.6.1", Port: 6081},
+	} {
+		s := s
+		if err := fake.AddServer(&s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	current, _ := fake.GetServers()
+
+	orphans := findOrphans(config, current)
+	var keys []string
+	for _, s := range orphans {
+		keys = append(keys, serverKey(s.Backend, s.Name))
+	}
+	if got, want := strings.Join(keys, ","), "cache/varnish-1,stats/stats-2"; got != want {
+		t.Errorf("findOrphans() = %s, want %s（設定ファイルにあるバックエンドのサーバーは含めないこと）", got, want)
+	}
+
+	out := formatOrphans("memory://orphans", orphans)
+	for _, want := range []string{"サーバー 2 台", "backend  server     address", "cache    varnish-1  10.0.6.1:6081", "stats    stats-2    10.0.7.2:9000"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("孤立したサーバーの一覧に %q が含まれていません:\n%s", want, out)
+		}
+	}
+}
+
+func TestFormatOrphansWithoutOrphans(t *testing.T) {
+	if got := formatOrphans("memory://orphans", nil); !strings.Contains(got, "孤立したサーバーはありません") {
+		t.Errorf("formatOrphans(nil) = %q, want 孤立したサーバーがないこと", got)
+	}
+}
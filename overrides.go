@@ -0,0 +1,40 @@
+package main
+
+import "strings"
+
+// 接続情報を上書きする環境変数
+const (
+	envEndpoint = "HAPROXY_ENDPOINT"
+	envAPIKey   = "HAPROXY_API_KEY"
+)
+
+// applyConnectionOverrides は、接続情報を「フラグ > 環境変数 > 設定ファイル」の優先順位で決定します。
+// 空の値は未指定として扱います。エンドポイントはカンマ区切りで複数指定できます。
+// APIキーは秘匿情報のためログには出力しません
+func applyConnectionOverrides(config *Config, endpointFlag, apiKeyFlag string, getenv func(string) string) {
+	if endpoint := firstNonEmpty(endpointFlag, getenv(envEndpoint)); endpoint != "" {
+		config.HaproxyEndpoint = splitEndpoints(endpoint)
+	}
+	config.APIKey = firstNonEmpty(apiKeyFlag, getenv(envAPIKey), config.APIKey)
+}
+
+// splitEndpoints は、カンマ区切りのエンドポイント指定を一覧にします
+func splitEndpoints(value string) endpointList {
+	var endpoints endpointList
+	for _, e := range strings.Split(value, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints
+}
+
+// firstNonEmpty は、引数のうち最初の空でない文字列を返します
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
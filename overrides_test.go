@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyConnectionOverridesPrecedence(t *testing.T) {
+	env := map[string]string{envEndpoint: "http://env:5555", envAPIKey: "env-key"}
+	getenv := func(key string) string { return env[key] }
+
+	for _, tt := range []struct {
+		name                 string
+		endpointFlag, apiKey string
+		getenv               func(string) string
+		wantEndpoints        endpointList
+		wantAPIKey           string
+	}{
+		{"フラグを優先", "http://flag-a:5555, http://flag-b:5555", "flag-key", getenv, endpointList{"http://flag-a:5555", "http://flag-b:5555"}, "flag-key"},
+		{"フラグがなければ環境変数", "", "", getenv, endpointList{"http://env:5555"}, "env-key"},
+		{"どちらもなければ設定ファイル", "", "", func(string) string { return "" }, endpointList{"http://file:5555"}, "file-key"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{HaproxyEndpoint: endpointList{"http://file:5555"}, APIKey: "file-key"}
+			applyConnectionOverrides(config, tt.endpointFlag, tt.apiKey, tt.getenv)
+			if !reflect.DeepEqual(config.HaproxyEndpoint, tt.wantEndpoints) {
+				t.Errorf("haproxy_endpoint = %v, want %v", config.HaproxyEndpoint, tt.wantEndpoints)
+			}
+			if config.APIKey != tt.wantAPIKey {
+				t.Errorf("api_key = %q, want %q", config.APIKey, tt.wantAPIKey)
+			}
+		})
+	}
+}
+
+func TestSplitEndpointsIgnoresBlanks(t *testing.T) {
+	if got := splitEndpoints(" a , ,b,"); !reflect.DeepEqual(got, endpointList{"a", "b"}) {
+		t.Errorf("splitEndpoints = %v, want [a b]", got)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// PeersConfig はHAProxyの peers セクション（インスタンス間での stick-table の共有）の設定を表します。
+// groups の stick で peers にこのセクションを指定すると、その stick-table の内容をピア間で同期します
+type PeersConfig struct {
+	Name    string         `json:"name"`
+	Bind    string         `json:"bind,omitempty"` // ローカルのピアが待ち受けるアドレス（例: ":10000"）。address のないピアを指定する場合は必須
+	TLS     *PeerTLSConfig `json:"tls,omitempty"`  // bind と各ピアへの接続に使う TLS の設定（ピアごとの tls で上書きできます）
+	Members []PeerConfig   `json:"members"`        // ピアの一覧（記載順）
+}
+
+// PeerConfig は peers セクションの1つのピアです。address を省略したピアはローカルのピア（このインスタンス自身）です
+type PeerConfig struct {
+	Name    string         `json:"name"`              // ピア名（HAProxy の -L または hostname と一致させます）
+	Address string         `json:"address,omitempty"` // "host:port" 形式の接続先
+	TLS     *PeerTLSConfig `json:"tls,omitempty"`     // このピアへの接続に使う TLS の設定（セクションの tls より優先）
+}
+
+// PeerTLSConfig は、ピア間の通信を暗号化する TLS の設定です
+type PeerTLSConfig struct {
+	Crt    string `json:"crt"`               // 証明書と秘密鍵を含む PEM ファイルのパス
+	CAFile string `json:"ca_file,omitempty"` // 相手の証明書を検証する CA 証明書のパス（verify required の場合は必須）
+	Verify string `json:"verify,omitempty"`  // 相手の証明書の検証（none または required、未指定時は required）
+}
+
+// peerVerifyModes は、ピアの TLS の verify に指定できる値です
+var peerVerifyModes = map[string]bool{
+	"none":     true,
+	"required": true,
+}
+
+// effectiveVerify は、未指定の場合は required として verify の値を返します（暗号化した通信の相手を常に検証するため）
+func (t PeerTLSConfig) effectiveVerify() string {
+	if t.Verify == "" {
+		return "required"
+	}
+	return t.Verify
+}
+
+// validate は、TLS の設定値と、証明書のファイルが存在するかを検証します
+func (t PeerTLSConfig) validate() error {
+	if t.Crt == "" {
+		return errors.New("tls の crt が指定されていません")
+	}
+	if err := checkRegularFile(t.Crt); err != nil {
+		return fmt.Errorf("tls の crt[%s]を確認できません: %w", t.Crt, err)
+	}
+	if !peerVerifyModes[t.effectiveVerify()] {
+		return fmt.Errorf("tls の verify[%s]は未対応です（none または required）", t.Verify)
+	}
+	if t.effectiveVerify() == "required" && t.CAFile == "" {
+		return errors.New("tls の verify が required の場合は ca_file を指定してください")
+	}
+	if t.CAFile != "" {
+		if err := checkRegularFile(t.CAFile); err != nil {
+			return fmt.Errorf("tls の ca_file[%s]を確認できません: %w", t.CAFile, err)
+		}
+	}
+	return nil
+}
+
+// validate は、peers セクションの設定値を検証します
+func (p PeersConfig) validate() error {
+	if p.Name == "" {
+		return errors.New("name が指定されていません")
+	}
+	if len(p.Members) == 0 {
+		return errors.New("members にピアを1つ以上指定してください")
+	}
+	if p.Bind != "" {
+		if _, _, err := parsePeerAddress(p.Bind, true); err != nil {
+			return fmt.Errorf("bind: %w", err)
+		}
+	}
+	if p.TLS != nil {
+		if p.Bind == "" {
+			return errors.New("tls を指定する場合は、暗号化した接続を待ち受ける bind を指定してください")
+		}
+		if err := p.TLS.validate(); err != nil {
+			return err
+		}
+	}
+	names := map[string]bool{}
+	local := ""
+	for _, m := range p.Members {
+		if m.Name == "" {
+			return errors.New("members の name が指定されていません")
+		}
+		if names[m.Name] {
+			return fmt.Errorf("members のピア[%s]が重複しています", m.Name)
+		}
+		names[m.Name] = true
+		if m.Address == "" {
+			if local != "" {
+				return fmt.Errorf("address のないローカルのピアは1つだけ指定できます（%s, %s）", local, m.Name)
+			}
+			if p.Bind == "" {
+				return fmt.Errorf("ローカルのピア[%s]を指定する場合は bind を指定してください", m.Name)
+			}
+			if m.TLS != nil {
+				return fmt.Errorf("ローカルのピア[%s]には tls を指定できません（待ち受けの TLS はセクションの tls で指定します）", m.Name)
+			}
+			local = m.Name
+			continue
+		}
+		if _, _, err := parsePeerAddress(m.Address, false); err != nil {
+			return fmt.Errorf("ピア[%s]: %w", m.Name, err)
+		}
+		if m.TLS != nil {
+			if err := m.TLS.validate(); err != nil {
+				return fmt.Errorf("ピア[%s]: %w", m.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parsePeerAddress は、"host:port" 形式のアドレスをホストとポートに分けます（allowEmptyHost が true の場合は ":10000" のようにホストを省略できます）
+func parsePeerAddress(address string, allowEmptyHost bool) (string, int, error) {
+	host, p, err := net.SplitHostPort(address)
+	if err != nil || (host == "" && !allowEmptyHost) {
+		return "", 0, fmt.Errorf("アドレス[%s]は \"host:port\" 形式で指定してください（例: 192.168.0.2:10000）", address)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("アドレス[%s]のポートは 1〜65535 の範囲で指定してください", address)
+	}
+	return host, port, nil
+}
+
+// buildPeerTLS は、TLS の設定を HAProxy の ssl の指定に変換します（tls が nil の場合は ssl を使いません）
+func buildPeerTLS(tls *PeerTLSConfig) haproxy.PeerTLS {
+	if tls == nil {
+		return haproxy.PeerTLS{}
+	}
+	return haproxy.PeerTLS{SSL: true, Crt: tls.Crt, CAFile: tls.CAFile, Verify: tls.effectiveVerify()}
+}
+
+// buildPeers は、peers の設定から HAProxy の peers セクションの定義を組み立てます（検証済みであること）。
+// 各ピアへの接続にはピアの tls、なければセクションの tls を使います
+func buildPeers(p PeersConfig) haproxy.PeerSection {
+	section := haproxy.PeerSection{Name: p.Name}
+	if p.Bind != "" {
+		host, port, _ := parsePeerAddress(p.Bind, true)
+		section.Bind = haproxy.PeerBind{Address: host, Port: port, TLS: buildPeerTLS(p.TLS)}
+	}
+	for _, m := range p.Members {
+		entry := haproxy.PeerEntry{Name: m.Name}
+		if m.Address != "" {
+			entry.Address, entry.Port, _ = parsePeerAddress(m.Address, false)
+			tls := p.TLS
+			if m.TLS != nil {
+				tls = m.TLS
+			}
+			entry.TLS = buildPeerTLS(tls)
+		}
+		section.Entries = append(section.Entries, entry)
+	}
+	return section
+}
+
+// peersMatches は、現在の peers セクションが設定から組み立てた定義と一致するかを返します
+func peersMatches(current, desired haproxy.PeerSection) bool {
+	if current.Bind != desired.Bind || len(current.Entries) != len(desired.Entries) {
+		return false
+	}
+	for i := range current.Entries {
+		if current.Entries[i] != desired.Entries[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyPeers は、peers セクションを作成し、内容が異なる場合は更新します。
+// stick-table からの参照（peers）は group-settings で設定するため、それより前に作成します
+func applyPeers(client haproxyClient, config *Config) error {
+	if len(config.Peers) == 0 {
+		return nil
+	}
+	current, err := client.GetPeers()
+	if err != nil {
+		return fmt.Errorf("現在の peers の取得に失敗: %w", err)
+	}
+	existing := make(map[string]haproxy.PeerSection, len(current))
+	for _, p := range current {
+		existing[p.Name] = p
+	}
+
+	for _, p := range config.Peers {
+		desired := buildPeers(p)
+		cur, ok := existing[p.Name]
+		switch {
+		case !ok:
+			if err := client.AddPeers(&desired); err != nil {
+				return fmt.Errorf("peers[%s]の作成失敗: %w", p.Name, err)
+			}
+			logf("peers[%s]を作成しました\n", p.Name)
+		case peersMatches(cur, desired):
+			logf("peers[%s]は既に同じ内容のためスキップしました\n", p.Name)
+		default:
+			if err := client.UpdatePeers(&desired); err != nil {
+				return fmt.Errorf("peers[%s]の更新失敗: %w", p.Name, err)
+			}
+			logf("peers[%s]を更新しました\n", p.Name)
+		}
+	}
+	return nil
+}
+
+// peerTLSOptions は、ssl の指定を bind / server 行のオプション（"ssl crt ... ca-file ... verify ..."）に変換します
+func peerTLSOptions(tls haproxy.PeerTLS) string {
+	if !tls.SSL {
+		return ""
+	}
+	opts := []string{"ssl", "crt", tls.Crt}
+	if tls.CAFile != "" {
+		opts = append(opts, "ca-file", tls.CAFile)
+	}
+	if tls.Verify != "" {
+		opts = append(opts, "verify", tls.Verify)
+	}
+	return " " + strings.Join(opts, " ")
+}
+
+// peersLines は、peers セクションの定義を haproxy.cfg の peers セクションの各行に変換します。
+// bind を指定した場合は、ピアを server 行（ローカルのピアはアドレスなし）で表します
+func peersLines(p haproxy.PeerSection) []string {
+	var lines []string
+	if p.Bind.Port > 0 {
+		lines = append(lines, fmt.Sprintf("bind %s%s", net.JoinHostPort(p.Bind.Address, strconv.Itoa(p.Bind.Port)), peerTLSOptions(p.Bind.TLS)))
+	}
+	for _, e := range p.Entries {
+		keyword := "peer"
+		if p.Bind.Port > 0 {
+			keyword = "server"
+		}
+		if e.Address == "" {
+			lines = append(lines, fmt.Sprintf("%s %s", keyword, e.Name))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s%s", keyword, e.Name, net.JoinHostPort(e.Address, strconv.Itoa(e.Port)), peerTLSOptions(e.TLS)))
+	}
+	return lines
+}
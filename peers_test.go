@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// peersTestFiles は、テスト用の証明書と CA 証明書のファイルを作成し、そのパスを返します
+func peersTestFiles(t *testing.T) (crt, ca, peerCrt string) {
+	t.Helper()
+	return writeTestFile(t, "peers.pem", "cert"), writeTestFile(t, "ca.pem", "ca"), writeTestFile(t, "lb2.pem", "cert")
+}
+
+func TestApplySecurePeers(t *testing.T) {
+	captureOutput(t)
+	crt, ca, peerCrt := peersTestFiles(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://peers"],
+		"load_balancing_algorithm": "roundrobin",
+		"peers": [{
+			"name": "lb",
+			"bind": ":10000",
+			"tls": {"crt": "`+crt+`", "ca_file": "`+ca+`"},
+			"members": [
+				{"name": "lb1"},
+				{"name": "lb2", "address": "192.168.0.2:10000", "tls": {"crt": "`+peerCrt+`", "verify": "none"}},
+				{"name": "lb3", "address": "192.168.0.3:10000"}
+			]
+		}],
+		"backends": []
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, config, applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	sections, _ := fake.GetPeers()
+	if len(sections) != 1 {
+		t.Fatalf("作成した peers = %+v, want lb のみ", sections)
+	}
+	want := []string{
+		"bind :10000 ssl crt " + crt + " ca-file " + ca + " verify required",
+		"server lb1",
+		"server lb2 192.168.0.2:10000 ssl crt " + peerCrt + " verify none",
+		"server lb3 192.168.0.3:10000 ssl crt " + crt + " ca-file " + ca + " verify required",
+	}
+	if got := peersLines(sections[0]); !reflect.DeepEqual(got, want) {
+		t.Errorf("peers の行 =\n%s\nwant\n%s（ピアの tls がセクションの tls より優先され、verify の既定は required であること）", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	logs, _ := captureOutput(t)
+	if _, err := applyConfig(fake, config, applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "peers[lb]は既に同じ内容のためスキップしました") {
+		t.Errorf("同じ内容での再適用のログ =\n%s\nwant スキップしたこと", logs.String())
+	}
+}
+
+func TestValidatePeers(t *testing.T) {
+	crt, ca, _ := peersTestFiles(t)
+	for _, tt := range []struct{ name, peers, want string }{
+		{"存在しない crt", `{"name": "lb", "bind": ":10000", "tls": {"crt": "/nonexistent/peers.pem", "verify": "none"}, "members": [{"name": "lb1"}]}`, "crt"},
+		{"存在しない ca_file", `{"name": "lb", "bind": ":10000", "tls": {"crt": "` + crt + `", "ca_file": "/nonexistent/ca.pem"}, "members": [{"name": "lb1"}]}`, "ca_file"},
+		{"required で ca_file なし", `{"name": "lb", "bind": ":10000", "tls": {"crt": "` + crt + `"}, "members": [{"name": "lb1"}]}`, "ca_file"},
+		{"未対応の verify", `{"name": "lb", "bind": ":10000", "tls": {"crt": "` + crt + `", "ca_file": "` + ca + `", "verify": "optional"}, "members": [{"name": "lb1"}]}`, "verify"},
+		{"bind なしの tls", `{"name": "lb", "tls": {"crt": "` + crt + `", "ca_file": "` + ca + `"}, "members": [{"name": "lb2", "address": "192.168.0.2:10000"}]}`, "bind"},
+		{"ローカルのピアの tls", `{"name": "lb", "bind": ":10000", "members": [{"name": "lb1", "tls": {"crt": "` + crt + `", "verify": "none"}}]}`, "ローカルのピア"},
+		{"不正なアドレス", `{"name": "lb", "bind": ":10000", "members": [{"name": "lb2", "address": "192.168.0.2"}]}`, "host:port"},
+	} {
+		err := validateTestConfig(t, `{"haproxy_endpoint": ["memory://peers"], "load_balancing_algorithm": "roundrobin", "peers": [`+tt.peers+`], "backends": []}`)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s の検証のエラー = %v, want %s に関するエラー", tt.name, err, tt.want)
+		}
+	}
+
+	err := validateTestConfig(t, `{"haproxy_endpoint": ["memory://peers"], "load_balancing_algorithm": "roundrobin",
+		"groups": [{"name": "web", "stick": {"type": "ip", "size": "100k", "expire": "30m", "peers": "missing"}}], "backends": []}`)
+	if err == nil || !strings.Contains(err.Error(), "peers[missing]") {
+		t.Errorf("未定義の peers を参照する stick の検証のエラー = %v, want peers[missing]が未定義の旨のエラー", err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// -plan-format に指定できる計画の出力形式です
+const (
+	planFormatText     = "text"
+	planFormatMarkdown = "markdown" // PR のコメントに貼り付けられる GitHub の Markdown（diff のコードブロック）
+)
+
+// planDiffPrefix は、diff のコードブロックでの計画の1件の行頭の記号です。
+// 追加は +、削除は -、更新は !（GitHub の diff の強調表示で変更された行として表示されます）、それ以外は空白とします
+func planDiffPrefix(action reconcileAction) string {
+	switch action {
+	case actionAdd:
+		return "+"
+	case actionRemove:
+		return "-"
+	case actionUpdate, actionCheck, actionRename:
+		return "!"
+	default:
+		return " "
+	}
+}
+
+// countPlanChanges は、計画のうち追加・更新（ヘルスチェックの切り替えと名前の変更を含む）・削除の件数を返します
+func countPlanChanges(entries []serverPlanEntry) (added, updated, removed int) {
+	for _, e := range entries {
+		switch e.action {
+		case actionAdd:
+			added++
+		case actionUpdate, actionCheck, actionRename:
+			updated++
+		case actionRemove:
+			removed++
+		}
+	}
+	return added, updated, removed
+}
+
+// formatPlanMarkdown は、サーバーごとの計画を1行の件数の要約と diff のコードブロックからなる Markdown にします。
+// 変更のないサーバーは含めず、変更がない場合は要約のみとします（複数のインスタンスを続けて出力できるよう空行で終わります）
+func formatPlanMarkdown(title string, entries []serverPlanEntry) string {
+	added, updated, removed := countPlanChanges(entries)
+	var b strings.Builder
+	if added+updated+removed == 0 {
+		fmt.Fprintf(&b, "**%s**: 変更はありません\n\n", title)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "**%s**: 追加 %d, 更新 %d, 削除 %d\n\n", title, added, updated, removed)
+	b.WriteString("```diff\n")
+	for _, e := range entries {
+		if e.action == actionSkip {
+			continue
+		}
+		fmt.Fprintf(&b, "%s %s\n", planDiffPrefix(e.action), e)
+	}
+	b.WriteString("```\n\n")
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatPlanMarkdownGolden(t *testing.T) {
+	captureOutput(t)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://markdown"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-old", "ip": "10.0.0.9", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`), applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://markdown"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 20, "group": "web"},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "group": "web", "health_check": {"enabled": false}},
+			{"name": "web-4", "ip": "10.0.0.4", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	entries, err := planServers(fake, config, applyOptions{prune: true})
+	if err != nil {
+		t.Fatalf("planServers がエラーを返しました: %v", err)
+	}
+
+	got := formatPlanMarkdown("インスタンス[memory://markdown]", entries) + formatPlanMarkdown("インスタンス[memory://empty]", nil)
+	path := filepath.Join("testdata", "plan.golden.md")
+	if *updateGolden {
+		if err := ioutil.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("golden ファイルの読み込みに失敗: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("formatPlanMarkdown の出力が %s と異なります（意図した変更なら -update で更新してください）\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// profileEntry は計測した1区間（フェーズまたは個別の操作）です
+type profileEntry struct {
+	name     string
+	duration time.Duration
+}
+
+// profiler は、適用処理のフェーズごとの所要時間と個別の操作の所要時間を集めます（-profile）
+type profiler struct {
+	mu     sync.Mutex
+	phases []profileEntry // フェーズ名ごとの合計（最初に現れた順）
+	ops    []profileEntry
+}
+
+// activeProfiler は、-profile 指定時の計測先です。nil の場合は計測を行いません
+var activeProfiler *profiler
+
+// startProfiling は、-profile 指定時に新しい計測を開始し、その計測先を返します（未指定時は nil）
+func startProfiling() *profiler {
+	activeProfiler = nil
+	if *profileFlag {
+		activeProfiler = &profiler{}
+	}
+	return activeProfiler
+}
+
+// profilePhase は、フェーズの計測を開始し、終了時に呼び出す関数を返します。
+// 複数のインスタンスで同じフェーズを実行した場合は合計時間を記録します
+func profilePhase(name string) func() {
+	p := activeProfiler
+	if p == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		d := time.Since(start)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for i := range p.phases {
+			if p.phases[i].name == name {
+				p.phases[i].duration += d
+				return
+			}
+		}
+		p.phases = append(p.phases, profileEntry{name: name, duration: d})
+	}
+}
+
+// profileOp は、個別の操作（Ping やサーバーの追加など）の計測を開始し、終了時に呼び出す関数を返します
+func profileOp(name string) func() {
+	p := activeProfiler
+	if p == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		d := time.Since(start)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.ops = append(p.ops, profileEntry{name: name, duration: d})
+	}
+}
+
+// format は、フェーズごとの所要時間と、所要時間の長い順に top 件の操作を表示用に整形します
+func (p *profiler) format(top int) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("フェーズごとの所要時間:\n")
+	for _, e := range p.phases {
+		fmt.Fprintf(&b, "  %-16s %v\n", e.name, e.duration.Round(time.Microsecond))
+	}
+	ops := append([]profileEntry(nil), p.ops...)
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].duration > ops[j].duration })
+	if top > 0 && len(ops) > top {
+		ops = ops[:top]
+	}
+	fmt.Fprintf(&b, "所要時間の長い操作（上位 %d 件）:\n", len(ops))
+	for _, e := range ops {
+		fmt.Fprintf(&b, "  %-40s %v\n", e.name, e.duration.Round(time.Microsecond))
+	}
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileListsPhasesAndOperations(t *testing.T) {
+	captureOutput(t)
+	setFlag(t, "profile", "true")
+	t.Cleanup(func() { activeProfiler = nil })
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://profile"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+
+	p := startProfiling()
+	if p == nil {
+		t.Fatal("-profile 指定時に startProfiling() = nil, want 計測先")
+	}
+	if _, err := applyConfig(fake, config, applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	out := p.format(1)
+	for _, want := range []string{"フェーズごとの所要時間:", "  servers ", "  algorithm ", "所要時間の長い操作（上位 1 件）:"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("-profile の出力に %q が含まれていません:\n%s", want, out)
+		}
+	}
+	ops := out[strings.Index(out, "所要時間の長い操作"):]
+	if n := strings.Count(ops, "\n") - 1; n != 1 {
+		t.Errorf("-profile の出力の操作の件数 = %d, want 1（-profile-top で指定した件数まで）:\n%s", n, out)
+	}
+}
+
+func TestProfileFormatSortsOperations(t *testing.T) {
+	p := &profiler{
+		phases: []profileEntry{{"servers", 3 * time.Millisecond}},
+		ops: []profileEntry{
+			{"add web/web-1", time.Millisecond},
+			{"add web/web-2", 5 * time.Millisecond},
+			{"ping memory://a", 2 * time.Millisecond},
+		},
+	}
+	out := p.format(0)
+	first, second, third := strings.Index(out, "web-2"), strings.Index(out, "ping"), strings.Index(out, "web-1")
+	if first < 0 || first > second || second > third {
+		t.Errorf("操作の並び順が所要時間の長い順ではありません:\n%s", out)
+	}
+	if !strings.Contains(out, "（上位 3 件）") {
+		t.Errorf("top 0 のとき全件を表示しませんでした:\n%s", out)
+	}
+}
+
+func TestProfileDisabled(t *testing.T) {
+	setFlag(t, "profile", "false")
+	if p := startProfiling(); p != nil {
+		t.Error("-profile 未指定時に startProfiling() が計測先を返しました")
+	}
+	profilePhase("servers")()
+	profileOp("add web/web-1")()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// proxyV2Options は proxy-v2-options で指定できる TLV です
+var proxyV2Options = map[string]bool{
+	"ssl":        true,
+	"cert-cn":    true,
+	"ssl-cipher": true,
+	"cert-sig":   true,
+	"cert-key":   true,
+	"authority":  true,
+	"crc32c":     true,
+	"unique-id":  true,
+}
+
+// validateProxyProtocol は、PROXY プロトコルの設定を検証します。
+// proxy_v2_options は v2 のヘッダーに付加する TLV のため、send_proxy が v2 であることを要求します
+func validateProxyProtocol(backend BackendConfig) error {
+	switch backend.SendProxy {
+	case "", "v1", "v2":
+	default:
+		return fmt.Errorf("send_proxy には v1 または v2 を指定してください（指定値: %s）", backend.SendProxy)
+	}
+	if len(backend.ProxyV2Options) == 0 {
+		return nil
+	}
+	if backend.SendProxy != "v2" {
+		return errors.New(`proxy_v2_options を指定する場合は send_proxy に "v2" を指定してください`)
+	}
+	for _, option := range backend.ProxyV2Options {
+		if !proxyV2Options[option] {
+			return fmt.Errorf("proxy_v2_options[%s]は未対応です（authority, crc32c, unique-id, ssl, cert-cn, ssl-cipher, cert-sig, cert-key）", option)
+		}
+	}
+	return nil
+}
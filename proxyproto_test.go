@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyProxyV2Options(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://proxyproto"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "send_proxy": "v2", "proxy_v2_options": ["authority", "crc32c"]},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "send_proxy": "v1"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, config, applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	servers, _ := fake.GetServers()
+	if len(servers) != 2 {
+		t.Fatalf("適用後のサーバー数 = %d, want 2", len(servers))
+	}
+	if servers[0].SendProxy != "v2" || servers[0].ProxyV2Options != "authority,crc32c" {
+		t.Errorf("web-1 = send_proxy %q proxy_v2_options %q, want v2, authority,crc32c", servers[0].SendProxy, servers[0].ProxyV2Options)
+	}
+	if got := serverLine(servers[0]); !strings.Contains(got, " send-proxy-v2 proxy-v2-options authority,crc32c") {
+		t.Errorf("web-1 の server 行 = %q, want send-proxy-v2 proxy-v2-options authority,crc32c を含むこと", got)
+	}
+	if got := serverLine(servers[1]); !strings.Contains(got, " send-proxy") || strings.Contains(got, "send-proxy-v2") {
+		t.Errorf("web-2 の server 行 = %q, want send-proxy のみ", got)
+	}
+
+	// 変更がなければ再適用してもサーバーを更新しません
+	result, err := applyConfig(fake, config, applyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range result.Backends {
+		if r.Status != StatusSkippedExists {
+			t.Errorf("再適用の %s の結果 = %s, want %s", r.Name, r.Status, StatusSkippedExists)
+		}
+	}
+}
+
+func TestValidateProxyProtocol(t *testing.T) {
+	for _, tt := range []struct {
+		sendProxy string
+		options   []string
+		valid     bool
+	}{
+		{"", nil, true},
+		{"v1", nil, true},
+		{"v2", []string{"authority", "crc32c"}, true},
+		{"v3", nil, false},
+		{"v1", []string{"authority"}, false},
+		{"", []string{"crc32c"}, false},
+		{"v2", []string{"tls-version"}, false},
+	} {
+		err := validateProxyProtocol(BackendConfig{Name: "web-1", SendProxy: tt.sendProxy, ProxyV2Options: tt.options})
+		if (err == nil) != tt.valid {
+			t.Errorf("validateProxyProtocol(send_proxy %q, proxy_v2_options %v) = %v, want 有効 %v", tt.sendProxy, tt.options, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// errRemovalDeclined は、削除の確認プロンプトで操作が拒否された場合のエラーです
+var errRemovalDeclined = errors.New("サーバーの削除が確認されなかったため中止しました")
+
+// plannedRemovals は、設定ファイルで管理しているグループに属するのに、
+// 設定ファイルに記載のないサーバー（削除対象）を返します
+func plannedRemovals(config *Config, current []haproxy.Server) []haproxy.Server {
+	managed := map[string]bool{}
+	for _, g := range config.Groups {
+		// 削除対象のグループはバックエンドごと削除するため、サーバー単位では削除しません
+		if !g.absent() {
+			managed[g.Name] = true
+		}
+	}
+	desired := map[string]bool{}
+	for _, b := range config.Backends {
+		managed[b.Group] = true
+		for _, name := range desiredServerNames(b) {
+			desired[serverKey(b.Group, name)] = true
+		}
+	}
+
+	// 同じ名前のサーバーがなく、同じ id のサーバーがある場合は名前を変更するため削除しません
+	present := map[string]bool{}
+	for _, s := range current {
+		present[serverKey(s.Backend, s.Name)] = true
+	}
+	renamedIDs := map[string]bool{}
+	for _, b := range config.Backends {
+		if b.ID > 0 && b.SRV == "" && !present[serverKey(b.Group, b.Name)] {
+			renamedIDs[serverIDKey(b.Group, int64(b.ID))] = true
+		}
+	}
+
+	var removals []haproxy.Server
+	for _, s := range current {
+		if s.ID > 0 && renamedIDs[serverIDKey(s.Backend, s.ID)] {
+			continue
+		}
+		if managed[s.Backend] && !desired[serverKey(s.Backend, s.Name)] {
+			removals = append(removals, s)
+		}
+	}
+	return removals
+}
+
+// defaultMinServers は、min_servers 未指定時に -prune 後も残すサーバー数の下限です
+const defaultMinServers = 1
+
+// minServers は、グループの min_servers（未指定時は defaultMinServers）を返します
+func (g *GroupConfig) minServers() int {
+	if g == nil || g.MinServers == nil {
+		return defaultMinServers
+	}
+	return *g.MinServers
+}
+
+// guardMinServers は、削除後に残るサーバー数が min_servers を下回るバックエンドの削除対象を除外します。
+// 削除してよいサーバーと、削除を見送ったサーバーの結果を返します（force の場合は全て削除します）
+func guardMinServers(config *Config, removals []haproxy.Server, force bool) ([]haproxy.Server, []BackendResult) {
+	if force || len(removals) == 0 {
+		return removals, nil
+	}
+	// 適用後のバックエンドには設定ファイルに記載されたサーバーのみが残ります
+	remaining := map[string]int{}
+	for _, b := range config.Backends {
+		remaining[b.Group] += len(desiredServerNames(b))
+	}
+
+	var allowed []haproxy.Server
+	var blocked []BackendResult
+	warned := map[string]bool{}
+	for _, s := range removals {
+		limit := findGroup(config, s.Backend).minServers()
+		if remaining[s.Backend] >= limit {
+			allowed = append(allowed, s)
+			continue
+		}
+		err := fmt.Errorf("削除するとバックエンド[%s]のサーバーが %d 台となり min_servers（%d）を下回ります", s.Backend, remaining[s.Backend], limit)
+		if !warned[s.Backend] {
+			warned[s.Backend] = true
+			warnf("%v。バックエンド[%s]のサーバーは削除しません（削除するには -force を指定してください）", err, s.Backend)
+		}
+		blocked = append(blocked, newBackendResult(serverKey(s.Backend, s.Name), StatusRemovalBlocked, err))
+	}
+	return allowed, blocked
+}
+
+// removeServers は、削除対象のサーバーを順に削除し、サーバーごとの結果を返します（各削除は最大 attempts 回試行します）。
+// drain が nil でなければ、各サーバーを drain して接続がなくなるのを待ってから削除します（-graceful-remove）。
+// deadline を過ぎた後のサーバーは削除せず、結果を deferred とします
+func removeServers(ctx context.Context, client haproxyClient, removals []haproxy.Server, attempts int, drain *drainPolicy, deadline *applyDeadline) []BackendResult {
+	results := make([]BackendResult, 0, len(removals))
+	for _, s := range removals {
+		if deadline.expired() {
+			results = append(results, newBackendResult(s.Name, StatusDeferred, nil))
+			continue
+		}
+		if drain != nil {
+			ok, err := drainBeforeRemove(client, s, drain)
+			if err != nil {
+				reportError(errorCategoryServer, s.Name, fmt.Sprintf("サーバー[%s]の drain に失敗したため削除しません", s.Name), err)
+				results = append(results, newBackendResult(s.Name, StatusFailedAPI, err))
+				continue
+			}
+			if !ok {
+				results = append(results, newBackendResult(s.Name, StatusRemovalBlocked, fmt.Errorf("-drain-timeout（%v）以内に接続がなくなりませんでした", drain.timeout)))
+				continue
+			}
+		}
+		if err := removeServerWithRetry(ctx, client, s, attempts); err != nil {
+			reportError(errorCategoryServer, s.Name, fmt.Sprintf("サーバー[%s]の削除に最終的に失敗", s.Name), err)
+			results = append(results, newBackendResult(s.Name, StatusFailedAPI, err))
+			continue
+		}
+		emitRemoval(changeStageApplied, s)
+		results = append(results, newBackendResult(s.Name, StatusRemoved, nil))
+	}
+	return results
+}
+
+// confirmRemovals は、削除対象のサーバーを一覧表示し、"yes" と入力された場合のみ true を返します
+func confirmRemovals(in io.Reader, out io.Writer, removals []haproxy.Server) (bool, error) {
+	fmt.Fprintf(out, "以下の %d 台のサーバーを削除します:\n", len(removals))
+	for _, s := range removals {
+		fmt.Fprintf(out, "  - %s (%s)\n", serverKey(s.Backend, s.Name), serverAddress(s))
+	}
+	fmt.Fprint(out, "続行するには yes と入力してください: ")
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("確認入力の読み込みに失敗: %w", err)
+	}
+	return strings.TrimSpace(answer) == "yes", nil
+}
+
+// stdinConfirm は、標準入力から削除の確認を受け付けます
+func stdinConfirm(removals []haproxy.Server) (bool, error) {
+	return confirmRemovals(os.Stdin, os.Stdout, removals)
+}
+
+// stdinIsTerminal は、標準入力が端末に接続されているかを返します。削除前の確認と -interactive の確認の
+// どちらもこの判定を使用します（テスト用に差し替えられます）
+var stdinIsTerminal = func() bool { return isTerminal(os.Stdin) }
+
+// isTerminal は、ファイルが端末（TTY）に接続されているかを返します
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+func TestConfirmRemovalsRequiresYes(t *testing.T) {
+	removals := []haproxy.Server{{Backend: "web", Name: "web-3", IP: "10.0.0.3", Port: 80}}
+	for input, want := range map[string]bool{"yes\n": true, " yes \n": true, "y\n": false, "no\n": false, "": false} {
+		var out bytes.Buffer
+		got, err := confirmRemovals(strings.NewReader(input), &out, removals)
+		if err != nil {
+			t.Fatalf("confirmRemovals(%q) がエラーを返しました: %v", input, err)
+		}
+		if got != want {
+			t.Errorf("confirmRemovals(%q) = %v, want %v", input, got, want)
+		}
+		if !strings.Contains(out.String(), "web/web-3 (10.0.0.3:80)") {
+			t.Errorf("確認の表示に削除対象のサーバーが含まれていません: %q", out.String())
+		}
+	}
+}
+
+// pruneTestClient は、設定にない web-3 を含む3台のサーバーがあるメモリ上のインスタンスを返します
+func pruneTestClient(t *testing.T, config *Config) *haproxyfake.HAProxy {
+	client := haproxyfake.New()
+	if _, err := applyConfig(client, config, applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddServer(&haproxy.Server{Backend: "web", Name: "web-3", IP: "10.0.0.3", Port: 80, Weight: 10}); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// withStdinTerminal は、テストの間だけ標準入力が端末に接続されているかの判定を差し替えます
+func withStdinTerminal(t *testing.T, terminal bool) {
+	t.Helper()
+	prev := stdinIsTerminal
+	stdinIsTerminal = func() bool { return terminal }
+	t.Cleanup(func() { stdinIsTerminal = prev })
+}
+
+// withStdin は、テストの間だけ標準入力を input を内容とするファイルに差し替えます
+func withStdin(t *testing.T, input string) {
+	t.Helper()
+	f, err := os.Open(writeTestFile(t, "stdin", input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := os.Stdin
+	os.Stdin = f
+	t.Cleanup(func() {
+		os.Stdin = prev
+		f.Close()
+	})
+}
+
+func TestApplyOnceAsksBeforeRemovingOnlyOnTerminal(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		terminal bool
+		yes      bool
+		asked    bool // 確認を求め、拒否されること
+	}{
+		{"端末以外からの実行は確認せずに削除する", false, false, false},
+		{"端末からの実行は確認を求める", true, false, true},
+		{"-yes 指定時は端末でも確認しない", true, true, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			captureOutput(t)
+			endpoint, fake := testMemoryEndpoint(t)
+			config := loadTestConfig(t, `{
+				"haproxy_endpoint": ["`+endpoint+`"],
+				"load_balancing_algorithm": "roundrobin",
+				"backends": [
+					{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+					{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+				]
+			}`)
+			if err := fake.AddServer(&haproxy.Server{Backend: "web", Name: "web-3", IP: "10.0.0.3", Port: 80, Weight: 10}); err != nil {
+				t.Fatal(err)
+			}
+			setFlag(t, "prune", "true")
+			setFlag(t, "yes", fmt.Sprint(tt.yes))
+			withStdinTerminal(t, tt.terminal)
+			withStdin(t, "no\n") // 確認を求めた場合は拒否します
+
+			err := applyOnce(context.Background(), config)
+			var names []string
+			servers, _ := fake.GetServers()
+			for _, s := range servers {
+				names = append(names, s.Name)
+			}
+			if tt.asked {
+				if !errors.Is(err, errRemovalDeclined) {
+					t.Errorf("applyOnce のエラー = %v, want errRemovalDeclined（確認で拒否）", err)
+				}
+				if strings.Join(names, ",") != "web-3" {
+					t.Errorf("拒否した後のサーバー = %v, want [web-3]（何も変更しないこと）", names)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyOnce がエラーを返しました: %v", err)
+			}
+			if strings.Join(names, ",") != "web-1,web-2" {
+				t.Errorf("適用後のサーバー = %v, want [web-1 web-2]（確認せずに web-3 を削除すること）", names)
+			}
+		})
+	}
+}
+
+func TestPruneAsksBeforeRemoving(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://prune"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+
+	declined := pruneTestClient(t, config)
+	var asked []haproxy.Server
+	_, err := applyConfig(declined, config, applyOptions{prune: true, confirmRemoval: func(removals []haproxy.Server) (bool, error) {
+		asked = removals
+		return false, nil
+	}})
+	if !errors.Is(err, errRemovalDeclined) {
+		t.Fatalf("拒否した場合の applyConfig のエラー = %v, want errRemovalDeclined", err)
+	}
+	if len(asked) != 1 || asked[0].Name != "web-3" {
+		t.Errorf("確認した削除対象 = %+v, want web-3 のみ", asked)
+	}
+	if servers, _ := declined.GetServers(); len(servers) != 3 {
+		t.Errorf("拒否した後のサーバー数 = %d, want 3（何も削除しないこと）", len(servers))
+	}
+
+	confirmed := pruneTestClient(t, config)
+	result, err := applyConfig(confirmed, config, applyOptions{prune: true, confirmRemoval: func([]haproxy.Server) (bool, error) { return true, nil }})
+	if err != nil {
+		t.Fatalf("確認した場合の applyConfig がエラーを返しました: %v", err)
+	}
+	if len(result.Removed) != 1 || result.Removed[0].Status != StatusRemoved {
+		t.Errorf("削除の結果 = %+v, want web-3 を removed", result.Removed)
+	}
+	if servers, _ := confirmed.GetServers(); len(servers) != 2 {
+		t.Errorf("確認した後のサーバー数 = %d, want 2", len(servers))
+	}
+}
+
+func TestPruneRespectsMinServers(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://min-servers"],
+		"load_balancing_algorithm": "roundrobin",
+		"groups": [{"name": "web", "min_servers": 2}],
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+
+	blocked := pruneTestClient(t, config)
+	result, err := applyConfig(blocked, config, applyOptions{prune: true})
+	if err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	if len(result.Removed) != 1 || result.Removed[0].Status != StatusRemovalBlocked {
+		t.Errorf("削除の結果 = %+v, want web-3 を %s", result.Removed, StatusRemovalBlocked)
+	}
+	if servers, _ := blocked.GetServers(); len(servers) != 2 {
+		t.Errorf("削除を見送った後のサーバー数 = %d, want 2（min_servers を下回る削除はしないこと）", len(servers))
+	}
+	if got := warnings.count(); got != 1 {
+		t.Errorf("警告の件数 = %d, want 1（バックエンドごとに1回）", got)
+	}
+
+	forced := pruneTestClient(t, config)
+	result, err = applyConfig(forced, config, applyOptions{prune: true, force: true})
+	if err != nil {
+		t.Fatalf("-force を指定した applyConfig がエラーを返しました: %v", err)
+	}
+	if len(result.Removed) != 1 || result.Removed[0].Status != StatusRemoved {
+		t.Errorf("-force を指定した削除の結果 = %+v, want web-3 を removed", result.Removed)
+	}
+	if servers, _ := forced.GetServers(); len(servers) != 1 {
+		t.Errorf("-force を指定した後のサーバー数 = %d, want 1", len(servers))
+	}
+}
+
+func TestValidateMinServers(t *testing.T) {
+	err := validateTestConfig(t, `{
+		"haproxy_endpoint": ["memory://min-servers"],
+		"load_balancing_algorithm": "roundrobin",
+		"groups": [{"name": "web", "min_servers": -1}],
+		"backends": []
+	}`)
+	if err == nil {
+		t.Error("負の min_servers の検証がエラーになりませんでした")
+	}
+}
+
+func TestSeedSkipsRemovalsOnInitialApply(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://seed"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if err := fake.AddServer(&haproxy.Server{Backend: "web", Name: "web-9", IP: "10.0.0.9", Port: 80, Weight: 10}); err != nil {
+		t.Fatal(err)
+	}
+	opts := applyOptions{prune: true, seed: true}
+
+	result, err := applyConfig(fake, config, opts)
+	if err != nil {
+		t.Fatalf("初回の applyConfig がエラーを返しました: %v", err)
+	}
+	if !result.Seeded || len(result.Removed) != 0 {
+		t.Errorf("初回の適用 = seeded %v removed %+v, want seeded で削除なし", result.Seeded, result.Removed)
+	}
+	if servers, _ := fake.GetServers(); len(servers) != 3 {
+		t.Errorf("初回の適用後のサーバー数 = %d, want 3（web-9 を削除しないこと）", len(servers))
+	}
+
+	// 管理対象のサーバーが存在する2回目以降は通常どおり削除します
+	result, err = applyConfig(fake, config, opts)
+	if err != nil {
+		t.Fatalf("2回目の applyConfig がエラーを返しました: %v", err)
+	}
+	if result.Seeded || len(result.Removed) != 1 || result.Removed[0].Status != StatusRemoved {
+		t.Errorf("2回目の適用 = seeded %v removed %+v, want web-9 を removed", result.Seeded, result.Removed)
+	}
+}
+
+func TestPruneOnlyRemovesWithoutAdding(t *testing.T) {
+	captureOutput(t)
+	initial := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://prune-only"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	client := pruneTestClient(t, initial)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://prune-only"],
+		"load_balancing_algorithm": "leastconn",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 50, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-4", "ip": "10.0.0.4", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+
+	asked := false
+	result, err := applyConfig(client, config, applyOptions{prune: true, pruneOnly: true, confirmRemoval: func([]haproxy.Server) (bool, error) {
+		asked = true
+		return true, nil
+	}})
+	if err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	if !asked {
+		t.Error("-prune-only で削除の確認を求めませんでした")
+	}
+	if len(result.Backends) != 0 || len(result.Removed) != 1 || result.Removed[0].Status != StatusRemoved {
+		t.Errorf("適用結果 = backends %+v removed %+v, want web-3 の削除のみ", result.Backends, result.Removed)
+	}
+	servers, _ := client.GetServers()
+	if len(servers) != 2 || servers[0].Name != "web-1" || servers[0].Weight != 10 || servers[1].Name != "web-2" {
+		t.Errorf("適用後のサーバー = %+v, want web-1（重み 10 のまま）, web-2（追加・更新をしないこと）", servers)
+	}
+	if got := client.Algorithm(); got != "roundrobin" {
+		t.Errorf("適用後のアルゴリズム = %q, want roundrobin（servers 以外のフェーズを実行しないこと）", got)
+	}
+}
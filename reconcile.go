@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// reconcileServers は、HAProxy上の現在のサーバー一覧と設定ファイルのバックエンドを比較し、
+// 足りないサーバーの追加と、内容が異なるサーバーの更新を行います。
+// opts.prune が有効な場合は、設定ファイルに記載のないサーバーを最後に削除します（min_servers を下回る削除は行いません）。
+// opts.pruneOnly が有効な場合は追加・更新を行わず、削除のみを行います。
+// グループは depends_on の依存関係順に適用し、opts.parallelBackends が有効な場合は
+// 同じグループ内のサーバーを並列に適用します。opts.tags で対象外となったバックエンドは変更しません
+func reconcileServers(client haproxyClient, config *Config, opts applyOptions) (*Result, error) {
+	groups, err := orderGroups(config)
+	if err != nil {
+		return nil, err
+	}
+
+	state, current, err := loadLiveState(client, config)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+
+	// -prune-only 指定時はサーバーの追加・更新を行わず、削除のみを行います
+	if opts.pruneOnly {
+		groups = nil
+	}
+
+	// -seed 指定時、管理対象のサーバーがまだ1台もない接続先には追加のみを行います
+	if opts.seed && isInitialTarget(config, state) {
+		logf("管理対象のサーバーが存在しないため、初回の適用（seed）として削除を行わずに適用します\n")
+		result.Seeded = true
+	}
+
+	// -prune 指定時は削除対象を決定します（min_servers を下回る削除は除きます）
+	var removals []haproxy.Server
+	var blocked []BackendResult
+	if opts.prune && !result.Seeded {
+		removals, blocked = guardMinServers(config, opts.tags.filterRemovals(plannedRemovals(config, current)), opts.force)
+	}
+
+	// -max-change-percent 指定時は、変更が多すぎる場合に何も変更せず中止します
+	if opts.maxChangePercent > 0 && !opts.force {
+		if err := checkChangeLimit(plannedChanges(config, state, groups, opts, removals), len(current), opts.maxChangePercent); err != nil {
+			return nil, err
+		}
+	}
+
+	// 削除を伴う場合は、変更を始める前に確認を求めます
+	if len(removals) > 0 && opts.confirmRemoval != nil {
+		ok, err := opts.confirmRemoval(removals)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errRemovalDeclined
+		}
+	}
+
+	for _, group := range groups {
+		backends := opts.tags.filter(group.backends)
+		backends = skipUnresolvable(opts.resolver, result, backends)
+		// 一括追加に対応したクライアントでは、連続して新規に追加するサーバーをまとめて送ります。
+		// まとめるのは order の並びで隣り合うサーバーのみとし、他のサーバーとの適用順は変えません
+		batch, _ := client.(batchServerAdder)
+		for _, run := range splitBatchRuns(config, state, backends, batch != nil) {
+			if len(run.servers) > 0 && !opts.deadline.expired() {
+				result.Backends = append(result.Backends, addServersInBatches(opts.context(), batch, run.backends, run.servers, opts.operationAttempts())...)
+				continue
+			}
+			result.Backends = append(result.Backends, reconcileBackends(client, config, state, run.backends, opts, result)...)
+		}
+	}
+	result.Removed = append(removeServers(opts.context(), client, removals, opts.operationAttempts(), opts.drain, opts.deadline), blocked...)
+	for _, r := range result.Removed {
+		if r.Status == StatusDeferred {
+			result.DeadlineExceeded = true
+		}
+	}
+	return result, nil
+}
+
+// reconcileBackends は、サーバーを1台ずつ（-parallel-backends 指定時は並行して）追加・更新し、order の順に結果を返します。
+// max_apply_duration を過ぎた後のサーバーは開始せず、打ち切りとして記録します
+func reconcileBackends(client haproxyClient, config *Config, state *liveState, backends []BackendConfig, opts applyOptions, result *Result) []BackendResult {
+	results := make([]BackendResult, len(backends))
+	if opts.parallelBackends {
+		var wg sync.WaitGroup
+		for i, backend := range backends {
+			if opts.deadline.expired() {
+				results[i] = deferBackend(result, backend)
+				continue
+			}
+			wg.Add(1)
+			go func(i int, backend BackendConfig) {
+				defer wg.Done()
+				results[i] = reconcileBackend(opts.context(), client, config, state, backend, opts.operationAttempts())
+			}(i, backend)
+		}
+		wg.Wait()
+		return results
+	}
+	for i, backend := range backends {
+		if opts.deadline.expired() {
+			results[i] = deferBackend(result, backend)
+			continue
+		}
+		results[i] = reconcileBackend(opts.context(), client, config, state, backend, opts.operationAttempts())
+	}
+	return results
+}
+
+// deferBackend は、max_apply_duration を過ぎたため開始しなかったサーバーの結果を返し、適用の打ち切りを記録します
+func deferBackend(result *Result, backend BackendConfig) BackendResult {
+	result.DeadlineExceeded = true
+	return newBackendResultFor(backend, StatusDeferred, nil)
+}
+
+// isInitialTarget は、設定ファイルに記載されたサーバーとサーバーテンプレートが接続先に1台も存在しないか
+// （空のHAProxyへの初回の適用か）を返します
+func isInitialTarget(config *Config, state *liveState) bool {
+	for _, b := range config.Backends {
+		if _, ok := state.templates[serverKey(b.Group, b.Name)]; ok {
+			return false
+		}
+		if _, ok := state.ids[serverIDKey(b.Group, int64(b.ID))]; ok && b.ID > 0 {
+			return false
+		}
+		for _, name := range desiredServerNames(b) {
+			if _, ok := state.servers[serverKey(b.Group, name)]; ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// liveState は、適用開始時点でHAProxy上に存在するサーバーとサーバーテンプレートです
+type liveState struct {
+	servers   map[string]haproxy.Server         // serverKey をキーとするサーバー
+	ids       map[string]haproxy.Server         // serverIDKey をキーとする、id を持つサーバー
+	templates map[string]haproxy.ServerTemplate // serverKey（プレフィックス）をキーとするテンプレート
+
+	// fill は、クライアントが返さない項目を設定ファイルの値で補います（partialServerReader のクライアントのみ）
+	fill func(cur, desired haproxy.Server) haproxy.Server
+}
+
+// partialServerReader は、GetServers でサーバー定義の一部の項目しか返せないクライアントです（runtime socket）。
+// 返せない項目は設定ファイルの値で補い、常に差分があるとみなして更新し続けないようにします
+type partialServerReader interface {
+	fillUnreadServerFields(cur, desired haproxy.Server) haproxy.Server
+}
+
+// server は、サーバー定義に対応する現在のサーバーを返します（存在しない場合は nil）。
+// 同じ名前のサーバーがなく id が指定されている場合は、同じバックエンドで同じ id のサーバー（名前の変更前）を返します
+func (s *liveState) server(desired haproxy.Server) *haproxy.Server {
+	cur, ok := s.servers[serverKey(desired.Backend, desired.Name)]
+	if !ok && desired.ID > 0 {
+		cur, ok = s.ids[serverIDKey(desired.Backend, desired.ID)]
+	}
+	if !ok {
+		return nil
+	}
+	if s.fill != nil {
+		cur = s.fill(cur, desired)
+	}
+	return &cur
+}
+
+// serverIDKey は、バックエンド名とサーバーの id からサーバーを一意に識別するキーを返します
+func serverIDKey(backend string, id int64) string {
+	return fmt.Sprintf("%s/#%d", backend, id)
+}
+
+// template は、server-template と同じバックエンド・プレフィックスの現在のテンプレートを返します（存在しない場合は nil）
+func (s *liveState) template(desired haproxy.ServerTemplate) *haproxy.ServerTemplate {
+	cur, ok := s.templates[serverKey(desired.Backend, desired.Prefix)]
+	if !ok {
+		return nil
+	}
+	return &cur
+}
+
+// loadLiveState は、HAProxy上の現在のサーバーとサーバーテンプレートを取得します
+func loadLiveState(client haproxyClient, config *Config) (*liveState, []haproxy.Server, error) {
+	current, err := client.GetServers()
+	if err != nil {
+		return nil, nil, fmt.Errorf("現在のサーバー一覧の取得に失敗: %w", err)
+	}
+	state := &liveState{servers: make(map[string]haproxy.Server, len(current)), ids: make(map[string]haproxy.Server)}
+	if p, ok := client.(partialServerReader); ok {
+		state.fill = p.fillUnreadServerFields
+	}
+	for _, s := range current {
+		state.servers[serverKey(s.Backend, s.Name)] = s
+		if s.ID > 0 {
+			state.ids[serverIDKey(s.Backend, s.ID)] = s
+		}
+	}
+	if state.templates, err = currentTemplates(client, config); err != nil {
+		return nil, nil, err
+	}
+	return state, current, nil
+}
+
+// reconcileBackend は、1つのバックエンドサーバーを現在の状態と比較して追加または更新します（各操作は最大 attempts 回試行します）
+func reconcileBackend(ctx context.Context, client haproxyClient, config *Config, state *liveState, backend BackendConfig, attempts int) BackendResult {
+	if err := validateBackend(backend); err != nil {
+		reportError(errorCategoryConfig, backend.Name, fmt.Sprintf("サーバー%sの設定が不正なためスキップします", backendLabel(backend)), err)
+		return newBackendResultFor(backend, StatusFailedValidation, err)
+	}
+	if backend.SRV != "" {
+		return reconcileTemplate(client, config, state, backend)
+	}
+
+	server := buildServer(config, backend)
+	cur := state.server(server)
+	switch decideServer(state, server).action {
+	case actionAdd:
+		if err := addServerWithRetry(ctx, client, server, attempts); err != nil {
+			reportError(errorCategoryServer, backend.Name, fmt.Sprintf("サーバー%sの追加に最終的に失敗", backendLabel(backend)), err)
+			return newBackendResultFor(backend, StatusFailedAPI, err)
+		}
+		emitServerChanges(changeStageApplied, actionAdd, nil, server)
+		return newBackendResultFor(backend, StatusAdded, nil)
+	case actionSkip:
+		logf("サーバー[%s]は既に同じ内容で存在するためスキップしました\n", server.Name)
+		return newBackendResultFor(backend, StatusSkippedExists, nil)
+	case actionCheck:
+		if err := applyServerUpdate(ctx, client, cur, server, attempts); err != nil {
+			reportError(errorCategoryServer, backend.Name, fmt.Sprintf("サーバー%sのヘルスチェックの切り替えに最終的に失敗", backendLabel(backend)), err)
+			return newBackendResultFor(backend, StatusFailedAPI, err)
+		}
+		health := "無効"
+		if server.Check {
+			health = "有効"
+		}
+		logf("サーバー[%s]のヘルスチェックを%sにしました\n", server.Name, health)
+		emitServerChanges(changeStageApplied, actionCheck, cur, server)
+		return newBackendResultFor(backend, StatusUpdated, nil)
+	case actionRename:
+		if err := renameServerWithRetry(ctx, client, cur.Name, server, attempts); err != nil {
+			reportError(errorCategoryServer, backend.Name, fmt.Sprintf("サーバー%sの名前の変更に最終的に失敗", backendLabel(backend)), err)
+			return newBackendResultFor(backend, StatusFailedAPI, err)
+		}
+		emitServerChanges(changeStageApplied, actionRename, cur, server)
+		return newBackendResultFor(backend, StatusUpdated, nil)
+	default: // actionUpdate
+		if err := applyServerUpdate(ctx, client, cur, server, attempts); err != nil {
+			reportError(errorCategoryServer, backend.Name, fmt.Sprintf("サーバー%sの更新に最終的に失敗", backendLabel(backend)), err)
+			return newBackendResultFor(backend, StatusFailedAPI, err)
+		}
+		emitServerChanges(changeStageApplied, actionUpdate, cur, server)
+		return newBackendResultFor(backend, StatusUpdated, nil)
+	}
+}
+
+// backendLabel は、ログ出力用にサーバー名と管理者を "[name]（owner: team）" の形式で返します
+func backendLabel(backend BackendConfig) string {
+	if backend.Owner == "" {
+		return "[" + backend.Name + "]"
+	}
+	return fmt.Sprintf("[%s]（owner: %s）", backend.Name, backend.Owner)
+}
+
+// serverKey は、バックエンド名とサーバー名からサーバーを一意に識別するキーを返します
+func serverKey(backend, name string) string {
+	return backend + "/" + name
+}
+
+// buildServer は、バックエンド設定とヘルスチェック設定から HAProxy のサーバー定義を組み立てます
+func buildServer(config *Config, backend BackendConfig) haproxy.Server {
+	backend = applyWebsocketServerDefaults(applyServerDefaults(config, backend))
+	hc := effectiveHealthCheck(config, backend)
+	server := haproxy.Server{
+		Backend: backend.Group,
+		Name:    backend.Name,
+		IP:      backend.IP,
+		Port:    backend.Port,
+		Weight:  int64(backend.Weight),
+		Maxconn: int64(backend.Maxconn),
+		Source:  backend.Source,
+		Check:   hc.Enabled,
+		SSL:     backend.SSL,
+		Alpn:    strings.Join(backend.ALPN, ","),
+		Npn:     strings.Join(backend.NPN, ","),
+		Verify:  backend.Verify,
+		Sni:     backend.SNI,
+		ID:      int64(backend.ID),
+
+		Metadata:       copyLabels(backend.Labels),
+		SSLCertificate: backend.SSLClientCert,
+		SendProxy:      backend.SendProxy,
+		ProxyV2Options: strings.Join(backend.ProxyV2Options, ","),
+		Track:          backend.Track,
+	}
+	// unix ソケットのサーバーはポートを持たず、アドレスを unix@ 形式で指定します
+	if backend.Socket != "" {
+		server.IP, server.Port = unixAddressPrefix+backend.Socket, 0
+	}
+	// track で追従するサーバーは自身のヘルスチェックを行いません
+	if backend.Track != "" {
+		server.Check = false
+	}
+	// ヘルスチェックが有効な場合のパラメータを設定
+	if server.Check {
+		server.Inter = fmt.Sprintf("%ds", hc.Interval)
+		server.Fall = hc.Fall
+		server.Rise = hc.Rise
+		// downinter / fastinter は指定された場合のみ反映（検証済みのため変換エラーは起きない）
+		if hc.Downinter != "" {
+			server.Downinter, _ = haproxyDuration(hc.Downinter)
+		}
+		if hc.Fastinter != "" {
+			server.Fastinter, _ = haproxyDuration(hc.Fastinter)
+		}
+		server.CheckAddr, server.CheckPort = hc.Address, hc.Port
+	}
+	return server
+}
+
+// effectiveHealthCheck は、バックエンドに適用するヘルスチェック設定を返します。
+// 全体の設定に、バックエンド個別に指定された項目のみを上書きします
+func effectiveHealthCheck(config *Config, backend BackendConfig) HealthCheckConfig {
+	return backend.HealthCheck.merge(config.HealthCheck)
+}
+
+// merge は、base のうち上書き設定で指定された項目のみを置き換えた設定を返します（o が nil なら base のまま）
+func (o *HealthCheckOverride) merge(base HealthCheckConfig) HealthCheckConfig {
+	if o == nil {
+		return base
+	}
+	if o.Enabled != nil {
+		base.Enabled = *o.Enabled
+	}
+	if o.Interval != nil {
+		base.Interval = *o.Interval
+	}
+	if o.Fall != nil {
+		base.Fall = *o.Fall
+	}
+	if o.Rise != nil {
+		base.Rise = *o.Rise
+	}
+	if o.Type != nil {
+		base.Type = *o.Type
+	}
+	if o.Downinter != nil {
+		base.Downinter = *o.Downinter
+	}
+	if o.Fastinter != nil {
+		base.Fastinter = *o.Fastinter
+	}
+	if o.CheckSend != nil {
+		base.CheckSend = *o.CheckSend
+	}
+	if o.CheckExpect != nil {
+		base.CheckExpect = *o.CheckExpect
+	}
+	if o.Address != nil {
+		base.Address = *o.Address
+	}
+	if o.Port != nil {
+		base.Port = *o.Port
+	}
+	return base
+}
+
+// serverMatches は、現在のサーバー定義が設定から組み立てたサーバー定義と一致するかを返します
+func serverMatches(current, desired haproxy.Server) bool {
+	return current.Backend == desired.Backend &&
+		current.Name == desired.Name &&
+		current.IP == desired.IP &&
+		current.Port == desired.Port &&
+		current.Weight == desired.Weight &&
+		current.Maxconn == desired.Maxconn &&
+		current.Source == desired.Source &&
+		current.Check == desired.Check &&
+		current.Inter == desired.Inter &&
+		current.Fall == desired.Fall &&
+		current.Rise == desired.Rise &&
+		current.Downinter == desired.Downinter &&
+		current.Fastinter == desired.Fastinter &&
+		current.CheckAddr == desired.CheckAddr &&
+		current.CheckPort == desired.CheckPort &&
+		current.SSL == desired.SSL &&
+		current.Alpn == desired.Alpn &&
+		current.Npn == desired.Npn &&
+		current.Verify == desired.Verify &&
+		current.Sni == desired.Sni &&
+		current.SSLCertificate == desired.SSLCertificate &&
+		current.ID == desired.ID &&
+		current.SendProxy == desired.SendProxy &&
+		current.ProxyV2Options == desired.ProxyV2Options &&
+		current.Track == desired.Track &&
+		formatLabels(current.Metadata) == formatLabels(desired.Metadata)
+}
+
+// validateBackend は、1つのバックエンドサーバー設定を検証します
+func validateBackend(backend BackendConfig) error {
+	if backend.Name == "" {
+		return errors.New("name が指定されていません")
+	}
+	if err := validateLabels(backend.Labels); err != nil {
+		return err
+	}
+	if backend.SRV != "" {
+		if len(backend.Labels) > 0 {
+			return errors.New("labels は srv（server-template）のサーバーには指定できません")
+		}
+		return validateTemplate(backend)
+	}
+	switch {
+	case backend.Socket != "":
+		if backend.IP != "" || backend.Port != 0 {
+			return errors.New("socket と ip / port は同時に指定できません")
+		}
+		if !strings.HasPrefix(backend.Socket, "/") {
+			return fmt.Errorf("socket[%s]は絶対パスで指定してください", backend.Socket)
+		}
+	case backend.IP == "":
+		return errors.New("ip / port または socket のいずれかを指定してください")
+	case backend.Port < 1 || backend.Port > 65535:
+		return fmt.Errorf("port は 1〜65535 の範囲で指定してください（指定値: %d）", backend.Port)
+	}
+	if backend.ID < 0 {
+		return fmt.Errorf("id は 1 以上の整数で指定してください（指定値: %d）", backend.ID)
+	}
+	if backend.Weight < 0 || backend.Weight > 256 {
+		return fmt.Errorf("weight は 0〜256 の範囲で指定してください（指定値: %d）", backend.Weight)
+	}
+	if backend.Maxconn < 0 {
+		return fmt.Errorf("maxconn は 0 以上で指定してください（指定値: %d）", backend.Maxconn)
+	}
+	if backend.Source != "" {
+		if err := validateSource(backend.Source); err != nil {
+			return err
+		}
+	}
+	if err := validateBackendTLS(backend); err != nil {
+		return err
+	}
+	if err := validateProxyProtocol(backend); err != nil {
+		return err
+	}
+	// 指定された項目のみを検証します（未指定の項目は全体の設定として検証済み）
+	if backend.HealthCheck != nil {
+		if err := backend.HealthCheck.merge(HealthCheckConfig{}).validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSource は、送信元アドレスが IP アドレス、または IP アドレスとポートの組であるかを検証します
+// （IPv6 とポートを組み合わせる場合は "[2001:db8::1]:0" のように角括弧で囲みます）
+func validateSource(source string) error {
+	if net.ParseIP(source) != nil {
+		return nil
+	}
+	host, port, err := net.SplitHostPort(source)
+	if err != nil || net.ParseIP(host) == nil {
+		return fmt.Errorf("source[%s]は不正なアドレスです（例: 10.0.0.5, 10.0.0.5:0）", source)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("source[%s]のポートは 0〜65535 の範囲で指定してください", source)
+	}
+	return nil
+}
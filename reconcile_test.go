@@ -0,0 +1,295 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildServerHealthCheckIntervals(t *testing.T) {
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://reconcile"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2, "downinter": "10s"},
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10,
+				"health_check": {"interval": 5, "fastinter": "500ms"}},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "health_check": {"enabled": false}}
+		]
+	}`)
+
+	web1 := buildServer(config, config.Backends[0])
+	if !web1.Check || web1.Inter != "2s" || web1.Downinter != "10000ms" || web1.Fastinter != "" {
+		t.Errorf("web-1 = check %v inter %q downinter %q fastinter %q, want 全体の設定（2s, 10000ms）", web1.Check, web1.Inter, web1.Downinter, web1.Fastinter)
+	}
+	web2 := buildServer(config, config.Backends[1])
+	if web2.Inter != "5s" || web2.Downinter != "10000ms" || web2.Fastinter != "500ms" || web2.Fall != 3 {
+		t.Errorf("web-2 = inter %q downinter %q fastinter %q fall %d, want 指定した項目のみ上書き（5s, 10000ms, 500ms, 3）", web2.Inter, web2.Downinter, web2.Fastinter, web2.Fall)
+	}
+	web3 := buildServer(config, config.Backends[2])
+	if web3.Check || web3.Inter != "" || web3.Downinter != "" {
+		t.Errorf("web-3 = check %v inter %q downinter %q, want ヘルスチェックなし", web3.Check, web3.Inter, web3.Downinter)
+	}
+}
+
+func TestHealthCheckIntervalsRejectInvalidDuration(t *testing.T) {
+	for _, value := range []string{"10", "0.5us"} {
+		err := validateTestConfig(t, `{
+			"haproxy_endpoint": ["memory://reconcile"],
+			"load_balancing_algorithm": "roundrobin",
+			"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2, "fastinter": "`+value+`"},
+			"backends": []
+		}`)
+		if err == nil {
+			t.Errorf("fastinter %q の検証がエラーになりませんでした", value)
+		}
+	}
+}
+
+func TestApplySourceAddress(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://source"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "db-1", "ip": "10.0.0.1", "port": 5432, "weight": 10, "group": "db", "source": "10.0.9.5"},
+			{"name": "db-2", "ip": "10.0.0.2", "port": 5432, "weight": 10, "group": "db"},
+			{"name": "db-3", "ip": "10.0.0.3", "port": 5432, "weight": 10, "group": "db", "source": "10.0.9.5:70000"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	result, err := applyConfig(fake, config, applyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers, _ := fake.GetServers()
+	if len(servers) != 2 || servers[0].Source != "10.0.9.5" || servers[1].Source != "" {
+		t.Errorf("適用後のサーバー = %+v, want db-1 のみ source 10.0.9.5", servers)
+	}
+	if status := result.Backends[2].Status; status != StatusFailedValidation {
+		t.Errorf("db-3 の結果 = %s, want %s（不正なポート）", status, StatusFailedValidation)
+	}
+}
+
+func TestValidateSource(t *testing.T) {
+	for source, valid := range map[string]bool{
+		"10.0.0.5":         true,
+		"10.0.0.5:0":       true,
+		"2001:db8::1":      true,
+		"[2001:db8::1]:80": true,
+		"lb.internal":      false,
+		"10.0.0.5:http":    false,
+		"10.0.0.5:65536":   false,
+	} {
+		if err := validateSource(source); (err == nil) != valid {
+			t.Errorf("validateSource(%q) = %v, want 有効 %v", source, err, valid)
+		}
+	}
+}
+
+func TestEffectiveHealthCheckDeepMerge(t *testing.T) {
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://merge"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2, "type": "tcp"},
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "health_check": {"interval": 10}},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "health_check": {"rise": 5, "enabled": false}},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10}
+		]
+	}`)
+
+	for _, tt := range []struct {
+		backend int
+		want    HealthCheckConfig
+	}{
+		{0, HealthCheckConfig{Enabled: true, Interval: 10, Fall: 3, Rise: 2, Type: "tcp"}},
+		{1, HealthCheckConfig{Enabled: false, Interval: 2, Fall: 3, Rise: 5, Type: "tcp"}},
+		{2, config.HealthCheck},
+	} {
+		if got := effectiveHealthCheck(config, config.Backends[tt.backend]); got != tt.want {
+			t.Errorf("%s の health_check = %+v, want %+v（指定した項目のみ上書き）", config.Backends[tt.backend].Name, got, tt.want)
+		}
+	}
+	if config.HealthCheck.Interval != 2 || config.HealthCheck.Rise != 2 {
+		t.Errorf("全体の health_check = %+v, want 変更されないこと", config.HealthCheck)
+	}
+}
+
+func TestApplyUnixSocketServer(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://unix"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "app-1", "socket": "/run/app/app.sock", "weight": 10, "group": "app"},
+			{"name": "app-2", "ip": "10.0.0.2", "port": 8080, "weight": 10, "group": "app"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, config, applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	servers, _ := fake.GetServers()
+	if len(servers) != 2 {
+		t.Fatalf("適用後のサーバー数 = %d, want 2", len(servers))
+	}
+	if servers[0].IP != "unix@/run/app/app.sock" || servers[0].Port != 0 {
+		t.Errorf("app-1 のアドレス = %s:%d, want unix@/run/app/app.sock（ポートなし）", servers[0].IP, servers[0].Port)
+	}
+	if got := serverLine(servers[0]); !strings.HasPrefix(got, "server app-1 unix@/run/app/app.sock ") {
+		t.Errorf("app-1 の server 行 = %q, want unix@ 形式のアドレス", got)
+	}
+	if got := serverLine(servers[1]); !strings.HasPrefix(got, "server app-2 10.0.0.2:8080 ") {
+		t.Errorf("app-2 の server 行 = %q, want ip:port 形式のアドレス", got)
+	}
+}
+
+func TestValidateBackendSocketExclusive(t *testing.T) {
+	for _, tt := range []struct {
+		backend BackendConfig
+		valid   bool
+	}{
+		{BackendConfig{Name: "a", Socket: "/run/app.sock", Weight: 10}, true},
+		{BackendConfig{Name: "a", IP: "10.0.0.1", Port: 80, Weight: 10}, true},
+		{BackendConfig{Name: "a", Socket: "/run/app.sock", IP: "10.0.0.1", Weight: 10}, false},
+		{BackendConfig{Name: "a", Socket: "/run/app.sock", Port: 80, Weight: 10}, false},
+		{BackendConfig{Name: "a", Socket: "run/app.sock", Weight: 10}, false},
+		{BackendConfig{Name: "a", Weight: 10}, false},
+	} {
+		if err := validateBackend(tt.backend); (err == nil) != tt.valid {
+			t.Errorf("validateBackend(socket %q ip %q port %d) = %v, want 有効 %v", tt.backend.Socket, tt.backend.IP, tt.backend.Port, err, tt.valid)
+		}
+	}
+}
+
+func TestCheckOnlyChangeUpdatesServer(t *testing.T) {
+	captureOutput(t)
+	configWith := func(enabled string) *Config {
+		return loadTestConfig(t, `{
+			"haproxy_endpoint": ["memory://check-toggle"],
+			"load_balancing_algorithm": "roundrobin",
+			"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+			"backends": [
+				{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web", "health_check": {"enabled": `+enabled+`}}
+			]
+		}`)
+	}
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, configWith("true"), applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &orderRecordingClient{HAProxy: fake}
+	result, err := applyConfig(client, configWith("false"), applyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.calls) != 1 || client.calls[0] != "update:web-1" {
+		t.Errorf("check の切り替えで行った操作 = %v, want [update:web-1]（追加・削除をしないこと）", client.calls)
+	}
+	if status := result.Backends[0].Status; status != StatusUpdated {
+		t.Errorf("web-1 の結果 = %s, want %s", status, StatusUpdated)
+	}
+	servers, _ := fake.GetServers()
+	if len(servers) != 1 || servers[0].Check || servers[0].Inter != "" {
+		t.Errorf("切り替え後のサーバー = %+v, want check なし", servers)
+	}
+}
+
+func TestBuildServerHealthCheckAddressAndPort(t *testing.T) {
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://check-addr"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2, "port": 8081},
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "health_check": {"address": "10.0.9.2", "port": 9000}}
+		]
+	}`)
+	web1 := buildServer(config, config.Backends[0])
+	if web1.CheckAddr != "" || web1.CheckPort != 8081 {
+		t.Errorf("web-1 = addr %q port %d, want 全体の設定（サーバー自身のアドレス、8081）", web1.CheckAddr, web1.CheckPort)
+	}
+	web2 := buildServer(config, config.Backends[1])
+	if web2.CheckAddr != "10.0.9.2" || web2.CheckPort != 9000 {
+		t.Errorf("web-2 = addr %q port %d, want 10.0.9.2, 9000", web2.CheckAddr, web2.CheckPort)
+	}
+	if got := serverLine(web2); !strings.Contains(got, " addr 10.0.9.2 port 9000") {
+		t.Errorf("web-2 の server 行 = %q, want addr 10.0.9.2 port 9000 を含むこと", got)
+	}
+}
+
+func TestHealthCheckAddressIsValidated(t *testing.T) {
+	address, port := func(s string) *string { return &s }, func(n int) *int { return &n }
+	for name, override := range map[string]HealthCheckOverride{
+		"ホスト名":    {Address: address("check.internal")},
+		"複数のアドレス": {Address: address("10.0.9.1,10.0.9.2")},
+		"範囲外のポート": {Port: port(70000)},
+	} {
+		override := override
+		backend := BackendConfig{Name: "web-1", IP: "10.0.0.1", Port: 80, Weight: 10, HealthCheck: &override}
+		if err := validateBackend(backend); err == nil {
+			t.Errorf("%s の health_check の検証がエラーになりませんでした", name)
+		}
+	}
+	if err := validateBackend(BackendConfig{Name: "web-1", IP: "10.0.0.1", Port: 80, Weight: 10,
+		HealthCheck: &HealthCheckOverride{Address: address("10.0.9.1"), Port: port(9000)}}); err != nil {
+		t.Errorf("正しい address / port の検証がエラーになりました: %v", err)
+	}
+}
+
+func TestRenameWithSameIDUpdatesServer(t *testing.T) {
+	captureOutput(t)
+	configWith := func(name string) *Config {
+		return loadTestConfig(t, `{
+			"haproxy_endpoint": ["memory://rename"],
+			"load_balancing_algorithm": "roundrobin",
+			"backends": [
+				{"name": "`+name+`", "id": 1, "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+				{"name": "web-2", "id": 2, "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+			]
+		}`)
+	}
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, configWith("web-1"), applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &orderRecordingClient{HAProxy: fake}
+	result, err := applyConfig(client, configWith("web-01"), applyOptions{prune: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.calls) != 0 {
+		t.Errorf("名前の変更で行った追加・更新 = %v, want なし（削除と追加をしないこと）", client.calls)
+	}
+	if result.Backends[0].Status != StatusUpdated || len(result.Removed) != 0 {
+		t.Errorf("適用結果 = backends %+v removed %+v, want web-01 が updated で削除なし", result.Backends, result.Removed)
+	}
+	servers, _ := fake.GetServers()
+	if len(servers) != 2 || servers[0].Name != "web-01" || servers[0].ID != 1 {
+		t.Errorf("名前の変更後のサーバー = %+v, want id 1 の web-01", servers)
+	}
+}
+
+func TestServerIDsAreValidated(t *testing.T) {
+	if err := validateBackend(BackendConfig{Name: "web-1", ID: -1, IP: "10.0.0.1", Port: 80, Weight: 10}); err == nil {
+		t.Error("負の id の検証がエラーになりませんでした")
+	}
+	for backends, valid := range map[string]bool{
+		`{"name": "web-1", "id": 1, "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+		{"name": "web-2", "id": 1, "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}`: false,
+		`{"name": "web-1", "id": 1, "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+		{"name": "api-1", "id": 1, "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "api"}`: true,
+	} {
+		err := validateTestConfig(t, `{
+			"haproxy_endpoint": ["memory://rename"],
+			"load_balancing_algorithm": "roundrobin",
+			"backends": [`+backends+`]
+		}`)
+		if (err == nil) != valid {
+			t.Errorf("id の検証 = %v, want 有効 %v（id はグループ内で一意）: %s", err, valid, backends)
+		}
+	}
+}
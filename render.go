@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// defaultBackendName は、group を指定していないサーバーを render で出力する際のバックエンド名です
+const defaultBackendName = "default"
+
+// renderConfig は、設定内容を haproxy.cfg の backend セクション形式で返します。
+// バックエンドの description / owner / labels はサーバー行の直前にコメントとして出力します
+func renderConfig(config *Config) (string, error) {
+	groups, err := orderGroups(config)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("# haproxy-loadbalancer により生成\n")
+	for _, r := range managedResolvers(config) {
+		fmt.Fprintf(&b, "\nresolvers %s\n", r.Name)
+		for _, line := range resolverLines(buildResolver(r)) {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+	for _, p := range config.Peers {
+		fmt.Fprintf(&b, "\npeers %s\n", p.Name)
+		for _, line := range peersLines(buildPeers(p)) {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+	for _, c := range config.Caches {
+		fmt.Fprintf(&b, "\ncache %s\n", c.Name)
+		for _, line := range cacheLines(buildCache(c)) {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+	for _, m := range config.Mailers {
+		fmt.Fprintf(&b, "\nmailers %s\n", m.Name)
+		for _, line := range mailerLines(buildMailers(m)) {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+	for _, group := range groups {
+		name := group.name
+		if name == "" {
+			name = defaultBackendName
+		}
+		fmt.Fprintf(&b, "\nbackend %s\n", name)
+		if g := findGroup(config, group.name); g != nil && g.Mode != "" {
+			fmt.Fprintf(&b, "    mode %s\n", g.Mode)
+		}
+		fmt.Fprintf(&b, "    balance %s\n", effectiveAlgorithm(config, group.name))
+		if checkType, err := groupCheckType(config, group); err == nil && checkType != "" {
+			fmt.Fprintf(&b, "    option %s\n", checkTypeOptions[checkType])
+		}
+		if config.HealthCheck.LogHealthChecks {
+			b.WriteString("    option log-health-checks\n")
+		}
+		if check, err := groupTCPCheck(config, group); err == nil {
+			for _, d := range tcpCheckDirectives(check) {
+				fmt.Fprintf(&b, "    %s %s\n", d[0], d[1])
+			}
+		}
+		fmt.Fprintf(&b, "    retries %d\n", config.RetryPolicy.Retries)
+		if config.RetryPolicy.Redispatch {
+			b.WriteString("    option redispatch\n")
+		}
+		if tunings, err := groupBackendTunings(config); err == nil {
+			for _, d := range backendTuningDirectives(tunings[group.name]) {
+				fmt.Fprintf(&b, "    %s %s\n", d[0], d[1])
+			}
+		}
+		if g := findGroup(config, group.name); g != nil && g.EmailAlert != "" {
+			if m := findMailer(config, g.EmailAlert); m != nil {
+				for _, d := range emailAlertDirectives(*m) {
+					fmt.Fprintf(&b, "    %s %s\n", d[0], d[1])
+				}
+			}
+		}
+		if g := findGroup(config, group.name); g != nil && g.Cache != "" {
+			for _, d := range cacheDirectives(g.Cache) {
+				fmt.Fprintf(&b, "    %s %s\n", d[0], d[1])
+			}
+		}
+		if g := findGroup(config, group.name); g != nil && g.Stick != nil {
+			fmt.Fprintf(&b, "    stick-table %s\n", stickTableValue(g.Stick))
+			fmt.Fprintf(&b, "    stick on %s\n", g.Stick.On)
+		}
+		for _, r := range config.HTTPRules {
+			if r.Scope == "backend" && r.Name == name {
+				fmt.Fprintf(&b, "    %s\n", httpRuleLine(r))
+			}
+		}
+		if g := findGroup(config, group.name); g != nil && g.Defaults != nil {
+			if line := defaultServerLine(g.Defaults); line != "" {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+		for _, backend := range group.backends {
+			if comment := metadataComment(backend); comment != "" {
+				fmt.Fprintf(&b, "    # %s\n", comment)
+			}
+			if backend.SRV != "" {
+				fmt.Fprintf(&b, "    %s\n", serverTemplateLine(buildServerTemplate(config, backend)))
+				continue
+			}
+			fmt.Fprintf(&b, "    %s\n", serverLine(buildServer(config, backend)))
+		}
+	}
+	return b.String(), nil
+}
+
+// metadataComment は、バックエンドのメタデータを1行のコメント文字列にまとめます
+func metadataComment(backend BackendConfig) string {
+	var parts []string
+	if backend.Owner != "" {
+		parts = append(parts, "owner: "+backend.Owner)
+	}
+	if backend.Description != "" {
+		parts = append(parts, strings.ReplaceAll(backend.Description, "\n", " "))
+	}
+	if len(backend.Labels) > 0 {
+		parts = append(parts, "labels: "+formatLabels(backend.Labels))
+	}
+	return strings.Join(parts, " / ")
+}
+
+// unixAddressPrefix は unix ソケットのサーバーアドレスの接頭辞です
+const unixAddressPrefix = "unix@"
+
+// serverLine は、サーバー定義を haproxy.cfg の server 行に変換します
+func serverLine(s haproxy.Server) string {
+	return fmt.Sprintf("server %s %s%s", s.Name, serverAddress(s), serverOptions(s))
+}
+
+// serverAddress は、サーバーのアドレスを "ip:port"、unix ソケットの場合は "unix@/path" の形式で返します
+func serverAddress(s haproxy.Server) string {
+	if strings.HasPrefix(s.IP, unixAddressPrefix) {
+		return s.IP
+	}
+	return fmt.Sprintf("%s:%d", s.IP, s.Port)
+}
+
+// serverOptions は、サーバー定義のうちアドレス以外の設定を server 行のオプション表記で返します。
+// haproxy.cfg の出力と runtime socket の add server で共通に使用します
+func serverOptions(s haproxy.Server) string {
+	opts := fmt.Sprintf(" weight %d", s.Weight)
+	if s.ID > 0 {
+		opts = fmt.Sprintf(" id %d", s.ID) + opts
+	}
+	if s.Maxconn > 0 {
+		opts += fmt.Sprintf(" maxconn %d", s.Maxconn)
+	}
+	if s.Source != "" {
+		opts += " source " + s.Source
+	}
+	if s.SSL {
+		opts += " ssl"
+		if s.Verify != "" {
+			opts += " verify " + s.Verify
+		}
+		if s.Sni != "" {
+			opts += " sni " + s.Sni
+		}
+		if s.SSLCertificate != "" {
+			opts += " crt " + s.SSLCertificate
+		}
+		if s.Alpn != "" {
+			opts += " alpn " + s.Alpn
+		}
+		if s.Npn != "" {
+			opts += " npn " + s.Npn
+		}
+	}
+	switch s.SendProxy {
+	case "v1":
+		opts += " send-proxy"
+	case "v2":
+		opts += " send-proxy-v2"
+		if s.ProxyV2Options != "" {
+			opts += " proxy-v2-options " + s.ProxyV2Options
+		}
+	}
+	if s.Track != "" {
+		opts += " track " + s.Track
+	}
+	if s.Check {
+		opts += " check"
+		if s.Inter != "" {
+			opts += " inter " + s.Inter
+		}
+		if s.Downinter != "" {
+			opts += " downinter " + s.Downinter
+		}
+		if s.Fastinter != "" {
+			opts += " fastinter " + s.Fastinter
+		}
+		if s.CheckAddr != "" {
+			opts += " addr " + s.CheckAddr
+		}
+		if s.CheckPort > 0 {
+			opts += fmt.Sprintf(" port %d", s.CheckPort)
+		}
+		if s.Fall > 0 {
+			opts += fmt.Sprintf(" fall %d", s.Fall)
+		}
+		if s.Rise > 0 {
+			opts += fmt.Sprintf(" rise %d", s.Rise)
+		}
+	}
+	return opts
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// configChecksum は、設定内容（上書き反映後）のチェックサムを返します。
+// 前回適用時から設定が変わったかどうかの判定に使用します
+func configChecksum(config *Config) (string, error) {
+	bytes, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// repeatRunner は、一定間隔で設定ファイルを読み直して適用を繰り返します
+type repeatRunner struct {
+	interval time.Duration
+	load     func() (*Config, error)              // 設定の読み込み（上書き反映と検証を含む）
+	apply    func(context.Context, *Config) error // 設定の適用（ctx は終了時にキャンセルされ、再試行の待機を中断します）
+
+	// after は待機に使う関数です（テストで時刻を差し替えるため。nil の場合は time.After）
+	after func(time.Duration) <-chan time.Time
+
+	lastChecksum string
+}
+
+// run は、ctx がキャンセルされるまで適用を繰り返します。最初の適用は即座に行います
+func (r *repeatRunner) run(ctx context.Context) {
+	after := r.after
+	if after == nil {
+		after = time.After
+	}
+	for {
+		r.cycle(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-after(r.interval):
+		}
+	}
+}
+
+// cycle は、1回分の読み込みと適用を行います。
+// 読み込みや適用に失敗してもログに出力するだけで、次の周期で再試行します
+func (r *repeatRunner) cycle(ctx context.Context) {
+	config, err := r.load()
+	if err != nil {
+		log.Printf("設定の読み込みに失敗したため今回の適用をスキップし、前回適用した設定を維持します: %v", err)
+		return
+	}
+	sum, err := configChecksum(config)
+	if err != nil {
+		log.Printf("設定のチェックサム計算に失敗: %v", err)
+		return
+	}
+	if sum == r.lastChecksum {
+		logf("設定に変更がないため今回の適用をスキップします\n")
+		return
+	}
+	if err := r.apply(ctx, config); err != nil {
+		log.Printf("設定の適用に失敗しました（次の周期で再試行します）: %v", err)
+		return
+	}
+	r.lastChecksum = sum
+}
+
+// runRepeat は、SIGINT / SIGTERM を受け取るまで一定間隔で適用を繰り返します（apply -repeat）。
+// シグナルを受け取ると、適用中の再試行の待機も中断します
+func runRepeat(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		logf("シグナル[%s]を受け取ったため終了します\n", s)
+		cancel()
+	}()
+
+	logf("%s 間隔で設定の適用を繰り返します\n", interval)
+	r := &repeatRunner{
+		interval: interval,
+		load:     loadEffectiveConfig,
+		apply:    applyOnce,
+	}
+	r.run(ctx)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock は、repeatRunner の待機を差し替え、テストから周期を1つずつ進めるための時計です
+type fakeClock struct {
+	waiting chan time.Duration // 待機を始めた周期の間隔
+	ticks   chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{waiting: make(chan time.Duration), ticks: make(chan time.Time)}
+}
+
+func (c *fakeClock) after(d time.Duration) <-chan time.Time {
+	c.waiting <- d
+	return c.ticks
+}
+
+func TestRepeatRunnerReconcilesEachCycle(t *testing.T) {
+	_, errs := captureOutput(t)
+	configA := &Config{LoadBalancingAlgorithm: "roundrobin"}
+	configB := &Config{LoadBalancingAlgorithm: "leastconn"}
+	loads := []struct {
+		config *Config
+		err    error
+	}{
+		{config: configA},
+		{config: configA}, // 変更なし: 適用しない
+		{err: errors.New("unexpected end of JSON")}, // 読み込みの失敗: 終了せずに次の周期へ
+		{config: configB},
+		{config: configA},
+	}
+
+	var applied []*Config
+	clock := newFakeClock()
+	cycle := 0
+	r := &repeatRunner{
+		interval: 30 * time.Second,
+		load: func() (*Config, error) {
+			l := loads[cycle]
+			cycle++
+			return l.config, l.err
+		},
+		apply: func(_ context.Context, c *Config) error {
+			applied = append(applied, c)
+			return nil
+		},
+		after: clock.after,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.run(ctx)
+		close(done)
+	}()
+	for i := range loads {
+		if d := <-clock.waiting; d != 30*time.Second {
+			t.Fatalf("待機の間隔 = %v, want 30s", d)
+		}
+		if i < len(loads)-1 {
+			clock.ticks <- time.Now()
+		}
+	}
+	cancel()
+	<-done
+
+	want := []*Config{configA, configB, configA}
+	if len(applied) != len(want) {
+		t.Fatalf("適用した回数 = %d, want %d（5周期のうち変更なしと読み込みの失敗を除く）", len(applied), len(want))
+	}
+	for i := range want {
+		if applied[i] != want[i] {
+			t.Errorf("%d 回目の適用の設定 = %s, want %s", i+1, applied[i].LoadBalancingAlgorithm, want[i].LoadBalancingAlgorithm)
+		}
+	}
+	if cycle != len(loads) {
+		t.Errorf("読み込んだ回数 = %d, want %d（読み込みの失敗後も続けること）", cycle, len(loads))
+	}
+	if !strings.Contains(errs.String(), "設定の読み込みに失敗したため今回の適用をスキップし") {
+		t.Errorf("読み込みの失敗がログに出力されていません: %q", errs.String())
+	}
+}
+
+func TestRepeatRunnerRetriesFailedApply(t *testing.T) {
+	captureOutput(t)
+	config := &Config{LoadBalancingAlgorithm: "roundrobin"}
+	attempts := 0
+	clock := newFakeClock()
+	r := &repeatRunner{
+		interval: time.Second,
+		load:     func() (*Config, error) { return config, nil },
+		apply: func(context.Context, *Config) error {
+			attempts++
+			if attempts == 1 {
+				return errors.New("接続できません")
+			}
+			return nil
+		},
+		after: clock.after,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.run(ctx)
+		close(done)
+	}()
+	for i := 0; i < 3; i++ {
+		<-clock.waiting
+		if i < 2 {
+			clock.ticks <- time.Now()
+		}
+	}
+	cancel()
+	<-done
+
+	// 1回目の失敗ではチェックサムを記録しないため、同じ設定でも2回目に再試行し、3回目は変更なしとしてスキップします
+	if attempts != 2 {
+		t.Errorf("適用を試みた回数 = %d, want 2", attempts)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// validate は、resolvers セクションの設定値を検証します
+func (r ResolverConfig) validate() error {
+	if r.Name == "" {
+		return errors.New("name が指定されていません")
+	}
+	for _, ns := range r.Nameservers {
+		if _, _, err := parseNameserver(ns); err != nil {
+			return err
+		}
+	}
+	if r.ResolveRetries < 0 {
+		return fmt.Errorf("resolve_retries は 0 以上で指定してください（指定値: %d）", r.ResolveRetries)
+	}
+	for _, d := range []struct{ name, value string }{
+		{"timeout_resolve", r.TimeoutResolve},
+		{"timeout_retry", r.TimeoutRetry},
+		{"hold_valid", r.HoldValid},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if len(r.Nameservers) == 0 {
+			return fmt.Errorf("%s を指定する場合は nameservers も指定してください", d.name)
+		}
+		if _, err := haproxyDuration(d.value); err != nil {
+			return fmt.Errorf("%s が不正です: %w", d.name, err)
+		}
+	}
+	return nil
+}
+
+// parseNameserver は、"ip:port" 形式のDNSサーバーのアドレスを IP アドレスとポートに分けます
+func parseNameserver(ns string) (string, int, error) {
+	host, p, err := net.SplitHostPort(ns)
+	if err != nil || net.ParseIP(host) == nil {
+		return "", 0, fmt.Errorf("nameserver[%s]は \"ip:port\" 形式で指定してください（例: 10.0.0.2:53）", ns)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("nameserver[%s]のポートは 1〜65535 の範囲で指定してください", ns)
+	}
+	return host, port, nil
+}
+
+// managedResolvers は、nameservers が指定され、適用時に作成・更新する resolvers セクションを返します
+func managedResolvers(config *Config) []ResolverConfig {
+	var managed []ResolverConfig
+	for _, r := range config.Resolvers {
+		if len(r.Nameservers) > 0 {
+			managed = append(managed, r)
+		}
+	}
+	return managed
+}
+
+// buildResolver は、resolvers セクションの設定から HAProxy の resolvers 定義を組み立てます（検証済みであること）。
+// DNSサーバーには記載順に ns1, ns2, ... の名前を付けます
+func buildResolver(r ResolverConfig) haproxy.Resolver {
+	resolver := haproxy.Resolver{Name: r.Name, ResolveRetries: int64(r.ResolveRetries)}
+	for i, ns := range r.Nameservers {
+		host, port, _ := parseNameserver(ns)
+		resolver.Nameservers = append(resolver.Nameservers, haproxy.Nameserver{Name: fmt.Sprintf("ns%d", i+1), Address: host, Port: port})
+	}
+	resolver.TimeoutResolve, _ = optionalDuration(r.TimeoutResolve)
+	resolver.TimeoutRetry, _ = optionalDuration(r.TimeoutRetry)
+	resolver.HoldValid, _ = optionalDuration(r.HoldValid)
+	return resolver
+}
+
+// optionalDuration は、指定されていれば期間表記をHAProxyの時間表記に変換します（未指定なら空文字列）
+func optionalDuration(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	return haproxyDuration(value)
+}
+
+// resolverMatches は、現在の resolvers 定義が設定から組み立てた定義と一致するかを返します
+func resolverMatches(current, desired haproxy.Resolver) bool {
+	if current.ResolveRetries != desired.ResolveRetries ||
+		current.TimeoutResolve != desired.TimeoutResolve ||
+		current.TimeoutRetry != desired.TimeoutRetry ||
+		current.HoldValid != desired.HoldValid ||
+		len(current.Nameservers) != len(desired.Nameservers) {
+		return false
+	}
+	for i := range current.Nameservers {
+		if current.Nameservers[i] != desired.Nameservers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyResolvers は、nameservers を指定した resolvers セクションを作成し、内容が異なる場合は更新します。
+// server-template が名前解決に使うため、バックエンドサーバーより先に適用します
+func applyResolvers(client haproxyClient, config *Config) error {
+	managed := managedResolvers(config)
+	if len(managed) == 0 {
+		return nil
+	}
+	current, err := client.GetResolvers()
+	if err != nil {
+		return fmt.Errorf("現在の resolvers の取得に失敗: %w", err)
+	}
+	existing := make(map[string]haproxy.Resolver, len(current))
+	for _, r := range current {
+		existing[r.Name] = r
+	}
+
+	for _, r := range managed {
+		desired := buildResolver(r)
+		cur, ok := existing[r.Name]
+		switch {
+		case !ok:
+			if err := client.AddResolver(&desired); err != nil {
+				return fmt.Errorf("resolvers[%s]の作成失敗: %w", r.Name, err)
+			}
+			logf("resolvers[%s]を作成しました\n", r.Name)
+		case resolverMatches(cur, desired):
+			logf("resolvers[%s]は既に同じ内容のためスキップしました\n", r.Name)
+		default:
+			if err := client.UpdateResolver(&desired); err != nil {
+				return fmt.Errorf("resolvers[%s]の更新失敗: %w", r.Name, err)
+			}
+			logf("resolvers[%s]を更新しました\n", r.Name)
+		}
+	}
+	return nil
+}
+
+// resolverLines は、resolvers 定義を haproxy.cfg の resolvers セクションの各行に変換します
+func resolverLines(r haproxy.Resolver) []string {
+	var lines []string
+	for _, ns := range r.Nameservers {
+		lines = append(lines, fmt.Sprintf("nameserver %s %s:%d", ns.Name, ns.Address, ns.Port))
+	}
+	if r.ResolveRetries > 0 {
+		lines = append(lines, fmt.Sprintf("resolve_retries %d", r.ResolveRetries))
+	}
+	if r.TimeoutResolve != "" {
+		lines = append(lines, "timeout resolve "+r.TimeoutResolve)
+	}
+	if r.TimeoutRetry != "" {
+		lines = append(lines, "timeout retry "+r.TimeoutRetry)
+	}
+	if r.HoldValid != "" {
+		lines = append(lines, "hold valid "+r.HoldValid)
+	}
+	return lines
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// resolversTestConfig は、nameservers を指定した resolvers と、それを参照する server-template を持つ設定です
+func resolversTestConfig(t *testing.T, retries string) *Config {
+	t.Helper()
+	return loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://resolvers"],
+		"load_balancing_algorithm": "roundrobin",
+		"resolvers": [{"name": "dns", "nameservers": ["10.0.0.2:53", "10.0.0.3:5353"], "resolve_retries": `+retries+`, "hold_valid": "10s"}],
+		"backends": [{"name": "api", "srv": "_http._tcp.api.service.consul", "resolver": "dns", "count": 2, "weight": 10, "group": "api"}]
+	}`)
+}
+
+func TestApplyResolvers(t *testing.T) {
+	logs, _ := captureOutput(t)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, resolversTestConfig(t, "3"), applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	resolvers, _ := fake.GetResolvers()
+	if len(resolvers) != 1 {
+		t.Fatalf("作成した resolvers の数 = %d, want 1", len(resolvers))
+	}
+	want := []haproxy.Nameserver{{Name: "ns1", Address: "10.0.0.2", Port: 53}, {Name: "ns2", Address: "10.0.0.3", Port: 5353}}
+	r := resolvers[0]
+	if r.Name != "dns" || r.ResolveRetries != 3 || r.HoldValid == "" || len(r.Nameservers) != 2 || r.Nameservers[0] != want[0] || r.Nameservers[1] != want[1] {
+		t.Errorf("作成した resolvers = %+v, want dns（ns1, ns2、resolve_retries 3、hold valid あり）", r)
+	}
+	if templates, _ := fake.GetServerTemplates(); len(templates) != 1 {
+		t.Errorf("server-template の数 = %d, want 1（resolvers の後に作成すること）", len(templates))
+	}
+
+	if _, err := applyConfig(fake, resolversTestConfig(t, "3"), applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "resolvers[dns]は既に同じ内容のためスキップしました") {
+		t.Errorf("同じ内容の再適用で resolvers をスキップしませんでした:\n%s", logs)
+	}
+	if _, err := applyConfig(fake, resolversTestConfig(t, "5"), applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if resolvers, _ := fake.GetResolvers(); len(resolvers) != 1 || resolvers[0].ResolveRetries != 5 {
+		t.Errorf("変更後の resolvers = %+v, want resolve_retries 5 に更新", resolvers)
+	}
+}
+
+func TestValidateResolvers(t *testing.T) {
+	for name, tt := range map[string]struct{ resolvers, resolver string }{
+		"未定義の参照":                  {`[{"name": "dns", "nameservers": ["10.0.0.2:53"]}]`, "missing"},
+		"ポートなし":                   {`[{"name": "dns", "nameservers": ["10.0.0.2"]}]`, "dns"},
+		"ホスト名":                    {`[{"name": "dns", "nameservers": ["ns.internal:53"]}]`, "dns"},
+		"重複":                      {`[{"name": "dns"}, {"name": "dns"}]`, "dns"},
+		"nameservers なしの timeout": {`[{"name": "dns", "timeout_retry": "1s"}]`, "dns"},
+	} {
+		err := validateTestConfig(t, `{
+			"haproxy_endpoint": ["memory://resolvers"],
+			"load_balancing_algorithm": "roundrobin",
+			"resolvers": `+tt.resolvers+`,
+			"backends": [{"name": "api", "srv": "_http._tcp.api.service.consul", "resolver": "`+tt.resolver+`", "count": 2, "weight": 10, "group": "api"}]
+		}`)
+		if err == nil {
+			t.Errorf("%s の resolvers の検証がエラーになりませんでした", name)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// BackendStatus はバックエンドごとの適用結果を表します。
+// 値はJSONレポート経由で外部から参照されるため、既存の値は変更しないでください
+type BackendStatus string
+
+const (
+	// StatusAdded は、サーバーを新規に追加したことを表します
+	StatusAdded BackendStatus = "added"
+	// StatusUpdated は、既存のサーバーを設定内容で更新したことを表します
+	StatusUpdated BackendStatus = "updated"
+	// StatusSkippedExists は、同一内容のサーバーが既に存在するため何もしなかったことを表します
+	StatusSkippedExists BackendStatus = "skipped-exists"
+	// StatusFailedValidation は、設定内容の検証に失敗したため適用しなかったことを表します
+	StatusFailedValidation BackendStatus = "failed-validation"
+	// StatusFailedAPI は、HAProxy APIの呼び出しに失敗したことを表します
+	StatusFailedAPI BackendStatus = "failed-api"
+	// StatusRemoved は、設定ファイルに記載のないサーバーを削除したことを表します（-prune 指定時）
+	StatusRemoved BackendStatus = "removed"
+	// StatusBackendRemoved は、state: absent のバックエンドをサーバーごと削除したことを表します
+	StatusBackendRemoved BackendStatus = "backend-removed"
+	// StatusRemovalBlocked は、削除するとバックエンドのサーバー数が min_servers を下回るため、
+	// または -graceful-remove で -drain-timeout までに接続がなくならなかったため削除しなかったことを表します
+	StatusRemovalBlocked BackendStatus = "removal-blocked"
+	// StatusDeferred は、max_apply_duration を過ぎたため追加・更新・削除を開始しなかったことを表します
+	StatusDeferred BackendStatus = "deferred"
+	// StatusSkippedUnresolvable は、-skip-unresolvable 指定時にホスト名を名前解決できなかったため追加・更新しなかったことを表します
+	StatusSkippedUnresolvable BackendStatus = "skipped-unresolvable"
+)
+
+// BackendResult は1つのバックエンドサーバーの適用結果です
+type BackendResult struct {
+	Name        string        `json:"name"`
+	Status      BackendStatus `json:"status"`
+	Error       string        `json:"error,omitempty"`       // 失敗時のエラーメッセージ
+	Err         error         `json:"-"`                     // 失敗時のエラー（ライブラリ利用時向け）
+	Description string        `json:"description,omitempty"` // 設定ファイルのメタデータ
+	Owner       string        `json:"owner,omitempty"`       // 設定ファイルのメタデータ
+
+	Labels map[string]string `json:"labels,omitempty"` // サーバーに設定するラベル
+}
+
+// Result は設定の適用結果全体を表します
+type Result struct {
+	Endpoint string          `json:"endpoint,omitempty"` // 適用先のHAProxyインスタンス
+	Error    string          `json:"error,omitempty"`    // インスタンス全体の適用に失敗した場合のエラー
+	Backends []BackendResult `json:"backends"`
+	Removed  []BackendResult `json:"removed,omitempty"` // -prune で削除対象となったサーバーの結果
+
+	// Seeded は、-seed 指定時に初回の適用と判定し、削除を行わなかったことを表します
+	Seeded bool `json:"seeded,omitempty"`
+
+	// SkippedFeatures は、-degrade-unsupported により接続先が未対応のため適用しなかった機能の識別子です
+	SkippedFeatures []string `json:"skipped_features,omitempty"`
+
+	// SkippedPhases は、-no-algorithm / -no-retry-policy / -prune-only により実行しなかったフェーズ名です
+	SkippedPhases []string `json:"skipped_phases,omitempty"`
+
+	// DeadlineExceeded は、max_apply_duration を過ぎたため適用を打ち切ったことを表します。
+	// 開始しなかったサーバーの status は deferred となり、実行しなかったフェーズ名は DeferredPhases に記録されます
+	DeadlineExceeded bool     `json:"deadline_exceeded,omitempty"`
+	DeferredPhases   []string `json:"deferred_phases,omitempty"`
+}
+
+// newBackendResult は、バックエンドの結果を組み立てます
+func newBackendResult(name string, status BackendStatus, err error) BackendResult {
+	br := BackendResult{Name: name, Status: status, Err: err}
+	if err != nil {
+		br.Error = err.Error()
+	}
+	return br
+}
+
+// newBackendResultFor は、設定ファイルのメタデータを含めてバックエンドの結果を組み立てます
+func newBackendResultFor(backend BackendConfig, status BackendStatus, err error) BackendResult {
+	br := newBackendResult(backend.Name, status, err)
+	br.Description = backend.Description
+	br.Owner = backend.Owner
+	br.Labels = copyLabels(backend.Labels)
+	return br
+}
+
+// writeReport は、適用結果をJSON形式のレポートとしてファイルに書き出します。
+// インスタンスが1つの場合は Result をそのまま、複数の場合は {"instances": [...]} の形式で書き出します
+func writeReport(filename string, results []*Result) error {
+	var v interface{} = struct {
+		Instances []*Result `json:"instances"`
+	}{results}
+	if len(results) == 1 {
+		v = results[0]
+	}
+	bytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(bytes, '\n'), 0644)
+}
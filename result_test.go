@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+func TestApplyConfigReportsStatusPerBackend(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://result"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	client := haproxyfake.New()
+	// web-1 は同じ内容、web-2 は重みの異なるサーバーが既にあり、web-3 は存在しません
+	if _, err := applyConfig(client, config, applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetWeight("web", "web-2", 50); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RemoveServer(&haproxy.Server{Backend: "web", Name: "web-3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := applyConfig(client, config, applyOptions{})
+	if err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	want := map[string]BackendStatus{"web-1": StatusSkippedExists, "web-2": StatusUpdated, "web-3": StatusAdded}
+	if len(result.Backends) != len(want) {
+		t.Fatalf("結果の件数 = %d, want %d: %+v", len(result.Backends), len(want), result.Backends)
+	}
+	for _, b := range result.Backends {
+		if b.Status != want[b.Name] {
+			t.Errorf("サーバー[%s]の status = %s, want %s", b.Name, b.Status, want[b.Name])
+		}
+	}
+}
+
+func TestInvalidBackendReportsFailedValidation(t *testing.T) {
+	captureOutput(t)
+	config := &Config{Backends: []BackendConfig{{Name: "web-1", IP: "10.0.0.1", Port: 70000, Weight: 10}}}
+	result, err := applyConfig(haproxyfake.New(), config, applyOptions{})
+	if err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	if len(result.Backends) != 1 || result.Backends[0].Status != StatusFailedValidation || result.Backends[0].Err == nil {
+		t.Errorf("結果 = %+v, want failed-validation とエラー", result.Backends)
+	}
+}
+
+func TestWriteReportFormats(t *testing.T) {
+	dir := t.TempDir()
+	one := &Result{Endpoint: "memory://a", Backends: []BackendResult{newBackendResult("web-1", StatusAdded, nil)}}
+	two := &Result{Endpoint: "memory://b", Backends: []BackendResult{}}
+
+	single := filepath.Join(dir, "single.json")
+	if err := writeReport(single, []*Result{one}); err != nil {
+		t.Fatal(err)
+	}
+	var got Result
+	readJSON(t, single, &got)
+	if got.Endpoint != "memory://a" || len(got.Backends) != 1 || got.Backends[0].Status != StatusAdded {
+		t.Errorf("1インスタンスのレポート = %+v, want Result をそのまま書き出すこと", got)
+	}
+
+	multi := filepath.Join(dir, "multi.json")
+	if err := writeReport(multi, []*Result{one, two}); err != nil {
+		t.Fatal(err)
+	}
+	var instances struct {
+		Instances []Result `json:"instances"`
+	}
+	readJSON(t, multi, &instances)
+	if len(instances.Instances) != 2 || instances.Instances[1].Endpoint != "memory://b" {
+		t.Errorf("複数インスタンスのレポート = %+v, want instances の配列", instances)
+	}
+}
+
+// readJSON は、JSON ファイルを読み込んで v にパースします
+func readJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("%s のパースに失敗: %v", path, err)
+	}
+}
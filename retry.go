@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// clientOperation は、リトライの対象となる1つの変更操作です
+type clientOperation struct {
+	subject string // ログに表示する対象（"サーバー[web1]" など）
+	verb    string // ログに表示する操作名（"追加" など）
+	success string // 成功時のログ（省略時は "<subject>を正常に<verb>しました"）
+
+	// idempotent は、同じ操作を繰り返しても結果が変わらないかどうかです（更新など）。
+	// 追加や削除は2回目がエラーになる、または別の結果になるため冪等ではありません
+	idempotent bool
+	run        func() error
+
+	// applied は、結果の分からない失敗（タイムアウト、または以前の試行が反映済みの可能性がある 409 Conflict）の後に、操作が既に反映されているかを確認します。
+	// 冪等でない操作では、再送する前に呼び出して反映済みであれば成功とし、二重に適用しないようにします
+	applied func() (bool, error)
+}
+
+// defaultOperationAttempts は、サーバーの追加・更新などの HAProxy への操作の既定の最大試行回数です（-max-retries で変更できます）
+const defaultOperationAttempts = 3
+
+// サーバーの追加・更新など、HAProxy への変更操作を再試行する間隔（初回の待機時間と上限）です
+const (
+	clientRetryInitialDelay = 200 * time.Millisecond
+	clientRetryMaxDelay     = 2 * time.Second
+)
+
+// retryPolicy は、retry による再試行の方針です
+type retryPolicy struct {
+	attempts     int           // 最大の試行回数（0 の場合は budget が経過するまで試行します）
+	initialDelay time.Duration // 初回の再試行までの待機時間（0 の場合は待たずに再試行します）
+	maxDelay     time.Duration // 待機時間の上限（待機時間は再試行のたびに2倍にします。0 で上限なし）
+	budget       time.Duration // 最初の試行からの経過時間の上限（0 で上限なし）
+
+	// retryable は、再試行するエラーかどうかを返します（nil の場合はすべてのエラーを再試行します）
+	retryable func(error) bool
+	// onRetry は、待機して再試行する前に呼び出されます（ログの出力用、省略可）
+	onRetry func(attempt int, delay time.Duration, err error)
+
+	// テスト用に差し替えられるようにしています（nil の場合は sleepContext / time.Now）
+	sleep func(ctx context.Context, d time.Duration) error
+	now   func() time.Time
+}
+
+// permanentError は、retry に再試行せずに直ちに終了させるためのエラーです（stopRetrying で作成します）
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// stopRetrying は、retry の fn から返すと、retryable の判定によらず再試行せずに err を返させるエラーを返します
+func stopRetrying(err error) error {
+	return &permanentError{err: err}
+}
+
+// retry は、fn が成功するまで policy に従って再試行します。fn には1から始まる試行回数を渡します。
+// 再試行しないエラー（retryable が false、または stopRetrying）の場合や試行回数・budget を使い切った場合は、最後のエラーを返します。
+// ctx がキャンセルされた場合は、待機を中断して ctx のエラーを含むエラーを返します
+func retry(ctx context.Context, policy retryPolicy, fn func(attempt int) error) error {
+	sleep, now := policy.sleep, policy.now
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	if now == nil {
+		now = time.Now
+	}
+	attempts := policy.attempts
+	if attempts <= 0 && policy.budget <= 0 {
+		attempts = 1
+	}
+
+	start := now()
+	delay := policy.initialDelay
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return canceledRetryError(err, lastErr)
+		}
+		lastErr = fn(attempt)
+		if lastErr == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(lastErr, &permanent) {
+			return permanent.err
+		}
+		if policy.retryable != nil && !policy.retryable(lastErr) {
+			return lastErr
+		}
+		if attempts > 0 && attempt >= attempts {
+			return lastErr
+		}
+		if policy.budget > 0 {
+			remaining := policy.budget - now().Sub(start)
+			if remaining <= 0 {
+				return lastErr
+			}
+			if delay > remaining {
+				delay = remaining
+			}
+		}
+
+		if policy.onRetry != nil {
+			policy.onRetry(attempt, delay, lastErr)
+		}
+		if delay <= 0 {
+			continue
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return canceledRetryError(err, lastErr)
+		}
+		if delay *= 2; policy.maxDelay > 0 && delay > policy.maxDelay {
+			delay = policy.maxDelay
+		}
+	}
+}
+
+// canceledRetryError は、キャンセルにより再試行を中止したことを表すエラーを返します（errors.Is で ctx のエラーと判定できます）
+func canceledRetryError(ctxErr, lastErr error) error {
+	if lastErr == nil {
+		return fmt.Errorf("再試行を中止しました: %w", ctxErr)
+	}
+	return fmt.Errorf("再試行を中止しました（最後のエラー: %v）: %w", lastErr, ctxErr)
+}
+
+// sleepContext は、d が経過するか ctx がキャンセルされるまで待ちます。キャンセルされた場合は ctx のエラーを返します
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// clientRetryPolicy は、HAProxy への操作を最大 attempts 回、間隔を広げながら試行する方針を返します。
+// 再試行しても結果の変わらないエラー（isRetryableError）は再試行しません
+func clientRetryPolicy(attempts int) retryPolicy {
+	return retryPolicy{
+		attempts:     attempts,
+		initialDelay: clientRetryInitialDelay,
+		maxDelay:     clientRetryMaxDelay,
+		retryable:    isRetryableError,
+	}
+}
+
+// isRetryableError は、再試行すれば成功する可能性のあるエラーかを返します。
+// 認証エラーや、リクエストの内容に起因する 4xx の応答（408, 409, 429 を除く）は再試行しても解消しないため false を返します
+func isRetryableError(err error) bool {
+	if isAuthError(err) {
+		return false
+	}
+	var apiErr *haproxy.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode/100 != 4 {
+		return true
+	}
+	switch apiErr.StatusCode {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// runWithRetry は、操作を最大 retries 回実行します（clientRetryPolicy）。
+// 冪等でない操作がタイムアウトまたは競合（409 Conflict）で失敗した場合は、そのまま再送せず applied で現在の状態を確認し、
+// 反映済みであれば成功、未反映であればリトライ、確認できなければリトライせずにエラーとします。
+// ctx がキャンセルされた場合は、再試行の待機を中断してエラーを返します（実行中の操作は中断しません）
+func runWithRetry(ctx context.Context, op clientOperation, retries int) error {
+	alreadyApplied := false
+	var stopped error
+	err := retry(ctx, clientRetryPolicy(retries), func(attempt int) error {
+		err := op.run()
+		if err == nil {
+			return nil
+		}
+		logf("%s%s失敗 (試行 %d/%d): %v\n", op.subject, op.verb, attempt, retries, err)
+
+		if op.idempotent || op.applied == nil || !(isAmbiguousError(err) || isConflictError(err)) {
+			return err
+		}
+		done, checkErr := op.applied()
+		if checkErr != nil {
+			stopped = fmt.Errorf("%sの%sの結果が分からず、反映されたかを確認できないためリトライしません（確認時のエラー: %v）: %w", op.subject, op.verb, checkErr, err)
+			return stopRetrying(stopped)
+		}
+		if done {
+			alreadyApplied = true
+			return nil
+		}
+		return err
+	})
+	switch {
+	case stopped != nil:
+		return stopped
+	case err != nil:
+		return fmt.Errorf("%sの%sに最終的に失敗しました: %w", op.subject, op.verb, err)
+	case alreadyApplied:
+		logf("%sの%sは失敗しましたが、既に反映されているため再送しません\n", op.subject, op.verb)
+	case op.success != "":
+		logf("%s\n", op.success)
+	default:
+		logf("%sを正常に%sしました\n", op.subject, op.verb)
+	}
+	return nil
+}
+
+// isAmbiguousError は、操作が反映されたかどうか分からない失敗（タイムアウト）かを返します
+func isAmbiguousError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isConflictError は、API が 409 Conflict を返した失敗かを返します。
+// 以前の試行が反映済みの場合も 409 になるため、冪等でない操作では再送する前に反映済みかを確認します
+func isConflictError(err error) bool {
+	var apiErr *haproxy.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict
+}
+
+// existingServers は、現在のサーバーを serverKey の集合として返します（タイムアウト後の状態確認用）
+func existingServers(client haproxyClient) (map[string]bool, error) {
+	current, err := client.GetServers()
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool, len(current))
+	for _, s := range current {
+		keys[serverKey(s.Backend, s.Name)] = true
+	}
+	return keys, nil
+}
+
+// serverAddedCheck は、サーバーがすべて存在するか（追加が反映済みか）を確認する関数を返します
+func serverAddedCheck(client haproxyClient, servers ...haproxy.Server) func() (bool, error) {
+	return func() (bool, error) {
+		keys, err := existingServers(client)
+		if err != nil {
+			return false, err
+		}
+		for _, s := range servers {
+			if !keys[serverKey(s.Backend, s.Name)] {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// errTestTimeout は、結果の分からない失敗（タイムアウト）を表すテスト用のエラーです
+var errTestTimeout = context.DeadlineExceeded
+
+func TestRunWithRetrySucceedsAfterRetryableError(t *testing.T) {
+	captureOutput(t)
+	calls := 0
+	err := runWithRetry(context.Background(), clientOperation{
+		subject:    "サーバー[web-1]",
+		verb:       "更新",
+		idempotent: true,
+		run: func() error {
+			calls++
+			if calls == 1 {
+				return &haproxy.APIError{StatusCode: http.StatusServiceUnavailable, Message: "unavailable"}
+			}
+			return nil
+		},
+	}, 2)
+	if err != nil {
+		t.Fatalf("runWithRetry がエラーを返しました: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("実行回数 = %d, want 2（503 の後に再試行すること）", calls)
+	}
+}
+
+func TestRunWithRetryStopsOnNonRetryableError(t *testing.T) {
+	captureOutput(t)
+	calls := 0
+	badRequest := &haproxy.APIError{StatusCode: http.StatusBadRequest, Message: "bad request"}
+	err := runWithRetry(context.Background(), clientOperation{
+		subject: "サーバー[web-1]",
+		verb:    "追加",
+		run: func() error {
+			calls++
+			return badRequest
+		},
+	}, 3)
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("runWithRetry のエラー = %v, want 400 のエラーを含むこと", err)
+	}
+	if calls != 1 {
+		t.Errorf("実行回数 = %d, want 1（400 は再試行しないこと）", calls)
+	}
+}
+
+func TestRunWithRetryConflictChecksApplied(t *testing.T) {
+	captureOutput(t)
+	calls, checks := 0, 0
+	err := runWithRetry(context.Background(), clientOperation{
+		subject: "サーバー[web-1]",
+		verb:    "追加",
+		run: func() error {
+			calls++
+			return &haproxy.APIError{StatusCode: http.StatusConflict, Message: "already exists"}
+		},
+		applied: func() (bool, error) {
+			checks++
+			return true, nil
+		},
+	}, 3)
+	if err != nil {
+		t.Fatalf("runWithRetry がエラーを返しました: %v（反映済みの 409 は成功とすること）", err)
+	}
+	if calls != 1 || checks != 1 {
+		t.Errorf("実行回数 = %d, 確認回数 = %d, want 1, 1（409 では再送せずに反映済みかを確認すること）", calls, checks)
+	}
+}
+
+func TestRunWithRetryStopsWhenAppliedCheckFails(t *testing.T) {
+	captureOutput(t)
+	calls := 0
+	err := runWithRetry(context.Background(), clientOperation{
+		subject: "サーバー[web-1]",
+		verb:    "削除",
+		run: func() error {
+			calls++
+			return errTestTimeout
+		},
+		applied: func() (bool, error) { return false, errors.New("一覧を取得できません") },
+	}, 3)
+	if err == nil || !errors.Is(err, errTestTimeout) {
+		t.Fatalf("runWithRetry のエラー = %v, want タイムアウトのエラーを含むこと", err)
+	}
+	if calls != 1 {
+		t.Errorf("実行回数 = %d, want 1（反映されたか分からない場合は再送しないこと）", calls)
+	}
+}
+
+func TestRunWithRetryExhaustsAttempts(t *testing.T) {
+	captureOutput(t)
+	calls := 0
+	unavailable := &haproxy.APIError{StatusCode: http.StatusServiceUnavailable, Message: "unavailable"}
+	err := runWithRetry(context.Background(), clientOperation{
+		subject:    "サーバー[web-1]",
+		verb:       "更新",
+		idempotent: true,
+		run: func() error {
+			calls++
+			return unavailable
+		},
+	}, 1)
+	if !errors.Is(err, unavailable) {
+		t.Fatalf("runWithRetry のエラー = %v, want 503 のエラーを含むこと", err)
+	}
+	if calls != 1 {
+		t.Errorf("実行回数 = %d, want 1（試行回数を超えて実行しないこと）", calls)
+	}
+}
+
+func TestRunWithRetryCanceledDuringBackoff(t *testing.T) {
+	captureOutput(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	start := time.Now()
+	err := runWithRetry(ctx, clientOperation{
+		subject:    "サーバー[web-1]",
+		verb:       "更新",
+		idempotent: true,
+		run: func() error {
+			calls++
+			cancel() // 1回目の失敗の後の待機中にキャンセルされた状態にします
+			return &haproxy.APIError{StatusCode: http.StatusServiceUnavailable, Message: "unavailable"}
+		},
+	}, 3)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("runWithRetry のエラー = %v, want context.Canceled を含むこと", err)
+	}
+	if calls != 1 {
+		t.Errorf("実行回数 = %d, want 1（キャンセル後は再試行しないこと）", calls)
+	}
+	if elapsed := time.Since(start); elapsed >= clientRetryInitialDelay {
+		t.Errorf("キャンセルまでの時間 = %v, want 待機（%v）を中断すること", elapsed, clientRetryInitialDelay)
+	}
+}
+
+func TestRetryBacksOffUntilExhausted(t *testing.T) {
+	var delays []time.Duration
+	calls := 0
+	policy := clientRetryPolicy(4)
+	policy.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	err := retry(context.Background(), policy, func(int) error {
+		calls++
+		return errors.New("接続できません")
+	})
+	if err == nil {
+		t.Fatal("試行回数を使い切ってもエラーになりませんでした")
+	}
+	want := []time.Duration{200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond}
+	if calls != 4 || len(delays) != len(want) {
+		t.Fatalf("実行回数 = %d, 待機 = %v, want 4 回, %v", calls, delays, want)
+	}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Errorf("%d 回目の待機 = %v, want %v（間隔を2倍ずつ広げること）", i+1, delays[i], want[i])
+		}
+	}
+}
+
+func TestApplyOnceStopsWhenCanceled(t *testing.T) {
+	captureOutput(t)
+	endpoint, _ := testMemoryEndpoint(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["`+endpoint+`"],
+		"load_balancing_algorithm": "roundrobin",
+		"max_apply_duration": "1h",
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10}]
+	}`)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := applyOnce(ctx, config)
+	if err == nil || !errors.Is(err, context.Canceled) {
+		t.Errorf("キャンセル済みの applyOnce のエラー = %v, want context.Canceled を含むこと", err)
+	}
+}
+
+// timeoutAfterApplyClient は、サーバーの追加を反映した後にタイムアウトを返すクライアントです（応答だけが失われた場合を模します）
+type timeoutAfterApplyClient struct {
+	*haproxyfake.HAProxy
+	adds int
+}
+
+func (c *timeoutAfterApplyClient) AddServer(server *haproxy.Server) error {
+	c.adds++
+	if err := c.HAProxy.AddServer(server); err != nil {
+		return err
+	}
+	return errTestTimeout
+}
+
+func TestAddServerTimeoutAlreadyAppliedIsNotResent(t *testing.T) {
+	logs, _ := captureOutput(t)
+	client := &timeoutAfterApplyClient{HAProxy: haproxyfake.New()}
+	server := haproxy.Server{Backend: "web", Name: "web-1", IP: "10.0.0.1", Port: 80, Weight: 10}
+	if err := addServerWithRetry(context.Background(), client, server, 3); err != nil {
+		t.Fatalf("addServerWithRetry がエラーを返しました: %v（反映済みのタイムアウトは成功とすること）", err)
+	}
+	if client.adds != 1 {
+		t.Errorf("AddServer の呼び出し回数 = %d, want 1（反映済みのため再送しないこと）", client.adds)
+	}
+	if servers, _ := client.GetServers(); len(servers) != 1 {
+		t.Errorf("サーバー数 = %d, want 1（二重に追加しないこと）", len(servers))
+	}
+	if !strings.Contains(logs.String(), "既に反映されているため再送しません") {
+		t.Errorf("反映済みであることがログに出力されていません:\n%s", logs)
+	}
+}
+
+func TestIdempotentOperationRetriesTimeoutDirectly(t *testing.T) {
+	captureOutput(t)
+	calls := 0
+	err := runWithRetry(context.Background(), clientOperation{
+		subject:    "サーバー[web-1]",
+		verb:       "更新",
+		idempotent: true,
+		run: func() error {
+			calls++
+			if calls == 1 {
+				return errTestTimeout
+			}
+			return nil
+		},
+		applied: func() (bool, error) {
+			t.Error("冪等な操作で反映済みかを確認しました")
+			return false, nil
+		},
+	}, 3)
+	if err != nil || calls != 2 {
+		t.Errorf("runWithRetry = %v（実行回数 %d）, want nil（2回）", err, calls)
+	}
+}
+
+// failingAddClient は、サーバーの追加（一括追加を含む）を常に再試行可能なエラーで失敗させるクライアントです
+type failingAddClient struct {
+	*haproxyfake.HAProxy
+	adds int
+}
+
+func (c *failingAddClient) AddServer(*haproxy.Server) error {
+	c.adds++
+	return errors.New("接続できません")
+}
+
+func (c *failingAddClient) AddServers([]haproxy.Server) error {
+	c.adds++
+	return errors.New("接続できません")
+}
+
+func TestMaxRetriesLimitsAttempts(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://max-retries"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10}]
+	}`)
+	for _, tt := range []struct{ maxRetries, wantAdds int }{
+		{0, 1},
+		{1, 2},
+		{-1, defaultOperationAttempts},
+	} {
+		client := &failingAddClient{HAProxy: haproxyfake.New()}
+		result, err := reconcileServers(client, config, applyOptions{attempts: tt.maxRetries + 1})
+		if err != nil {
+			t.Fatalf("reconcileServers がエラーを返しました: %v", err)
+		}
+		if client.adds != tt.wantAdds {
+			t.Errorf("-max-retries %d での AddServer の呼び出し回数 = %d, want %d", tt.maxRetries, client.adds, tt.wantAdds)
+		}
+		if len(result.Backends) != 1 || result.Backends[0].Status != StatusFailedAPI {
+			t.Errorf("-max-retries %d での結果 = %+v, want %s", tt.maxRetries, result.Backends, StatusFailedAPI)
+		}
+	}
+}
+
+func TestMaxRetriesOverridesRetryPolicy(t *testing.T) {
+	captureOutput(t)
+	path := writeTestFile(t, "config.json", `{
+		"haproxy_endpoint": ["memory://max-retries"],
+		"load_balancing_algorithm": "roundrobin",
+		"retry_policy": {"retries": 5, "redispatch": true},
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10}]
+	}`)
+	setFlag(t, "config", path)
+	for flagValue, want := range map[string]int{"-1": 5, "0": 0, "2": 2} {
+		setFlag(t, "max-retries", flagValue)
+		config, err := loadEffectiveConfig()
+		if err != nil {
+			t.Fatalf("-max-retries %s で loadEffectiveConfig がエラーを返しました: %v", flagValue, err)
+		}
+		if config.RetryPolicy.Retries != want {
+			t.Errorf("-max-retries %s での retry_policy.retries = %d, want %d", flagValue, config.RetryPolicy.Retries, want)
+		}
+	}
+	setFlag(t, "max-retries", "-2")
+	if _, err := loadEffectiveConfig(); err == nil {
+		t.Error("-max-retries -2 がエラーになりませんでした")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// currentConfigVersion は、設定ファイルの現在のスキーマのバージョン（apiVersion）です。
+// apiVersion を指定していない設定ファイルは v1 として読み込み、現在のスキーマに移行します
+const currentConfigVersion = "v2"
+
+// unversionedConfigVersion は、apiVersion を指定していない設定ファイルのバージョンです
+const unversionedConfigVersion = "v1"
+
+// configMigration は、設定ファイルを from のスキーマから次のバージョン（to）のスキーマに移行する処理です。
+// migrate は設定内容を直接書き換え、変更内容の説明を返します
+type configMigration struct {
+	from    string
+	to      string
+	migrate func(config map[string]interface{}) []string
+}
+
+// configMigrations は、登録されている移行処理です。スキーマを変更した場合は currentConfigVersion を上げ、
+// 1つ前のバージョンからの移行処理をここに追加してください
+var configMigrations = []configMigration{
+	{from: "v1", to: "v2", migrate: migrateConfigV1},
+}
+
+// migrateConfigV1 は、v1 の設定ファイルを v2 に移行します。
+// v2 では haproxy_endpoint を常に配列で記述するため、1つの文字列で指定されている場合は配列に変換します
+func migrateConfigV1(config map[string]interface{}) []string {
+	var changes []string
+	if endpoint, ok := config["haproxy_endpoint"].(string); ok {
+		config["haproxy_endpoint"] = []interface{}{endpoint}
+		changes = append(changes, fmt.Sprintf("haproxy_endpoint を配列 [%q] に変換しました", endpoint))
+	}
+	return changes
+}
+
+// migrateConfig は、JSONとして読み込んだ設定内容（source はログ用のファイル名）を現在のスキーマに移行します。
+// 古いバージョンの場合は登録された移行処理を順に適用して変更内容を警告として出力し、
+// 未知のバージョンや、このツールより新しいバージョンの場合はエラーを返します
+func migrateConfig(source string, value interface{}) (interface{}, error) {
+	config, ok := value.(map[string]interface{})
+	if !ok {
+		return value, nil
+	}
+	version := unversionedConfigVersion
+	if v, ok := config["apiVersion"]; ok {
+		s, isString := v.(string)
+		if !isString || s == "" {
+			return nil, fmt.Errorf("apiVersion は %q のような文字列で指定してください（指定値: %v）", currentConfigVersion, v)
+		}
+		version = s
+	}
+	if version == currentConfigVersion {
+		return config, nil
+	}
+	if newer, err := isNewerConfigVersion(version); err != nil {
+		return nil, err
+	} else if newer {
+		return nil, fmt.Errorf("apiVersion[%s]はこのツールが対応する %s より新しいバージョンです（ツールを更新してください）", version, currentConfigVersion)
+	}
+
+	for version != currentConfigVersion {
+		m := findConfigMigration(version)
+		if m == nil {
+			return nil, fmt.Errorf("apiVersion[%s]から %s への移行には未対応です", version, currentConfigVersion)
+		}
+		for _, change := range m.migrate(config) {
+			reportMigration(fmt.Sprintf("設定ファイル[%s]を %s から %s に移行: %s", source, m.from, m.to, change))
+		}
+		version = m.to
+	}
+	config["apiVersion"] = currentConfigVersion
+	return config, nil
+}
+
+// reportedMigrations は、このプロセスで報告済みの移行内容です（-repeat や再読み込みのたびに同じ内容を出力しないため）
+var reportedMigrations = struct {
+	sync.Mutex
+	seen map[string]bool
+}{seen: map[string]bool{}}
+
+// reportMigration は、移行内容を警告として出力します。render や export の標準出力に混ざらないよう
+// 標準エラー出力に出し、同じ内容はプロセス内で1回だけ報告します
+func reportMigration(msg string) {
+	reportedMigrations.Lock()
+	seen := reportedMigrations.seen[msg]
+	reportedMigrations.seen[msg] = true
+	reportedMigrations.Unlock()
+	if !seen {
+		warnf("%s", msg)
+	}
+}
+
+// findConfigMigration は、version からの移行処理を返します（登録されていない場合は nil）
+func findConfigMigration(version string) *configMigration {
+	for i := range configMigrations {
+		if configMigrations[i].from == version {
+			return &configMigrations[i]
+		}
+	}
+	return nil
+}
+
+// isNewerConfigVersion は、version が現在のスキーマより新しいかどうかを返します（"v" + 整数の形式でない場合はエラー）
+func isNewerConfigVersion(version string) (bool, error) {
+	n, err := configVersionNumber(version)
+	if err != nil {
+		return false, err
+	}
+	current, _ := configVersionNumber(currentConfigVersion)
+	return n > current, nil
+}
+
+// configVersionNumber は、"v2" のようなバージョンの番号を返します
+func configVersionNumber(version string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	if err != nil || !strings.HasPrefix(version, "v") || n < 1 {
+		return 0, fmt.Errorf("apiVersion[%s]は未知のバージョンです（現在のバージョンは %s）", version, currentConfigVersion)
+	}
+	return n, nil
+}
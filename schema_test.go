@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrationNoticeGoesToStderrOnce(t *testing.T) {
+	logs, errs := captureOutput(t)
+	path := writeTestFile(t, "config.json", `{
+		"haproxy_endpoint": "memory://schema",
+		"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10}]
+	}`)
+
+	for i := 0; i < 2; i++ {
+		config, err := loadConfig(path)
+		if err != nil {
+			t.Fatalf("%d 回目の loadConfig がエラーを返しました: %v", i+1, err)
+		}
+		if len(config.HaproxyEndpoint) != 1 || config.HaproxyEndpoint[0] != "memory://schema" {
+			t.Errorf("移行後の haproxy_endpoint = %v, want [memory://schema]", config.HaproxyEndpoint)
+		}
+	}
+	if logs.Len() != 0 {
+		t.Errorf("移行の通知が標準出力に出力されました: %q（render や export の出力を壊さないこと）", logs.String())
+	}
+	if n := strings.Count(errs.String(), "v1 から v2 に移行"); n != 1 {
+		t.Errorf("移行の通知の回数 = %d, want 1（同じ内容は1回だけ報告すること）: %q", n, errs.String())
+	}
+}
+
+func TestMigrateConfigKeepsCurrentVersion(t *testing.T) {
+	logs, errs := captureOutput(t)
+	value := map[string]interface{}{"apiVersion": currentConfigVersion, "haproxy_endpoint": "memory://current"}
+	migrated, err := migrateConfig("test", value)
+	if err != nil {
+		t.Fatalf("migrateConfig がエラーを返しました: %v", err)
+	}
+	if got := migrated.(map[string]interface{})["haproxy_endpoint"]; got != "memory://current" {
+		t.Errorf("現在のバージョンの haproxy_endpoint = %v, want 変更しないこと", got)
+	}
+	if logs.Len() != 0 || errs.Len() != 0 {
+		t.Errorf("移行しない設定での出力 = %q, 標準エラー出力 = %q, want なし", logs.String(), errs.String())
+	}
+}
+
+func TestMigrateConfigRejectsNewerVersion(t *testing.T) {
+	_, err := migrateConfig("test", map[string]interface{}{"apiVersion": "v99"})
+	if err == nil || !strings.Contains(err.Error(), "新しいバージョン") {
+		t.Errorf("migrateConfig(v99) のエラー = %v, want 新しいバージョンのエラー", err)
+	}
+	for _, version := range []interface{}{"beta", "v0", 2, ""} {
+		if _, err := migrateConfig("test", map[string]interface{}{"apiVersion": version}); err == nil {
+			t.Errorf("apiVersion %v がエラーになりませんでした", version)
+		}
+	}
+}
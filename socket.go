@@ -0,0 +1,539 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// socketScheme は runtime socket を指すエンドポイントのスキームです（例: unix:///var/run/haproxy.sock）
+const socketScheme = "unix://"
+
+// errRuntimeUnsupported は、runtime socket からは変更できない設定を指定された場合のエラーです
+var errRuntimeUnsupported = errors.New("runtime socket では未対応の操作です")
+
+// socketClient は、HAProxy の runtime socket（stats socket）を通じてサーバーを操作するクライアントです。
+// runtime API はサーバーのヘルスチェック間隔などを返さないため、GetServers で取得できるのは
+// バックエンド名・サーバー名・アドレス・ポート・重み・最大同時接続数・ヘルスチェックの有無とその接続先・ssl の有無のみです。
+// それ以外の項目は fillUnreadServerFields で差分の比較から除きます
+type socketClient struct {
+	path    string
+	timeout time.Duration
+}
+
+// newSocketClient は、指定したパスの runtime socket を使うクライアントを返します
+func newSocketClient(path string) *socketClient {
+	return &socketClient{path: path, timeout: 5 * time.Second}
+}
+
+// exec は、runtime socket に1つのコマンドを送り、応答全体を返します
+func (c *socketClient) exec(command string) (string, error) {
+	conn, err := net.DialTimeout("unix", c.path, c.timeout)
+	if err != nil {
+		return "", fmt.Errorf("runtime socket[%s]への接続失敗: %w", c.path, err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return "", err
+	}
+
+	if _, err := conn.Write([]byte(command + "\n")); err != nil {
+		return "", fmt.Errorf("コマンド[%s]の送信失敗: %w", command, err)
+	}
+	resp, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return "", fmt.Errorf("コマンド[%s]の応答読み込み失敗: %w", command, err)
+	}
+	return strings.TrimSpace(string(resp)), nil
+}
+
+// execExpect は、コマンドを実行し、応答が期待したメッセージで始まる場合のみ成功とします。
+// 期待するメッセージを指定しない場合は、応答が空であれば成功とします
+func (c *socketClient) execExpect(command string, okPrefixes ...string) error {
+	resp, err := c.exec(command)
+	if err != nil {
+		return err
+	}
+	if resp == "" && len(okPrefixes) == 0 {
+		return nil
+	}
+	for _, prefix := range okPrefixes {
+		if strings.HasPrefix(resp, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("コマンド[%s]が失敗しました: %s", command, resp)
+}
+
+// Ping は、runtime socket に show info を送り疎通確認を行います
+func (c *socketClient) Ping() error {
+	resp, err := c.exec("show info")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(resp, "Name:") {
+		return fmt.Errorf("runtime socket から想定外の応答: %s", resp)
+	}
+	return nil
+}
+
+// GetAPIVersion は、show version で HAProxy 本体のバージョンを返します
+func (c *socketClient) GetAPIVersion() (string, error) {
+	return c.exec("show version")
+}
+
+// GetServers は、show servers state の結果から現在のサーバー一覧を返します。
+// 最大同時接続数は show servers state に含まれないため、show stat の slim から補います
+func (c *socketClient) GetServers() ([]haproxy.Server, error) {
+	resp, err := c.exec("show servers state")
+	if err != nil {
+		return nil, err
+	}
+	servers, err := parseServersState(resp)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := c.exec("show stat")
+	if err != nil {
+		return nil, err
+	}
+	limits, err := parseStatLimits(stat)
+	if err != nil {
+		return nil, err
+	}
+	for i := range servers {
+		servers[i].Maxconn = limits[serverKey(servers[i].Backend, servers[i].Name)]
+	}
+	return servers, nil
+}
+
+// fillUnreadServerFields は、show servers state と show stat から取得できない項目（inter, fall, rise, ssl のパラメータ、
+// send-proxy、track、ラベルなど）を設定ファイルの値で補ったサーバー定義を返します。
+// これらの項目を常に差分として扱うと、適用のたびにサーバーを更新し続けて収束しなくなるためです。
+// check-addr / check-port は Runtime API で変更できますが解除はできないため、設定ファイルで指定していない場合は比較しません
+func (c *socketClient) fillUnreadServerFields(cur, desired haproxy.Server) haproxy.Server {
+	cur.ID, cur.Source = desired.ID, desired.Source
+	cur.Inter, cur.Fall, cur.Rise, cur.Downinter, cur.Fastinter = desired.Inter, desired.Fall, desired.Rise, desired.Downinter, desired.Fastinter
+	cur.Alpn, cur.Npn, cur.Verify, cur.Sni, cur.SSLCertificate = desired.Alpn, desired.Npn, desired.Verify, desired.Sni, desired.SSLCertificate
+	cur.SendProxy, cur.ProxyV2Options, cur.Track, cur.Metadata = desired.SendProxy, desired.ProxyV2Options, desired.Track, desired.Metadata
+	if desired.CheckAddr == "" {
+		cur.CheckAddr = ""
+	}
+	if desired.CheckPort == 0 {
+		cur.CheckPort = 0
+	}
+	return cur
+}
+
+// AddServer は、add server でサーバーを動的に追加し、有効化します
+func (c *socketClient) AddServer(server *haproxy.Server) error {
+	target, err := socketTarget(server)
+	if err != nil {
+		return err
+	}
+	if len(server.Metadata) > 0 {
+		return fmt.Errorf("%w: サーバー[%s]のラベル", errRuntimeUnsupported, target)
+	}
+	cmd := fmt.Sprintf("add server %s %s%s", target, serverAddress(*server), serverOptions(*server))
+	if err := c.execExpect(cmd, "New server registered"); err != nil {
+		return err
+	}
+	// 動的に追加したサーバーはメンテナンス状態で登録されるため有効化する
+	if server.Check {
+		if err := c.execExpect("enable health " + target); err != nil {
+			return err
+		}
+	}
+	return c.execExpect("enable server " + target)
+}
+
+// UpdateServer は、既存サーバーのアドレス・ポート、重み、最大同時接続数、ヘルスチェックの接続先、ssl の有無と
+// ヘルスチェックの有効・無効を変更します（GetServers で読み取れる項目をすべて設定ファイルの値にします）
+func (c *socketClient) UpdateServer(server *haproxy.Server) error {
+	target, err := socketTarget(server)
+	if err != nil {
+		return err
+	}
+	// Runtime API の set server addr は unix ソケットのアドレスに対応していません
+	if strings.HasPrefix(server.IP, unixAddressPrefix) {
+		return fmt.Errorf("サーバー[%s]の unix ソケットのアドレスは Runtime API では変更できません: %w", target, errRuntimeUnsupported)
+	}
+	if len(server.Metadata) > 0 {
+		return fmt.Errorf("%w: サーバー[%s]のラベル", errRuntimeUnsupported, target)
+	}
+	if err := c.execExpect(fmt.Sprintf("set server %s addr %s port %d", target, server.IP, server.Port), "IP changed", "port changed", "no need to change"); err != nil {
+		return err
+	}
+	if err := c.SetWeight(server.Backend, server.Name, server.Weight); err != nil {
+		return err
+	}
+	if err := c.SetMaxconn(server.Backend, server.Name, server.Maxconn); err != nil {
+		return err
+	}
+	if err := c.setCheckTarget(target, server); err != nil {
+		return err
+	}
+	ssl := "off"
+	if server.SSL {
+		ssl = "on"
+	}
+	if err := c.execExpect(fmt.Sprintf("set server %s ssl %s", target, ssl), "server ssl setting updated"); err != nil {
+		return err
+	}
+	// check の有無はサーバーを作り直さずに enable / disable health で切り替えます
+	return c.SetHealthCheck(server.Backend, server.Name, server.Check)
+}
+
+// setCheckTarget は、ヘルスチェックの接続先（check-addr / check-port）を変更します。
+// どちらも指定されていない場合は何もしません（Runtime API では解除できないため）
+func (c *socketClient) setCheckTarget(target string, server *haproxy.Server) error {
+	switch {
+	case server.CheckAddr != "" && server.CheckPort != 0:
+		return c.execExpect(fmt.Sprintf("set server %s check-addr %s port %d", target, server.CheckAddr, server.CheckPort), "health check", "no need to change")
+	case server.CheckAddr != "":
+		return c.execExpect(fmt.Sprintf("set server %s check-addr %s", target, server.CheckAddr), "health check", "no need to change")
+	case server.CheckPort != 0:
+		return c.execExpect(fmt.Sprintf("set server %s check-port %d", target, server.CheckPort), "health check")
+	}
+	return nil
+}
+
+// RenameServer は runtime socket ではサーバー名を変更できないため常にエラーを返します
+func (c *socketClient) RenameServer(name string, server *haproxy.Server) error {
+	return fmt.Errorf("%w: サーバー[%s]の名前の変更", errRuntimeUnsupported, serverKey(server.Backend, name))
+}
+
+// RemoveServer は、サーバーをメンテナンス状態にしてから del server で削除します
+func (c *socketClient) RemoveServer(server *haproxy.Server) error {
+	target, err := socketTarget(server)
+	if err != nil {
+		return err
+	}
+	if err := c.DisableServer(server.Backend, server.Name); err != nil {
+		return err
+	}
+	return c.execExpect("del server "+target, "Server deleted")
+}
+
+// DrainServer は、サーバーを drain 状態にして新しい接続の振り分け対象から外します（既存の接続は維持されます）
+func (c *socketClient) DrainServer(backend, name string) error {
+	return c.execExpect(fmt.Sprintf("set server %s/%s state drain", backend, name))
+}
+
+// GetServerSessions は、show stat の scur（現在の接続数）からサーバーの接続数を返します
+func (c *socketClient) GetServerSessions(backend, name string) (int64, error) {
+	resp, err := c.exec("show stat")
+	if err != nil {
+		return 0, err
+	}
+	return parseStatSessions(resp, backend, name)
+}
+
+// parseStatRows は、show stat の CSV の応答を、列名をキーとする行の一覧に変換します
+func parseStatRows(resp string) ([]map[string]string, error) {
+	var columns []string
+	var rows []map[string]string
+	for _, line := range strings.Split(resp, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			columns = strings.Split(strings.TrimSpace(strings.TrimPrefix(line, "#")), ",")
+			continue
+		}
+		if columns == nil {
+			return nil, fmt.Errorf("show stat の応答にヘッダー行がありません: %s", line)
+		}
+		fields := strings.Split(line, ",")
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			if i < len(fields) {
+				row[column] = fields[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseStatSessions は、show stat の CSV の応答から、指定したサーバーの scur を返します
+func parseStatSessions(resp, backend, name string) (int64, error) {
+	rows, err := parseStatRows(resp)
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		if row["pxname"] == backend && row["svname"] == name {
+			sessions, err := strconv.ParseInt(row["scur"], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("サーバー[%s]の scur[%s]を解釈できません: %w", serverKey(backend, name), row["scur"], err)
+			}
+			return sessions, nil
+		}
+	}
+	return 0, fmt.Errorf("show stat にサーバー[%s]がありません", serverKey(backend, name))
+}
+
+// parseStatLimits は、show stat の CSV の応答から、サーバーごとの slim（最大同時接続数）を serverKey をキーとして返します。
+// slim が空のサーバー（maxconn の指定なし）は 0 とします
+func parseStatLimits(resp string) (map[string]int64, error) {
+	rows, err := parseStatRows(resp)
+	if err != nil {
+		return nil, err
+	}
+	limits := map[string]int64{}
+	for _, row := range rows {
+		if row["svname"] == "FRONTEND" || row["svname"] == "BACKEND" || row["slim"] == "" {
+			continue
+		}
+		limit, err := strconv.ParseInt(row["slim"], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("サーバー[%s]の slim[%s]を解釈できません: %w", serverKey(row["pxname"], row["svname"]), row["slim"], err)
+		}
+		limits[serverKey(row["pxname"], row["svname"])] = limit
+	}
+	return limits, nil
+}
+
+// SetWeight は、サーバーの重みを変更します
+func (c *socketClient) SetWeight(backend, name string, weight int64) error {
+	return c.execExpect(fmt.Sprintf("set server %s/%s weight %d", backend, name, weight))
+}
+
+// SetMaxconn は、サーバーの最大同時接続数を変更します
+func (c *socketClient) SetMaxconn(backend, name string, maxconn int64) error {
+	return c.execExpect(fmt.Sprintf("set maxconn server %s/%s %d", backend, name, maxconn))
+}
+
+// SetHealthCheck は、サーバーを作り直さずにヘルスチェックを enable / disable health で切り替えます
+func (c *socketClient) SetHealthCheck(backend, name string, enabled bool) error {
+	health := "disable"
+	if enabled {
+		health = "enable"
+	}
+	return c.execExpect(fmt.Sprintf("%s health %s/%s", health, backend, name))
+}
+
+// DisableServer は、サーバーをメンテナンス状態にして振り分け対象から外します
+func (c *socketClient) DisableServer(backend, name string) error {
+	return c.execExpect(fmt.Sprintf("disable server %s/%s", backend, name))
+}
+
+// SetLoadBalancingAlgorithm は runtime socket では変更できないため常にエラーを返します
+func (c *socketClient) SetLoadBalancingAlgorithm(algorithm string) error {
+	return fmt.Errorf("%w: balance %s", errRuntimeUnsupported, algorithm)
+}
+
+// GetConfig は runtime socket では取得できないため常にエラーを返します
+func (c *socketClient) GetConfig(key string) (string, error) {
+	return "", fmt.Errorf("%w: %s の取得", errRuntimeUnsupported, key)
+}
+
+// SetConfig は runtime socket では変更できないため常にエラーを返します
+func (c *socketClient) SetConfig(key, value string) error {
+	return fmt.Errorf("%w: %s %s", errRuntimeUnsupported, key, value)
+}
+
+// GetServerTemplates は runtime socket では取得できないため常にエラーを返します
+func (c *socketClient) GetServerTemplates() ([]haproxy.ServerTemplate, error) {
+	return nil, fmt.Errorf("%w: server-template の取得", errRuntimeUnsupported)
+}
+
+// AddServerTemplate は runtime socket では作成できないため常にエラーを返します
+func (c *socketClient) AddServerTemplate(template *haproxy.ServerTemplate) error {
+	return fmt.Errorf("%w: server-template %s", errRuntimeUnsupported, template.Prefix)
+}
+
+// UpdateServerTemplate は runtime socket では変更できないため常にエラーを返します
+func (c *socketClient) UpdateServerTemplate(template *haproxy.ServerTemplate) error {
+	return fmt.Errorf("%w: server-template %s", errRuntimeUnsupported, template.Prefix)
+}
+
+// GetBackends は runtime socket では取得できないため常にエラーを返します
+func (c *socketClient) GetBackends() ([]string, error) {
+	return nil, fmt.Errorf("%w: バックエンド一覧の取得", errRuntimeUnsupported)
+}
+
+// GetFrontends は runtime socket では取得できないため常にエラーを返します
+func (c *socketClient) GetFrontends() ([]haproxy.Frontend, error) {
+	return nil, fmt.Errorf("%w: フロントエンド一覧の取得", errRuntimeUnsupported)
+}
+
+// DeleteBackend は runtime socket では削除できないため常にエラーを返します
+func (c *socketClient) DeleteBackend(name string) error {
+	return fmt.Errorf("%w: バックエンド %s の削除", errRuntimeUnsupported, name)
+}
+
+// GetResolvers は runtime socket では取得できないため常にエラーを返します
+func (c *socketClient) GetResolvers() ([]haproxy.Resolver, error) {
+	return nil, fmt.Errorf("%w: resolvers の取得", errRuntimeUnsupported)
+}
+
+// AddResolver は runtime socket では作成できないため常にエラーを返します
+func (c *socketClient) AddResolver(resolver *haproxy.Resolver) error {
+	return fmt.Errorf("%w: resolvers %s の作成", errRuntimeUnsupported, resolver.Name)
+}
+
+// UpdateResolver は runtime socket では変更できないため常にエラーを返します
+func (c *socketClient) UpdateResolver(resolver *haproxy.Resolver) error {
+	return fmt.Errorf("%w: resolvers %s の更新", errRuntimeUnsupported, resolver.Name)
+}
+
+// GetMailers は runtime socket では取得できないため常にエラーを返します
+func (c *socketClient) GetMailers() ([]haproxy.MailersSection, error) {
+	return nil, fmt.Errorf("%w: mailers の取得", errRuntimeUnsupported)
+}
+
+// AddMailers は runtime socket では作成できないため常にエラーを返します
+func (c *socketClient) AddMailers(mailers *haproxy.MailersSection) error {
+	return fmt.Errorf("%w: mailers %s の作成", errRuntimeUnsupported, mailers.Name)
+}
+
+// UpdateMailers は runtime socket では変更できないため常にエラーを返します
+func (c *socketClient) UpdateMailers(mailers *haproxy.MailersSection) error {
+	return fmt.Errorf("%w: mailers %s の更新", errRuntimeUnsupported, mailers.Name)
+}
+
+// GetCaches は runtime socket では取得できないため常にエラーを返します
+func (c *socketClient) GetCaches() ([]haproxy.Cache, error) {
+	return nil, fmt.Errorf("%w: cache の取得", errRuntimeUnsupported)
+}
+
+// AddCache は runtime socket では作成できないため常にエラーを返します
+func (c *socketClient) AddCache(cache *haproxy.Cache) error {
+	return fmt.Errorf("%w: cache %s の作成", errRuntimeUnsupported, cache.Name)
+}
+
+// UpdateCache は runtime socket では変更できないため常にエラーを返します
+func (c *socketClient) UpdateCache(cache *haproxy.Cache) error {
+	return fmt.Errorf("%w: cache %s の更新", errRuntimeUnsupported, cache.Name)
+}
+
+// GetPeers は runtime socket では取得できないため常にエラーを返します
+func (c *socketClient) GetPeers() ([]haproxy.PeerSection, error) {
+	return nil, fmt.Errorf("%w: peers の取得", errRuntimeUnsupported)
+}
+
+// AddPeers は runtime socket では作成できないため常にエラーを返します
+func (c *socketClient) AddPeers(peers *haproxy.PeerSection) error {
+	return fmt.Errorf("%w: peers %s の作成", errRuntimeUnsupported, peers.Name)
+}
+
+// UpdatePeers は runtime socket では更新できないため常にエラーを返します
+func (c *socketClient) UpdatePeers(peers *haproxy.PeerSection) error {
+	return fmt.Errorf("%w: peers %s の更新", errRuntimeUnsupported, peers.Name)
+}
+
+// ReplaceHTTPRules は runtime socket では変更できないため常にエラーを返します
+func (c *socketClient) ReplaceHTTPRules(parentType, parentName, direction string, rules []haproxy.HTTPRule) error {
+	return fmt.Errorf("%w: %s %s の http ルール", errRuntimeUnsupported, parentType, parentName)
+}
+
+// SetFrontendConfig は runtime socket では変更できないため常にエラーを返します
+func (c *socketClient) SetFrontendConfig(frontend, key, value string) error {
+	return fmt.Errorf("%w: frontend %s: %s %s", errRuntimeUnsupported, frontend, key, value)
+}
+
+// SetBackendConfig は runtime socket では変更できないため常にエラーを返します
+func (c *socketClient) SetBackendConfig(backend, key, value string) error {
+	return fmt.Errorf("%w: backend %s: %s %s", errRuntimeUnsupported, backend, key, value)
+}
+
+// socketTarget は、runtime API で使う "バックエンド名/サーバー名" を返します
+func socketTarget(server *haproxy.Server) (string, error) {
+	if server.Backend == "" {
+		return "", fmt.Errorf("runtime socket でサーバー[%s]を操作するには group（バックエンド名）の指定が必要です", server.Name)
+	}
+	return server.Backend + "/" + server.Name, nil
+}
+
+// parseServersState は、show servers state の出力をサーバー一覧に変換します。
+// 列の位置はHAProxyのバージョンで異なるため、ヘッダー行の列名から判断します
+func parseServersState(resp string) ([]haproxy.Server, error) {
+	var columns map[string]int
+	var servers []haproxy.Server
+	for _, line := range strings.Split(resp, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line == "1":
+			// 空行とフォーマットバージョン行は読み飛ばす
+			continue
+		case strings.HasPrefix(line, "#"):
+			columns = map[string]int{}
+			for i, name := range strings.Fields(strings.TrimPrefix(line, "#")) {
+				columns[name] = i
+			}
+			continue
+		}
+		if columns == nil {
+			return nil, fmt.Errorf("show servers state の応答にヘッダー行がありません: %s", line)
+		}
+
+		fields := strings.Fields(line)
+		// 値のない列は "-" と出力されるため空文字列とします
+		get := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(fields) || fields[i] == "-" {
+				return ""
+			}
+			return fields[i]
+		}
+		port, _ := strconv.Atoi(get("srv_port"))
+		weight, _ := strconv.ParseInt(get("srv_uweight"), 10, 64)
+		opState, _ := strconv.Atoi(get("srv_op_state"))
+		adminState, _ := strconv.Atoi(get("srv_admin_state"))
+		checkState, _ := strconv.Atoi(get("srv_check_state"))
+		checkPort, _ := strconv.Atoi(get("srv_check_port"))
+		server := haproxy.Server{
+			Backend:   get("be_name"),
+			Name:      get("srv_name"),
+			IP:        get("srv_addr"),
+			Port:      port,
+			Weight:    weight,
+			Status:    socketServerStatus(opState, adminState),
+			Check:     checkState&srvCheckConfigured != 0 && checkState&srvCheckEnabled != 0,
+			CheckAddr: get("srv_check_addr"),
+			CheckPort: checkPort,
+			SSL:       get("srv_use_ssl") == "1",
+		}
+		// srv_time_since_last_change は最後に状態が変化してからの秒数
+		if lastChange, err := strconv.ParseInt(get("srv_time_since_last_change"), 10, 64); err == nil {
+			server.LastChange = &lastChange
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+// runtime API の srv_admin_state のフラグ
+const (
+	srvAdminMaintMask = 0x01 | 0x02 | 0x04 | 0x20 // FMAINT, IMAINT, CMAINT, RMAINT
+	srvAdminDrainMask = 0x08 | 0x10               // FDRAIN, IDRAIN
+)
+
+// runtime API の srv_check_state のフラグ（ヘルスチェックが設定され、disable health で無効にされていない場合に両方が立ちます）
+const (
+	srvCheckConfigured = 0x02 // CHK_ST_CONFIGURED
+	srvCheckEnabled    = 0x04 // CHK_ST_ENABLED
+)
+
+// socketServerStatus は、show servers state の運用状態と管理状態を統計ページと同じ状態表記に変換します
+func socketServerStatus(opState, adminState int) string {
+	switch {
+	case adminState&srvAdminMaintMask != 0:
+		return "MAINT"
+	case adminState&srvAdminDrainMask != 0:
+		return "DRAIN"
+	case opState == 2: // SRV_ST_RUNNING
+		return "UP"
+	default:
+		return "DOWN"
+	}
+}
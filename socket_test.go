@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// 実際の HAProxy 2.4 の show servers state と show stat の出力（show stat は先頭の列のみ）です
+const (
+	testServersStateHeader = "# be_id be_name srv_id srv_name srv_addr srv_op_state srv_admin_state srv_uweight srv_iweight srv_time_since_last_change srv_check_status srv_check_result srv_check_health srv_check_state srv_agent_state bk_f_forced_id srv_f_forced_id srv_fqdn srv_port srvrecord srv_use_ssl srv_check_port srv_check_addr srv_agent_addr srv_agent_port"
+	testStatHeader         = "# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight"
+)
+
+// fakeSocket は、runtime socket のコマンドを記録し、あらかじめ設定した応答を返すテスト用の unix ソケットのサーバーです
+type fakeSocket struct {
+	mu        sync.Mutex
+	path      string
+	responses map[string]string // コマンド（前方一致、最も長く一致したもの）→ 応答
+	commands  []string
+}
+
+// newFakeSocket は、一時ディレクトリに unix ソケットを作成し、接続ごとに1つのコマンドに応答するサーバーを起動します
+func newFakeSocket(t *testing.T, responses map[string]string) *fakeSocket {
+	t.Helper()
+	s := &fakeSocket{path: filepath.Join(t.TempDir(), "haproxy.sock"), responses: responses}
+	l, err := net.Listen("unix", s.path)
+	if err != nil {
+		t.Fatalf("unix ソケットを作成できません: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSocket) serve(conn net.Conn) {
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	command := strings.TrimSpace(line)
+	s.mu.Lock()
+	s.commands = append(s.commands, command)
+	resp, matched := "", -1
+	for prefix, r := range s.responses {
+		if strings.HasPrefix(command, prefix) && len(prefix) > matched {
+			resp, matched = r, len(prefix)
+		}
+	}
+	s.mu.Unlock()
+	conn.Write([]byte(resp + "\n"))
+}
+
+// mutations は、記録したコマンドのうち状態を読み取るだけのもの（show ...）以外を返します
+func (s *fakeSocket) mutations() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var commands []string
+	for _, c := range s.commands {
+		if !strings.HasPrefix(c, "show ") {
+			commands = append(commands, c)
+		}
+	}
+	return commands
+}
+
+// socketTestConfig は、ヘルスチェックを有効にした web グループのサーバー2台を runtime socket に適用する設定を返します
+func socketTestConfig(t *testing.T, socket *fakeSocket, weight string) *Config {
+	return loadTestConfig(t, `{
+		"haproxy_endpoint": ["unix://`+socket.path+`"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": `+weight+`, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web", "maxconn": 100}
+		]
+	}`)
+}
+
+// socketTestState は、socketTestConfig と同じ状態の HAProxy の show servers state と show stat の応答です
+func socketTestState() map[string]string {
+	return map[string]string{
+		"show servers state": "1\n" + testServersStateHeader + "\n" +
+			"3 web 1 web-1 10.0.0.1 2 0 10 10 120 6 3 4 6 0 0 0 - 80 - 0 0 - - 0\n" +
+			"3 web 2 web-2 10.0.0.2 2 0 10 10 95 6 3 4 6 0 0 0 - 80 - 0 0 - - 0",
+		"show stat": testStatHeader + "\n" +
+			"web,FRONTEND,,,0,0,2000,0,0,0,0,0,0,,,,,OPEN,\n" +
+			"web,web-1,0,0,0,0,,0,0,0,,0,,0,0,0,0,UP,10\n" +
+			"web,web-2,0,0,0,0,100,0,0,0,,0,,0,0,0,0,UP,10\n" +
+			"web,BACKEND,0,0,0,0,200,0,0,0,0,0,,0,0,0,0,UP,20",
+		"add server":    "New server registered.",
+		"set server":    "",
+		"enable health": "",
+	}
+}
+
+func TestSocketGetServersReadsState(t *testing.T) {
+	socket := newFakeSocket(t, socketTestState())
+	servers, err := newSocketClient(socket.path).GetServers()
+	if err != nil {
+		t.Fatalf("GetServers がエラーを返しました: %v", err)
+	}
+	if len(servers) != 2 {
+		t.Fatalf("GetServers の件数 = %d, want 2", len(servers))
+	}
+	s := servers[1]
+	if s.Backend != "web" || s.Name != "web-2" || s.IP != "10.0.0.2" || s.Port != 80 || s.Weight != 10 {
+		t.Errorf("サーバーの基本の項目が異なります: %+v", s)
+	}
+	if !s.Check || s.CheckAddr != "" || s.CheckPort != 0 || s.SSL {
+		t.Errorf("ヘルスチェックと ssl の項目が異なります: %+v", s)
+	}
+	if s.Maxconn != 100 || servers[0].Maxconn != 0 {
+		t.Errorf("maxconn = %d, %d, want 0, 100（show stat の slim。空の場合は 0）", servers[0].Maxconn, s.Maxconn)
+	}
+	if s.Status != "UP" {
+		t.Errorf("status = %q, want UP", s.Status)
+	}
+}
+
+func TestSocketReconcileConverges(t *testing.T) {
+	captureOutput(t)
+	socket := newFakeSocket(t, socketTestState())
+	config := socketTestConfig(t, socket, "10")
+
+	result, err := reconcileServers(newSocketClient(socket.path), config, applyOptions{})
+	if err != nil {
+		t.Fatalf("reconcileServers がエラーを返しました: %v", err)
+	}
+	for _, b := range result.Backends {
+		if b.Status != StatusSkippedExists {
+			t.Errorf("サーバー[%s]の結果 = %s, want %s（取得できない inter などを差分としないこと）", b.Name, b.Status, StatusSkippedExists)
+		}
+	}
+	if m := socket.mutations(); len(m) != 0 {
+		t.Errorf("変更のない適用で runtime socket に変更のコマンドが送られました: %v", m)
+	}
+}
+
+func TestSocketReconcileSendsOnlyChangedFields(t *testing.T) {
+	captureOutput(t)
+	socket := newFakeSocket(t, socketTestState())
+	config := socketTestConfig(t, socket, "20")
+
+	result, err := reconcileServers(newSocketClient(socket.path), config, applyOptions{})
+	if err != nil {
+		t.Fatalf("reconcileServers がエラーを返しました: %v", err)
+	}
+	if result.Backends[0].Status != StatusUpdated {
+		t.Errorf("web-1 の結果 = %s, want %s", result.Backends[0].Status, StatusUpdated)
+	}
+	want := []string{"set server web/web-1 weight 20"}
+	if m := socket.mutations(); strings.Join(m, "\n") != strings.Join(want, "\n") {
+		t.Errorf("runtime socket に送られた変更のコマンド = %v, want %v", m, want)
+	}
+}
+
+func TestSocketAddServer(t *testing.T) {
+	captureOutput(t)
+	state := socketTestState()
+	state["show servers state"] = "1\n" + testServersStateHeader + "\n" +
+		"3 web 1 web-1 10.0.0.1 2 0 10 10 120 6 3 4 6 0 0 0 - 80 - 0 0 - - 0"
+	socket := newFakeSocket(t, state)
+	config := socketTestConfig(t, socket, "10")
+
+	result, err := reconcileServers(newSocketClient(socket.path), config, applyOptions{})
+	if err != nil {
+		t.Fatalf("reconcileServers がエラーを返しました: %v", err)
+	}
+	if result.Backends[1].Status != StatusAdded {
+		t.Fatalf("web-2 の結果 = %+v, want %s", result.Backends[1], StatusAdded)
+	}
+	m := socket.mutations()
+	if len(m) != 3 || !strings.HasPrefix(m[0], "add server web/web-2 10.0.0.2:80 weight 10 maxconn 100") ||
+		m[1] != "enable health web/web-2" || m[2] != "enable server web/web-2" {
+		t.Errorf("runtime socket に送られた追加のコマンド = %q", m)
+	}
+}
+
+func TestSocketUpdateServerConvergesReadableFields(t *testing.T) {
+	captureOutput(t)
+	state := socketTestState()
+	// web-2 の maxconn・ヘルスチェックの接続先・ssl が設定と異なり、web-1 には設定にない check-addr があります
+	drifted := "1\n" + testServersStateHeader + "\n" +
+		"3 web 1 web-1 10.0.0.1 2 0 10 10 120 6 3 4 6 0 0 0 - 80 - 0 0 10.0.9.9 - 0\n" +
+		"3 web 2 web-2 10.0.0.2 2 0 10 10 95 6 3 4 6 0 0 0 - 80 - 1 8081 10.0.9.9 - 0"
+	state["show servers state"] = drifted
+	state["show stat"] = strings.Replace(state["show stat"], "web,web-2,0,0,0,0,100,", "web,web-2,0,0,0,0,50,", 1)
+	state["set server web/web-2 addr"] = "no need to change the addr, port or addr and port"
+	state["set server web/web-2 check-addr"] = "health check addr updated."
+	state["set server web/web-2 ssl"] = "server ssl setting updated."
+	socket := newFakeSocket(t, state)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["unix://`+socket.path+`"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web", "maxconn": 100,
+				"health_check": {"address": "10.0.9.2", "port": 8080}}
+		]
+	}`)
+
+	result, err := reconcileServers(newSocketClient(socket.path), config, applyOptions{})
+	if err != nil {
+		t.Fatalf("reconcileServers がエラーを返しました: %v", err)
+	}
+	if result.Backends[0].Status != StatusSkippedExists {
+		t.Errorf("web-1 の結果 = %s, want %s（解除できない check-addr は設定にない場合は比較しないこと）", result.Backends[0].Status, StatusSkippedExists)
+	}
+	if result.Backends[1].Status != StatusUpdated {
+		t.Fatalf("web-2 の結果 = %+v, want %s", result.Backends[1], StatusUpdated)
+	}
+	want := []string{
+		"set server web/web-2 addr 10.0.0.2 port 80",
+		"set server web/web-2 weight 10",
+		"set maxconn server web/web-2 100",
+		"set server web/web-2 check-addr 10.0.9.2 port 8080",
+		"set server web/web-2 ssl off",
+		"enable health web/web-2",
+	}
+	if m := socket.mutations(); strings.Join(m, "\n") != strings.Join(want, "\n") {
+		t.Errorf("runtime socket に送られた更新のコマンド = %q, want %q", m, want)
+	}
+
+	// 更新後の状態では差分がなく、次の適用で変更しないこと
+	converged := newFakeSocket(t, map[string]string{
+		"show servers state": strings.Replace(drifted, "- 80 - 1 8081 10.0.9.9 - 0", "- 80 - 0 8080 10.0.9.2 - 0", 1),
+		"show stat":          socketTestState()["show stat"],
+	})
+	if _, err := reconcileServers(newSocketClient(converged.path), config, applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if m := converged.mutations(); len(m) != 0 {
+		t.Errorf("更新後の適用で runtime socket に変更のコマンドが送られました: %q", m)
+	}
+}
+
+func TestSocketAddServerFailsOnUnexpectedResponse(t *testing.T) {
+	socket := newFakeSocket(t, map[string]string{"add server": "No such backend."})
+	err := newSocketClient(socket.path).AddServer(&haproxy.Server{Backend: "web", Name: "web-1", IP: "10.0.0.1", Port: 80})
+	if err == nil || !strings.Contains(err.Error(), "No such backend.") {
+		t.Errorf("AddServer のエラー = %v, want runtime socket の応答を含むエラー", err)
+	}
+	if got := socket.mutations(); len(got) != 1 {
+		t.Errorf("送信したコマンド = %q, want add server のみ（失敗後に有効化しないこと）", got)
+	}
+}
+
+func TestSocketUnsupportedOperations(t *testing.T) {
+	client := newSocketClient(filepath.Join(t.TempDir(), "unused.sock"))
+	if err := client.AddServer(&haproxy.Server{Name: "web-1", IP: "10.0.0.1", Port: 80}); err == nil || !strings.Contains(err.Error(), "group") {
+		t.Errorf("group のないサーバーの AddServer = %v, want group の指定が必要なエラー", err)
+	}
+	if err := client.SetLoadBalancingAlgorithm("leastconn"); !errors.Is(err, errRuntimeUnsupported) {
+		t.Errorf("SetLoadBalancingAlgorithm() = %v, want errRuntimeUnsupported", err)
+	}
+	if err := client.SetConfig("retries", "3"); !errors.Is(err, errRuntimeUnsupported) {
+		t.Errorf("SetConfig() = %v, want errRuntimeUnsupported", err)
+	}
+}
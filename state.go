@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// stateFileNameInvalid は、-output-state のファイル名に接続先を含める際に置き換える文字です
+var stateFileNameInvalid = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// outputStatePath は、-output-state の書き出し先を返します。接続先が複数ある場合はインスタンスごとにファイルを分けるため、
+// 拡張子の前に接続先から作った名前を挿入します（例: state.json → state.haproxy1_9000.json）
+func outputStatePath(path, endpoint string, endpoints int) string {
+	if endpoints <= 1 {
+		return path
+	}
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		endpoint = endpoint[i+3:]
+	}
+	name := strings.Trim(stateFileNameInvalid.ReplaceAllString(endpoint, "_"), "_.")
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + name + ext
+}
+
+// writeStateSnapshot は、適用後の HAProxy の状態を改めて読み取り、export と同じ設定ファイルの形式で書き出します（-output-state）。
+// 設定ファイルの内容ではなく実際の状態を書き出すため、次回の compare の -compare-file にそのまま使えます
+func writeStateSnapshot(client haproxyClient, endpoint, path string) error {
+	state, err := exportConfig(client, endpoint)
+	if err != nil {
+		return fmt.Errorf("適用後の状態の取得に失敗: %w", err)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("JSONへの変換に失敗: %w", err)
+	}
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("ファイル[%s]への書き出しに失敗: %w", path, err)
+	}
+	logf("インスタンス[%s]の適用後の状態を %s に書き出しました（サーバー %d 台）\n", endpoint, path, len(state.Backends))
+	return nil
+}
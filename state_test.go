@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+func TestOutputStatePath(t *testing.T) {
+	for _, tt := range []struct {
+		path, endpoint string
+		endpoints      int
+		want           string
+	}{
+		{"state.json", "http://haproxy1:9000", 1, "state.json"},
+		{"state.json", "http://haproxy1:9000", 2, "state.haproxy1_9000.json"},
+		{"out/state.json", "unix:///run/haproxy/admin.sock", 2, "out/state.run_haproxy_admin.sock.json"},
+		{"state", "https://lb.example.com:5555/", 3, "state.lb.example.com_5555"},
+	} {
+		if got := outputStatePath(tt.path, tt.endpoint, tt.endpoints); got != tt.want {
+			t.Errorf("outputStatePath(%q, %q, %d) = %q, want %q", tt.path, tt.endpoint, tt.endpoints, got, tt.want)
+		}
+	}
+}
+
+func TestWriteStateSnapshotReflectsLiveState(t *testing.T) {
+	captureOutput(t)
+	endpoint, fake := testMemoryEndpoint(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["`+endpoint+`"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 20, "group": "web"}
+		]
+	}`)
+	if _, err := applyConfig(fake, config, applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// 設定ファイルにないサーバーを直接追加し、スナップショットが設定ではなく実際の状態を表すことを確認します
+	if err := fake.AddServer(&haproxy.Server{Backend: "web", Name: "web-manual", IP: "10.0.0.9", Port: 8080, Weight: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := writeStateSnapshot(fake, endpoint, path); err != nil {
+		t.Fatalf("writeStateSnapshot がエラーを返しました: %v", err)
+	}
+	snapshot, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("書き出した状態を設定ファイルとして読み込めません: %v", err)
+	}
+
+	var got, want []string
+	for _, b := range snapshot.Backends {
+		got = append(got, fmt.Sprintf("%s %s:%d weight %d", serverKey(b.Group, b.Name), b.IP, b.Port, b.Weight))
+	}
+	servers, _ := fake.GetServers()
+	for _, s := range servers {
+		want = append(want, fmt.Sprintf("%s %s:%d weight %d", serverKey(s.Backend, s.Name), s.IP, s.Port, s.Weight))
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("書き出した状態 =\n%s\nwant 適用後の実際の状態\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(got) != 3 {
+		t.Errorf("書き出したサーバー数 = %d, want 3（直接追加したサーバーを含むこと）", len(got))
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// tagFilter は、-tag / -exclude-tag / -server-filter によるバックエンドの絞り込み条件です
+type tagFilter struct {
+	include []string       // いずれかのタグを持つバックエンドのみ適用する（空なら全て）
+	exclude []string       // いずれかのタグを持つバックエンドは適用しない
+	servers *regexp.Regexp // 名前が一致するサーバーのみ追加・更新・削除する（nil なら全て）
+}
+
+// compileServerFilter は、-server-filter の正規表現をコンパイルします（空の場合は nil を返し、絞り込みません）
+func compileServerFilter(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("-server-filter の正規表現[%s]が不正です: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// matches は、バックエンドが絞り込み条件を満たすかを返します。
+// include が空の場合、タグのないバックエンドも含めて全てが対象となり、exclude に一致したものだけが除かれます
+func (f tagFilter) matches(backend BackendConfig) bool {
+	if f.servers != nil && !f.servers.MatchString(backend.Name) {
+		return false
+	}
+	if len(f.include) > 0 && !hasAnyTag(backend, f.include) {
+		return false
+	}
+	return !hasAnyTag(backend, f.exclude)
+}
+
+// filter は、絞り込み条件を満たすバックエンドのみを返します
+func (f tagFilter) filter(backends []BackendConfig) []BackendConfig {
+	if len(f.include) == 0 && len(f.exclude) == 0 && f.servers == nil {
+		return backends
+	}
+	var filtered []BackendConfig
+	for _, b := range backends {
+		if f.matches(b) {
+			filtered = append(filtered, b)
+		}
+	}
+	return filtered
+}
+
+// hasAnyTag は、バックエンドが指定したタグのいずれかを持つかを返します
+func hasAnyTag(backend BackendConfig, tags []string) bool {
+	for _, t := range backend.Tags {
+		for _, want := range tags {
+			if t == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterRemovals は、削除対象のサーバーのうち -server-filter に名前が一致するものを返します。
+// 一致しないサーバーは設定ファイルに記載がなくても削除しません
+func (f tagFilter) filterRemovals(removals []haproxy.Server) []haproxy.Server {
+	if f.servers == nil {
+		return removals
+	}
+	var filtered []haproxy.Server
+	for _, s := range removals {
+		if f.servers.MatchString(s.Name) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
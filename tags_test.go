@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// tagTestBackends は、タグの有無が異なるバックエンドの一覧です
+var tagTestBackends = []BackendConfig{
+	{Name: "web-1", Tags: []string{"canary"}},
+	{Name: "web-2", Tags: []string{"stable"}},
+	{Name: "web-3"},
+	{Name: "web-4", Tags: []string{"canary", "legacy"}},
+}
+
+// backendNames は、バックエンド名の一覧を返します
+func backendNames(backends []BackendConfig) []string {
+	var names []string
+	for _, b := range backends {
+		names = append(names, b.Name)
+	}
+	return names
+}
+
+func TestTagFilter(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		filter tagFilter
+		want   []string
+	}{
+		{"指定なし", tagFilter{}, []string{"web-1", "web-2", "web-3", "web-4"}},
+		{"タグで絞り込み", tagFilter{include: []string{"canary"}}, []string{"web-1", "web-4"}},
+		{"タグで除外（タグなしは含む）", tagFilter{exclude: []string{"legacy"}}, []string{"web-1", "web-2", "web-3"}},
+		{"絞り込みと除外", tagFilter{include: []string{"canary", "stable"}, exclude: []string{"legacy"}}, []string{"web-1", "web-2"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backendNames(tt.filter.filter(tagTestBackends)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyConfigOnlyAppliesTaggedBackends(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://tags"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web", "tags": ["canary"]},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, config, applyOptions{tags: tagFilter{include: []string{"canary"}}}); err != nil {
+		t.Fatal(err)
+	}
+	servers, _ := fake.GetServers()
+	if len(servers) != 1 || servers[0].Name != "web-1" {
+		t.Errorf("適用後のサーバー = %+v, want canary の web-1 のみ", servers)
+	}
+}
+
+func TestServerFilterOnlyTouchesMatchingServers(t *testing.T) {
+	captureOutput(t)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://server-filter"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-old", "ip": "10.0.0.9", "port": 80, "weight": 10, "group": "web"},
+			{"name": "api-1", "ip": "10.0.1.1", "port": 80, "weight": 10, "group": "api"},
+			{"name": "api-old", "ip": "10.0.1.9", "port": 80, "weight": 10, "group": "api"}
+		]
+	}`), applyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://server-filter"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 20, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"},
+			{"name": "api-1", "ip": "10.0.1.1", "port": 80, "weight": 20, "group": "api"},
+			{"name": "api-2", "ip": "10.0.1.2", "port": 80, "weight": 10, "group": "api"}
+		]
+	}`)
+	filter, err := compileServerFilter("^web-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyConfig(fake, config, applyOptions{prune: true, force: true, tags: tagFilter{servers: filter}}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+
+	got := map[string]int64{}
+	servers, _ := fake.GetServers()
+	for _, s := range servers {
+		got[s.Name] = s.Weight
+	}
+	want := map[string]int64{"web-1": 20, "web-2": 10, "api-1": 10, "api-old": 10}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("適用後のサーバーと weight = %v, want %v（一致しないサーバーは追加・更新・削除しないこと）", got, want)
+	}
+}
+
+func TestCompileServerFilter(t *testing.T) {
+	if re, err := compileServerFilter(""); re != nil || err != nil {
+		t.Errorf("compileServerFilter(\"\") = %v, %v, want nil, nil（絞り込まないこと）", re, err)
+	}
+	if _, err := compileServerFilter("web-(1"); err == nil {
+		t.Error("不正な正規表現の -server-filter がエラーになりませんでした")
+	}
+}
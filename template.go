@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// srvNamePattern は DNS SRV レコード名（_service._proto.name）です
+var srvNamePattern = regexp.MustCompile(`^_[A-Za-z0-9-]+\._(tcp|udp)\.[A-Za-z0-9.-]+$`)
+
+// hasTemplates は、設定に server-template のバックエンドが含まれるかを返します
+func hasTemplates(config *Config) bool {
+	for _, b := range config.Backends {
+		if b.SRV != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// currentTemplates は、HAProxy上の server-template を取得します。
+// 設定に server-template がない場合はAPIを呼び出さずに nil を返します
+func currentTemplates(client haproxyClient, config *Config) (map[string]haproxy.ServerTemplate, error) {
+	if !hasTemplates(config) {
+		return nil, nil
+	}
+	current, err := client.GetServerTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("現在の server-template 一覧の取得に失敗: %w", err)
+	}
+	templates := make(map[string]haproxy.ServerTemplate, len(current))
+	for _, t := range current {
+		templates[serverKey(t.Backend, t.Prefix)] = t
+	}
+	return templates, nil
+}
+
+// buildServerTemplate は、SRV 形式のバックエンド設定から server-template の定義を組み立てます
+func buildServerTemplate(config *Config, backend BackendConfig) haproxy.ServerTemplate {
+	// 重みやヘルスチェックは通常のサーバーと同じ規則で決定する
+	server := buildServer(config, backend)
+	return haproxy.ServerTemplate{
+		Backend:    backend.Group,
+		Prefix:     backend.Name,
+		NumOrRange: fmt.Sprintf("%d", backend.Count),
+		Fqdn:       backend.SRV,
+		Resolvers:  backend.Resolver,
+		Weight:     server.Weight,
+		Check:      server.Check,
+		Inter:      server.Inter,
+		Fall:       server.Fall,
+		Rise:       server.Rise,
+	}
+}
+
+// reconcileTemplate は、server-template を現在の状態と比較して追加または更新します
+func reconcileTemplate(client haproxyClient, config *Config, state *liveState, backend BackendConfig) BackendResult {
+	template := buildServerTemplate(config, backend)
+	cur := state.template(template)
+	switch decideTemplate(state, template).action {
+	case actionAdd:
+		if err := client.AddServerTemplate(&template); err != nil {
+			reportError(errorCategoryServer, backend.Name, fmt.Sprintf("server-template%sの追加に失敗", backendLabel(backend)), err)
+			return newBackendResultFor(backend, StatusFailedAPI, err)
+		}
+		logf("server-template[%s]を正常に追加しました（%s × %s）\n", template.Prefix, template.Fqdn, template.NumOrRange)
+		emitTemplateChanges(changeStageApplied, actionAdd, nil, template)
+		return newBackendResultFor(backend, StatusAdded, nil)
+	case actionSkip:
+		logf("server-template[%s]は既に同じ内容で存在するためスキップしました\n", template.Prefix)
+		return newBackendResultFor(backend, StatusSkippedExists, nil)
+	default: // actionUpdate
+		if err := client.UpdateServerTemplate(&template); err != nil {
+			reportError(errorCategoryServer, backend.Name, fmt.Sprintf("server-template%sの更新に失敗", backendLabel(backend)), err)
+			return newBackendResultFor(backend, StatusFailedAPI, err)
+		}
+		logf("server-template[%s]を正常に更新しました\n", template.Prefix)
+		emitTemplateChanges(changeStageApplied, actionUpdate, cur, template)
+		return newBackendResultFor(backend, StatusUpdated, nil)
+	}
+}
+
+// desiredServerNames は、バックエンド設定から作成されるサーバー名の一覧を返します。
+// server-template の場合は HAProxy と同じく プレフィックス + 1〜count の連番になります
+func desiredServerNames(backend BackendConfig) []string {
+	if backend.SRV == "" {
+		return []string{backend.Name}
+	}
+	names := make([]string, 0, backend.Count)
+	for i := 1; i <= backend.Count; i++ {
+		names = append(names, fmt.Sprintf("%s%d", backend.Name, i))
+	}
+	return names
+}
+
+// validateTemplate は、SRV 形式のバックエンド設定を検証します
+func validateTemplate(backend BackendConfig) error {
+	if !srvNamePattern.MatchString(backend.SRV) {
+		return fmt.Errorf("srv[%s]は不正なSRVレコード名です（例: _http._tcp.api.service.consul）", backend.SRV)
+	}
+	if backend.Resolver == "" {
+		return errors.New("srv を指定する場合は resolver も指定してください")
+	}
+	if backend.Count < 1 {
+		return fmt.Errorf("count は 1 以上で指定してください（指定値: %d）", backend.Count)
+	}
+	if backend.IP != "" || backend.Port != 0 {
+		return errors.New("srv を指定する場合は ip / port は指定できません（SRVレコードから解決されます）")
+	}
+	if backend.Weight < 0 || backend.Weight > 256 {
+		return fmt.Errorf("weight は 0〜256 の範囲で指定してください（指定値: %d）", backend.Weight)
+	}
+	return nil
+}
+
+// serverTemplateLine は、server-template の定義を haproxy.cfg の server-template 行に変換します
+func serverTemplateLine(t haproxy.ServerTemplate) string {
+	line := fmt.Sprintf("server-template %s %s %s resolvers %s init-addr none weight %d", t.Prefix, t.NumOrRange, t.Fqdn, t.Resolvers, t.Weight)
+	if t.Check {
+		line += " check"
+		if t.Inter != "" {
+			line += " inter " + t.Inter
+		}
+		if t.Fall > 0 {
+			line += fmt.Sprintf(" fall %d", t.Fall)
+		}
+		if t.Rise > 0 {
+			line += fmt.Sprintf(" rise %d", t.Rise)
+		}
+	}
+	return line
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// templateTestConfig は、resolvers を参照する server-template のバックエンドを持つ設定です
+const templateTestConfig = `{
+	"haproxy_endpoint": ["memory://template"],
+	"load_balancing_algorithm": "roundrobin",
+	"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+	"resolvers": [{"name": "consul"}],
+	"backends": [{"name": "api", "srv": "_http._tcp.api.service.consul", "resolver": "consul", "count": 5, "weight": 10, "group": "api"}]
+}`
+
+func TestApplyCreatesServerTemplate(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, templateTestConfig)
+	_, fake := testMemoryEndpoint(t)
+	result, err := applyConfig(fake, config, applyOptions{})
+	if err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	if len(result.Backends) != 1 || result.Backends[0].Status != StatusAdded {
+		t.Errorf("適用結果 = %+v, want api が added", result.Backends)
+	}
+
+	templates, _ := fake.GetServerTemplates()
+	if len(templates) != 1 {
+		t.Fatalf("server-template の数 = %d, want 1", len(templates))
+	}
+	tmpl := templates[0]
+	if tmpl.Backend != "api" || tmpl.Prefix != "api" || tmpl.NumOrRange != "5" || tmpl.Fqdn != "_http._tcp.api.service.consul" ||
+		tmpl.Resolvers != "consul" || tmpl.Weight != 10 || !tmpl.Check || tmpl.Inter != "2s" {
+		t.Errorf("server-template = %+v, want 設定どおりの内容", tmpl)
+	}
+	if servers, _ := fake.GetServers(); len(servers) != 0 {
+		t.Errorf("固定のサーバー数 = %d, want 0（server-template のみ作成）", len(servers))
+	}
+	if got, want := serverTemplateLine(tmpl), "server-template api 5 _http._tcp.api.service.consul resolvers consul init-addr none weight 10 check inter 2s fall 3 rise 2"; got != want {
+		t.Errorf("serverTemplateLine() = %q, want %q", got, want)
+	}
+
+	// 同じ内容の再適用では変更しないこと
+	result, err = applyConfig(fake, config, applyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Backends[0].Status != StatusSkippedExists {
+		t.Errorf("再適用の結果 = %s, want %s", result.Backends[0].Status, StatusSkippedExists)
+	}
+}
+
+func TestServerTemplateRequiresDefinedResolver(t *testing.T) {
+	err := validateTestConfig(t, strings.Replace(templateTestConfig, `"resolvers": [{"name": "consul"}],`, `"resolvers": [],`, 1))
+	if err == nil || !strings.Contains(err.Error(), "resolvers[consul]") {
+		t.Errorf("Validate() = %v, want 未定義の resolvers[consul]のエラー", err)
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	valid := BackendConfig{Name: "api", SRV: "_http._tcp.api.service.consul", Resolver: "consul", Count: 3}
+	if err := validateTemplate(valid); err != nil {
+		t.Errorf("validateTemplate() = %v, want nil", err)
+	}
+	for name, modify := range map[string]func(*BackendConfig){
+		"不正なSRVレコード名":    func(b *BackendConfig) { b.SRV = "api.service.consul" },
+		"resolver の指定なし": func(b *BackendConfig) { b.Resolver = "" },
+		"count が 0":      func(b *BackendConfig) { b.Count = 0 },
+		"ip との併用":        func(b *BackendConfig) { b.IP = "10.0.0.1" },
+	} {
+		b := valid
+		modify(&b)
+		if err := validateTemplate(b); err == nil {
+			t.Errorf("%s: validateTemplate がエラーになりませんでした", name)
+		}
+	}
+}
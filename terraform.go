@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// terraformLabelInvalid は、Terraform のリソース名に使えない文字です
+var terraformLabelInvalid = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// hclAttr は、HCL のリソースブロックの1つの属性です（value は書式化済みの値）
+type hclAttr struct {
+	key   string
+	value string
+}
+
+// renderTerraform は、設定内容を HAProxy の Terraform プロバイダー（SepehrImanian/haproxy）の
+// haproxy_backend / haproxy_server リソースとして HCL 形式で返します（terraform サブコマンド）。
+// サーバーの項目は buildServer と同じ対応で変換します。server-template（srv）は対応するリソースがないためコメントのみ出力します
+func renderTerraform(config *Config) (string, error) {
+	groups, err := orderGroups(config)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("# haproxy-loadbalancer により生成\n")
+	for _, group := range groups {
+		name := group.name
+		if name == "" {
+			name = defaultBackendName
+		}
+		backendLabel := terraformLabel(name)
+		attrs := []hclAttr{{"name", hclString(name)}}
+		if g := findGroup(config, group.name); g != nil && g.Mode != "" {
+			attrs = append(attrs, hclAttr{"mode", hclString(g.Mode)})
+		}
+		writeHCLBlock(&b, "haproxy_backend", backendLabel, attrs, fmt.Sprintf("balance {\n    algorithm = %s\n  }", hclString(effectiveAlgorithm(config, group.name))))
+
+		for _, backend := range group.backends {
+			if backend.SRV != "" {
+				fmt.Fprintf(&b, "\n# サーバー[%s]は server-template（srv %s）のため出力していません\n", backend.Name, backend.SRV)
+				continue
+			}
+			server := buildServer(config, backend)
+			server.Backend = name
+			attrs := terraformServerAttrs(server)
+			attrs = append(attrs, hclAttr{"depends_on", fmt.Sprintf("[haproxy_backend.%s]", backendLabel)})
+			writeHCLBlock(&b, "haproxy_server", terraformLabel(name+"_"+server.Name), attrs, "")
+		}
+	}
+	return b.String(), nil
+}
+
+// terraformServerAttrs は、サーバー定義を haproxy_server リソースの属性に変換します
+func terraformServerAttrs(s haproxy.Server) []hclAttr {
+	attrs := []hclAttr{
+		{"name", hclString(s.Name)},
+		{"parent_name", hclString(s.Backend)},
+		{"parent_type", hclString("backend")},
+		{"address", hclString(s.IP)},
+	}
+	if s.Port > 0 {
+		attrs = append(attrs, hclAttr{"port", fmt.Sprint(s.Port)})
+	}
+	attrs = append(attrs, hclAttr{"weight", fmt.Sprint(s.Weight)})
+	if s.Maxconn > 0 {
+		attrs = append(attrs, hclAttr{"maxconn", fmt.Sprint(s.Maxconn)})
+	}
+	if s.Source != "" {
+		attrs = append(attrs, hclAttr{"source", hclString(s.Source)})
+	}
+	if s.SSL {
+		attrs = append(attrs, hclAttr{"ssl", hclString("enabled")})
+		for _, a := range []hclAttr{{"verify", s.Verify}, {"sni", s.Sni}, {"alpn", s.Alpn}, {"npn", s.Npn}, {"ssl_certificate", s.SSLCertificate}} {
+			if a.value != "" {
+				attrs = append(attrs, hclAttr{a.key, hclString(a.value)})
+			}
+		}
+	}
+	switch s.SendProxy {
+	case "v1":
+		attrs = append(attrs, hclAttr{"send_proxy", hclString("enabled")})
+	case "v2":
+		attrs = append(attrs, hclAttr{"send_proxy_v2", hclString("enabled")})
+		if s.ProxyV2Options != "" {
+			options := strings.Split(s.ProxyV2Options, ",")
+			for i, o := range options {
+				options[i] = hclString(o)
+			}
+			attrs = append(attrs, hclAttr{"proxy_v2_options", "[" + strings.Join(options, ", ") + "]"})
+		}
+	}
+	if s.Check {
+		attrs = append(attrs, hclAttr{"check", hclString("enabled")})
+		if s.Inter != "" {
+			attrs = append(attrs, hclAttr{"inter", hclString(s.Inter)})
+		}
+		if s.Downinter != "" {
+			attrs = append(attrs, hclAttr{"downinter", hclString(s.Downinter)})
+		}
+		if s.Fastinter != "" {
+			attrs = append(attrs, hclAttr{"fastinter", hclString(s.Fastinter)})
+		}
+		if s.Fall > 0 {
+			attrs = append(attrs, hclAttr{"fall", fmt.Sprint(s.Fall)})
+		}
+		if s.Rise > 0 {
+			attrs = append(attrs, hclAttr{"rise", fmt.Sprint(s.Rise)})
+		}
+	}
+	return attrs
+}
+
+// writeHCLBlock は、resource ブロックを "=" の位置を揃えて書き出します（nested は属性の後に続けるブロック）
+func writeHCLBlock(b *strings.Builder, resourceType, label string, attrs []hclAttr, nested string) {
+	width := 0
+	for _, a := range attrs {
+		if len(a.key) > width {
+			width = len(a.key)
+		}
+	}
+	fmt.Fprintf(b, "\nresource %q %q {\n", resourceType, label)
+	for _, a := range attrs {
+		fmt.Fprintf(b, "  %-*s = %s\n", width, a.key, a.value)
+	}
+	if nested != "" {
+		fmt.Fprintf(b, "\n  %s\n", nested)
+	}
+	b.WriteString("}\n")
+}
+
+// terraformLabel は、名前を Terraform のリソース名として使える形式（英数字とアンダースコア）に変換します
+func terraformLabel(name string) string {
+	label := terraformLabelInvalid.ReplaceAllString(name, "_")
+	if label == "" || (label[0] >= '0' && label[0] <= '9') {
+		label = "_" + label
+	}
+	return label
+}
+
+// hclString は、文字列を HCL の文字列リテラルにします（"${" は補間されないようエスケープします）
+func hclString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "${", "$${", "%{", "%%{")
+	return `"` + r.Replace(s) + `"`
+}
+
+// runTerraform は、設定内容を Terraform の HCL として標準出力に書き出します（terraform サブコマンド）
+func runTerraform(config *Config) {
+	out, err := renderTerraform(config)
+	if err != nil {
+		log.Fatalf("Terraform の設定の生成に失敗: %v", err)
+	}
+	fmt.Print(out)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// updateGolden を指定すると、golden ファイルを現在の出力で書き換えます（go test -run TestRenderTerraformGolden -update）
+var updateGolden = flag.Bool("update", false, "golden ファイルを現在の出力で更新する")
+
+func TestRenderTerraformGolden(t *testing.T) {
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://terraform"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+		"groups": [{"name": "api", "mode": "tcp"}],
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web", "maxconn": 100},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 20, "group": "web", "health_check": {"enabled": false}},
+			{"name": "api-1", "ip": "10.0.1.1", "port": 8443, "weight": 10, "group": "api",
+				"ssl": true, "verify": "required", "sni": "str(api.example.com)", "alpn": ["h2", "http/1.1"],
+				"send_proxy": "v2", "proxy_v2_options": ["authority", "crc32c"]}
+		]
+	}`)
+
+	got, err := renderTerraform(config)
+	if err != nil {
+		t.Fatalf("renderTerraform がエラーを返しました: %v", err)
+	}
+	path := filepath.Join("testdata", "terraform.golden.tf")
+	if *updateGolden {
+		if err := ioutil.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("golden ファイルの読み込みに失敗: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("renderTerraform の出力が %s と異なります（意図した変更なら -update で更新してください）\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+func TestTerraformLabelAndString(t *testing.T) {
+	for in, want := range map[string]string{"web-1": "web_1", "1st": "_1st", "api.v2": "api_v2"} {
+		if got := terraformLabel(in); got != want {
+			t.Errorf("terraformLabel(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got, want := hclString(`a"b${c}`), `"a\"b$${c}"`; got != want {
+		t.Errorf("hclString = %s, want %s（引用符をエスケープし、補間しないこと）", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+# haproxy-loadbalancer により生成
+
+resource "haproxy_backend" "api" {
+  name = "api"
+  mode = "tcp"
+
+  balance {
+    algorithm = "roundrobin"
+  }
+}
+
+resource "haproxy_server" "api_api_1" {
+  name             = "api-1"
+  parent_name      = "api"
+  parent_type      = "backend"
+  address          = "10.0.1.1"
+  port             = 8443
+  weight           = 10
+  ssl              = "enabled"
+  verify           = "required"
+  sni              = "str(api.example.com)"
+  alpn             = "h2,http/1.1"
+  send_proxy_v2    = "enabled"
+  proxy_v2_options = ["authority", "crc32c"]
+  check            = "enabled"
+  inter            = "2s"
+  fall             = 3
+  rise             = 2
+  depends_on       = [haproxy_backend.api]
+}
+
+resource "haproxy_backend" "web" {
+  name = "web"
+
+  balance {
+    algorithm = "roundrobin"
+  }
+}
+
+resource "haproxy_server" "web_web_1" {
+  name        = "web-1"
+  parent_name = "web"
+  parent_type = "backend"
+  address     = "10.0.0.1"
+  port        = 80
+  weight      = 10
+  maxconn     = 100
+  check       = "enabled"
+  inter       = "2s"
+  fall        = 3
+  rise        = 2
+  depends_on  = [haproxy_backend.web]
+}
+
+resource "haproxy_server" "web_web_2" {
+  name        = "web-2"
+  parent_name = "web"
+  parent_type = "backend"
+  address     = "10.0.0.2"
+  port        = 80
+  weight      = 20
+  depends_on  = [haproxy_backend.web]
+}
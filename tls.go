@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// protocolTokenPattern は ALPN/NPN のプロトコル名（h2, http/1.1 など）です
+var protocolTokenPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.\-/]*$`)
+
+// validateBackendTLS は、バックエンド側TLSの設定を検証します。
+// alpn / npn / verify / sni / ssl_client_cert はTLS接続でのみ意味を持つため、ssl が有効であることを要求します
+func validateBackendTLS(backend BackendConfig) error {
+	if !backend.SSL {
+		if len(backend.ALPN) > 0 || len(backend.NPN) > 0 || backend.Verify != "" || backend.SNI != "" || backend.SSLClientCert != "" || backend.SSLClientKey != "" {
+			return errors.New("alpn, npn, verify, sni, ssl_client_cert, ssl_client_key を指定する場合は ssl を有効にしてください")
+		}
+		return nil
+	}
+	if err := validateClientCert(backend); err != nil {
+		return err
+	}
+	for _, list := range []struct {
+		name   string
+		tokens []string
+	}{
+		{"alpn", backend.ALPN},
+		{"npn", backend.NPN},
+	} {
+		for _, token := range list.tokens {
+			if len(token) > 255 || !protocolTokenPattern.MatchString(token) {
+				return fmt.Errorf("%s のプロトコル名[%s]が不正です（例: h2, http/1.1）", list.name, token)
+			}
+		}
+	}
+	switch backend.Verify {
+	case "", "none", "required":
+	default:
+		return fmt.Errorf("verify には none または required を指定してください（指定値: %s）", backend.Verify)
+	}
+	if backend.SNI != "" && !sampleExprPattern.MatchString(backend.SNI) {
+		return fmt.Errorf("sni[%s]は不正なサンプル取得式です（例: str(api.example.com), req.hdr(host)）", backend.SNI)
+	}
+	return nil
+}
+
+// validateClientCert は、クライアント証明書（ssl_client_cert / ssl_client_key）のファイルが存在することを検証します。
+// HAProxy の crt は秘密鍵を証明書と同じファイルか、証明書のパスに .key を付けたファイルから読み込むため、
+// ssl_client_key はその名前であることを要求します
+func validateClientCert(backend BackendConfig) error {
+	if backend.SSLClientCert == "" {
+		if backend.SSLClientKey != "" {
+			return errors.New("ssl_client_key を指定する場合は ssl_client_cert も指定してください")
+		}
+		return nil
+	}
+	if err := checkRegularFile(backend.SSLClientCert); err != nil {
+		return fmt.Errorf("ssl_client_cert[%s]を確認できません: %w", backend.SSLClientCert, err)
+	}
+	if backend.SSLClientKey == "" {
+		return nil
+	}
+	if backend.SSLClientKey != backend.SSLClientCert+".key" {
+		return fmt.Errorf("ssl_client_key には %s.key を指定してください（HAProxy は証明書のパスに .key を付けたファイルを秘密鍵として読み込みます。指定値: %s）", backend.SSLClientCert, backend.SSLClientKey)
+	}
+	if err := checkRegularFile(backend.SSLClientKey); err != nil {
+		return fmt.Errorf("ssl_client_key[%s]を確認できません: %w", backend.SSLClientKey, err)
+	}
+	return nil
+}
+
+// checkRegularFile は、パスが通常のファイルとして存在するかを確認します
+func checkRegularFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return errors.New("ディレクトリです")
+	}
+	return nil
+}
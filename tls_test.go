@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildServerPropagatesTLSOptions(t *testing.T) {
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://tls"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "api-1", "ip": "10.0.0.1", "port": 443, "weight": 10, "group": "api",
+				"ssl": true, "alpn": ["h2", "http/1.1"], "npn": ["http/1.1"], "verify": "required", "sni": "str(api.example.com)"},
+			{"name": "api-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "api"}
+		]
+	}`)
+
+	s := buildServer(config, config.Backends[0])
+	if !s.SSL || s.Alpn != "h2,http/1.1" || s.Npn != "http/1.1" || s.Verify != "required" || s.Sni != "str(api.example.com)" {
+		t.Errorf("api-1 = ssl %v alpn %q npn %q verify %q sni %q, want 設定したTLSの項目", s.SSL, s.Alpn, s.Npn, s.Verify, s.Sni)
+	}
+	if plain := buildServer(config, config.Backends[1]); plain.SSL || plain.Alpn != "" {
+		t.Errorf("api-2 = ssl %v alpn %q, want TLSなし", plain.SSL, plain.Alpn)
+	}
+
+	// TLSの項目だけが異なるサーバーも更新の対象になること
+	changed := s
+	changed.Alpn = "h2"
+	if serverMatches(changed, s) {
+		t.Error("alpn の異なるサーバーが一致と判定されました")
+	}
+}
+
+func TestValidateBackendTLS(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		backend BackendConfig
+		valid   bool
+	}{
+		{"ssl と alpn", BackendConfig{SSL: true, ALPN: []string{"h2", "http/1.1"}, Verify: "none"}, true},
+		{"ssl なしの alpn", BackendConfig{ALPN: []string{"h2"}}, false},
+		{"ssl なしの sni", BackendConfig{SNI: "str(api.example.com)"}, false},
+		{"不正なプロトコル名", BackendConfig{SSL: true, ALPN: []string{"H2 "}}, false},
+		{"空のプロトコル名", BackendConfig{SSL: true, NPN: []string{""}}, false},
+		{"不正な verify", BackendConfig{SSL: true, Verify: "optional"}, false},
+		{"不正な sni", BackendConfig{SSL: true, SNI: "api example"}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBackendTLS(tt.backend)
+			if (err == nil) != tt.valid {
+				t.Errorf("validateBackendTLS() = %v, want 有効 %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestBuildServerPropagatesClientCert(t *testing.T) {
+	cert := writeTestFile(t, "client.pem", "証明書")
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://mtls"],
+		"load_balancing_algorithm": "roundrobin",
+		"backends": [
+			{"name": "api-1", "ip": "10.0.0.1", "port": 443, "weight": 10, "group": "api", "ssl": true, "ssl_client_cert": "`+cert+`"}
+		]
+	}`)
+	s := buildServer(config, config.Backends[0])
+	if s.SSLCertificate != cert {
+		t.Errorf("api-1 の crt = %q, want %q", s.SSLCertificate, cert)
+	}
+	if got := serverLine(s); !strings.Contains(got, " crt "+cert) {
+		t.Errorf("api-1 の server 行 = %q, want crt %s を含むこと", got, cert)
+	}
+	changed := s
+	changed.SSLCertificate = ""
+	if serverMatches(changed, s) {
+		t.Error("crt の異なるサーバーが一致と判定されました")
+	}
+}
+
+func TestValidateClientCert(t *testing.T) {
+	cert := writeTestFile(t, "client.pem", "証明書")
+	if err := ioutil.WriteFile(cert+".key", []byte("秘密鍵"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	withoutKey := writeTestFile(t, "other.pem", "証明書")
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	for _, tt := range []struct {
+		name    string
+		backend BackendConfig
+		valid   bool
+	}{
+		{"証明書のみ", BackendConfig{SSL: true, SSLClientCert: cert}, true},
+		{"証明書と秘密鍵", BackendConfig{SSL: true, SSLClientCert: cert, SSLClientKey: cert + ".key"}, true},
+		{"ssl なし", BackendConfig{SSLClientCert: cert}, false},
+		{"存在しない証明書", BackendConfig{SSL: true, SSLClientCert: missing}, false},
+		{"ディレクトリ", BackendConfig{SSL: true, SSLClientCert: filepath.Dir(cert)}, false},
+		{"秘密鍵のみ", BackendConfig{SSL: true, SSLClientKey: cert + ".key"}, false},
+		{"秘密鍵の名前が異なる", BackendConfig{SSL: true, SSLClientCert: cert, SSLClientKey: missing}, false},
+		{"存在しない秘密鍵", BackendConfig{SSL: true, SSLClientCert: withoutKey, SSLClientKey: withoutKey + ".key"}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBackendTLS(tt.backend)
+			if (err == nil) != tt.valid {
+				t.Errorf("validateBackendTLS() = %v, want 有効 %v", err, tt.valid)
+			}
+		})
+	}
+}
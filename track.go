@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// trackTarget は、track の指定（"backend/server"、同じグループのサーバーは "server" のみでも可）から
+// 追従するサーバーのグループとサーバー名を返します
+func trackTarget(backend BackendConfig) (group, name string) {
+	if i := strings.Index(backend.Track, "/"); i >= 0 {
+		return backend.Track[:i], backend.Track[i+1:]
+	}
+	return backend.Group, backend.Track
+}
+
+// validateTracks は、track が設定ファイルで定義されたサーバーを参照しているか、
+// また track を辿った先のサーバーでヘルスチェックが有効か（循環していないか）を確認します
+func (c *Config) validateTracks() error {
+	servers := map[string]BackendConfig{}
+	for _, b := range c.Backends {
+		if b.SRV == "" {
+			servers[serverKey(b.Group, b.Name)] = b
+		}
+	}
+	for _, b := range c.Backends {
+		if b.Track == "" {
+			continue
+		}
+		if b.SRV != "" {
+			return fmt.Errorf("サーバー[%s]: srv を指定したサーバーには track を指定できません", b.Name)
+		}
+		visited := map[string]bool{serverKey(b.Group, b.Name): true}
+		cur := b
+		for cur.Track != "" {
+			group, name := trackTarget(cur)
+			if group == "" || name == "" {
+				return fmt.Errorf("サーバー[%s]: track[%s]は \"backend/server\" の形式で指定してください", cur.Name, cur.Track)
+			}
+			key := serverKey(group, name)
+			next, ok := servers[key]
+			if !ok {
+				return fmt.Errorf("サーバー[%s]: track が参照するサーバー[%s]が設定ファイルにありません", cur.Name, key)
+			}
+			if visited[key] {
+				return fmt.Errorf("サーバー[%s]: track の参照が循環しています（%s）", b.Name, key)
+			}
+			visited[key] = true
+			cur = next
+		}
+		if !effectiveHealthCheck(c, applyServerDefaults(c, cur)).Enabled {
+			return fmt.Errorf("サーバー[%s]: track で追従するサーバー[%s]のヘルスチェックが無効です", b.Name, serverKey(cur.Group, cur.Name))
+		}
+	}
+	return nil
+}
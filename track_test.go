@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyServerTrack(t *testing.T) {
+	captureOutput(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["memory://track"],
+		"load_balancing_algorithm": "roundrobin",
+		"health_check": {"enabled": true, "interval": 2, "fall": 3, "rise": 2},
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web", "track": "web-1"},
+			{"name": "api-1", "ip": "10.0.0.1", "port": 8080, "weight": 10, "group": "api", "track": "web/web-1"}
+		]
+	}`)
+	_, fake := testMemoryEndpoint(t)
+	if _, err := applyConfig(fake, config, applyOptions{}); err != nil {
+		t.Fatalf("applyConfig がエラーを返しました: %v", err)
+	}
+	servers, _ := fake.GetServers()
+	got := map[string]string{}
+	for _, s := range servers {
+		got[s.Name] = s.Track
+		if s.Track != "" && s.Check {
+			t.Errorf("サーバー[%s]の check = true, want false（track で追従するサーバーは自身でチェックしないこと）", s.Name)
+		}
+	}
+	for name, want := range map[string]string{"web-1": "", "web-2": "web-1", "api-1": "web/web-1"} {
+		if got[name] != want {
+			t.Errorf("サーバー[%s]の track = %q, want %q", name, got[name], want)
+		}
+	}
+}
+
+func TestValidateTracks(t *testing.T) {
+	for _, tt := range []struct{ name, healthCheck, backends, want string }{
+		{"未定義のサーバー", `true`, `{"name": "web-1", "group": "web", "track": "web-9"}`, "サーバー[web/web-9]が設定ファイルにありません"},
+		{"別グループの未定義のサーバー", `true`, `{"name": "web-1", "group": "web"}, {"name": "api-1", "group": "api", "track": "api/web-1"}`, "サーバー[api/web-1]が設定ファイルにありません"},
+		{"循環", `true`, `{"name": "web-1", "group": "web", "track": "web-2"}, {"name": "web-2", "group": "web", "track": "web-1"}`, "循環"},
+		{"追従先のヘルスチェックが無効", `false`, `{"name": "web-1", "group": "web"}, {"name": "web-2", "group": "web", "track": "web-1"}`, "ヘルスチェックが無効"},
+		{"不正な形式", `true`, `{"name": "web-1", "group": "web"}, {"name": "web-2", "group": "web", "track": "/web-1"}`, "backend/server"},
+	} {
+		backends := strings.Replace(tt.backends, `"group"`, `"ip": "10.0.0.1", "port": 80, "weight": 10, "group"`, -1)
+		err := validateTestConfig(t, `{"haproxy_endpoint": ["memory://track"], "load_balancing_algorithm": "roundrobin",
+			"health_check": {"enabled": `+tt.healthCheck+`, "interval": 2, "fall": 3, "rise": 2}, "backends": [`+backends+`]}`)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s の検証のエラー = %v, want %s を含むエラー", tt.name, err, tt.want)
+		}
+	}
+}
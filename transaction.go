@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// errTransactionUnsupported は、トランザクションに対応していない接続先で -atomic を指定した場合のエラーです
+var errTransactionUnsupported = errors.New("-atomic は Data Plane API（または memory://）の接続先でのみ使用できます")
+
+// transactionalClient は、変更をトランザクションに積み、コミット時に1回だけ再読み込みできるクライアントです
+// （Data Plane API の dataPlaneClient と、メモリ上のインスタンス）
+type transactionalClient interface {
+	StartTransaction() (string, error)
+	CommitTransaction(id string) error
+	DeleteTransaction(id string) error
+	// InTransaction は、変更をトランザクション id に積むクライアントを返します
+	InTransaction(id string) (haproxyClient, error)
+}
+
+// applyAtomically は、トランザクション内で apply を実行し、最後に1回だけコミットします。
+// 変更ごとの再読み込みを避け、コミット時の1回の reload で全ての変更を反映します。
+// apply がエラーを返した場合や API 呼び出しに失敗したサーバーがある場合は、
+// トランザクションを破棄して何も反映しません
+func applyAtomically(client haproxyClient, apply func(client haproxyClient) (*Result, error)) (*Result, error) {
+	h, ok := client.(transactionalClient)
+	if !ok {
+		return &Result{}, errTransactionUnsupported
+	}
+	id, err := h.StartTransaction()
+	if err != nil {
+		return &Result{}, fmt.Errorf("トランザクションの開始に失敗: %w", err)
+	}
+
+	// 同じ接続先のトランザクションに結び付いたクライアントで、全ての変更をトランザクションに積みます
+	tx, err := h.InTransaction(id)
+	if err != nil {
+		if derr := h.DeleteTransaction(id); derr != nil {
+			log.Printf("トランザクション[%s]の破棄に失敗: %v", id, derr)
+		}
+		return &Result{}, fmt.Errorf("トランザクション[%s]のクライアントを作成できません: %w", id, err)
+	}
+	result, err := apply(tx)
+	if err == nil && hasFailedAPI(result) {
+		err = errors.New("API呼び出しに失敗したサーバーがあります")
+	}
+	if err != nil {
+		if derr := h.DeleteTransaction(id); derr != nil {
+			log.Printf("トランザクション[%s]の破棄に失敗: %v", id, derr)
+		}
+		return result, fmt.Errorf("トランザクション[%s]を破棄しました（変更は反映されていません）: %w", id, err)
+	}
+
+	if err := h.CommitTransaction(id); err != nil {
+		return result, fmt.Errorf("トランザクション[%s]のコミットに失敗: %w", id, err)
+	}
+	logf("トランザクション[%s]をコミットしました（再読み込みは1回のみ）\n", id)
+	return result, nil
+}
+
+// hasFailedAPI は、結果に API 呼び出しに失敗したサーバーが含まれるかを返します
+func hasFailedAPI(result *Result) bool {
+	if result == nil {
+		return false
+	}
+	for _, list := range [][]BackendResult{result.Backends, result.Removed} {
+		for _, b := range list {
+			if b.Status == StatusFailedAPI {
+				return true
+			}
+		}
+	}
+	return false
+}
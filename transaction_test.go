@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// atomicTestConfig は、memory:// に3台のサーバーとロードバランシングアルゴリズムを適用する設定を返します
+func atomicTestConfig(t *testing.T) (*Config, *haproxyfake.HAProxy) {
+	endpoint, client := testMemoryEndpoint(t)
+	config := loadTestConfig(t, `{
+		"haproxy_endpoint": ["`+endpoint+`"],
+		"load_balancing_algorithm": "leastconn",
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10, "group": "web"},
+			{"name": "web-3", "ip": "10.0.0.3", "port": 80, "weight": 10, "group": "web"}
+		]
+	}`)
+	return config, client
+}
+
+func TestAtomicApplyReloadsOnce(t *testing.T) {
+	captureOutput(t)
+	setFlag(t, "atomic", "true")
+	config, client := atomicTestConfig(t)
+
+	if err := applyOnce(context.Background(), config); err != nil {
+		t.Fatalf("applyOnce がエラーを返しました: %v", err)
+	}
+	if servers, _ := client.GetServers(); len(servers) != 3 {
+		t.Fatalf("適用後のサーバー数 = %d, want 3", len(servers))
+	}
+	if got := client.Reloads(); got != 1 {
+		t.Errorf("再読み込みの回数 = %d, want 1（コミット時の1回のみ）", got)
+	}
+}
+
+func TestNonAtomicApplyReloadsPerChange(t *testing.T) {
+	captureOutput(t)
+	config, client := atomicTestConfig(t)
+
+	if err := applyOnce(context.Background(), config); err != nil {
+		t.Fatalf("applyOnce がエラーを返しました: %v", err)
+	}
+	if got := client.Reloads(); got <= 1 {
+		t.Errorf("-atomic なしの再読み込みの回数 = %d, want 変更ごと（2回以上）", got)
+	}
+}
+
+func TestApplyAtomicallyDiscardsOnError(t *testing.T) {
+	captureOutput(t)
+	client := haproxyfake.New()
+	applyErr := errors.New("適用に失敗")
+
+	_, err := applyAtomically(client, func(tx haproxyClient) (*Result, error) {
+		if err := tx.AddServer(&haproxy.Server{Backend: "web", Name: "web-1"}); err != nil {
+			t.Fatal(err)
+		}
+		return &Result{}, applyErr
+	})
+	if !errors.Is(err, applyErr) {
+		t.Fatalf("applyAtomically のエラー = %v, want 適用処理のエラーを含むこと", err)
+	}
+	if servers, _ := client.GetServers(); len(servers) != 0 {
+		t.Errorf("破棄後のサーバー数 = %d, want 0（何も反映しないこと）", len(servers))
+	}
+	if got := client.Reloads(); got != 0 {
+		t.Errorf("破棄後の再読み込みの回数 = %d, want 0", got)
+	}
+}
+
+func TestDataPlaneClientInTransaction(t *testing.T) {
+	client := newDataPlaneClient("http://127.0.0.1:5555/v2", "secret", "")
+	tx, err := client.InTransaction("tx-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, ok := tx.(*dataPlaneClient)
+	if !ok {
+		t.Fatalf("InTransaction の型 = %T, want *dataPlaneClient", tx)
+	}
+	if d.HAProxy == client.HAProxy {
+		t.Error("InTransaction が元のクライアントを共有しています（新しいクライアントを作成すること）")
+	}
+	if d.Endpoint != client.Endpoint || d.ApiKey != client.ApiKey || d.TransactionID != "tx-1" {
+		t.Errorf("InTransaction のクライアント = %+v, want 同じ接続先でトランザクション tx-1", d.HAProxy)
+	}
+	if client.TransactionID != "" {
+		t.Errorf("元のクライアントのトランザクション ID = %q, want 空文字列（変更しないこと）", client.TransactionID)
+	}
+}
+
+func TestApplyAtomicallyRequiresDataPlaneAPI(t *testing.T) {
+	called := false
+	_, err := applyAtomically(newSocketClient(filepath.Join(t.TempDir(), "unused.sock")), func(haproxyClient) (*Result, error) {
+		called = true
+		return &Result{}, nil
+	})
+	if !errors.Is(err, errTransactionUnsupported) {
+		t.Errorf("applyAtomically のエラー = %v, want errTransactionUnsupported", err)
+	}
+	if called {
+		t.Error("トランザクションに対応していない接続先で適用処理を実行しました")
+	}
+}
+
+func TestHasFailedAPI(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		result *Result
+		want   bool
+	}{
+		{"結果なし", nil, false},
+		{"成功のみ", &Result{Backends: []BackendResult{newBackendResult("web-1", StatusAdded, nil)}}, false},
+		{"検証エラーのみ", &Result{Backends: []BackendResult{newBackendResult("web-1", StatusFailedValidation, errors.New("不正なIP"))}}, false},
+		{"削除の失敗", &Result{Removed: []BackendResult{newBackendResult("web-3", StatusFailedAPI, errors.New("500"))}}, true},
+	} {
+		if got := hasFailedAPI(tt.result); got != tt.want {
+			t.Errorf("%s: hasFailedAPI() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
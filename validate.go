@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// errPolicyViolation は、運用ポリシーで禁止された設定が使われた場合のエラーです
+var errPolicyViolation = errors.New("ポリシー違反")
+
+// Validate は、HAProxy APIを呼び出す前に設定内容を検証します
+func (c *Config) Validate() error {
+	if len(c.HaproxyEndpoint) == 0 {
+		return errors.New("haproxy_endpoint が指定されていません")
+	}
+	seen := map[string]bool{}
+	for _, e := range c.HaproxyEndpoint {
+		if seen[e] {
+			return fmt.Errorf("haproxy_endpoint[%s]が重複しています", e)
+		}
+		seen[e] = true
+	}
+	if err := validateAPIBasePath(c.APIBasePath, c.HaproxyEndpoint); err != nil {
+		return err
+	}
+	if err := c.validateMaxApplyDuration(); err != nil {
+		return err
+	}
+
+	// 禁止されたロードバランシングアルゴリズムが指定されていないか確認
+	if c.isAlgorithmDisabled(c.balanceAlgorithm()) {
+		return fmt.Errorf("%w: ロードバランシングアルゴリズム[%s]の使用は禁止されています", errPolicyViolation, c.balanceAlgorithm())
+	}
+
+	// バックエンドごとのアルゴリズムの確認
+	if err := c.validateAlgorithms(); err != nil {
+		return err
+	}
+
+	// バックエンドごとの retry_on / fullconn の確認
+	if err := c.validateBackendTunings(); err != nil {
+		return err
+	}
+
+	// track が参照するサーバーの確認
+	if err := c.validateTracks(); err != nil {
+		return err
+	}
+
+	// ヘルスチェック設定の確認（有効な場合は、バックエンドごとの上書きと defaults を反映した値も確認します）
+	if err := c.HealthCheck.validate(); err != nil {
+		return err
+	}
+	if err := c.HealthCheck.validateCounts(); err != nil {
+		return err
+	}
+	for _, b := range c.Backends {
+		if err := effectiveHealthCheck(c, applyServerDefaults(c, b)).validateCounts(); err != nil {
+			return fmt.Errorf("バックエンド[%s]: %w", b.Name, err)
+		}
+	}
+
+	// critical_features に指定された機能が存在するか確認
+	for id := range c.CriticalFeatures {
+		if findFeature(id) == nil {
+			return fmt.Errorf("critical_features の機能[%s]は存在しません", id)
+		}
+	}
+
+	// ヘッダー操作ルールの確認
+	for i, r := range c.HTTPRules {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("http_rules[%d]が不正です: %w", i, err)
+		}
+	}
+
+	// frontend 単位の設定の確認
+	frontends := map[string]bool{}
+	for i, f := range c.Frontends {
+		if err := f.validate(); err != nil {
+			return fmt.Errorf("frontends[%d]が不正です: %w", i, err)
+		}
+		if frontends[f.Name] {
+			return fmt.Errorf("frontends[%s]が重複しています", f.Name)
+		}
+		frontends[f.Name] = true
+	}
+
+	// resolvers の定義と、server-template が参照する resolvers が定義されているか確認
+	resolvers := map[string]bool{}
+	for i, r := range c.Resolvers {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("resolvers[%d]が不正です: %w", i, err)
+		}
+		if resolvers[r.Name] {
+			return fmt.Errorf("resolvers[%s]が重複しています", r.Name)
+		}
+		resolvers[r.Name] = true
+	}
+	// peers の定義と、グループの stick-table が参照する peers が定義されているか確認
+	peers := map[string]bool{}
+	for i, p := range c.Peers {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("peers[%d]が不正です: %w", i, err)
+		}
+		if peers[p.Name] {
+			return fmt.Errorf("peers[%s]が重複しています", p.Name)
+		}
+		peers[p.Name] = true
+	}
+	for _, g := range c.Groups {
+		if g.Stick != nil && g.Stick.Peers != "" && !peers[g.Stick.Peers] {
+			return fmt.Errorf("グループ[%s]の stick.peers が未定義の peers[%s]を参照しています", g.Name, g.Stick.Peers)
+		}
+	}
+	// mailers の定義と、グループの email_alert が参照する mailers が定義されているか確認
+	mailers := map[string]bool{}
+	for i, m := range c.Mailers {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("mailers[%d]が不正です: %w", i, err)
+		}
+		if mailers[m.Name] {
+			return fmt.Errorf("mailers[%s]が重複しています", m.Name)
+		}
+		mailers[m.Name] = true
+	}
+	for _, g := range c.Groups {
+		if g.EmailAlert != "" && !mailers[g.EmailAlert] {
+			return fmt.Errorf("グループ[%s]の email_alert が未定義の mailers[%s]を参照しています", g.Name, g.EmailAlert)
+		}
+	}
+	// cache の定義と、グループ・frontend の cache が参照する cache が定義されているか確認
+	caches := map[string]bool{}
+	for i, cache := range c.Caches {
+		if err := cache.validate(); err != nil {
+			return fmt.Errorf("caches[%d]が不正です: %w", i, err)
+		}
+		if caches[cache.Name] {
+			return fmt.Errorf("cache[%s]が重複しています", cache.Name)
+		}
+		caches[cache.Name] = true
+	}
+	for _, g := range c.Groups {
+		if g.Cache == "" {
+			continue
+		}
+		if !caches[g.Cache] {
+			return fmt.Errorf("グループ[%s]の cache が未定義の cache[%s]を参照しています", g.Name, g.Cache)
+		}
+		if g.Mode == "tcp" {
+			return fmt.Errorf("グループ[%s]: cache は mode http のバックエンドでのみ指定できます", g.Name)
+		}
+	}
+	for _, f := range c.Frontends {
+		if f.Cache != "" && !caches[f.Cache] {
+			return fmt.Errorf("frontend[%s]の cache が未定義の cache[%s]を参照しています", f.Name, f.Cache)
+		}
+	}
+	// サーバーの id はバックエンド（グループ）内で一意である必要があります
+	ids := map[string]string{}
+	for _, b := range c.Backends {
+		if b.ID == 0 {
+			continue
+		}
+		if b.SRV != "" {
+			return fmt.Errorf("バックエンド[%s]: id は srv と同時に指定できません", b.Name)
+		}
+		key := serverIDKey(b.Group, int64(b.ID))
+		if other, ok := ids[key]; ok {
+			return fmt.Errorf("バックエンド[%s]の id %d はバックエンド[%s]と重複しています", b.Name, b.ID, other)
+		}
+		ids[key] = b.Name
+	}
+	for _, b := range c.Backends {
+		if b.SRV != "" && b.Resolver != "" && !resolvers[b.Resolver] {
+			return fmt.Errorf("バックエンド[%s]が未定義の resolvers[%s]を参照しています", b.Name, b.Resolver)
+		}
+	}
+
+	// グループ単位の設定の確認
+	for _, g := range c.Groups {
+		if g.Stick != nil {
+			if err := g.Stick.validate(); err != nil {
+				return fmt.Errorf("グループ[%s]の stick 設定が不正です: %w", g.Name, err)
+			}
+		}
+		if g.Defaults != nil {
+			if err := g.Defaults.validate(); err != nil {
+				return fmt.Errorf("グループ[%s]の defaults 設定が不正です: %w", g.Name, err)
+			}
+		}
+		if g.Weight != nil {
+			if *g.Weight < 0 || *g.Weight > 256 {
+				return fmt.Errorf("グループ[%s]の weight は 0〜256 の範囲で指定してください（指定値: %d）", g.Name, *g.Weight)
+			}
+			if g.Defaults != nil && g.Defaults.Weight != nil {
+				return fmt.Errorf("グループ[%s]の weight と defaults の weight は同時に指定できません", g.Name)
+			}
+		}
+		if g.MinServers != nil && *g.MinServers < 0 {
+			return fmt.Errorf("グループ[%s]の min_servers は 0 以上で指定してください（指定値: %d）", g.Name, *g.MinServers)
+		}
+		if g.Mode != "" && !backendModes[g.Mode] {
+			return fmt.Errorf("グループ[%s]の mode[%s]は未対応です（tcp または http）", g.Name, g.Mode)
+		}
+	}
+
+	// 削除対象のグループが参照されていないか確認
+	if err := validateAbsentGroups(c); err != nil {
+		return err
+	}
+
+	// グループの依存関係（未定義のグループや循環依存がないか）を確認
+	groups, err := orderGroups(c)
+	if err != nil {
+		return err
+	}
+
+	// mode とヘルスチェックの種類の組み合わせ、tcp チェックの送受信内容を確認
+	for _, g := range groups {
+		if _, err := groupCheckType(c, g); err != nil {
+			return err
+		}
+		if _, err := groupTCPCheck(c, g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate は、ヘルスチェック設定の値を検証します
+func (h HealthCheckConfig) validate() error {
+	for _, v := range []struct {
+		name  string
+		value int
+	}{
+		{"interval", h.Interval},
+		{"fall", h.Fall},
+		{"rise", h.Rise},
+	} {
+		if v.value < 0 {
+			return fmt.Errorf("health_check.%s に負の値は指定できません（指定値: %d）", v.name, v.value)
+		}
+	}
+	if h.Type != "" && checkTypeOptions[h.Type] == "" {
+		return fmt.Errorf("health_check.type[%s]は未対応です（tcp または http）", h.Type)
+	}
+	if h.Address != "" && net.ParseIP(h.Address) == nil {
+		return fmt.Errorf("health_check.address[%s]は IP アドレスで指定してください（チェック先は1つのみ指定できます）", h.Address)
+	}
+	if h.Port < 0 || h.Port > 65535 {
+		return fmt.Errorf("health_check.port は 1〜65535 の範囲で指定してください（指定値: %d）", h.Port)
+	}
+	for _, d := range []struct{ name, value string }{
+		{"downinter", h.Downinter},
+		{"fastinter", h.Fastinter},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if _, err := haproxyDuration(d.value); err != nil {
+			return fmt.Errorf("health_check.%s が不正です: %w", d.name, err)
+		}
+	}
+	return nil
+}
+
+// validateCounts は、ヘルスチェックが有効な場合に interval, fall, rise が 1 以上であることを確認します。
+// 0 のままでは HAProxy に inter 0s や fall 0 を設定することになり、サーバーの状態を正しく判定できません
+func (h HealthCheckConfig) validateCounts() error {
+	if !h.Enabled {
+		return nil
+	}
+	for _, v := range []struct {
+		name, meaning string
+		value         int
+	}{
+		{"interval", "チェック間隔の秒数", h.Interval},
+		{"fall", "DOWN と判断するまでの連続失敗回数", h.Fall},
+		{"rise", "UP に戻すまでの連続成功回数", h.Rise},
+	} {
+		if v.value < 1 {
+			return fmt.Errorf("ヘルスチェックが有効な場合、health_check.%s（%s）は 1 以上で指定してください（指定値: %d）", v.name, v.meaning, v.value)
+		}
+	}
+	return nil
+}
+
+// haproxyDuration は、"500ms" や "2s" などの期間表記を検証し、HAProxyの時間表記（ミリ秒）に変換します
+func haproxyDuration(value string) (string, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return "", err
+	}
+	if d < time.Millisecond {
+		return "", fmt.Errorf("1ms 以上を指定してください（指定値: %s）", value)
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds()), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDisabledAlgorithmsRejectsForbiddenBalance(t *testing.T) {
+	for _, tt := range []struct {
+		name, config string
+		violation    bool
+	}{
+		{"全体のアルゴリズム", `{"haproxy_endpoint": ["memory://v"], "load_balancing_algorithm": "source", "disabled_algorithms": ["source"], "backends": []}`, true},
+		{"大文字小文字を区別しない", `{"haproxy_endpoint": ["memory://v"], "load_balancing_algorithm": "source", "disabled_algorithms": ["SOURCE"], "backends": []}`, true},
+		{"引数付きの指定をアルゴリズム名で禁止", `{"haproxy_endpoint": ["memory://v"], "load_balancing_algorithm": "url_param", "load_balancing_param": "sid", "disabled_algorithms": ["url_param"], "backends": []}`, true},
+		{"グループのアルゴリズム", `{"haproxy_endpoint": ["memory://v"], "load_balancing_algorithm": "roundrobin", "disabled_algorithms": ["leastconn"],
+			"backends": [{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, "group": "web", "algorithm": "leastconn"}]}`, true},
+		{"禁止されていないアルゴリズム", `{"haproxy_endpoint": ["memory://v"], "load_balancing_algorithm": "roundrobin", "disabled_algorithms": ["source"], "backends": []}`, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTestConfig(t, tt.config)
+			if got := errors.Is(err, errPolicyViolation); got != tt.violation {
+				t.Errorf("Validate() = %v, want ポリシー違反 %v", err, tt.violation)
+			}
+		})
+	}
+}
+
+func TestForbidAlgorithmFlagAddsToDisabledAlgorithms(t *testing.T) {
+	captureOutput(t)
+	path := writeTestFile(t, "config.json", `{"haproxy_endpoint": ["memory://v"], "load_balancing_algorithm": "source", "backends": []}`)
+	setFlag(t, "config", path)
+	setFlag(t, "forbid-algorithm", "first,source")
+	t.Cleanup(func() { forbidAlgorithmFlag = nil })
+
+	_, err := loadEffectiveConfig()
+	if !errors.Is(err, errPolicyViolation) {
+		t.Errorf("loadEffectiveConfig() = %v, want -forbid-algorithm によるポリシー違反", err)
+	}
+}
+
+func TestValidateHealthCheckCounts(t *testing.T) {
+	for _, tt := range []struct {
+		name, healthCheck, backend string
+		valid                      bool
+	}{
+		{"すべて 1", `{"enabled": true, "interval": 1, "fall": 1, "rise": 1}`, "", true},
+		{"interval が 0", `{"enabled": true, "interval": 0, "fall": 3, "rise": 2}`, "", false},
+		{"fall が 0", `{"enabled": true, "interval": 2, "fall": 0, "rise": 2}`, "", false},
+		{"rise が 0", `{"enabled": true, "interval": 2, "fall": 3, "rise": 0}`, "", false},
+		{"無効なら 0 を許可", `{"enabled": false, "interval": 0, "fall": 0, "rise": 0}`, "", true},
+		{"無効でも負の値は不可", `{"enabled": false, "interval": 2, "fall": -1, "rise": 2}`, "", false},
+		{"サーバーの上書きで fall が 0", `{"enabled": true, "interval": 2, "fall": 3, "rise": 2}`, `"health_check": {"fall": 0}`, false},
+		{"サーバーの上書きで有効にして interval が 0", `{"enabled": false, "interval": 0, "fall": 3, "rise": 2}`, `"health_check": {"enabled": true}`, false},
+		{"サーバーの上書きで無効", `{"enabled": true, "interval": 2, "fall": 3, "rise": 2}`, `"health_check": {"enabled": false, "rise": 0}`, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := `{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10}`
+			if tt.backend != "" {
+				backend = `{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10, ` + tt.backend + `}`
+			}
+			err := validateTestConfig(t, `{"haproxy_endpoint": ["memory://v"], "load_balancing_algorithm": "roundrobin", "health_check": `+tt.healthCheck+`, "backends": [`+backend+`]}`)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, want 正しい設定=%v", err, tt.valid)
+			}
+		})
+	}
+}
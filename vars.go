@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// varPattern は ${VAR} および ${VAR:-default} 形式の変数参照です
+var varPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandVars は、文字列中の変数参照を展開します。
+// 値は環境変数、設定ファイルの vars の順に探し、どちらにもなければ :- で指定した既定値を使います。
+// 既定値もない未定義の変数を参照した場合はエラーを返します
+func expandVars(s string, vars map[string]string, getenv func(string) string) (string, error) {
+	var undefined []string
+	expanded := varPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		m := varPattern.FindStringSubmatch(ref)
+		name, hasDefault, def := m[1], m[2] != "", m[3]
+		if v := getenv(name); v != "" {
+			return v
+		}
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		if hasDefault {
+			return def
+		}
+		undefined = append(undefined, name)
+		return ref
+	})
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("未定義の変数 %s を参照しています", strings.Join(undefined, ", "))
+	}
+	return expanded, nil
+}
+
+// substituteVars は、設定内の全ての文字列項目の変数参照を展開します（vars 自体は展開しません）。
+// 設定ファイルの読み込み後、検証の前に呼び出します
+func substituteVars(config *Config, getenv func(string) string) error {
+	vars := config.Vars
+	return walkStrings(reflect.ValueOf(config).Elem(), "", func(path string, v reflect.Value) error {
+		if path == "vars" || strings.HasPrefix(path, "vars.") {
+			return nil
+		}
+		expanded, err := expandVars(v.String(), vars, getenv)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetString(expanded)
+		return nil
+	})
+}
+
+// walkStrings は、構造体・ポインタ・スライスをたどり、書き換え可能な文字列ごとに fn を呼び出します。
+// path は "backends[0].ip" のような JSON 上の項目名です
+func walkStrings(v reflect.Value, path string, fn func(path string, v reflect.Value) error) error {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			return fn(path, v)
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return walkStrings(v.Elem(), path, fn)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkStrings(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			if err := walkStrings(v.Field(i), name, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// varsTestConfig は、vars と変数参照を含む設定です
+const varsTestConfig = `{
+	"haproxy_endpoint": ["http://${LB_HOST}:5555"],
+	"load_balancing_algorithm": "roundrobin",
+	"vars": {"DOMAIN": "svc.example.com", "LB_HOST": "lb-vars"},
+	"backends": [
+		{"name": "web-1", "ip": "web-1.${DOMAIN}", "port": 80, "weight": 10, "group": "${GROUP:-web}"},
+		{"name": "web-2", "ip": "web-2.${DOMAIN}", "port": 80, "weight": 10, "group": "${GROUP:-web}", "tags": ["${TAG:-}"]}
+	]
+}`
+
+// loadVarsTestConfig は、設定を読み込み、getenv の環境変数で変数参照を展開します
+func loadVarsTestConfig(t *testing.T, data string, env map[string]string) (*Config, error) {
+	t.Helper()
+	config, err := loadConfig(writeTestFile(t, "config.json", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config, substituteVars(config, func(key string) string { return env[key] })
+}
+
+func TestSubstituteVarsFromVarsAndDefaults(t *testing.T) {
+	config, err := loadVarsTestConfig(t, varsTestConfig, nil)
+	if err != nil {
+		t.Fatalf("substituteVars がエラーを返しました: %v", err)
+	}
+	b := config.Backends[1]
+	if b.IP != "web-2.svc.example.com" || b.Group != "web" || b.Tags[0] != "" {
+		t.Errorf("web-2 = ip %q group %q tags %q, want vars と既定値で展開", b.IP, b.Group, b.Tags)
+	}
+	if got := config.HaproxyEndpoint[0]; got != "http://lb-vars:5555" {
+		t.Errorf("haproxy_endpoint = %s, want http://lb-vars:5555", got)
+	}
+	if got := config.Vars["DOMAIN"]; got != "svc.example.com" {
+		t.Errorf("vars.DOMAIN = %q, want そのまま", got)
+	}
+}
+
+func TestSubstituteVarsPrefersEnv(t *testing.T) {
+	config, err := loadVarsTestConfig(t, varsTestConfig, map[string]string{"DOMAIN": "staging.example.com", "GROUP": "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := config.Backends[0]; b.IP != "web-1.staging.example.com" || b.Group != "api" {
+		t.Errorf("web-1 = ip %q group %q, want 環境変数の値で展開", b.IP, b.Group)
+	}
+}
+
+func TestSubstituteVarsRejectsUndefined(t *testing.T) {
+	_, err := loadVarsTestConfig(t, strings.Replace(varsTestConfig, "web-1.${DOMAIN}", "${WEB1_ADDR}", 1), nil)
+	if err == nil || !strings.Contains(err.Error(), "backends[0].ip") || !strings.Contains(err.Error(), "WEB1_ADDR") {
+		t.Errorf("substituteVars() = %v, want 項目名と変数名を含む未定義のエラー", err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+)
+
+// waitForAPI の再試行間隔（初回の待機時間と上限）です
+const (
+	apiWaitInitialDelay = time.Second
+	apiWaitMaxDelay     = 10 * time.Second
+)
+
+// waitForAPI は、Ping が成功するか timeout が経過するまで、間隔を広げながら Ping を繰り返します（-wait-for-api）。
+// 起動直後でまだ応答しない API を待つためのもので、認証エラーは待っても解消しないため直ちに失敗します
+func waitForAPI(client haproxyClient, endpoint string, timeout time.Duration, sleep func(time.Duration)) error {
+	attempts := 0
+	err := retry(context.Background(), retryPolicy{
+		initialDelay: apiWaitInitialDelay,
+		maxDelay:     apiWaitMaxDelay,
+		budget:       timeout,
+		retryable:    func(err error) bool { return !isAuthError(err) },
+		onRetry: func(attempt int, delay time.Duration, err error) {
+			logf("インスタンス[%s]: APIに接続できません（%d 回目）。%v 後に再試行します: %v\n", endpoint, attempt, delay, err)
+		},
+		sleep: func(_ context.Context, d time.Duration) error {
+			sleep(d)
+			return nil
+		},
+	}, func(attempt int) error {
+		attempts = attempt
+		return client.Ping()
+	})
+	switch {
+	case err == nil:
+		if attempts > 1 {
+			logf("インスタンス[%s]: %d 回目の試行でAPIに接続できました\n", endpoint, attempts)
+		}
+		return nil
+	case isAuthError(err):
+		return fmt.Errorf("認証に失敗したため待機を中止します: %w", err)
+	default:
+		return fmt.Errorf("%v 待ってもAPIに接続できませんでした（%d 回試行）: %w", timeout, attempts, err)
+	}
+}
+
+// isAuthError は、APIキーの誤りなど認証・認可に失敗したエラーかどうかを返します
+func isAuthError(err error) bool {
+	var apiErr *haproxy.APIError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haproxytech/client-go/v2/haproxy"
+	"github.com/limonene213u/lb_haproxy/haproxyfake"
+)
+
+// startingClient は、最初の failures 回の Ping が err で失敗するクライアントです（起動中の API を模します）
+type startingClient struct {
+	*haproxyfake.HAProxy
+	failures int
+	err      error
+	pings    int
+}
+
+func (c *startingClient) Ping() error {
+	c.pings++
+	if c.pings <= c.failures {
+		return c.err
+	}
+	return nil
+}
+
+func TestWaitForAPISucceedsAfterFailures(t *testing.T) {
+	logs, _ := captureOutput(t)
+	client := &startingClient{HAProxy: haproxyfake.New(), failures: 3, err: errors.New("connection refused")}
+	var delays []time.Duration
+	if err := waitForAPI(client, "memory://wait", time.Minute, func(d time.Duration) { delays = append(delays, d) }); err != nil {
+		t.Fatalf("waitForAPI がエラーを返しました: %v", err)
+	}
+	if client.pings != 4 {
+		t.Errorf("Ping の回数 = %d, want 4（3回失敗した後に成功）", client.pings)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	if len(delays) != len(want) {
+		t.Fatalf("待機時間 = %v, want %v", delays, want)
+	}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Errorf("%d 回目の待機時間 = %v, want %v（間隔を広げること）", i+1, delays[i], want[i])
+		}
+	}
+	if n := strings.Count(logs.String(), "APIに接続できません"); n != 3 {
+		t.Errorf("再試行のログの件数 = %d, want 3（試行ごとに出力）", n)
+	}
+	if !strings.Contains(logs.String(), "4 回目の試行でAPIに接続できました") {
+		t.Errorf("接続できたことがログに出力されていません:\n%s", logs)
+	}
+}
+
+func TestWaitForAPIFailsFastOnAuthError(t *testing.T) {
+	captureOutput(t)
+	client := &startingClient{HAProxy: haproxyfake.New(), failures: 10, err: &haproxy.APIError{StatusCode: http.StatusUnauthorized, Message: "unauthorized"}}
+	err := waitForAPI(client, "memory://wait", time.Minute, func(time.Duration) { t.Error("認証エラーで待機しました") })
+	if err == nil || !strings.Contains(err.Error(), "認証に失敗") {
+		t.Errorf("waitForAPI のエラー = %v, want 認証の失敗", err)
+	}
+	if client.pings != 1 {
+		t.Errorf("Ping の回数 = %d, want 1（認証エラーは再試行しないこと）", client.pings)
+	}
+}
+
+func TestWaitForAPITimesOut(t *testing.T) {
+	captureOutput(t)
+	client := &startingClient{HAProxy: haproxyfake.New(), failures: 100, err: errors.New("connection refused")}
+	err := waitForAPI(client, "memory://wait", 20*time.Millisecond, time.Sleep)
+	if err == nil || !strings.Contains(err.Error(), "待ってもAPIに接続できませんでした") {
+		t.Errorf("waitForAPI のエラー = %v, want タイムアウト", err)
+	}
+	if client.pings != 2 {
+		t.Errorf("Ping の回数 = %d, want 2（待機時間は残りの時間までに短縮すること）", client.pings)
+	}
+}
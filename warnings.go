@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// warningSink は、実行中に出力された警告を集めます（-fail-on-warnings の判定に使用）
+type warningSink struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+// warnings は、このプロセスで出力された警告の集計先です
+var warnings = &warningSink{}
+
+// warnf は、警告を出力し、集計先に記録します。警告はすべてこの関数（または warnWithFields）から出力してください
+func warnf(format string, args ...interface{}) {
+	warnWithFields(nil, format, args...)
+}
+
+// warnWithFields は、warnf と同様に警告を出力します。-log-format json の場合は fields をイベントの項目に含め、
+// 呼び出し側が警告の内容をメッセージを解析せずに扱えるようにします
+func warnWithFields(fields map[string]interface{}, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	warnings.mu.Lock()
+	warnings.messages = append(warnings.messages, msg)
+	warnings.mu.Unlock()
+	if jsonLogEnabled && len(fields) > 0 {
+		logEvent("warn", msg, fields)
+		return
+	}
+	log.Printf("警告: %s", msg)
+}
+
+// count は、記録された警告の数を返します
+func (w *warningSink) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.messages)
+}
+
+// failOnWarnings は、-fail-on-warnings が指定され警告が1件以上ある場合、終了コード 1 で終了します。
+// 警告自体は出力済みのため、件数をまとめて報告します
+func failOnWarnings() {
+	if !*failOnWarningsFlag {
+		return
+	}
+	if n := warnings.count(); n > 0 {
+		log.Printf("-fail-on-warnings が指定されているため、%d 件の警告により失敗として終了します", n)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// failOnWarningsHelperEnv が設定されている場合、TestFailOnWarningsHelper は警告を出力して failOnWarnings を呼び出します
+// （os.Exit を伴うため、別プロセスとして実行します）
+const failOnWarningsHelperEnv = "LB_HAPROXY_FAIL_ON_WARNINGS_HELPER"
+
+func TestFailOnWarningsHelper(t *testing.T) {
+	mode := os.Getenv(failOnWarningsHelperEnv)
+	if mode == "" {
+		t.Skip("TestFailOnWarningsExitStatus から実行される補助プロセスです")
+	}
+	captureOutput(t)
+	if mode == "strict" {
+		*failOnWarningsFlag = true
+	}
+	warnf("サーバー[web-1]と[web-2]のアドレスが重複しています")
+	failOnWarnings()
+}
+
+func TestFailOnWarningsExitStatus(t *testing.T) {
+	for mode, wantFailure := range map[string]bool{"default": false, "strict": true} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestFailOnWarningsHelper$")
+		cmd.Env = append(os.Environ(), failOnWarningsHelperEnv+"="+mode)
+		err := cmd.Run()
+		if _, exited := err.(*exec.ExitError); err != nil && !exited {
+			t.Fatalf("補助プロセスを実行できません: %v", err)
+		}
+		if failed := err != nil; failed != wantFailure {
+			t.Errorf("%s: 警告がある場合の終了 = %v, want 失敗 %v（-fail-on-warnings の指定時のみ失敗）", mode, err, wantFailure)
+		}
+	}
+}
+
+func TestWarnfCountsWarnings(t *testing.T) {
+	_, errs := captureOutput(t)
+	warnf("1件目")
+	warnWithFields(map[string]interface{}{"server": "web-1"}, "2件目")
+	if got := warnings.count(); got != 2 {
+		t.Errorf("warnings.count() = %d, want 2", got)
+	}
+	if got := errs.String(); got != "警告: 1件目\n警告: 2件目\n" {
+		t.Errorf("警告の出力 = %q, want テキスト形式の2行", got)
+	}
+}
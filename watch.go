@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchRunner は、設定ファイルの変更の通知を受けて、変更が落ち着いてから適用します（apply -watch）。
+// エディタは1回の保存で書き込み・名前の変更などの複数のイベントを発生させるため、
+// 最後のイベントから debounce の間に次のイベントがなければ1回だけ適用します
+type watchRunner struct {
+	debounce time.Duration
+	events   <-chan struct{} // 設定ファイルの変更の通知（閉じると終了します）
+	// reconcile は、読み込みと適用（変更がなければスキップ）を -repeat と同じ手順で行います
+	reconcile *repeatRunner
+
+	// after は待機に使う関数です（テストで時刻を差し替えるため。nil の場合は time.After）
+	after func(time.Duration) <-chan time.Time
+}
+
+// run は、ctx がキャンセルされるか通知が閉じられるまで、変更のたびに適用します。最初の適用は即座に行います。
+// 変更が続いている間は待機をやり直し、debounce の間イベントがなくなった時点で適用します
+func (w *watchRunner) run(ctx context.Context) {
+	after := w.after
+	if after == nil {
+		after = time.After
+	}
+	w.reconcile.cycle(ctx)
+	var quiet <-chan time.Time // 最後の変更から debounce 経過の通知（変更を待っている間は nil）
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-w.events:
+			if !ok {
+				return
+			}
+			quiet = after(w.debounce)
+		case <-quiet:
+			quiet = nil
+			w.reconcile.cycle(ctx)
+		}
+	}
+}
+
+// watchConfigEvents は、設定ファイル（ディレクトリの場合は中のすべてのファイル）の変更を通知するチャネルを返します。
+// エディタや ConfigMap の更新はファイルを置き換えるため、ファイル自体ではなく親ディレクトリを監視し、ファイル名で絞り込みます。
+// 属性の変更のみのイベントは通知しません。ctx がキャンセルされると監視を終了し、チャネルを閉じます
+func watchConfigEvents(ctx context.Context, path string) (<-chan struct{}, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, name := filepath.Dir(path), filepath.Base(path)
+	if info.IsDir() {
+		dir, name = path, ""
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	events := make(chan struct{})
+	go func() {
+		defer close(events)
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if ev.Op == fsnotify.Chmod || (name != "" && filepath.Base(ev.Name) != name) {
+					continue
+				}
+				select {
+				case events <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("設定ファイルの監視でエラーが発生しました: %v", err)
+			}
+		}
+	}()
+	return events, nil
+}
+
+// errWatchSource は、-watch でローカルのファイル・ディレクトリ以外の読み込み元を指定した場合のエラーです
+var errWatchSource = errors.New("-watch はローカルの設定ファイルまたはディレクトリにのみ指定できます")
+
+// runWatch は、SIGINT / SIGTERM を受け取るまで、設定ファイルの変更のたびに適用します（apply -watch）
+func runWatch(debounce time.Duration) error {
+	source, ok := newConfigSource(*configFlag).(*fileSource)
+	if !ok {
+		return errWatchSource
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		logf("シグナル[%s]を受け取ったため終了します\n", s)
+		cancel()
+	}()
+
+	events, err := watchConfigEvents(ctx, source.path)
+	if err != nil {
+		return err
+	}
+	logf("%s の変更を監視し、変更が %s 落ち着いてから適用します\n", source.path, debounce)
+	w := &watchRunner{
+		debounce:  debounce,
+		events:    events,
+		reconcile: &repeatRunner{load: loadEffectiveConfig, apply: applyOnce},
+	}
+	w.run(ctx)
+	return nil
+}
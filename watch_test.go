@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchRunnerCoalescesBurstOfEvents(t *testing.T) {
+	captureOutput(t)
+	loads := 0
+	applied := make(chan string, 10)
+	clock := newFakeClock()
+	events := make(chan struct{})
+	w := &watchRunner{
+		debounce: 500 * time.Millisecond,
+		events:   events,
+		reconcile: &repeatRunner{
+			// 読み込むたびに内容を変え、変更なしとしてスキップされないようにします
+			load: func() (*Config, error) {
+				loads++
+				return &Config{LoadBalancingAlgorithm: fmt.Sprintf("config-%d", loads)}, nil
+			},
+			apply: func(_ context.Context, c *Config) error {
+				applied <- c.LoadBalancingAlgorithm
+				return nil
+			},
+		},
+		after: clock.after,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.run(context.Background())
+		close(done)
+	}()
+	if got := <-applied; got != "config-1" {
+		t.Fatalf("起動時の適用 = %s, want config-1", got)
+	}
+	// 1回の保存で発生する複数のイベントを模して、待機中に続けて通知します（そのたびに待機をやり直すこと）
+	for burst, n := range []int{5, 3} {
+		for i := 0; i < n; i++ {
+			events <- struct{}{}
+			if d := <-clock.waiting; d != 500*time.Millisecond {
+				t.Fatalf("待機の時間 = %v, want 500ms", d)
+			}
+		}
+		select {
+		case got := <-applied:
+			t.Fatalf("%d 回目の変更: 変更が落ち着く前に適用しました（%s）", burst+1, got)
+		default:
+		}
+		clock.ticks <- time.Now()
+		if got, want := <-applied, fmt.Sprintf("config-%d", burst+2); got != want {
+			t.Errorf("%d 回目の変更後の適用 = %s, want %s", burst+1, got, want)
+		}
+	}
+	close(events)
+	<-done
+
+	if loads != 3 || len(applied) != 0 {
+		t.Errorf("読み込み = %d 回, 残りの適用 = %d 回, want 3 回, 0 回（起動時と、変更が落ち着くたびに1回ずつ）", loads, len(applied))
+	}
+}
+
+func TestWatchConfigEventsFiltersOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := watchConfigEvents(ctx, path)
+	if err != nil {
+		t.Fatalf("watchConfigEvents がエラーを返しました: %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-events:
+		t.Fatal("同じディレクトリの別のファイルの変更を通知しました")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// エディタの保存を模して、一時ファイルに書いてから置き換えます
+	tmp := filepath.Join(dir, ".config.json.swp")
+	if err := ioutil.WriteFile(tmp, []byte(`{"backends": []}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("設定ファイルの置き換えが通知されませんでした")
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestRunWatchRejectsRemoteSource(t *testing.T) {
+	setFlag(t, "config", "env://LB_HAPROXY_CONFIG")
+	if err := runWatch(time.Second); !errors.Is(err, errWatchSource) {
+		t.Errorf("runWatch のエラー = %v, want errWatchSource", err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// loadWeightsFile は、サーバー名と weight の対応を保持したJSONファイル（{"web1": 10, ...}）を読み込みます
+func loadWeightsFile(filename string) (map[string]int, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var weights map[string]int
+	if err := json.Unmarshal(data, &weights); err != nil {
+		return nil, fmt.Errorf("JSONの解析に失敗: %w", err)
+	}
+	return weights, nil
+}
+
+// applyWeightsFile は、weights_file の weight を設定ファイルのバックエンドの weight に上書きします。
+// ファイルに記載のないサーバーは設定ファイルの weight のままです。
+// オートスケーラーがまだファイルを書き出していない場合に備え、ファイルが存在しなければ警告のみとします
+func applyWeightsFile(config *Config) error {
+	if config.WeightsFile == "" {
+		return nil
+	}
+	weights, err := loadWeightsFile(config.WeightsFile)
+	if os.IsNotExist(err) {
+		warnf("weights_file[%s]が存在しないため、設定ファイルの weight を使用します", config.WeightsFile)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("weights_file[%s]の読み込みに失敗: %w", config.WeightsFile, err)
+	}
+	for i, b := range config.Backends {
+		if w, ok := weights[b.Name]; ok {
+			config.Backends[i].Weight = w
+		}
+	}
+	return nil
+}
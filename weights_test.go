@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// loadWeightsTestConfig は、weights_file を参照する設定を -config に指定して loadEffectiveConfig で読み込みます
+func loadWeightsTestConfig(t *testing.T, weightsFile string) *Config {
+	t.Helper()
+	file, _ := json.Marshal(weightsFile)
+	path := writeTestFile(t, "config.json", `{
+		"haproxy_endpoint": ["memory://weights"],
+		"load_balancing_algorithm": "roundrobin",
+		"weights_file": `+string(file)+`,
+		"backends": [
+			{"name": "web-1", "ip": "10.0.0.1", "port": 80, "weight": 10},
+			{"name": "web-2", "ip": "10.0.0.2", "port": 80, "weight": 10}
+		]
+	}`)
+	setFlag(t, "config", path)
+	config, err := loadEffectiveConfig()
+	if err != nil {
+		t.Fatalf("loadEffectiveConfig がエラーを返しました: %v", err)
+	}
+	return config
+}
+
+func TestWeightsFileOverridesConfigWeights(t *testing.T) {
+	captureOutput(t)
+	config := loadWeightsTestConfig(t, writeTestFile(t, "weights.json", `{"web-1": 40, "web-9": 5}`))
+	if w1, w2 := config.Backends[0].Weight, config.Backends[1].Weight; w1 != 40 || w2 != 10 {
+		t.Errorf("weight = %d, %d, want 40, 10（ファイルに記載のないサーバーは設定ファイルの値）", w1, w2)
+	}
+}
+
+func TestMissingWeightsFileOnlyWarns(t *testing.T) {
+	_, errs := captureOutput(t)
+	config := loadWeightsTestConfig(t, writeTestFile(t, "placeholder", "")+".missing")
+	if w := config.Backends[0].Weight; w != 10 {
+		t.Errorf("weight = %d, want 10", w)
+	}
+	if !strings.Contains(errs.String(), "存在しないため、設定ファイルの weight を使用します") {
+		t.Errorf("警告が出力されていません: %q", errs.String())
+	}
+}
+
+func TestInvalidWeightsFileIsAnError(t *testing.T) {
+	captureOutput(t)
+	config := &Config{WeightsFile: writeTestFile(t, "weights.json", `{"web-1": "heavy"}`)}
+	if err := applyWeightsFile(config); err == nil {
+		t.Error("不正な weights_file がエラーになりませんでした")
+	}
+}